@@ -0,0 +1,406 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: bssci/stream.proto
+
+package bssci
+
+import (
+	bs "github.com/SplitStackServer/splitstack/api/go/v5/bs"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SubscriberMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Message:
+	//
+	//	*SubscriberMessage_Subscribe
+	//	*SubscriberMessage_Command
+	//	*SubscriberMessage_Response
+	Message       isSubscriberMessage_Message `protobuf_oneof:"message"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscriberMessage) Reset() {
+	*x = SubscriberMessage{}
+	mi := &file_bssci_stream_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscriberMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscriberMessage) ProtoMessage() {}
+
+func (x *SubscriberMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_bssci_stream_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscriberMessage.ProtoReflect.Descriptor instead.
+func (*SubscriberMessage) Descriptor() ([]byte, []int) {
+	return file_bssci_stream_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SubscriberMessage) GetMessage() isSubscriberMessage_Message {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+func (x *SubscriberMessage) GetSubscribe() *Subscribe {
+	if x != nil {
+		if x, ok := x.Message.(*SubscriberMessage_Subscribe); ok {
+			return x.Subscribe
+		}
+	}
+	return nil
+}
+
+func (x *SubscriberMessage) GetCommand() *bs.ServerCommand {
+	if x != nil {
+		if x, ok := x.Message.(*SubscriberMessage_Command); ok {
+			return x.Command
+		}
+	}
+	return nil
+}
+
+func (x *SubscriberMessage) GetResponse() *bs.ServerResponse {
+	if x != nil {
+		if x, ok := x.Message.(*SubscriberMessage_Response); ok {
+			return x.Response
+		}
+	}
+	return nil
+}
+
+type isSubscriberMessage_Message interface {
+	isSubscriberMessage_Message()
+}
+
+type SubscriberMessage_Subscribe struct {
+	Subscribe *Subscribe `protobuf:"bytes,1,opt,name=subscribe,proto3,oneof"`
+}
+
+type SubscriberMessage_Command struct {
+	Command *bs.ServerCommand `protobuf:"bytes,2,opt,name=command,proto3,oneof"`
+}
+
+type SubscriberMessage_Response struct {
+	Response *bs.ServerResponse `protobuf:"bytes,3,opt,name=response,proto3,oneof"`
+}
+
+func (*SubscriberMessage_Subscribe) isSubscriberMessage_Message() {}
+
+func (*SubscriberMessage_Command) isSubscriberMessage_Message() {}
+
+func (*SubscriberMessage_Response) isSubscriberMessage_Message() {}
+
+type Subscribe struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	BsEuis        []string               `protobuf:"bytes,1,rep,name=bs_euis,json=bsEuis,proto3" json:"bs_euis,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Subscribe) Reset() {
+	*x = Subscribe{}
+	mi := &file_bssci_stream_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Subscribe) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Subscribe) ProtoMessage() {}
+
+func (x *Subscribe) ProtoReflect() protoreflect.Message {
+	mi := &file_bssci_stream_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Subscribe.ProtoReflect.Descriptor instead.
+func (*Subscribe) Descriptor() ([]byte, []int) {
+	return file_bssci_stream_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Subscribe) GetBsEuis() []string {
+	if x != nil {
+		return x.BsEuis
+	}
+	return nil
+}
+
+type AdapterMessage struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	BsEui       string                 `protobuf:"bytes,1,opt,name=bs_eui,json=bsEui,proto3" json:"bs_eui,omitempty"`
+	EventSource string                 `protobuf:"bytes,2,opt,name=event_source,json=eventSource,proto3" json:"event_source,omitempty"`
+	EventType   string                 `protobuf:"bytes,3,opt,name=event_type,json=eventType,proto3" json:"event_type,omitempty"`
+	// Types that are valid to be assigned to Message:
+	//
+	//	*AdapterMessage_EndnodeUplink
+	//	*AdapterMessage_BasestationUplink
+	//	*AdapterMessage_State
+	//	*AdapterMessage_AdapterEvent
+	Message       isAdapterMessage_Message `protobuf_oneof:"message"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AdapterMessage) Reset() {
+	*x = AdapterMessage{}
+	mi := &file_bssci_stream_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AdapterMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AdapterMessage) ProtoMessage() {}
+
+func (x *AdapterMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_bssci_stream_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AdapterMessage.ProtoReflect.Descriptor instead.
+func (*AdapterMessage) Descriptor() ([]byte, []int) {
+	return file_bssci_stream_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *AdapterMessage) GetBsEui() string {
+	if x != nil {
+		return x.BsEui
+	}
+	return ""
+}
+
+func (x *AdapterMessage) GetEventSource() string {
+	if x != nil {
+		return x.EventSource
+	}
+	return ""
+}
+
+func (x *AdapterMessage) GetEventType() string {
+	if x != nil {
+		return x.EventType
+	}
+	return ""
+}
+
+func (x *AdapterMessage) GetMessage() isAdapterMessage_Message {
+	if x != nil {
+		return x.Message
+	}
+	return nil
+}
+
+func (x *AdapterMessage) GetEndnodeUplink() *bs.EndnodeUplink {
+	if x != nil {
+		if x, ok := x.Message.(*AdapterMessage_EndnodeUplink); ok {
+			return x.EndnodeUplink
+		}
+	}
+	return nil
+}
+
+func (x *AdapterMessage) GetBasestationUplink() *bs.BasestationUplink {
+	if x != nil {
+		if x, ok := x.Message.(*AdapterMessage_BasestationUplink); ok {
+			return x.BasestationUplink
+		}
+	}
+	return nil
+}
+
+func (x *AdapterMessage) GetState() *bs.BasestationState {
+	if x != nil {
+		if x, ok := x.Message.(*AdapterMessage_State); ok {
+			return x.State
+		}
+	}
+	return nil
+}
+
+func (x *AdapterMessage) GetAdapterEvent() *structpb.Struct {
+	if x != nil {
+		if x, ok := x.Message.(*AdapterMessage_AdapterEvent); ok {
+			return x.AdapterEvent
+		}
+	}
+	return nil
+}
+
+type isAdapterMessage_Message interface {
+	isAdapterMessage_Message()
+}
+
+type AdapterMessage_EndnodeUplink struct {
+	EndnodeUplink *bs.EndnodeUplink `protobuf:"bytes,10,opt,name=endnode_uplink,json=endnodeUplink,proto3,oneof"`
+}
+
+type AdapterMessage_BasestationUplink struct {
+	BasestationUplink *bs.BasestationUplink `protobuf:"bytes,11,opt,name=basestation_uplink,json=basestationUplink,proto3,oneof"`
+}
+
+type AdapterMessage_State struct {
+	State *bs.BasestationState `protobuf:"bytes,12,opt,name=state,proto3,oneof"`
+}
+
+type AdapterMessage_AdapterEvent struct {
+	AdapterEvent *structpb.Struct `protobuf:"bytes,13,opt,name=adapter_event,json=adapterEvent,proto3,oneof"`
+}
+
+func (*AdapterMessage_EndnodeUplink) isAdapterMessage_Message() {}
+
+func (*AdapterMessage_BasestationUplink) isAdapterMessage_Message() {}
+
+func (*AdapterMessage_State) isAdapterMessage_Message() {}
+
+func (*AdapterMessage_AdapterEvent) isAdapterMessage_Message() {}
+
+var File_bssci_stream_proto protoreflect.FileDescriptor
+
+const file_bssci_stream_proto_rawDesc = "" +
+	"\n" +
+	"\x12bssci/stream.proto\x12\x05bssci\x1a\x1cgoogle/protobuf/struct.proto\x1a\vbs/bs.proto\"\xb1\x01\n" +
+	"\x11SubscriberMessage\x120\n" +
+	"\tsubscribe\x18\x01 \x01(\v2\x10.bssci.SubscribeH\x00R\tsubscribe\x12-\n" +
+	"\acommand\x18\x02 \x01(\v2\x11.bs.ServerCommandH\x00R\acommand\x120\n" +
+	"\bresponse\x18\x03 \x01(\v2\x12.bs.ServerResponseH\x00R\bresponseB\t\n" +
+	"\amessage\"$\n" +
+	"\tSubscribe\x12\x17\n" +
+	"\abs_euis\x18\x01 \x03(\tR\x06bsEuis\"\xe6\x02\n" +
+	"\x0eAdapterMessage\x12\x15\n" +
+	"\x06bs_eui\x18\x01 \x01(\tR\x05bsEui\x12!\n" +
+	"\fevent_source\x18\x02 \x01(\tR\veventSource\x12\x1d\n" +
+	"\n" +
+	"event_type\x18\x03 \x01(\tR\teventType\x12:\n" +
+	"\x0eendnode_uplink\x18\n" +
+	" \x01(\v2\x11.bs.EndnodeUplinkH\x00R\rendnodeUplink\x12F\n" +
+	"\x12basestation_uplink\x18\v \x01(\v2\x15.bs.BasestationUplinkH\x00R\x11basestationUplink\x12,\n" +
+	"\x05state\x18\f \x01(\v2\x14.bs.BasestationStateH\x00R\x05state\x12>\n" +
+	"\radapter_event\x18\r \x01(\v2\x17.google.protobuf.StructH\x00R\fadapterEventB\t\n" +
+	"\amessage2H\n" +
+	"\aAdapter\x12=\n" +
+	"\x06Stream\x12\x18.bssci.SubscriberMessage\x1a\x15.bssci.AdapterMessage(\x010\x01B>Z<github.com/SplitStackServer/mioty-bssci-adapter/api/go/bsscib\x06proto3"
+
+var (
+	file_bssci_stream_proto_rawDescOnce sync.Once
+	file_bssci_stream_proto_rawDescData []byte
+)
+
+func file_bssci_stream_proto_rawDescGZIP() []byte {
+	file_bssci_stream_proto_rawDescOnce.Do(func() {
+		file_bssci_stream_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_bssci_stream_proto_rawDesc), len(file_bssci_stream_proto_rawDesc)))
+	})
+	return file_bssci_stream_proto_rawDescData
+}
+
+var file_bssci_stream_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_bssci_stream_proto_goTypes = []any{
+	(*SubscriberMessage)(nil),    // 0: bssci.SubscriberMessage
+	(*Subscribe)(nil),            // 1: bssci.Subscribe
+	(*AdapterMessage)(nil),       // 2: bssci.AdapterMessage
+	(*bs.ServerCommand)(nil),     // 3: bs.ServerCommand
+	(*bs.ServerResponse)(nil),    // 4: bs.ServerResponse
+	(*bs.EndnodeUplink)(nil),     // 5: bs.EndnodeUplink
+	(*bs.BasestationUplink)(nil), // 6: bs.BasestationUplink
+	(*bs.BasestationState)(nil),  // 7: bs.BasestationState
+	(*structpb.Struct)(nil),      // 8: google.protobuf.Struct
+}
+var file_bssci_stream_proto_depIdxs = []int32{
+	1, // 0: bssci.SubscriberMessage.subscribe:type_name -> bssci.Subscribe
+	3, // 1: bssci.SubscriberMessage.command:type_name -> bs.ServerCommand
+	4, // 2: bssci.SubscriberMessage.response:type_name -> bs.ServerResponse
+	5, // 3: bssci.AdapterMessage.endnode_uplink:type_name -> bs.EndnodeUplink
+	6, // 4: bssci.AdapterMessage.basestation_uplink:type_name -> bs.BasestationUplink
+	7, // 5: bssci.AdapterMessage.state:type_name -> bs.BasestationState
+	8, // 6: bssci.AdapterMessage.adapter_event:type_name -> google.protobuf.Struct
+	0, // 7: bssci.Adapter.Stream:input_type -> bssci.SubscriberMessage
+	2, // 8: bssci.Adapter.Stream:output_type -> bssci.AdapterMessage
+	8, // [8:9] is the sub-list for method output_type
+	7, // [7:8] is the sub-list for method input_type
+	7, // [7:7] is the sub-list for extension type_name
+	7, // [7:7] is the sub-list for extension extendee
+	0, // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_bssci_stream_proto_init() }
+func file_bssci_stream_proto_init() {
+	if File_bssci_stream_proto != nil {
+		return
+	}
+	file_bssci_stream_proto_msgTypes[0].OneofWrappers = []any{
+		(*SubscriberMessage_Subscribe)(nil),
+		(*SubscriberMessage_Command)(nil),
+		(*SubscriberMessage_Response)(nil),
+	}
+	file_bssci_stream_proto_msgTypes[2].OneofWrappers = []any{
+		(*AdapterMessage_EndnodeUplink)(nil),
+		(*AdapterMessage_BasestationUplink)(nil),
+		(*AdapterMessage_State)(nil),
+		(*AdapterMessage_AdapterEvent)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_bssci_stream_proto_rawDesc), len(file_bssci_stream_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   3,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_bssci_stream_proto_goTypes,
+		DependencyIndexes: file_bssci_stream_proto_depIdxs,
+		MessageInfos:      file_bssci_stream_proto_msgTypes,
+	}.Build()
+	File_bssci_stream_proto = out.File
+	file_bssci_stream_proto_goTypes = nil
+	file_bssci_stream_proto_depIdxs = nil
+}
@@ -0,0 +1,115 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: bssci/stream.proto
+
+package bssci
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Adapter_Stream_FullMethodName = "/bssci.Adapter/Stream"
+)
+
+// AdapterClient is the client API for Adapter service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdapterClient interface {
+	Stream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SubscriberMessage, AdapterMessage], error)
+}
+
+type adapterClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdapterClient(cc grpc.ClientConnInterface) AdapterClient {
+	return &adapterClient{cc}
+}
+
+func (c *adapterClient) Stream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[SubscriberMessage, AdapterMessage], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Adapter_ServiceDesc.Streams[0], Adapter_Stream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscriberMessage, AdapterMessage]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Adapter_StreamClient = grpc.BidiStreamingClient[SubscriberMessage, AdapterMessage]
+
+// AdapterServer is the server API for Adapter service.
+// All implementations must embed UnimplementedAdapterServer
+// for forward compatibility.
+type AdapterServer interface {
+	Stream(grpc.BidiStreamingServer[SubscriberMessage, AdapterMessage]) error
+	mustEmbedUnimplementedAdapterServer()
+}
+
+// UnimplementedAdapterServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedAdapterServer struct{}
+
+func (UnimplementedAdapterServer) Stream(grpc.BidiStreamingServer[SubscriberMessage, AdapterMessage]) error {
+	return status.Error(codes.Unimplemented, "method Stream not implemented")
+}
+func (UnimplementedAdapterServer) mustEmbedUnimplementedAdapterServer() {}
+func (UnimplementedAdapterServer) testEmbeddedByValue()                 {}
+
+// UnsafeAdapterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdapterServer will
+// result in compilation errors.
+type UnsafeAdapterServer interface {
+	mustEmbedUnimplementedAdapterServer()
+}
+
+func RegisterAdapterServer(s grpc.ServiceRegistrar, srv AdapterServer) {
+	// If the following call panics, it indicates UnimplementedAdapterServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Adapter_ServiceDesc, srv)
+}
+
+func _Adapter_Stream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AdapterServer).Stream(&grpc.GenericServerStream[SubscriberMessage, AdapterMessage]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Adapter_StreamServer = grpc.BidiStreamingServer[SubscriberMessage, AdapterMessage]
+
+// Adapter_ServiceDesc is the grpc.ServiceDesc for Adapter service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Adapter_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "bssci.Adapter",
+	HandlerType: (*AdapterServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			Handler:       _Adapter_Stream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "bssci/stream.proto",
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/mqtt"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/simulator"
+
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var benchOpts struct {
+	basestations   int
+	endnodes       int
+	rate           float64
+	payloadSize    int
+	version        string
+	duration       time.Duration
+	drain          time.Duration
+	reconnectDelay time.Duration
+	json           bool
+	addr           string
+	tls            bool
+	caCert         string
+	tlsCert        string
+	tlsKey         string
+}
+
+var benchCmd = &cobra.Command{
+	Use:   "bench [flags]",
+	Short: "Load test a mioty BSSCI Adapter",
+	Long: `Bench connects simulated basestations to a mioty BSSCI Adapter and sends ulData at the
+target rate. The uplink events published by the adapter are received from the MQTT broker
+configured in the configuration file.
+
+The report contains the end-to-end latency percentiles from the basestation to the MQTT
+event, the throughput, the dropped uplinks and the errors reported by the adapter.`,
+	Args: cobra.NoArgs,
+	RunE: bench,
+}
+
+func init() {
+	benchCmd.Flags().IntVar(&benchOpts.basestations, "basestations", 10, "number of simulated basestations")
+	benchCmd.Flags().IntVar(&benchOpts.endnodes, "endnodes", 10, "number of endnodes per basestation")
+	benchCmd.Flags().Float64Var(&benchOpts.rate, "rate", 100, "total uplinks per second")
+	benchCmd.Flags().IntVar(&benchOpts.payloadSize, "payload-size", 10, "user data size of an uplink in bytes")
+	benchCmd.Flags().StringVar(&benchOpts.version, "version", "", "requested protocol version, the latest if empty")
+	benchCmd.Flags().DurationVar(&benchOpts.duration, "duration", time.Minute, "time to send uplinks")
+	benchCmd.Flags().DurationVar(&benchOpts.drain, "drain", 10*time.Second, "time to wait for outstanding events after sending")
+	benchCmd.Flags().DurationVar(&benchOpts.reconnectDelay, "reconnect-delay", time.Second, "delay before reconnecting a basestation")
+	benchCmd.Flags().BoolVar(&benchOpts.json, "json", false, "print the report as json")
+	benchCmd.Flags().StringVar(&benchOpts.addr, "addr", "127.0.0.1:5005", "address of the adapter")
+	benchCmd.Flags().BoolVar(&benchOpts.tls, "tls", true, "connect using TLS")
+	benchCmd.Flags().StringVar(&benchOpts.caCert, "ca-cert", "", "CA certificate to verify the adapter, the adapter is not verified if empty")
+	benchCmd.Flags().StringVar(&benchOpts.tlsCert, "tls-cert", "", "client certificate")
+	benchCmd.Flags().StringVar(&benchOpts.tlsKey, "tls-key", "", "client certificate key")
+}
+
+func bench(cmd *cobra.Command, args []string) error {
+	setLogLevel()
+
+	scenario, err := simulator.NewBenchScenario(simulator.BenchConfig{
+		Basestations: benchOpts.basestations,
+		Endnodes:     benchOpts.endnodes,
+		Rate:         benchOpts.rate,
+		PayloadSize:  benchOpts.payloadSize,
+		Version:      benchOpts.version,
+	})
+	if err != nil {
+		return errors.Wrap(err, "create scenario error")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	recorder := simulator.NewBenchRecorder(scenario, time.Now())
+	client, err := subscribeUplinks(config.C, recorder.Record)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(250)
+
+	log.Info().Int("basestations", benchOpts.basestations).Int("endnodes", benchOpts.endnodes).Float64("rate", benchOpts.rate).Dur("duration", benchOpts.duration).Msg("starting load test")
+
+	sendCtx, cancel := context.WithTimeout(ctx, benchOpts.duration)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var failed atomic.Int64
+	basestations := make([]*simulator.Basestation, 0, len(scenario.Basestations))
+	for _, bsConfig := range scenario.Basestations {
+		basestation := simulator.NewBasestation(bsConfig, log.Logger)
+		basestations = append(basestations, basestation)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n := runSimulatedBasestation(sendCtx, basestation, func() (net.Conn, error) {
+				return dialAdapter(benchOpts.addr, benchOpts.tls, benchOpts.caCert, benchOpts.tlsCert, benchOpts.tlsKey)
+			}, benchOpts.reconnectDelay)
+			failed.Add(int64(n))
+		}()
+	}
+	wg.Wait()
+
+	stats := func() (sent int64, adapterErrors int64) {
+		for _, basestation := range basestations {
+			s := basestation.Stats()
+			sent += s.Sent
+			adapterErrors += s.Errors
+		}
+		return sent, adapterErrors + failed.Load()
+	}
+
+	// wait for the events of the last uplinks
+	sent, _ := stats()
+	drain := time.NewTimer(benchOpts.drain)
+	defer drain.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for done := false; !done; {
+		select {
+		case <-ticker.C:
+			done = int64(recorder.Received()) >= sent
+		case <-drain.C:
+			done = true
+		case <-ctx.Done():
+			done = true
+		}
+	}
+
+	return printBenchReport(recorder.Report(stats()))
+}
+
+// subscribe to the uplink events of all basestations
+func subscribeUplinks(conf config.Config, handler func(*bs.EndnodeUplink, time.Time)) (paho.Client, error) {
+	unmarshal, err := mqtt.Unmarshaler(conf.Integration.Marshaler)
+	if err != nil {
+		return nil, err
+	}
+	topic, err := mqtt.SubscriptionTopic(conf.Integration.MQTTV3.EventTopicTemplate, map[string]string{
+		mqtt.TopicFieldEventSource: mqtt.EventSourceEndpoint,
+		mqtt.TopicFieldEventType:   string(events.EventTypeEpUl),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newMqttClient(conf, "bench")
+	if err != nil {
+		return nil, err
+	}
+
+	token := client.Subscribe(topic, conf.Integration.MQTTV3.Auth.Generic.QOS, func(c paho.Client, msg paho.Message) {
+		received := time.Now()
+		var pb bs.EndnodeUplink
+		if err := unmarshal(msg.Payload(), &pb); err != nil {
+			log.Error().Err(err).Str("topic", msg.Topic()).Msg("unmarshal uplink event error")
+			return
+		}
+		handler(&pb, received)
+	})
+	if err := waitToken(token, conf.Integration.MQTTV3.MaxTokenWait); err != nil {
+		client.Disconnect(250)
+		return nil, errors.Wrapf(err, "subscribe %s error", topic)
+	}
+	log.Info().Str("topic", topic).Msg("subscribed to uplink events")
+	return client, nil
+}
+
+func printBenchReport(report simulator.BenchReport) error {
+	if benchOpts.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "duration\t%s\n", report.Duration.Round(time.Millisecond))
+	fmt.Fprintf(w, "sent\t%d\n", report.Sent)
+	fmt.Fprintf(w, "received\t%d\n", report.Received)
+	fmt.Fprintf(w, "dropped\t%d\n", report.Dropped)
+	fmt.Fprintf(w, "duplicates\t%d\n", report.Duplicates)
+	fmt.Fprintf(w, "errors\t%d\n", report.Errors)
+	fmt.Fprintf(w, "throughput\t%.1f/s\n", report.Throughput)
+	fmt.Fprintf(w, "latency min\t%s\n", report.Latency.Min)
+	fmt.Fprintf(w, "latency mean\t%s\n", report.Latency.Mean)
+	fmt.Fprintf(w, "latency p50\t%s\n", report.Latency.P50)
+	fmt.Fprintf(w, "latency p90\t%s\n", report.Latency.P90)
+	fmt.Fprintf(w, "latency p95\t%s\n", report.Latency.P95)
+	fmt.Fprintf(w, "latency p99\t%s\n", report.Latency.P99)
+	fmt.Fprintf(w, "latency max\t%s\n", report.Latency.Max)
+	return w.Flush()
+}
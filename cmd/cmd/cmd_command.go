@@ -0,0 +1,417 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/mqtt"
+
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+var commandOpts struct {
+	bsEui string
+	wait  time.Duration
+	json  bool
+}
+
+var commandCmd = &cobra.Command{
+	Use:   "command",
+	Short: "Send server commands to a basestation",
+	Long: `Command builds a server command, publishes it on the command topic of the basestation
+using the MQTT broker and marshaler configured in the configuration file and optionally
+waits for the matching result event published by the adapter.`,
+}
+
+// Options of the endnode commands
+var commandEndnodeOpts struct {
+	endnodeEui string
+	dlQueId    uint64
+}
+
+var commandDownlinkOpts struct {
+	data           string
+	ack            bool
+	format         uint32
+	priority       float32
+	responseExp    bool
+	responsePrio   bool
+	reqDlWindow    bool
+	onlyIfExpected bool
+}
+
+var commandAttPrpOpts struct {
+	nwkSessionKey string
+	shAddr        uint32
+	lastPacketCnt uint32
+	bidi          bool
+	dualChannel   bool
+	repetition    bool
+	wideCarrOff   bool
+	longBlkDist   bool
+}
+
+var commandVmOpts struct {
+	macType uint32
+}
+
+var commandDownlinkCmd = &cobra.Command{
+	Use:   "downlink [flags]",
+	Short: "Enqueue a downlink, waits for the downlink result",
+	Args:  cobra.NoArgs,
+	RunE:  commandDownlink,
+}
+
+var commandRevokeCmd = &cobra.Command{
+	Use:   "revoke [flags]",
+	Short: "Revoke an enqueued downlink, waits for the downlink result",
+	Args:  cobra.NoArgs,
+	RunE:  commandRevoke,
+}
+
+var commandRxStatusCmd = &cobra.Command{
+	Use:   "rx-status [flags]",
+	Short: "Query the downlink reception status of an endnode",
+	Args:  cobra.NoArgs,
+	RunE:  commandRxStatus,
+}
+
+var commandAttPrpCmd = &cobra.Command{
+	Use:   "att-prp [flags]",
+	Short: "Propagate the attachment of an endnode",
+	Args:  cobra.NoArgs,
+	RunE:  commandAttPrp,
+}
+
+var commandDetPrpCmd = &cobra.Command{
+	Use:   "det-prp [flags]",
+	Short: "Propagate the detachment of an endnode",
+	Args:  cobra.NoArgs,
+	RunE:  commandDetPrp,
+}
+
+var commandStatusCmd = &cobra.Command{
+	Use:   "status [flags]",
+	Short: "Request the status of the basestation",
+	Args:  cobra.NoArgs,
+	RunE:  commandStatus,
+}
+
+var commandVmActivateCmd = &cobra.Command{
+	Use:   "vm-activate [flags]",
+	Short: "Activate a variable MAC, no result is published",
+	Args:  cobra.NoArgs,
+	RunE:  commandVmActivate,
+}
+
+var commandVmDeactivateCmd = &cobra.Command{
+	Use:   "vm-deactivate [flags]",
+	Short: "Deactivate a variable MAC, no result is published",
+	Args:  cobra.NoArgs,
+	RunE:  commandVmDeactivate,
+}
+
+var commandVmStatusCmd = &cobra.Command{
+	Use:   "vm-status [flags]",
+	Short: "Request the variable MAC status of the basestation",
+	Args:  cobra.NoArgs,
+	RunE:  commandVmStatus,
+}
+
+func init() {
+	commandCmd.PersistentFlags().StringVar(&commandOpts.bsEui, "bs-eui", "", "EUI64 of the basestation")
+	commandCmd.PersistentFlags().DurationVar(&commandOpts.wait, "wait", 0, "time to wait for the result event, not waiting if 0")
+	commandCmd.PersistentFlags().BoolVar(&commandOpts.json, "json", false, "print the result as json")
+	commandCmd.MarkPersistentFlagRequired("bs-eui")
+
+	for _, c := range []*cobra.Command{commandDownlinkCmd, commandRevokeCmd, commandRxStatusCmd, commandAttPrpCmd, commandDetPrpCmd} {
+		c.Flags().StringVar(&commandEndnodeOpts.endnodeEui, "endnode-eui", "", "EUI64 of the endnode")
+		c.MarkFlagRequired("endnode-eui")
+	}
+	for _, c := range []*cobra.Command{commandDownlinkCmd, commandRevokeCmd} {
+		c.Flags().Uint64Var(&commandEndnodeOpts.dlQueId, "dl-que-id", 0, "id of the downlink queue entry")
+		c.MarkFlagRequired("dl-que-id")
+	}
+
+	commandDownlinkCmd.Flags().StringVar(&commandDownlinkOpts.data, "data", "", "hex encoded user data")
+	commandDownlinkCmd.Flags().BoolVar(&commandDownlinkOpts.ack, "ack", false, "send an acknowledgement without user data")
+	commandDownlinkCmd.Flags().Uint32Var(&commandDownlinkOpts.format, "format", 0, "user data format")
+	commandDownlinkCmd.Flags().Float32Var(&commandDownlinkOpts.priority, "priority", 0, "priority of the downlink")
+	commandDownlinkCmd.Flags().BoolVar(&commandDownlinkOpts.responseExp, "response-exp", false, "a response is expected")
+	commandDownlinkCmd.Flags().BoolVar(&commandDownlinkOpts.responsePrio, "response-prio", false, "the response has priority")
+	commandDownlinkCmd.Flags().BoolVar(&commandDownlinkOpts.reqDlWindow, "req-dl-window", false, "request a further downlink window")
+	commandDownlinkCmd.Flags().BoolVar(&commandDownlinkOpts.onlyIfExpected, "only-if-expected", false, "only send if a downlink is expected")
+	commandDownlinkCmd.MarkFlagsMutuallyExclusive("data", "ack")
+	commandDownlinkCmd.MarkFlagsOneRequired("data", "ack")
+
+	commandAttPrpCmd.Flags().StringVar(&commandAttPrpOpts.nwkSessionKey, "nwk-session-key", "", "hex encoded network session key")
+	commandAttPrpCmd.Flags().Uint32Var(&commandAttPrpOpts.shAddr, "sh-addr", 0, "short address")
+	commandAttPrpCmd.Flags().Uint32Var(&commandAttPrpOpts.lastPacketCnt, "last-packet-cnt", 0, "last packet counter")
+	commandAttPrpCmd.Flags().BoolVar(&commandAttPrpOpts.bidi, "bidi", false, "bidirectional endnode")
+	commandAttPrpCmd.Flags().BoolVar(&commandAttPrpOpts.dualChannel, "dual-channel", false, "dual channel mode")
+	commandAttPrpCmd.Flags().BoolVar(&commandAttPrpOpts.repetition, "repetition", false, "repetition mode")
+	commandAttPrpCmd.Flags().BoolVar(&commandAttPrpOpts.wideCarrOff, "wide-carr-off", false, "wide carrier offset")
+	commandAttPrpCmd.Flags().BoolVar(&commandAttPrpOpts.longBlkDist, "long-blk-dist", false, "long block distance")
+	commandAttPrpCmd.MarkFlagRequired("nwk-session-key")
+
+	for _, c := range []*cobra.Command{commandVmActivateCmd, commandVmDeactivateCmd} {
+		c.Flags().Uint32Var(&commandVmOpts.macType, "mac-type", 0, "variable MAC type")
+		c.MarkFlagRequired("mac-type")
+	}
+
+	commandCmd.AddCommand(
+		commandDownlinkCmd,
+		commandRevokeCmd,
+		commandRxStatusCmd,
+		commandAttPrpCmd,
+		commandDetPrpCmd,
+		commandStatusCmd,
+		commandVmActivateCmd,
+		commandVmDeactivateCmd,
+		commandVmStatusCmd,
+	)
+}
+
+func commandDownlink(cmd *cobra.Command, args []string) error {
+	endnodeEui, err := parseCommandEui(commandEndnodeOpts.endnodeEui)
+	if err != nil {
+		return errors.Wrap(err, "invalid endnode eui")
+	}
+
+	dl := bs.EnqueDownlink{
+		EndnodeEui: endnodeEui,
+		DlQueId:    commandEndnodeOpts.dlQueId,
+	}
+	if commandDownlinkOpts.ack {
+		dl.Payload = &bs.EnqueDownlink_Ack{Ack: &bs.Acknowledgement{}}
+	} else {
+		data, err := hex.DecodeString(commandDownlinkOpts.data)
+		if err != nil {
+			return errors.Wrap(err, "invalid data")
+		}
+		dl.Payload = &bs.EnqueDownlink_Data{Data: &bs.DownlinkData{Data: data}}
+	}
+
+	// optional fields are only set if given
+	flags := cmd.Flags()
+	if flags.Changed("format") {
+		dl.Format = &commandDownlinkOpts.format
+	}
+	if flags.Changed("priority") {
+		dl.Priority = &commandDownlinkOpts.priority
+	}
+	if flags.Changed("response-exp") {
+		dl.ResponseExp = &commandDownlinkOpts.responseExp
+	}
+	if flags.Changed("response-prio") {
+		dl.ResponsePrio = &commandDownlinkOpts.responsePrio
+	}
+	if flags.Changed("req-dl-window") {
+		dl.ReqDlWindow = &commandDownlinkOpts.reqDlWindow
+	}
+	if flags.Changed("only-if-expected") {
+		dl.OnlyIfExpected = &commandDownlinkOpts.onlyIfExpected
+	}
+
+	return sendServerCommand("dl_data_que", &bs.ServerCommand{Command: &bs.ServerCommand_DlDataQue{DlDataQue: &dl}})
+}
+
+func commandRevoke(cmd *cobra.Command, args []string) error {
+	endnodeEui, err := parseCommandEui(commandEndnodeOpts.endnodeEui)
+	if err != nil {
+		return errors.Wrap(err, "invalid endnode eui")
+	}
+
+	rev := bs.RevokeDownlink{
+		EndnodeEui: endnodeEui,
+		DlQueId:    commandEndnodeOpts.dlQueId,
+	}
+	return sendServerCommand("dl_data_rev", &bs.ServerCommand{Command: &bs.ServerCommand_DlDataRev{DlDataRev: &rev}})
+}
+
+func commandRxStatus(cmd *cobra.Command, args []string) error {
+	endnodeEui, err := parseCommandEui(commandEndnodeOpts.endnodeEui)
+	if err != nil {
+		return errors.Wrap(err, "invalid endnode eui")
+	}
+
+	qry := bs.DownlinkRxStatusQuery{EndnodeEui: endnodeEui}
+	return sendServerCommand("dl_rx_stat_qry", &bs.ServerCommand{Command: &bs.ServerCommand_DlRxStatQry{DlRxStatQry: &qry}})
+}
+
+func commandAttPrp(cmd *cobra.Command, args []string) error {
+	endnodeEui, err := parseCommandEui(commandEndnodeOpts.endnodeEui)
+	if err != nil {
+		return errors.Wrap(err, "invalid endnode eui")
+	}
+	key, err := hex.DecodeString(commandAttPrpOpts.nwkSessionKey)
+	if err != nil || len(key) != 16 {
+		return errors.New("invalid network session key, expected 16 hex encoded bytes")
+	}
+
+	prp := bs.AttachPropagate{
+		EndnodeEui:    endnodeEui,
+		Bidi:          commandAttPrpOpts.bidi,
+		NwkSessionKey: key,
+		ShAddr:        commandAttPrpOpts.shAddr,
+		LastPacketCnt: commandAttPrpOpts.lastPacketCnt,
+		DualChannel:   commandAttPrpOpts.dualChannel,
+		Repetition:    commandAttPrpOpts.repetition,
+		WideCarrOff:   commandAttPrpOpts.wideCarrOff,
+		LongBlkDist:   commandAttPrpOpts.longBlkDist,
+	}
+	return sendServerCommand("att_prp", &bs.ServerCommand{Command: &bs.ServerCommand_AttPrp{AttPrp: &prp}})
+}
+
+func commandDetPrp(cmd *cobra.Command, args []string) error {
+	endnodeEui, err := parseCommandEui(commandEndnodeOpts.endnodeEui)
+	if err != nil {
+		return errors.Wrap(err, "invalid endnode eui")
+	}
+
+	prp := bs.DetachPropagate{EndnodeEui: endnodeEui}
+	return sendServerCommand("det_prp", &bs.ServerCommand{Command: &bs.ServerCommand_DetPrp{DetPrp: &prp}})
+}
+
+func commandStatus(cmd *cobra.Command, args []string) error {
+	return sendServerCommand("req_status", &bs.ServerCommand{Command: &bs.ServerCommand_ReqStatus{ReqStatus: &bs.RequestStatus{}}})
+}
+
+func commandVmActivate(cmd *cobra.Command, args []string) error {
+	vm := bs.EnableVariableMac{MacType: commandVmOpts.macType}
+	return sendServerCommand("vm_activate", &bs.ServerCommand{Command: &bs.ServerCommand_VmActivate{VmActivate: &vm}})
+}
+
+func commandVmDeactivate(cmd *cobra.Command, args []string) error {
+	vm := bs.DisableVariableMac{MacType: commandVmOpts.macType}
+	return sendServerCommand("vm_deactivate", &bs.ServerCommand{Command: &bs.ServerCommand_VmDeactivate{VmDeactivate: &vm}})
+}
+
+func commandVmStatus(cmd *cobra.Command, args []string) error {
+	return sendServerCommand("vm_status", &bs.ServerCommand{Command: &bs.ServerCommand_VmStatus{VmStatus: &bs.RequestVariableMacStatus{}}})
+}
+
+// publish the command and wait for its result if requested
+func sendServerCommand(name string, command *bs.ServerCommand) error {
+	setLogLevel()
+
+	bsEui, err := parseCommandEui(commandOpts.bsEui)
+	if err != nil {
+		return errors.Wrap(err, "invalid bs eui")
+	}
+	command.BsEui = bsEui
+
+	conf := config.C.Integration
+	marshal, err := mqtt.Marshaler(conf.Marshaler)
+	if err != nil {
+		return err
+	}
+	unmarshal, err := mqtt.Unmarshaler(conf.Marshaler)
+	if err != nil {
+		return err
+	}
+	topic, err := mqtt.PublishTopic(conf.MQTTV3.CommandTopicTemplate, map[string]string{mqtt.TopicFieldBsEui: bsEui}, name)
+	if err != nil {
+		return err
+	}
+	payload, err := marshal(command)
+	if err != nil {
+		return errors.Wrap(err, "marshal command error")
+	}
+
+	result, hasResult := mqtt.CommandResultOf(command)
+	if commandOpts.wait > 0 && !hasResult {
+		log.Warn().Str("command", name).Msg("no result event is published for this command, not waiting")
+	}
+	wait := commandOpts.wait > 0 && hasResult
+
+	client, err := newMqttClient(config.C, "command")
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(250)
+
+	// subscribe before publishing to not miss the result
+	results := make(chan *bs.BasestationUplink, 1)
+	if wait {
+		eventTopic, err := mqtt.SubscriptionTopic(conf.MQTTV3.EventTopicTemplate, map[string]string{
+			mqtt.TopicFieldBsEui:       bsEui,
+			mqtt.TopicFieldEventSource: mqtt.EventSourceBasestation,
+			mqtt.TopicFieldEventType:   string(result.EventType),
+		})
+		if err != nil {
+			return err
+		}
+		token := client.Subscribe(eventTopic, conf.MQTTV3.Auth.Generic.QOS, func(c paho.Client, msg paho.Message) {
+			var pb bs.BasestationUplink
+			if err := unmarshal(msg.Payload(), &pb); err != nil {
+				log.Warn().Err(err).Str("topic", msg.Topic()).Msg("unmarshal event error")
+				return
+			}
+			if result.Match(&pb) {
+				select {
+				case results <- &pb:
+				default:
+				}
+			}
+		})
+		if err := waitToken(token, conf.MQTTV3.MaxTokenWait); err != nil {
+			return errors.Wrapf(err, "subscribe %s error", eventTopic)
+		}
+	}
+
+	token := client.Publish(topic, conf.MQTTV3.Auth.Generic.QOS, false, payload)
+	if err := waitToken(token, conf.MQTTV3.MaxTokenWait); err != nil {
+		return errors.Wrapf(err, "publish %s error", topic)
+	}
+	log.Info().Str("topic", topic).Str("command", name).Msg("command published")
+
+	if !wait {
+		return nil
+	}
+	select {
+	case pb := <-results:
+		return printCommandResult(result.EventType, pb)
+	case <-time.After(commandOpts.wait):
+		return errors.Errorf("no %s event received within %s", result.EventType, commandOpts.wait)
+	}
+}
+
+func printCommandResult(eventType events.EventType, pb *bs.BasestationUplink) error {
+	b, err := protojson.Marshal(pb)
+	if err != nil {
+		return err
+	}
+	if commandOpts.json {
+		return json.NewEncoder(os.Stdout).Encode(struct {
+			Type    events.EventType `json:"type"`
+			Payload json.RawMessage  `json:"payload"`
+		}{eventType, b})
+	}
+	fmt.Printf("%s %s\n", eventType, b)
+	return nil
+}
+
+// parse an EUI64 into the representation used by the adapter
+func parseCommandEui(s string) (string, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 8 {
+		return "", errors.Errorf("expected 8 hex encoded bytes: %s", s)
+	}
+	eui, err := common.Eui64FromHexString(s)
+	if err != nil {
+		return "", err
+	}
+	return eui.String(), nil
+}
@@ -1,8 +1,8 @@
 package cmd
 
 import (
-	"html/template"
 	"os"
+	"text/template"
 
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
 
@@ -73,8 +73,172 @@ type="{{ .Backend.Type }}"
   # Valid units are 'ms', 's', 'm', 'h'. Note that these values can be combined, e.g. '24h30m15s'.
   keep_alive_period="{{ .Backend.BssciV1.KeepAlivePeriod }}"
 
+  # Operation timeout.
+  #
+  # Each BSSCI operation (initiation, response, completion) is tracked per
+  # connection and out of sequence messages are rejected with an error.
+  # Operations which do not complete within this timeout are dropped and counted.
+  # Set this to 0 to disable the operation tracking.
+  #
+  # Valid units are 'ms', 's', 'm', 'h'. Note that these values can be combined, e.g. '24h30m15s'.
+  operation_timeout="{{ .Backend.BssciV1.OperationTimeout }}"
+
+  # Supported protocol versions.
+  #
+  # The version requested by a basestation in its 'con' message is negotiated
+  # against this range (major.minor.patch). Basestations requesting a major
+  # version outside of this range are rejected. A request for a newer minor
+  # version is answered with 'max_version'. Leave empty to use the versions
+  # implemented by the adapter.
+  min_version="{{ .Backend.BssciV1.MinVersion }}"
+  max_version="{{ .Backend.BssciV1.MaxVersion }}"
+
+  # Flap detection.
+  #
+  # Tracks the connects of each basestation. A basestation which connects
+  # 'threshold' times within 'window' is flagged as flapping and a 'flapping'
+  # event is published. Once it stays connected for 'stable_period' it is
+  # considered stable again and a second 'flapping' event is published.
+  [backend.bssci_v1.flap_detection]
+  enabled={{ .Backend.BssciV1.FlapDetection.Enabled }}
+
+  # Detection window, must be positive.
+  #
+  # Valid units are 'ms', 's', 'm', 'h'. Note that these values can be combined, e.g. '24h30m15s'.
+  window="{{ .Backend.BssciV1.FlapDetection.Window }}"
+
+  # Number of connects within the window to flag a basestation as flapping,
+  # must be at least 2.
+  threshold={{ .Backend.BssciV1.FlapDetection.Threshold }}
+
+  # Stable period.
+  #
+  # A flapping basestation is stable again after staying connected for this period.
+  #
+  # Valid units are 'ms', 's', 'm', 'h'. Note that these values can be combined, e.g. '24h30m15s'.
+  stable_period="{{ .Backend.BssciV1.FlapDetection.StablePeriod }}"
+
+  # Quarantine flapping basestations.
+  #
+  # When set to true, the integration subscription (and thereby the ONLINE/OFFLINE
+  # state publishes) of a flapping basestation is delayed until it is stable again.
+  quarantine={{ .Backend.BssciV1.FlapDetection.Quarantine }}
+
+  # Raw frame publishing.
+  #
+  # Publishes every BSSCI frame sent to or received from a basestation as
+  # 'raw' event, including the direction, command and opId of the frame.
+  # This is intended for debugging and for consumers which need fields that
+  # are not part of the protobuf messages. The frames of a basestation are
+  # published in order, up to 1000 frames are queued per basestation before
+  # frames are dropped.
+  [backend.bssci_v1.raw]
+  enabled={{ .Backend.BssciV1.Raw.Enabled }}
+
+  # Format of the published frame.
+  #
+  # json:    the frame is decoded into the 'data' field
+  # msgpack: the message pack bytes are published base64 encoded in the 'payload' field
+  format="{{ .Backend.BssciV1.Raw.Format }}"
+
+  # Commands to publish, e.g. ["con", "ulData"]. All commands are published if empty.
+  # Unknown command names are rejected at startup.
+  commands=[{{ range $index, $elm := .Backend.BssciV1.Raw.Commands }}
+    "{{ $elm }}",{{ end }}
+  ]
+
+  # Session capture.
+  #
+  # Records the frames of each basestation session with timestamp and
+  # direction into a capture file. Captures can be fed into an adapter
+  # instance with the 'replay' subcommand.
+  [backend.bssci_v1.capture]
+  enabled={{ .Backend.BssciV1.Capture.Enabled }}
+
+  # Directory for the capture files, created if it does not exist.
+  directory="{{ .Backend.BssciV1.Capture.Directory }}"
+
+  # Maximum size of a capture file in bytes.
+  #
+  # A session exceeding this size is continued in a new file. Set this to 0
+  # to disable the limit.
+  max_size={{ .Backend.BssciV1.Capture.MaxSize }}
+
+  # Maximum number of capture files.
+  #
+  # The oldest files are removed once exceeded. Set this to 0 to keep all files.
+  max_files={{ .Backend.BssciV1.Capture.MaxFiles }}
+
+  # Publish confirmation.
+  #
+  # When enabled, ulData and vmUlData are only acknowledged once the integration
+  # confirmed the publish of the uplink. If the publish fails or does not complete
+  # within the timeout, an error is returned so the basestation retains the data
+  # and retries it. The acknowledgement is sent once the publish completed, the
+  # following messages of the basestation are handled in the meantime. A publish
+  # which completes after the timeout is kept, the retried uplink is then
+  # acknowledged without being published again.
+  #
+  # What a confirmation means depends on the integration:
+  #   mqtt_v3, mqtt_v5: accepted by the broker (qos > 0) or sent (qos 0)
+  #   webhook: accepted by the endpoint with a 2xx status
+  #   nats: stored by JetStream, without JetStream only handed to the client
+  #   file: written to the file
+  #   grpc: queued for the subscribed clients, fails if all of their queues are
+  #     full, the uplink may still be lost if a client disconnects before
+  #     receiving it. Without subscribed clients uplinks are acknowledged.
+  #   websocket: never confirmed, uplinks are acknowledged even without clients
+  #
+  # With store_forward, an uplink is confirmed once it is written to the queue.
+  # With multiple integrations, the publish fails if one of the required
+  # integrations fails, see 'required' in [integration].
+  [backend.bssci_v1.publish_confirmation]
+  enabled={{ .Backend.BssciV1.PublishConfirmation.Enabled }}
+
+  # Maximum time to wait for the publish confirmation.
+  timeout="{{ .Backend.BssciV1.PublishConfirmation.Timeout }}"
+
 # Integration configuration.
 [integration]
+# Integration type.
+#
+# Valid options are:
+# * mqtt_v3:  MQTT 3.1.1 integration, configured in [integration.mqtt_v3]
+# * mqtt_v5:  MQTT 5 integration, configured in [integration.mqtt_v5]
+# * webhook:  HTTP webhook integration, configured in [integration.webhook]
+# * grpc:     gRPC stream integration, configured in [integration.grpc]
+# * nats:     NATS integration, configured in [integration.nats]
+# * websocket: WebSocket event stream, configured in [integration.websocket]
+# * file:     JSON lines on stdout or in a file, configured in [integration.file]
+type="{{ .Integration.Type }}"
+
+# Integration types.
+#
+# Publish to multiple integrations at once, e.g. ["mqtt_v3", "mqtt_v5"]. Overrides
+# type if set. Each integration is configured in its own section below, so each
+# type can be used once. The integrations are called concurrently, an error of
+# one integration does not prevent the publish to the others. Commands are
+# accepted from all integrations.
+types=[{{ range $index, $elm := .Integration.Types }}"{{ $elm }}",{{ end }}]
+
+# Required integrations.
+#
+# A publish waits for the required integrations and fails if one of them fails,
+# e.g. a confirmed uplink is then rejected and retransmitted by the basestation,
+# which publishes it again to all integrations. The publishes to the other
+# integrations are queued and their errors are only logged, as are their
+# subscription errors. Starting fails if a required integration fails to start,
+# the integrations which started are stopped again.
+# All integrations are required if empty.
+required=[{{ range $index, $elm := .Integration.Required }}"{{ $elm }}",{{ end }}]
+
+# Queue size of an optional integration.
+#
+# Number of publishes queued for each integration which is not required. Once
+# the queue is full, e.g. while the integration is unreachable, further
+# publishes to it are dropped.
+optional_queue_size={{ .Integration.OptionalQueueSize }}
+
 # Payload marshaler.
 #
 # This defines how the MQTT payloads are encoded. Valid options are:
@@ -82,6 +246,50 @@ type="{{ .Backend.Type }}"
 # * json:      JSON encoding (for debugging)
 marshaler="{{ .Integration.Marshaler }}"
 
+  # Event filters.
+  #
+  # Restricts the event types published by an integration, e.g.
+  # mqtt_v5=["ul", "dl"]. Integrations without filter publish all events.
+  # States are always published to all integrations.
+  [integration.event_filters]
+{{ range $name, $events := .Integration.EventFilters }}  {{ $name }}=[{{ range $index, $elm := $events }}"{{ $elm }}",{{ end }}]
+{{ end }}
+
+  # Store-and-forward.
+  #
+  # Events of the selected integrations are journaled to disk before they are
+  # published and are published in order by a single worker. While the broker
+  # is unreachable events are kept in the journal, also across restarts, and
+  # replayed after reconnect. States are not journaled.
+  [integration.store_forward]
+  # Integrations using store-and-forward, e.g. ["mqtt_v3"].
+  integrations=[{{ range $index, $elm := .Integration.StoreForward.Integrations }}"{{ $elm }}",{{ end }}]
+
+  # Directory of the journals, each integration uses a sub-directory.
+  dir="{{ .Integration.StoreForward.Dir }}"
+
+  # Maximum size of a journal in megabytes.
+  #
+  # The oldest events are dropped once exceeded. Set to 0 for no limit.
+  max_size_mb={{ .Integration.StoreForward.MaxSizeMB }}
+
+  # Size of the journal segment files in megabytes.
+  segment_size_mb={{ .Integration.StoreForward.SegmentSizeMB }}
+
+  # Maximum age of a journaled event.
+  #
+  # Older events are dropped instead of published. Set to 0 to disable.
+  max_age="{{ .Integration.StoreForward.MaxAge }}"
+
+  # Delay before a failed publish is retried.
+  retry_interval="{{ .Integration.StoreForward.RetryInterval }}"
+
+  # Sync the journal to disk after each event.
+  #
+  # Disable to reduce disk writes, events written shortly before a power loss
+  # may then be lost.
+  sync_writes={{ .Integration.StoreForward.SyncWrites }}
+
   # MQTT integration configuration.
   [integration.mqtt_v3]
 
@@ -154,6 +362,27 @@ marshaler="{{ .Integration.Marshaler }}"
   # Default: bssci/{{ .BsEui }}/response/#
   response_topic_template = "{{ .Integration.MQTTV3.ResponseTopicTemplate }}"
 
+  # Events published as retained MQTT messages, e.g. ["con"].
+  #
+  # The broker keeps the last event of each type per basestation. When the
+  # subscription of a basestation is removed, e.g. on disconnect, its retained
+  # events are cleared with empty retained messages. Valid event types are
+  # status, con, vm, dl, prp_ack, flapping, disconnect, raw, otaa, ul and rx.
+  retained_events=[{{ range $index, $elm := .Integration.MQTTV3.RetainedEvents }}"{{ $elm }}",{{ end }}]
+
+  # QoS of the command and response subscriptions.
+  #
+  # Set to -1 to use the qos of [integration.mqtt_v3.auth.generic].
+  subscribe_qos={{ .Integration.MQTTV3.SubscribeQOS }}
+
+  # QoS per event type.
+  #
+  # Overrides the qos of [integration.mqtt_v3.auth.generic] for the listed
+  # event types, e.g. ul=1, otaa=1, status=0. Unknown event types are rejected.
+  [integration.mqtt_v3.event_qos]
+{{ range $event, $qos := .Integration.MQTTV3.EventQOS }}  {{ $event }}={{ $qos }}
+{{ end }}
+
   # MQTT authentication.
   [integration.mqtt_v3.auth]
   # Type defines the MQTT authentication type to use.
@@ -215,6 +444,386 @@ marshaler="{{ .Integration.Marshaler }}"
     tls_key="{{ .Integration.MQTTV3.Auth.Generic.TLSKey }}"
 
 
+  # MQTT 5 integration configuration.
+  #
+  # Uses the same topics as the MQTT 3.1.1 integration. Published messages carry
+  # the user properties bs_eui, event_source and event_type and the content type
+  # of the marshaler.
+  #
+  # Commands may set a response topic and correlation data. The event carrying
+  # the result of the command is then additionally published to the response
+  # topic with the correlation data. Downlink commands may set a message expiry,
+  # the downlink is revoked if it was not sent before the expiry.
+  [integration.mqtt_v5]
+
+  # Keep alive will set the amount of time that the client should wait before
+  # sending a PING request to the broker.
+  # Valid units are 'ms', 's', 'm', 'h'. Note that these values can be combined, e.g. '24h30m15s'.
+  keep_alive="{{ .Integration.MQTTV5.KeepAlive }}"
+
+  # Delay between connection attempts.
+  connect_retry_delay="{{ .Integration.MQTTV5.ConnectRetryDelay }}"
+
+  # Timeout of a connection attempt.
+  connect_timeout="{{ .Integration.MQTTV5.ConnectTimeout }}"
+
+  # Maximum time to wait for the broker to acknowledge a publish or subscription.
+  publish_timeout="{{ .Integration.MQTTV5.PublishTimeout }}"
+
+  # Terminate on connect error.
+  #
+  # When set to true, instead of re-trying to connect, the mioty BSSCI Adapter
+  # process will be terminated on a connection error.
+  terminate_on_connect_error={{ .Integration.MQTTV5.TerminateOnConnectError }}
+
+  # Session expiry interval.
+  #
+  # Time the broker keeps the session, including subscriptions and queued
+  # messages, after the connection is lost. 0 ends the session with the connection.
+  session_expiry_interval="{{ .Integration.MQTTV5.SessionExpiryInterval }}"
+
+  # Command result timeout.
+  #
+  # Maximum time to wait for the result of a command with a response topic.
+  command_result_timeout="{{ .Integration.MQTTV5.CommandResultTimeout }}"
+
+  # Topic alias events.
+  #
+  # Events of these types are published using topic aliases if the broker
+  # supports them, reducing the size of high volume messages. Aliases are only
+  # used with qos 0.
+  topic_alias_events=[{{ range $index, $elm := .Integration.MQTTV5.TopicAliasEvents }}
+    "{{ $elm }}",{{ end }}
+  ]
+
+  # State retained.
+  #
+  # By default this value is set to true and states are published as retained
+  # MQTT messages.
+  state_retained={{ .Integration.MQTTV5.StateRetained }}
+
+  # State topic template, see [integration.mqtt_v3].
+  state_topic_template = "{{ .Integration.MQTTV5.StateTopicTemplate }}"
+
+  # Event topic template, see [integration.mqtt_v3].
+  event_topic_template = "{{ .Integration.MQTTV5.EventTopicTemplate }}"
+
+  # Command topic template, see [integration.mqtt_v3].
+  command_topic_template = "{{ .Integration.MQTTV5.CommandTopicTemplate }}"
+
+  # Response topic template, see [integration.mqtt_v3].
+  response_topic_template = "{{ .Integration.MQTTV5.ResponseTopicTemplate }}"
+
+  # Events published as retained MQTT messages, see [integration.mqtt_v3].
+  retained_events=[{{ range $index, $elm := .Integration.MQTTV5.RetainedEvents }}"{{ $elm }}",{{ end }}]
+
+  # QoS of the command and response subscriptions, see [integration.mqtt_v3].
+  subscribe_qos={{ .Integration.MQTTV5.SubscribeQOS }}
+
+  # QoS per event type, see [integration.mqtt_v3].
+  [integration.mqtt_v5.event_qos]
+{{ range $event, $qos := .Integration.MQTTV5.EventQOS }}  {{ $event }}={{ $qos }}
+{{ end }}
+
+  # MQTT authentication.
+  [integration.mqtt_v5.auth]
+  # Type defines the MQTT authentication type to use.
+  #
+  # Set this to the name of one of the sections below.
+  type="{{ .Integration.MQTTV5.Auth.Type }}"
+
+    # Generic MQTT authentication.
+    [integration.mqtt_v5.auth.generic]
+    # MQTT servers.
+    #
+    # Configure one or multiple MQTT server to connect to. Each item must be in
+    # the following format: scheme://host:port where scheme is tcp, ssl, ws or wss.
+    servers=[{{ range $index, $elm := .Integration.MQTTV5.Auth.Generic.Servers }}
+      "{{ $elm }}",{{ end }}
+    ]
+
+    # Connect with the given username (optional)
+    username="{{ .Integration.MQTTV5.Auth.Generic.Username }}"
+
+    # Connect with the given password (optional)
+    password="{{ .Integration.MQTTV5.Auth.Generic.Password }}"
+
+    # Quality of service level
+    qos={{ .Integration.MQTTV5.Auth.Generic.QOS }}
+
+    # Clean start
+    #
+    # Discard an existing session on the first connection. Reconnects always
+    # resume the session.
+    clean_start={{ .Integration.MQTTV5.Auth.Generic.CleanStart }}
+
+    # Client ID
+    #
+    # When left blank, the broker assigns an id. If set to a basestation EUI64 the
+    # integration only serves this basestation and sets an OFFLINE state as will.
+    client_id="{{ .Integration.MQTTV5.Auth.Generic.ClientID }}"
+
+    # CA certificate file (optional)
+    ca_cert="{{ .Integration.MQTTV5.Auth.Generic.CACert }}"
+
+    # mqtt TLS certificate file (optional)
+    tls_cert="{{ .Integration.MQTTV5.Auth.Generic.TLSCert }}"
+
+    # mqtt TLS key file (optional)
+    tls_key="{{ .Integration.MQTTV5.Auth.Generic.TLSKey }}"
+
+  # Webhook integration configuration.
+  #
+  # Events and states are POSTed to the configured URLs using the payload
+  # marshaler. Requests carry the X-Bssci-Bs-Eui, X-Bssci-Event-Source and
+  # X-Bssci-Event-Type headers. Failed requests are retried on network errors,
+  # 429 and 5xx responses.
+  [integration.webhook]
+
+  # Event URL template.
+  #
+  # Templated like the MQTT event topic, with the BsEui, EventSource and
+  # EventType fields.
+  event_url_template="{{ .Integration.Webhook.EventURLTemplate }}"
+
+  # State URL template.
+  #
+  # Templated like the MQTT state topic, with the BsEui field. Leave blank to
+  # not publish states.
+  state_url_template="{{ .Integration.Webhook.StateURLTemplate }}"
+
+  # Timeout of a single request.
+  timeout="{{ .Integration.Webhook.Timeout }}"
+
+  # Maximum number of retries of a failed request.
+  max_retries={{ .Integration.Webhook.MaxRetries }}
+
+  # Delay before the first retry, doubled with each further retry. Must be
+  # positive, as is the maximum delay.
+  retry_backoff="{{ .Integration.Webhook.RetryBackoff }}"
+
+  # Maximum delay between retries.
+  max_retry_backoff="{{ .Integration.Webhook.MaxRetryBackoff }}"
+
+  # Signing secret (optional).
+  #
+  # When set, requests carry a X-Bssci-Timestamp header with the unix time and
+  # a X-Bssci-Signature header "sha256=<hex>" with the HMAC-SHA256 of the
+  # timestamp, a dot and the body. Requests to the inbound endpoint must be
+  # signed the same way. Without it the inbound endpoint accepts unsigned
+  # commands, only bind it to a loopback address then.
+  signing_secret="{{ .Integration.Webhook.SigningSecret }}"
+
+  # CA certificate file (optional)
+  ca_cert="{{ .Integration.Webhook.CACert }}"
+
+  # Client TLS certificate file (optional)
+  tls_cert="{{ .Integration.Webhook.TLSCert }}"
+
+  # Client TLS key file (optional)
+  tls_key="{{ .Integration.Webhook.TLSKey }}"
+
+    # Inbound endpoint.
+    #
+    # Accepts server commands on POST /command and server responses on
+    # POST /response, encoded as set by the Content-Type header or the payload
+    # marshaler.
+    [integration.webhook.inbound]
+    # The ip:port to bind the inbound endpoint to. Leave blank to disable.
+    bind="{{ .Integration.Webhook.Inbound.Bind }}"
+
+    # TLS certificate file (optional)
+    tls_cert="{{ .Integration.Webhook.Inbound.TLSCert }}"
+
+    # TLS key file (optional)
+    tls_key="{{ .Integration.Webhook.Inbound.TLSKey }}"
+
+  # gRPC integration configuration.
+  #
+  # Serves the bssci.Adapter service defined in api/proto/bssci/stream.proto.
+  # Subscribers open a bidirectional stream, send a Subscribe message with the
+  # basestation EUIs of interest and receive their events and states. Commands
+  # and responses sent on the stream are accepted for connected basestations.
+  [integration.grpc]
+  # The ip:port to bind the gRPC server to.
+  #
+  # Subscribers can send commands for the connected basestations. Only bind to
+  # a public interface with ca_cert set, so that subscribers are authenticated.
+  bind="{{ .Integration.GRPC.Bind }}"
+
+  # TLS certificate file (optional)
+  tls_cert="{{ .Integration.GRPC.TLSCert }}"
+
+  # TLS key file (optional)
+  tls_key="{{ .Integration.GRPC.TLSKey }}"
+
+  # CA certificate file (optional)
+  #
+  # When set, subscribers must present a client certificate signed by this CA.
+  ca_cert="{{ .Integration.GRPC.CACert }}"
+
+  # Number of messages queued per stream.
+  #
+  # Messages for a subscriber that does not keep up are dropped once exceeded.
+  # Must be at least 1.
+  send_queue_size={{ .Integration.GRPC.SendQueueSize }}
+
+  # NATS integration configuration.
+  #
+  # Events and states are published to subjects derived from the templates
+  # below, with the same fields as the MQTT topic templates. Messages carry the
+  # Content-Type, Bssci-Bs-Eui, Bssci-Event-Source and Bssci-Event-Type headers.
+  # Commands and responses are received on the subjects of the connected
+  # basestations.
+  [integration.nats]
+  # NATS servers, e.g. nats://host:4222 or tls://host:4222.
+  servers=[{{ range $index, $elm := .Integration.NATS.Servers }}
+    "{{ $elm }}",{{ end }}
+  ]
+
+  # Connection name reported to the server.
+  name="{{ .Integration.NATS.Name }}"
+
+  # Connect with the given username and password (optional)
+  username="{{ .Integration.NATS.Username }}"
+  password="{{ .Integration.NATS.Password }}"
+
+  # Connect with the given token (optional)
+  token="{{ .Integration.NATS.Token }}"
+
+  # Connect with the given credentials file, containing the user JWT and nkey
+  # seed (optional)
+  credentials_file="{{ .Integration.NATS.CredentialsFile }}"
+
+  # CA certificate file (optional)
+  ca_cert="{{ .Integration.NATS.CACert }}"
+
+  # TLS certificate file (optional)
+  tls_cert="{{ .Integration.NATS.TLSCert }}"
+
+  # TLS key file (optional)
+  tls_key="{{ .Integration.NATS.TLSKey }}"
+
+  # Timeout of a connection attempt.
+  connect_timeout="{{ .Integration.NATS.ConnectTimeout }}"
+
+  # Delay between connection attempts.
+  reconnect_wait="{{ .Integration.NATS.ReconnectWait }}"
+
+  # Event subject template.
+  event_subject_template="{{ .Integration.NATS.EventSubjectTemplate }}"
+
+  # State subject template.
+  state_subject_template="{{ .Integration.NATS.StateSubjectTemplate }}"
+
+  # Command subject template.
+  command_subject_template="{{ .Integration.NATS.CommandSubjectTemplate }}"
+
+  # Response subject template.
+  response_subject_template="{{ .Integration.NATS.ResponseSubjectTemplate }}"
+
+    # JetStream.
+    #
+    # Events of the selected types are published to a JetStream stream. Each
+    # publish waits for the acknowledgement of the server, messages that were not
+    # acknowledged are republished with the same message id until max_retries is
+    # exceeded, then the publish fails. The server discards duplicates within the
+    # duplicate window of the stream.
+    [integration.nats.jetstream]
+    # Publish events to JetStream.
+    enabled={{ .Integration.NATS.JetStream.Enabled }}
+
+    # Stream name.
+    stream="{{ .Integration.NATS.JetStream.Stream }}"
+
+    # Create or update the stream on start.
+    create_stream={{ .Integration.NATS.JetStream.CreateStream }}
+
+    # Subjects of the created stream.
+    stream_subjects=[{{ range $index, $elm := .Integration.NATS.JetStream.StreamSubjects }}
+      "{{ $elm }}",{{ end }}
+    ]
+
+    # Event types published to JetStream, other events use core NATS.
+    events=[{{ range $index, $elm := .Integration.NATS.JetStream.Events }}
+      "{{ $elm }}",{{ end }}
+    ]
+
+    # Maximum time to wait for an acknowledgement.
+    ack_timeout="{{ .Integration.NATS.JetStream.AckTimeout }}"
+
+    # Maximum number of publishes waiting for an acknowledgement.
+    max_pending={{ .Integration.NATS.JetStream.MaxPending }}
+
+    # Maximum number of republishes of a message.
+    max_retries={{ .Integration.NATS.JetStream.MaxRetries }}
+
+    # Delay before a message is republished.
+    retry_wait="{{ .Integration.NATS.JetStream.RetryWait }}"
+
+  # WebSocket integration configuration.
+  #
+  # Clients connect to ws://<bind><path> and receive events and states as JSON
+  # encoded bssci.AdapterMessage frames. The last state of each basestation is
+  # sent on connect. Commands are not accepted. Query parameters filter the
+  # events of a connection, each can be repeated or comma separated:
+  # * bs_eui:  basestation EUIs
+  # * ep_eui:  endnode EUIs, only applies to endnode events
+  # * event:   event types, e.g. ul or state
+  [integration.websocket]
+  # The ip:port to bind the WebSocket server to.
+  #
+  # Clients are not authenticated. Only bind to a public interface behind a
+  # proxy which authenticates them.
+  bind="{{ .Integration.WebSocket.Bind }}"
+
+  # The path of the WebSocket endpoint.
+  path="{{ .Integration.WebSocket.Path }}"
+
+  # TLS certificate file (optional)
+  tls_cert="{{ .Integration.WebSocket.TLSCert }}"
+
+  # TLS key file (optional)
+  tls_key="{{ .Integration.WebSocket.TLSKey }}"
+
+  # Allowed origins of browser clients, e.g. ["https://noc.example.com"].
+  #
+  # Only same origin requests are accepted when empty, "*" allows any origin.
+  allowed_origins=[{{ range $index, $elm := .Integration.WebSocket.AllowedOrigins }}"{{ $elm }}",{{ end }}]
+
+  # Number of messages buffered per client.
+  #
+  # Clients that do not keep up are disconnected once exceeded.
+  send_buffer_size={{ .Integration.WebSocket.SendBufferSize }}
+
+  # Timeout for writing a message to a client.
+  write_timeout="{{ .Integration.WebSocket.WriteTimeout }}"
+
+  # File integration configuration.
+  #
+  # Events and states are written as JSON encoded bssci.AdapterMessage lines.
+  # Server commands are read as JSON encoded bs.ServerCommand lines and accepted
+  # for connected basestations.
+  [integration.file]
+  # Output file, or stdout.
+  #
+  # Log messages are written to stderr and do not mix with the output.
+  output="{{ .Integration.File.Output }}"
+
+  # Maximum size of the output file in megabytes before it is rotated.
+  #
+  # Set to 0 to disable rotation. Does not apply to stdout.
+  max_size_mb={{ .Integration.File.MaxSizeMB }}
+
+  # Number of rotated files to keep, named <output>.1 to <output>.<max_backups>.
+  max_backups={{ .Integration.File.MaxBackups }}
+
+  # Named pipe or file to read commands from (optional).
+  #
+  # A file is followed like tail -f, lines written before the start are not read.
+  command_input="{{ .Integration.File.CommandInput }}"
+
+
 # Metrics configuration.
 [metrics]
 
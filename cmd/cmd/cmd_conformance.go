@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/conformance"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/simulator"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var conformanceOpts struct {
+	bind           string
+	tls            bool
+	timeout        time.Duration
+	connectTimeout time.Duration
+	endnodeEui     string
+	macType        uint32
+	cases          []string
+	simulate       bool
+	json           bool
+}
+
+var conformanceCmd = &cobra.Command{
+	Use:   "conformance [flags]",
+	Short: "Run BSSCI conformance tests against a basestation",
+	Long: `Conformance takes the role of the service center and runs a scripted suite of cases
+against the first basestation connecting to it: status polling, downlink queueing with
+plain and counter dependent data, revoke, attach and detach propagation, variable MAC
+activation and status, error handling in both directions and session resume.
+
+The basestation must connect instead of the adapter. The bind address and TLS
+certificates are taken from the backend section of the configuration file. For the
+resume case the connection is closed and the basestation has to reconnect.
+
+With --simulate the suite runs against the built-in basestation simulator, e.g. in CI.
+The command fails if a case fails.`,
+	Args: cobra.NoArgs,
+	RunE: runConformance,
+}
+
+func init() {
+	conformanceCmd.Flags().StringVar(&conformanceOpts.bind, "bind", "", "address to listen on, the backend bind address if empty")
+	conformanceCmd.Flags().BoolVar(&conformanceOpts.tls, "tls", true, "accept TLS connections")
+	conformanceCmd.Flags().DurationVar(&conformanceOpts.timeout, "timeout", 10*time.Second, "timeout of a single message exchange")
+	conformanceCmd.Flags().DurationVar(&conformanceOpts.connectTimeout, "connect-timeout", 5*time.Minute, "time to wait for the basestation to connect or reconnect")
+	conformanceCmd.Flags().StringVar(&conformanceOpts.endnodeEui, "endnode-eui", "0102030405060708", "EUI64 of the endnode used by the endnode operations")
+	conformanceCmd.Flags().Uint32Var(&conformanceOpts.macType, "mac-type", 1, "variable MAC type used by the vm case")
+	conformanceCmd.Flags().StringSliceVar(&conformanceOpts.cases, "cases", nil, fmt.Sprintf("cases to run, all if empty: %v", conformance.Cases()))
+	conformanceCmd.Flags().BoolVar(&conformanceOpts.simulate, "simulate", false, "run against a simulated basestation")
+	conformanceCmd.Flags().BoolVar(&conformanceOpts.json, "json", false, "print the report as json")
+}
+
+func runConformance(cmd *cobra.Command, args []string) error {
+	setLogLevel()
+
+	endnodeEui, err := common.Eui64FromHexString(conformanceOpts.endnodeEui)
+	if err != nil {
+		return errors.Wrap(err, "invalid endnode eui")
+	}
+
+	bind := conformanceOpts.bind
+	if bind == "" {
+		bind = config.C.Backend.BssciV1.Bind
+		if conformanceOpts.simulate {
+			bind = "127.0.0.1:0"
+		}
+	}
+	listener, err := newConformanceListener(bind)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	log.Info().Str("addr", listener.Addr().String()).Msg("waiting for basestation")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if conformanceOpts.simulate {
+		scenario, err := simulator.NewBenchScenario(simulator.BenchConfig{Basestations: 1, Endnodes: 1, Rate: 1, PayloadSize: 10})
+		if err != nil {
+			return err
+		}
+		basestation := simulator.NewBasestation(scenario.Basestations[0], log.Logger)
+
+		simCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go runSimulatedBasestation(simCtx, basestation, func() (net.Conn, error) {
+			return dialAdapter(listener.Addr().String(), conformanceOpts.tls, "", "", "")
+		}, time.Second)
+	}
+
+	report, err := conformance.Run(ctx, listener, conformance.Config{
+		Timeout:        conformanceOpts.timeout,
+		ConnectTimeout: conformanceOpts.connectTimeout,
+		Endnode:        endnodeEui,
+		MacType:        conformanceOpts.macType,
+		Cases:          conformanceOpts.cases,
+	}, log.Logger)
+	if err != nil {
+		return err
+	}
+	if err := printConformanceReport(report); err != nil {
+		return err
+	}
+	if failed := report.Failed(); failed != 0 {
+		return errors.Errorf("%d of %d cases failed", failed, len(report.Results))
+	}
+	return nil
+}
+
+// listen like the backend, the simulated basestation does not have a client certificate
+func newConformanceListener(bind string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", bind)
+	if err != nil {
+		return nil, errors.Wrap(err, "listen error")
+	}
+	if !conformanceOpts.tls {
+		return listener, nil
+	}
+
+	conf := config.C.Backend.BssciV1
+	tlsConfig := tls.Config{}
+	if conf.TLSCert != "" && conf.TLSKey != "" && !conformanceOpts.simulate {
+		tlsCert, err := tls.LoadX509KeyPair(conf.TLSCert, conf.TLSKey)
+		if err != nil {
+			listener.Close()
+			return nil, errors.Wrap(err, "read tls cert error")
+		}
+		tlsConfig.Certificates = []tls.Certificate{tlsCert}
+
+		if conf.CACert != "" {
+			rawCACert, err := os.ReadFile(conf.CACert)
+			if err != nil {
+				listener.Close()
+				return nil, errors.Wrap(err, "read ca cert error")
+			}
+			tlsConfig.ClientCAs = x509.NewCertPool()
+			tlsConfig.ClientCAs.AppendCertsFromPEM(rawCACert)
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else {
+		tlsCert, err := common.GenX509KeyPair()
+		if err != nil {
+			listener.Close()
+			return nil, errors.Wrap(err, "generate tls cert error")
+		}
+		tlsConfig.Certificates = []tls.Certificate{tlsCert}
+	}
+	return tls.NewListener(listener, &tlsConfig), nil
+}
+
+func printConformanceReport(report conformance.Report) error {
+	if conformanceOpts.json {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "basestation\t%s\n", report.BsEui)
+	fmt.Fprintf(w, "vendor\t%s\n", report.Vendor)
+	fmt.Fprintf(w, "model\t%s\n", report.Model)
+	fmt.Fprintf(w, "version\t%s\n", report.Version)
+	fmt.Fprintf(w, "duration\t%s\n\n", report.Duration.Round(time.Millisecond))
+	for _, result := range report.Results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Name, result.Status, result.Duration.Round(time.Millisecond), result.Error)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/capture"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Formats of frames on the command line
+const (
+	frameFormatAuto   = "auto"
+	frameFormatHex    = "hex"
+	frameFormatBase64 = "base64"
+	frameFormatBinary = "binary"
+)
+
+var decodeOpts struct {
+	file   string
+	format string
+	bsEui  string
+}
+
+var decodeCmd = &cobra.Command{
+	Use:   "decode [flags] [frame]",
+	Short: "Decode BSSCI frames",
+	Long: `Decode BSSCI frames including the MIOTYB01 header and print them as JSON.
+
+The frames are read from the argument, the file given by --file or stdin. They can be
+hex or base64 encoded, binary or a capture file written by the adapter. Consecutive
+frames are decoded one after another.
+
+For every frame the decoded message, the result of its validation and the protobuf
+message published by the adapter are printed.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: decode,
+}
+
+func init() {
+	decodeCmd.Flags().StringVarP(&decodeOpts.file, "file", "f", "", "read the frames from a file")
+	decodeCmd.Flags().StringVar(&decodeOpts.format, "format", frameFormatAuto, "input format: auto, hex, base64 or binary")
+	decodeCmd.Flags().StringVar(&decodeOpts.bsEui, "bs-eui", "", "basestation EUI64 used for the protobuf messages, taken from capture files if empty")
+}
+
+// A decoded frame as printed by the decode command
+type decodedFrame struct {
+	Ts         *time.Time      `json:"ts,omitempty"`
+	Direction  string          `json:"direction,omitempty"`
+	Command    string          `json:"command"`
+	OpId       int64           `json:"opId"`
+	Message    json.RawMessage `json:"message"`
+	Error      string          `json:"error,omitempty"`
+	Validation string          `json:"validation,omitempty"`
+	Proto      json.RawMessage `json:"proto,omitempty"`
+}
+
+func decode(cmd *cobra.Command, args []string) error {
+	input, err := readFrameInput(args, decodeOpts.file)
+	if err != nil {
+		return err
+	}
+	buf, err := parseFrameInput(input, decodeOpts.format)
+	if err != nil {
+		return err
+	}
+
+	var bsEui common.EUI64
+	if decodeOpts.bsEui != "" {
+		if bsEui, err = common.Eui64FromHexString(decodeOpts.bsEui); err != nil {
+			return errors.Wrap(err, "invalid bs eui")
+		}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	if !capture.IsCapture(buf) {
+		frames, err := bssci_v1.DecodeFrames(buf)
+		for i := range frames {
+			if err := enc.Encode(newDecodedFrame(&frames[i], bsEui)); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+
+	r, err := capture.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	if decodeOpts.bsEui == "" {
+		bsEui = r.Header().BasestationEui
+	}
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		frame, err := bssci_v1.DecodeFrame(record.Payload)
+		if err != nil {
+			return errors.Wrapf(err, "record at %s", record.Ts.Format(time.RFC3339Nano))
+		}
+		decoded := newDecodedFrame(&frame, bsEui)
+		decoded.Ts = &record.Ts
+		decoded.Direction = string(record.Direction)
+		if err := enc.Encode(decoded); err != nil {
+			return err
+		}
+	}
+}
+
+func newDecodedFrame(frame *bssci_v1.Frame, bsEui common.EUI64) decodedFrame {
+	decoded := decodedFrame{
+		Command: string(frame.Command),
+		OpId:    frame.OpId,
+	}
+
+	if frame.Message != nil {
+		decoded.Message, _ = json.Marshal(frame.Message)
+		if err := frame.Validate(); err != nil {
+			decoded.Validation = err.Error()
+		} else if pb := frame.Proto(bsEui); pb != nil {
+			decoded.Proto, _ = protojson.Marshal(pb)
+		}
+	} else {
+		decoded.Error = frame.Err.Error()
+		// fall back to a generic decoding of the message pack data
+		if data, err := frame.Data(); err == nil {
+			decoded.Message, _ = protojson.Marshal(data)
+		}
+	}
+	if decoded.Message == nil {
+		decoded.Message = json.RawMessage("null")
+	}
+	return decoded
+}
+
+// read the argument, the file or stdin
+func readFrameInput(args []string, file string) ([]byte, error) {
+	switch {
+	case file != "":
+		b, err := os.ReadFile(file)
+		return b, errors.Wrap(err, "read file error")
+	case len(args) != 0:
+		return []byte(args[0]), nil
+	default:
+		b, err := io.ReadAll(os.Stdin)
+		return b, errors.Wrap(err, "read stdin error")
+	}
+}
+
+// decode the input into binary frames
+func parseFrameInput(input []byte, format string) ([]byte, error) {
+	switch format {
+	case frameFormatBinary:
+		return input, nil
+	case frameFormatHex:
+		return parseHex(string(input))
+	case frameFormatBase64:
+		return parseBase64(string(input))
+	case frameFormatAuto:
+		if bytes.HasPrefix(input, []byte("MIOTYB01")) || capture.IsCapture(input) {
+			return input, nil
+		}
+		if b, err := parseHex(string(input)); err == nil {
+			return b, nil
+		}
+		if b, err := parseBase64(string(input)); err == nil {
+			return b, nil
+		}
+		return nil, errors.New("input is neither binary, hex nor base64")
+	default:
+		return nil, errors.Errorf("unknown format: %s", format)
+	}
+}
+
+// parse hex dumps, whitespace, commas, colons and 0x prefixes are ignored
+func parseHex(s string) ([]byte, error) {
+	s = strings.NewReplacer("0x", "", "0X", "", ",", "", ":", "").Replace(s)
+	s = strings.Join(strings.Fields(s), "")
+	b, err := hex.DecodeString(s)
+	return b, errors.Wrap(err, "decode hex error")
+}
+
+// parse standard or URL base64 with or without padding
+func parseBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.Join(strings.Fields(s), ""), "=")
+	if strings.ContainsAny(s, "-_") {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		return b, errors.Wrap(err, "decode base64 error")
+	}
+	b, err := base64.RawStdEncoding.DecodeString(s)
+	return b, errors.Wrap(err, "decode base64 error")
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var encodeOpts struct {
+	file   string
+	format string
+	output string
+}
+
+var encodeCmd = &cobra.Command{
+	Use:   "encode [flags] [json]",
+	Short: "Encode BSSCI frames",
+	Long: `Encode JSON messages into BSSCI frames including the MIOTYB01 header.
+
+The messages are read from the argument, the file given by --file or stdin. The input is
+a single message, an array of messages or a sequence of messages, e.g.
+
+  {"command": "ping", "opId": 1}
+
+The message fields use the same names as the messages printed by decode.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: encode,
+}
+
+func init() {
+	encodeCmd.Flags().StringVarP(&encodeOpts.file, "file", "f", "", "read the messages from a file")
+	encodeCmd.Flags().StringVar(&encodeOpts.format, "format", frameFormatHex, "output format: hex, base64 or binary")
+	encodeCmd.Flags().StringVarP(&encodeOpts.output, "output", "o", "", "write the frames to a file instead of stdout")
+}
+
+func encode(cmd *cobra.Command, args []string) error {
+	input, err := readFrameInput(args, encodeOpts.file)
+	if err != nil {
+		return err
+	}
+	messages, err := splitJsonMessages(input)
+	if err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	for i, msg := range messages {
+		frame, err := bssci_v1.EncodeFrame(msg)
+		if err != nil {
+			return errors.Wrapf(err, "message %d", i)
+		}
+
+		switch encodeOpts.format {
+		case frameFormatHex:
+			fmt.Fprintln(&out, hex.EncodeToString(frame))
+		case frameFormatBase64:
+			fmt.Fprintln(&out, base64.StdEncoding.EncodeToString(frame))
+		case frameFormatBinary:
+			out.Write(frame)
+		default:
+			return errors.Errorf("unknown format: %s", encodeOpts.format)
+		}
+	}
+
+	if encodeOpts.output != "" {
+		return errors.Wrap(os.WriteFile(encodeOpts.output, out.Bytes(), 0o644), "write file error")
+	}
+	_, err = out.WriteTo(os.Stdout)
+	return err
+}
+
+// split a message, an array of messages or a sequence of messages
+func splitJsonMessages(input []byte) ([]json.RawMessage, error) {
+	var messages []json.RawMessage
+
+	dec := json.NewDecoder(bytes.NewReader(input))
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "parse json error")
+		}
+
+		if trimmed := bytes.TrimSpace(raw); len(trimmed) != 0 && trimmed[0] == '[' {
+			var array []json.RawMessage
+			if err := json.Unmarshal(raw, &array); err != nil {
+				return nil, errors.Wrap(err, "parse json error")
+			}
+			messages = append(messages, array...)
+		} else {
+			messages = append(messages, raw)
+		}
+	}
+
+	if len(messages) == 0 {
+		return nil, errors.New("no messages")
+	}
+	return messages, nil
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/capture"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/tinylib/msgp/msgp"
+)
+
+var replayOpts struct {
+	addr    string
+	speed   float64
+	linger  time.Duration
+	timeout time.Duration
+	tls     bool
+	caCert  string
+	tlsCert string
+	tlsKey  string
+}
+
+var replayCmd = &cobra.Command{
+	Use:   "replay [flags] capture-file...",
+	Short: "Replay a captured basestation session against a mioty BSSCI Adapter",
+	Long: `Replay sends the frames a basestation sent during a captured session to a mioty BSSCI Adapter.
+
+The capture files of a session are replayed in the given order. Only the frames sent
+by the basestation are replayed, the adapter under test generates its own responses.
+
+The operations of the basestation are replayed in the captured timing, a completion is
+only sent once the adapter responded to the operation. Operations initiated by the
+adapter, e.g. pings and status requests, are answered with the captured response to an
+operation of the same command using the operation ID issued by the adapter.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: replay,
+}
+
+func init() {
+	replayCmd.Flags().StringVar(&replayOpts.addr, "addr", "127.0.0.1:5005", "address of the adapter")
+	replayCmd.Flags().Float64Var(&replayOpts.speed, "speed", 1, "speed factor, 1 replays at the original speed, 0 without delays")
+	replayCmd.Flags().DurationVar(&replayOpts.linger, "linger", 5*time.Second, "time to wait for responses after the last frame")
+	replayCmd.Flags().DurationVar(&replayOpts.timeout, "response-timeout", 5*time.Second, "time to wait for the adapter to respond to an operation before its completion is skipped")
+	replayCmd.Flags().BoolVar(&replayOpts.tls, "tls", true, "connect using TLS")
+	replayCmd.Flags().StringVar(&replayOpts.caCert, "ca-cert", "", "CA certificate to verify the adapter, the adapter is not verified if empty")
+	replayCmd.Flags().StringVar(&replayOpts.tlsCert, "tls-cert", "", "client certificate")
+	replayCmd.Flags().StringVar(&replayOpts.tlsKey, "tls-key", "", "client certificate key")
+}
+
+func replay(cmd *cobra.Command, args []string) error {
+	setLogLevel()
+
+	var records []capture.Record
+	var header capture.Header
+
+	for i, path := range args {
+		h, r, err := readCapture(path)
+		if err != nil {
+			return errors.Wrapf(err, "read capture %s error", path)
+		}
+		if i == 0 {
+			header = h
+		} else if h.BasestationEui != header.BasestationEui {
+			log.Warn().Str("file", path).Str("bs_eui", h.BasestationEui.String()).Msg("capture file belongs to a different basestation")
+		}
+		records = append(records, r...)
+	}
+
+	logger := log.With().Str("bs_eui", header.BasestationEui.String()).Str("addr", replayOpts.addr).Logger()
+	logger.Info().Time("session_start", header.SessionStart).Int("records", len(records)).Float64("speed", replayOpts.speed).Msg("replaying capture")
+
+	conn, err := dialAdapter(replayOpts.addr, replayOpts.tls, replayOpts.caCert, replayOpts.tlsCert, replayOpts.tlsKey)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	stats, err := bssci_v1.Replay(ctx, conn, records, bssci_v1.ReplayOptions{
+		Speed:           replayOpts.speed,
+		Linger:          replayOpts.linger,
+		ResponseTimeout: replayOpts.timeout,
+		OnReceive: func(cmd structs.CommandHeader, raw msgp.Raw) {
+			logger.Debug().Str("command", string(cmd.GetCommand())).Int64("op_id", cmd.GetOpId()).Msg("received frame")
+		},
+	})
+	logger.Info().Int("sent", stats.Sent).Int("received", stats.Received).Int("answered", stats.Answered).Int("unanswered", stats.Unanswered).Int("skipped", stats.Skipped).Msg("replay finished")
+	return err
+}
+
+func readCapture(path string) (capture.Header, []capture.Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return capture.Header{}, nil, err
+	}
+	defer f.Close()
+
+	r, err := capture.NewReader(f)
+	if err != nil {
+		return capture.Header{}, nil, err
+	}
+	records, err := r.ReadAll()
+	return r.Header(), records, err
+}
+
+// connect to an adapter like a basestation
+func dialAdapter(addr string, useTls bool, caCert string, tlsCert string, tlsKey string) (net.Conn, error) {
+	if !useTls {
+		conn, err := net.Dial("tcp", addr)
+		return conn, errors.Wrap(err, "dial error")
+	}
+
+	tlsConfig := tls.Config{}
+	if caCert != "" {
+		rawCACert, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, errors.Wrap(err, "read ca cert error")
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		tlsConfig.RootCAs.AppendCertsFromPEM(rawCACert)
+	} else {
+		// the adapter generates a self signed certificate if none is configured
+		tlsConfig.InsecureSkipVerify = true
+	}
+	if tlsCert != "" && tlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "read tls cert error")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tlsConfig)
+	return conn, errors.Wrap(err, "dial error")
+}
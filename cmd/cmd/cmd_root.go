@@ -54,8 +54,33 @@ func init() {
 	viper.SetDefault("backend.bssci_v1.stats_interval", time.Minute*5)
 	viper.SetDefault("backend.bssci_v1.ping_interval", time.Second*30)
 	viper.SetDefault("backend.bssci_v1.keep_alive_period", time.Minute)
+	viper.SetDefault("backend.bssci_v1.operation_timeout", time.Minute)
+	viper.SetDefault("backend.bssci_v1.min_version", "1.0.0")
+	viper.SetDefault("backend.bssci_v1.max_version", "1.0.0")
+
+	viper.SetDefault("backend.bssci_v1.flap_detection.enabled", false)
+	viper.SetDefault("backend.bssci_v1.flap_detection.window", time.Minute*10)
+	viper.SetDefault("backend.bssci_v1.flap_detection.threshold", 5)
+	viper.SetDefault("backend.bssci_v1.flap_detection.stable_period", time.Minute*5)
+	viper.SetDefault("backend.bssci_v1.flap_detection.quarantine", false)
+
+	viper.SetDefault("backend.bssci_v1.raw.enabled", false)
+	viper.SetDefault("backend.bssci_v1.raw.format", "json")
+	viper.SetDefault("backend.bssci_v1.raw.commands", []string{})
+
+	viper.SetDefault("backend.bssci_v1.capture.enabled", false)
+	viper.SetDefault("backend.bssci_v1.capture.directory", "/var/lib/mioty-bssci-adapter/capture")
+	viper.SetDefault("backend.bssci_v1.capture.max_size", 10*1024*1024)
+	viper.SetDefault("backend.bssci_v1.capture.max_files", 100)
+
+	viper.SetDefault("backend.bssci_v1.publish_confirmation.enabled", false)
+	viper.SetDefault("backend.bssci_v1.publish_confirmation.timeout", time.Second*5)
 
 	// mqtt_v3 integration
+	viper.SetDefault("integration.type", "mqtt_v3")
+	viper.SetDefault("integration.types", []string{})
+	viper.SetDefault("integration.required", []string{})
+	viper.SetDefault("integration.optional_queue_size", 1000)
 	viper.SetDefault("integration.marshaler", "protobuf")
 
 	viper.SetDefault("integration.mqtt_v3.state_retained", true)
@@ -63,6 +88,8 @@ func init() {
 	viper.SetDefault("integration.mqtt_v3.max_reconnect_interval", time.Minute)
 	viper.SetDefault("integration.mqtt_v3.max_token_wait", time.Minute)
 	viper.SetDefault("integration.mqtt_v3.terminate_on_connect_error", false)
+	viper.SetDefault("integration.mqtt_v3.retained_events", []string{})
+	viper.SetDefault("integration.mqtt_v3.subscribe_qos", -1)
 
 	// mqtt_v3 topic templates
 	viper.SetDefault("integration.mqtt_v3.event_topic_template", "bssci/{{ .BsEui }}/event/{{ .EventSource }}/{{ .EventType }}")
@@ -75,8 +102,93 @@ func init() {
 	viper.SetDefault("integration.mqtt_v3.auth.generic.servers", []string{"tcp://127.0.0.1:1883"})
 	viper.SetDefault("integration.mqtt_v3.auth.generic.clean_session", true)
 
+	// mqtt_v5 integration
+	viper.SetDefault("integration.mqtt_v5.state_retained", true)
+	viper.SetDefault("integration.mqtt_v5.keep_alive", 30*time.Second)
+	viper.SetDefault("integration.mqtt_v5.connect_retry_delay", 10*time.Second)
+	viper.SetDefault("integration.mqtt_v5.connect_timeout", 10*time.Second)
+	viper.SetDefault("integration.mqtt_v5.publish_timeout", time.Minute)
+	viper.SetDefault("integration.mqtt_v5.terminate_on_connect_error", false)
+	viper.SetDefault("integration.mqtt_v5.session_expiry_interval", time.Duration(0))
+	viper.SetDefault("integration.mqtt_v5.command_result_timeout", time.Minute)
+	viper.SetDefault("integration.mqtt_v5.topic_alias_events", []string{"ul"})
+	viper.SetDefault("integration.mqtt_v5.retained_events", []string{})
+	viper.SetDefault("integration.mqtt_v5.subscribe_qos", -1)
+
+	// mqtt_v5 topic templates
+	viper.SetDefault("integration.mqtt_v5.event_topic_template", "bssci/{{ .BsEui }}/event/{{ .EventSource }}/{{ .EventType }}")
+	viper.SetDefault("integration.mqtt_v5.command_topic_template", "bssci/{{ .BsEui }}/command/#")
+	viper.SetDefault("integration.mqtt_v5.response_topic_template", "bssci/{{ .BsEui }}/response/#")
+	viper.SetDefault("integration.mqtt_v5.state_topic_template", "bssci/{{ .BsEui }}/state")
+
+	viper.SetDefault("integration.mqtt_v5.auth.type", "generic")
+	viper.SetDefault("integration.mqtt_v5.auth.generic.servers", []string{"tcp://127.0.0.1:1883"})
+	viper.SetDefault("integration.mqtt_v5.auth.generic.clean_start", true)
+
+	// webhook integration
+	viper.SetDefault("integration.webhook.event_url_template", "http://127.0.0.1:8090/bssci/{{ .BsEui }}/event/{{ .EventSource }}/{{ .EventType }}")
+	viper.SetDefault("integration.webhook.state_url_template", "http://127.0.0.1:8090/bssci/{{ .BsEui }}/state")
+	viper.SetDefault("integration.webhook.timeout", 10*time.Second)
+	viper.SetDefault("integration.webhook.max_retries", 5)
+	viper.SetDefault("integration.webhook.retry_backoff", time.Second)
+	viper.SetDefault("integration.webhook.max_retry_backoff", 30*time.Second)
+	viper.SetDefault("integration.webhook.inbound.bind", "")
+
+	// grpc integration
+	viper.SetDefault("integration.grpc.bind", "127.0.0.1:8091")
+	viper.SetDefault("integration.grpc.send_queue_size", 1000)
+
+	// nats integration
+	viper.SetDefault("integration.nats.servers", []string{"nats://127.0.0.1:4222"})
+	viper.SetDefault("integration.nats.name", "mioty-bssci-adapter")
+	viper.SetDefault("integration.nats.connect_timeout", 2*time.Second)
+	viper.SetDefault("integration.nats.reconnect_wait", 2*time.Second)
+
+	// nats subject templates
+	viper.SetDefault("integration.nats.event_subject_template", "bssci.{{ .BsEui }}.event.{{ .EventSource }}.{{ .EventType }}")
+	viper.SetDefault("integration.nats.state_subject_template", "bssci.{{ .BsEui }}.state")
+	viper.SetDefault("integration.nats.command_subject_template", "bssci.{{ .BsEui }}.command.>")
+	viper.SetDefault("integration.nats.response_subject_template", "bssci.{{ .BsEui }}.response.>")
+
+	viper.SetDefault("integration.nats.jetstream.enabled", false)
+	viper.SetDefault("integration.nats.jetstream.stream", "BSSCI")
+	viper.SetDefault("integration.nats.jetstream.create_stream", true)
+	viper.SetDefault("integration.nats.jetstream.stream_subjects", []string{"bssci.*.event.>"})
+	viper.SetDefault("integration.nats.jetstream.events", []string{"ul"})
+	viper.SetDefault("integration.nats.jetstream.ack_timeout", 5*time.Second)
+	viper.SetDefault("integration.nats.jetstream.max_pending", 4000)
+	viper.SetDefault("integration.nats.jetstream.max_retries", 5)
+	viper.SetDefault("integration.nats.jetstream.retry_wait", time.Second)
+
+	// websocket integration
+	viper.SetDefault("integration.websocket.bind", "127.0.0.1:8092")
+	viper.SetDefault("integration.websocket.path", "/events")
+	viper.SetDefault("integration.websocket.send_buffer_size", 256)
+	viper.SetDefault("integration.websocket.write_timeout", 10*time.Second)
+
+	// file integration
+	viper.SetDefault("integration.file.output", "stdout")
+	viper.SetDefault("integration.file.max_size_mb", 100)
+	viper.SetDefault("integration.file.max_backups", 5)
+
+	// store-and-forward
+	viper.SetDefault("integration.store_forward.dir", "/var/lib/mioty-bssci-adapter/queue")
+	viper.SetDefault("integration.store_forward.max_size_mb", 256)
+	viper.SetDefault("integration.store_forward.segment_size_mb", 8)
+	viper.SetDefault("integration.store_forward.max_age", 24*time.Hour)
+	viper.SetDefault("integration.store_forward.retry_interval", 2*time.Second)
+	viper.SetDefault("integration.store_forward.sync_writes", true)
+
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(replayCmd)
+	rootCmd.AddCommand(simulateCmd)
+	rootCmd.AddCommand(benchCmd)
+	rootCmd.AddCommand(decodeCmd)
+	rootCmd.AddCommand(encodeCmd)
+	rootCmd.AddCommand(tailCmd)
+	rootCmd.AddCommand(commandCmd)
+	rootCmd.AddCommand(conformanceCmd)
 }
 
 func initConfig() {
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/simulator"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var simulateOpts struct {
+	addr           string
+	tls            bool
+	caCert         string
+	tlsCert        string
+	tlsKey         string
+	reconnectDelay time.Duration
+}
+
+var simulateCmd = &cobra.Command{
+	Use:   "simulate [flags] scenario-file",
+	Short: "Simulate BSSCI basestations connecting to a mioty BSSCI Adapter",
+	Long: `Simulate connects one or more simulated basestations to a mioty BSSCI Adapter.
+
+Each basestation performs the connect operation, answers the operations of the adapter
+and sends the traffic configured in the scenario file (toml, yaml or json), e.g.
+
+  [[basestations]]
+  eui="0102030405060708"
+  vendor="simulator"
+  bidi=true
+
+    [[basestations.traffic]]
+    type="ulData"
+    endnode="1112131415161718"
+    interval="10s"
+    count=0
+    payload="cafe"
+    snr=10.5
+    rssi=-90
+
+Supported traffic types are att, ulData, dlRxStat and vm.ulData.`,
+	Args: cobra.ExactArgs(1),
+	RunE: simulate,
+}
+
+func init() {
+	simulateCmd.Flags().StringVar(&simulateOpts.addr, "addr", "127.0.0.1:5005", "address of the adapter")
+	simulateCmd.Flags().BoolVar(&simulateOpts.tls, "tls", true, "connect using TLS")
+	simulateCmd.Flags().StringVar(&simulateOpts.caCert, "ca-cert", "", "CA certificate to verify the adapter, the adapter is not verified if empty")
+	simulateCmd.Flags().StringVar(&simulateOpts.tlsCert, "tls-cert", "", "client certificate")
+	simulateCmd.Flags().StringVar(&simulateOpts.tlsKey, "tls-key", "", "client certificate key")
+	simulateCmd.Flags().DurationVar(&simulateOpts.reconnectDelay, "reconnect-delay", 5*time.Second, "delay before reconnecting a basestation")
+}
+
+func simulate(cmd *cobra.Command, args []string) error {
+	setLogLevel()
+
+	scenario, err := simulator.LoadScenario(args[0])
+	if err != nil {
+		return errors.Wrap(err, "load scenario error")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for _, config := range scenario.Basestations {
+		bs := simulator.NewBasestation(config, log.Logger)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runSimulatedBasestation(ctx, bs, func() (net.Conn, error) {
+				return dialAdapter(simulateOpts.addr, simulateOpts.tls, simulateOpts.caCert, simulateOpts.tlsCert, simulateOpts.tlsKey)
+			}, simulateOpts.reconnectDelay)
+		}()
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// run the basestation and reconnect until the context is done, returns the number of failed sessions
+func runSimulatedBasestation(ctx context.Context, bs *simulator.Basestation, dial func() (net.Conn, error), reconnectDelay time.Duration) (failed int) {
+	logger := log.With().Str("bs_eui", bs.Eui().String()).Logger()
+
+	for {
+		conn, err := dial()
+		if err == nil {
+			err = bs.Run(ctx, conn)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		failed++
+		logger.Error().Err(err).Dur("reconnect_delay", reconnectDelay).Msg("basestation disconnected")
+
+		select {
+		case <-time.After(reconnectDelay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/mqtt"
+
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var tailOpts struct {
+	bsEui     string
+	source    string
+	eventType string
+	events    bool
+	state     bool
+	json      bool
+}
+
+var tailCmd = &cobra.Command{
+	Use:   "tail [flags]",
+	Short: "Print the events published by a mioty BSSCI Adapter",
+	Long: `Tail subscribes to the event and state topics on the MQTT broker configured in the
+configuration file, decodes the published messages with the configured marshaler and
+prints them as human-readable or JSON lines.`,
+	Args: cobra.NoArgs,
+	RunE: tail,
+}
+
+func init() {
+	tailCmd.Flags().StringVar(&tailOpts.bsEui, "bs-eui", "", "only show messages of this basestation")
+	tailCmd.Flags().StringVar(&tailOpts.source, "source", "", "only show events of this source: ep or bs")
+	tailCmd.Flags().StringVar(&tailOpts.eventType, "type", "", "only show events of this type, e.g. ul")
+	tailCmd.Flags().BoolVar(&tailOpts.events, "events", true, "subscribe to the event topics")
+	tailCmd.Flags().BoolVar(&tailOpts.state, "state", true, "subscribe to the state topics")
+	tailCmd.Flags().BoolVar(&tailOpts.json, "json", false, "print JSON lines")
+}
+
+// A received message as printed by the tail command
+type tailMessage struct {
+	Ts      time.Time       `json:"ts"`
+	Topic   string          `json:"topic"`
+	Kind    string          `json:"kind"`
+	BsEui   string          `json:"bsEui,omitempty"`
+	Source  string          `json:"source,omitempty"`
+	Type    string          `json:"type,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+	Error   string          `json:"error,omitempty"`
+}
+
+func tail(cmd *cobra.Command, args []string) error {
+	setLogLevel()
+
+	conf := config.C.Integration
+	unmarshal, err := mqtt.Unmarshaler(conf.Marshaler)
+	if err != nil {
+		return err
+	}
+
+	filter := map[string]string{
+		mqtt.TopicFieldBsEui:       tailOpts.bsEui,
+		mqtt.TopicFieldEventSource: tailOpts.source,
+		mqtt.TopicFieldEventType:   tailOpts.eventType,
+	}
+
+	// message type of each subscription
+	type subscription struct {
+		matcher *mqtt.TopicMatcher
+		state   bool
+	}
+	subscriptions := make(map[string]subscription)
+	if tailOpts.events {
+		topic, err := mqtt.SubscriptionTopic(conf.MQTTV3.EventTopicTemplate, filter)
+		if err != nil {
+			return err
+		}
+		matcher, err := mqtt.NewTopicMatcher(conf.MQTTV3.EventTopicTemplate)
+		if err != nil {
+			return err
+		}
+		subscriptions[topic] = subscription{matcher: matcher}
+	}
+	if tailOpts.state && conf.MQTTV3.StateTopicTemplate != "" {
+		topic, err := mqtt.SubscriptionTopic(conf.MQTTV3.StateTopicTemplate, filter)
+		if err != nil {
+			return err
+		}
+		matcher, err := mqtt.NewTopicMatcher(conf.MQTTV3.StateTopicTemplate)
+		if err != nil {
+			return err
+		}
+		subscriptions[topic] = subscription{matcher: matcher, state: true}
+	}
+	if len(subscriptions) == 0 {
+		return errors.New("nothing to subscribe")
+	}
+
+	client, err := newMqttClient(config.C, "tail")
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(250)
+
+	for topic, sub := range subscriptions {
+		token := client.Subscribe(topic, conf.MQTTV3.Auth.Generic.QOS, func(c paho.Client, msg paho.Message) {
+			values, _ := sub.matcher.Match(msg.Topic())
+			printTailMessage(decodeTailMessage(msg, values, sub.state, unmarshal))
+		})
+		if err := waitToken(token, conf.MQTTV3.MaxTokenWait); err != nil {
+			return errors.Wrapf(err, "subscribe %s error", topic)
+		}
+		log.Info().Str("topic", topic).Msg("subscribed")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	return nil
+}
+
+// decode the payload by the source and type of the topic
+func decodeTailMessage(msg paho.Message, values map[string]string, state bool, unmarshal func([]byte, proto.Message) error) tailMessage {
+	m := tailMessage{
+		Ts:     time.Now(),
+		Topic:  msg.Topic(),
+		Kind:   "event",
+		BsEui:  values[mqtt.TopicFieldBsEui],
+		Source: values[mqtt.TopicFieldEventSource],
+		Type:   values[mqtt.TopicFieldEventType],
+	}
+
+	var pb proto.Message
+	switch {
+	case state:
+		m.Kind = "state"
+		pb = &bs.BasestationState{}
+	case m.Source == mqtt.EventSourceEndpoint:
+		pb = &bs.EndnodeUplink{}
+	case m.Source == mqtt.EventSourceBasestation && events.IsAdapterEvent(events.EventType(m.Type)):
+		pb = &structpb.Struct{}
+	case m.Source == mqtt.EventSourceBasestation:
+		pb = &bs.BasestationUplink{}
+	}
+
+	var err error
+	if pb == nil {
+		err = errors.New("unknown message type")
+	} else if err = unmarshal(msg.Payload(), pb); err == nil {
+		m.Payload, err = protojson.Marshal(pb)
+	}
+	if err != nil {
+		m.Error = err.Error()
+		m.Payload, _ = json.Marshal(base64.StdEncoding.EncodeToString(msg.Payload()))
+	}
+	return m
+}
+
+var tailPrintMux sync.Mutex
+
+// print a message as JSON or human-readable line
+func printTailMessage(m tailMessage) {
+	tailPrintMux.Lock()
+	defer tailPrintMux.Unlock()
+
+	if tailOpts.json {
+		json.NewEncoder(os.Stdout).Encode(m)
+		return
+	}
+
+	kind := m.Kind
+	if m.Kind == "event" {
+		kind = m.Source + "/" + m.Type
+	}
+	line := fmt.Sprintf("%s %s %s %s", m.Ts.Format(time.RFC3339Nano), m.BsEui, kind, m.Payload)
+	if m.Error != "" {
+		line += " error: " + m.Error
+	}
+	fmt.Println(line)
+}
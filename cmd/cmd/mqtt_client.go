@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/auth"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pkg/errors"
+)
+
+// connect to the MQTT broker of the adapter configuration
+func newMqttClient(conf config.Config, name string) (paho.Client, error) {
+	authentication, err := auth.NewGenericAuthentication(conf)
+	if err != nil {
+		return nil, errors.Wrap(err, "new generic authentication error")
+	}
+	opts := paho.NewClientOptions()
+	if err := authentication.Init(opts); err != nil {
+		return nil, errors.Wrap(err, "init authentication error")
+	}
+	// must not take over the session of the adapter
+	opts.SetClientID(fmt.Sprintf("mioty-bssci-adapter-%s-%d", name, time.Now().UnixNano()))
+	opts.SetCleanSession(true)
+	opts.SetProtocolVersion(4)
+
+	client := paho.NewClient(opts)
+	if err := waitToken(client.Connect(), conf.Integration.MQTTV3.MaxTokenWait); err != nil {
+		return nil, errors.Wrap(err, "mqtt connect error")
+	}
+	return client, nil
+}
+
+func waitToken(token paho.Token, timeout time.Duration) error {
+	if !token.WaitTimeout(timeout) {
+		return errors.New("token wait timeout error")
+	}
+	return token.Error()
+}
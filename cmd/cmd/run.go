@@ -4,6 +4,7 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
@@ -17,6 +18,9 @@ import (
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/metrics"
 )
 
+// time to wait for the events of the closed connections to be published on shutdown
+const forwarderShutdownTimeout = 5 * time.Second
+
 func run(cmd *cobra.Command, args []string) error {
 
 	tasks := []func() error{
@@ -42,6 +46,14 @@ func run(cmd *cobra.Command, args []string) error {
 	log.Info().Any("signal", <-sigChan).Msg("signal received")
 	log.Warn().Msg("shutting down server")
 
+	// close the basestation connections and publish their disconnect events before
+	// the integration goes offline
+	if err := backend.GetBackend().Stop(); err != nil {
+		log.Error().Err(err).Msg("stop backend error")
+	}
+	if !forwarder.Wait(forwarderShutdownTimeout) {
+		log.Warn().Msg("timeout while waiting for events to be published")
+	}
 	integration.GetIntegration().Stop()
 
 	return nil
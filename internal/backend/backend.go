@@ -54,6 +54,12 @@ type Backend interface {
 	// Set handler for messages from endnodes
 	SetEndnodeMessageHandler(func(common.EUI64, events.EventType, *bs.EndnodeUplink))
 
+	// Set handler for messages from endnodes which returns once the message is published
+	SetConfirmedEndnodeMessageHandler(func(common.EUI64, events.EventType, *bs.EndnodeUplink) error)
+
+	// Set handler for events generated by the adapter
+	SetAdapterEventHandler(func(common.EUI64, events.AdapterEvent))
+
 	// Handler for server command messages
 	HandleServerCommand(*bs.ServerCommand) error
 
@@ -18,6 +18,7 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/capture"
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs/messages"
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
@@ -25,6 +26,11 @@ import (
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
 )
 
+const (
+	// maximum time to wait for the basestation sessions to close on shutdown
+	shutdownTimeout = 5 * time.Second
+)
+
 type Backend struct {
 	sync.RWMutex
 
@@ -34,6 +40,8 @@ type Backend struct {
 
 	listener net.Listener
 	isClosed bool
+	// active basestation sessions
+	sessions sync.WaitGroup
 
 	basestations basestations
 
@@ -41,9 +49,33 @@ type Backend struct {
 	pingInterval    time.Duration
 	keepAlivePeriod time.Duration
 	writeTimeout    time.Duration
+	// timeout for open operations, 0 disables the operation tracking
+	operationTimeout time.Duration
+	// protocol versions accepted from basestations
+	versions structs.VersionRange
 
 	basestationMessageHandler func(common.EUI64, events.EventType, *bs.BasestationUplink)
 	endnodeMessageHandler     func(common.EUI64, events.EventType, *bs.EndnodeUplink)
+	adapterEventHandler       func(common.EUI64, events.AdapterEvent)
+
+	// handler for uplinks which are acknowledged after the publish, nil if disabled
+	confirmedEndnodeMessageHandler func(common.EUI64, events.EventType, *bs.EndnodeUplink) error
+	// publish confirmation enabled
+	confirmPublish bool
+	// maximum time to wait for a publish confirmation
+	confirmTimeout time.Duration
+	// confirmed publishes of uplinks
+	publishes *publishes
+
+	// flap detection, nil if disabled
+	flapDetector *flapDetector
+	// delay the subscription of flapping basestations until they are stable
+	flapQuarantine bool
+
+	// raw frame publishing, nil if disabled
+	rawFrames *rawFrames
+	// session capture, nil if disabled
+	capture *capture.Options
 
 	// cache for storing pending attPrp/detPrp requests
 	// key: BasestationEUI_opId value EndnodeEUI
@@ -64,9 +96,42 @@ func NewBackend(conf config.Config) (backend *Backend, err error) {
 		keepAlivePeriod: conf.Backend.BssciV1.KeepAlivePeriod,
 		writeTimeout:    time.Second,
 
+		operationTimeout: conf.Backend.BssciV1.OperationTimeout,
+
+		confirmPublish: conf.Backend.BssciV1.PublishConfirmation.Enabled,
+		confirmTimeout: conf.Backend.BssciV1.PublishConfirmation.Timeout,
+		publishes:      newPublishes(),
+
 		propagationCache: cache.New(time.Minute, time.Minute),
 	}
 
+	b.versions, err = structs.NewVersionRange(conf.Backend.BssciV1.MinVersion, conf.Backend.BssciV1.MaxVersion)
+	if err != nil {
+		return nil, errors.Wrap(err, "supported version range error")
+	}
+
+	if flap := conf.Backend.BssciV1.FlapDetection; flap.Enabled {
+		b.flapDetector, err = newFlapDetector(flap.Window, flap.Threshold, flap.StablePeriod)
+		if err != nil {
+			return nil, errors.Wrap(err, "flap detection error")
+		}
+		b.flapQuarantine = flap.Quarantine
+	}
+
+	if raw := conf.Backend.BssciV1.Raw; raw.Enabled {
+		b.rawFrames, err = newRawFrames(raw.Format, raw.Commands)
+		if err != nil {
+			return nil, errors.Wrap(err, "raw frame publishing error")
+		}
+	}
+
+	if c := conf.Backend.BssciV1.Capture; c.Enabled {
+		if err := os.MkdirAll(c.Directory, 0o750); err != nil {
+			return nil, errors.Wrap(err, "create capture directory error")
+		}
+		b.capture = &capture.Options{Directory: c.Directory, MaxSize: c.MaxSize, MaxFiles: c.MaxFiles}
+	}
+
 	// create the listener
 	b.listener, err = NewTcpKeepAliveListener(conf.Backend.BssciV1.Bind, b.keepAlivePeriod)
 	if err != nil {
@@ -125,6 +190,16 @@ func (b *Backend) SetEndnodeMessageHandler(f func(common.EUI64, events.EventType
 	b.endnodeMessageHandler = f
 }
 
+// Handler for uplink messages from endnodes, returns once the message is published
+func (b *Backend) SetConfirmedEndnodeMessageHandler(f func(common.EUI64, events.EventType, *bs.EndnodeUplink) error) {
+	b.confirmedEndnodeMessageHandler = f
+}
+
+// Handler for events generated by the adapter
+func (b *Backend) SetAdapterEventHandler(f func(common.EUI64, events.AdapterEvent)) {
+	b.adapterEventHandler = f
+}
+
 // Handler for server commands
 func (b *Backend) HandleServerCommand(pb *bs.ServerCommand) error {
 	if pb == nil {
@@ -306,7 +381,7 @@ func (b *Backend) HandleServerResponse(pb *bs.ServerResponse) error {
 		if command == nil {
 			return errors.New("invalid EndnodeDetachErrorResponse command")
 		}
-		msgA := messages.NewBssciError(opId, 5, command.GetMessage())
+		msgA := messages.NewBssciError(opId, messages.ErrorCodeEACCES, command.GetMessage())
 
 		msg = &msgA
 		log.Debug().Str("proto", "ServerResponse_DetRspErr").Int64("op_id", opId).Msgf("Server failed detaching endnode %v from basestation %v", command.EndnodeEui, bsEui.String())
@@ -315,14 +390,14 @@ func (b *Backend) HandleServerResponse(pb *bs.ServerResponse) error {
 		if command == nil {
 			return errors.New("invalid EndnodeAttachErrorResponse command")
 		}
-		msgA := messages.NewBssciError(opId, 5, command.GetMessage())
+		msgA := messages.NewBssciError(opId, messages.ErrorCodeEACCES, command.GetMessage())
 
 		msg = &msgA
 		log.Debug().Str("proto", "ServerResponse_AttRspErr").Int64("op_id", opId).Msgf("Server failed attaching endnode %v to basestation %v", command.EndnodeEui, bsEui.String())
 
 	case *bs.ServerResponse_Err:
 		command := pb.GetErr()
-		msgA := messages.NewBssciError(opId, 5, command.GetMessage())
+		msgA := messages.NewBssciError(opId, messages.ErrorCodeEIO, command.GetMessage())
 
 		msg = &msgA
 		log.Warn().Str("proto", "ServerResponse_Err").Int64("op_id", opId).Msgf("server responded with error: %s", command.GetMessage())
@@ -338,7 +413,24 @@ func (b *Backend) HandleServerResponse(pb *bs.ServerResponse) error {
 func (b *Backend) Stop() error {
 	log.Info().Str("addr", b.listener.Addr().String()).Msg("STOPPING SERVICE")
 	b.isClosed = true
-	return b.listener.Close()
+	err := b.listener.Close()
+
+	// close all active sessions and wait for their disconnect events
+	b.basestations.closeAll(events.DisconnectReasonServerShutdown)
+
+	done := make(chan struct{})
+	go func() {
+		b.sessions.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		log.Warn().Msg("timeout while waiting for basestation sessions to close")
+	}
+
+	return err
 }
 
 // Starts the backend.
@@ -365,76 +457,154 @@ func (b *Backend) Start() error {
 
 			if err != nil {
 				logger.Error().Err(err).Msg("codec error")
+				conn.Close()
 				continue
-			} else {
-				// first message after connecting should always be Con
-				cmd := cmdHeader.GetCommand()
-
-				if cmd == structs.MsgCon {
-					var con messages.Con
-					_, err = con.UnmarshalMsg(raw)
-					if err != nil {
-						logger.Error().Err(err).Str("command", string(cmd)).Msg("unmarshal msgp error")
-					} else {
-						logger.Info().Str("command", string(cmd)).Msg("initializing basestation connection")
-						ctx := context.Background()
-						ctx = logger.WithContext(ctx)
-						// handle the basestation in a new goroutine
-						go b.initBasestation(ctx, con, conn, b.handleBasestationMessages)
-					}
-				} else {
-					logger.Error().Str("command", string(cmd)).Msg("expected con command")
-					continue
-				}
 			}
+
+			// first message after connecting should always be Con
+			cmd := cmdHeader.GetCommand()
+			if cmd != structs.MsgCon {
+				logger.Error().Str("command", string(cmd)).Msg("expected con command")
+				bssciError := messages.NewBssciError(cmdHeader.GetOpId(), messages.ErrorCodeEPROTO, "expected con command")
+				b.rejectConnection(logger, conn, &bssciError)
+				continue
+			}
+
+			var con messages.Con
+			if _, err = con.UnmarshalMsg(raw); err != nil {
+				b.rejectConnection(logger, conn, log_and_notify_msgp_error(logger, err, cmdHeader.GetOpId()))
+				continue
+			}
+			if err = con.Validate(); err != nil {
+				b.rejectConnection(logger, conn, log_and_notify_validation_error(logger, con.GetEui(), cmd, err, con.GetOpId()))
+				continue
+			}
+
+			logger.Info().Str("command", string(cmd)).Msg("initializing basestation connection")
+			ctx := context.Background()
+			ctx = logger.WithContext(ctx)
+			// handle the basestation in a new goroutine, added before Stop can wait for it
+			b.sessions.Add(1)
+			go func() {
+				defer b.sessions.Done()
+				b.initBasestation(ctx, con, raw, conn, b.handleBasestationMessages)
+			}()
 		}
 	}()
 	return nil
 }
 
-func (b *Backend) initBasestation(ctx context.Context, con messages.Con, conn net.Conn, handler func(ctx context.Context, eui common.EUI64, conn *connection) error) error {
+// Answer the first message of a connection with an error and close it.
+func (b *Backend) rejectConnection(logger zerolog.Logger, conn net.Conn, msg messages.MessageMsgp) {
+	defer conn.Close()
+
+	conn.SetWriteDeadline(time.Now().Add(b.writeTimeout))
+	if err := WriteBssciMessage(conn, msg); err != nil {
+		logger.Error().Err(err).Msg("failed to send error message")
+	}
+}
+
+func (b *Backend) initBasestation(ctx context.Context, con messages.Con, raw []byte, conn net.Conn, handler func(ctx context.Context, eui common.EUI64, conn *connection) error) (err error) {
 	defer conn.Close()
 
 	eui := con.GetEui()
 
-	logger := zerolog.Ctx(ctx)
-	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
-		return c.Str("bs_eui", eui.String())
-	})
+	// a new logger, the context of the accepting logger is shared with other connections
+	bsLogger := zerolog.Ctx(ctx).With().Str("bs_eui", eui.String()).Logger()
+	logger := &bsLogger
+	ctx = logger.WithContext(ctx)
+
+	// reject a second connection before anything is published for it, the existing session is kept
+	if _, err := b.basestations.get(eui); err == nil {
+		err = errors.New("basestation already connected")
+		logger.Error().Err(err).Msg("connection with same gateway eui already exists")
+		return err
+	}
+
+	version, err := b.versions.Negotiate(con.Version)
+	if err != nil {
+		logger.Error().Err(err).Str("version", con.Version).Msg("rejecting basestation with unsupported protocol version")
+		versionRejectedCounter(eui.String()).Inc()
+
+		bssciError := messages.NewBssciError(con.OpId, messages.ErrorCodeEPROTONOSUPPORT, err.Error())
+		b.rejectConnection(*logger, conn, &bssciError)
+		return err
+	}
 
 	// keep track of new connections
 	connectCounter(eui.String()).Inc()
 	b.forwardBasestationMessage(ctx, eui, &con)
 
 	bsConnection := newConnection(conn, con.SnBsUuid)
-	conRsp := messages.NewConRsp(con.OpId, con.Version, bsConnection.SnScUuid)
+	bsConnection.version = version
 
-	// check for existing connection
-	if _, err := b.basestations.get(eui); err == nil {
-		err = errors.New("basestation already connected")
-		logger.Error().Err(err).Msg("connection with same gateway eui already exists")
-		return err
+	var session *capture.Session
+	if b.capture != nil {
+		var captureErr error
+		if session, captureErr = capture.OpenSession(*b.capture, eui, bsConnection.connectedAt); captureErr != nil {
+			logger.Error().Err(captureErr).Msg("failed to start session capture")
+		} else {
+			defer session.Close()
+		}
+	}
+
+	var stopFrames func()
+	bsConnection.onFrame, stopFrames = b.frameHandler(ctx, eui, session)
+	defer stopFrames()
+	if bsConnection.onFrame != nil {
+		// the con frame was read before the connection was set up
+		bsConnection.onFrame(events.RawDirectionInbound, con.GetCommand(), con.GetOpId(), raw)
 	}
+	if b.operationTimeout > 0 {
+		bsConnection.operations = newOperationTracker(*logger, eui, b.operationTimeout)
+		bsConnection.operations.received(con.GetCommand(), con.GetOpId(), time.Now())
+	}
+	conRsp := messages.NewConRsp(con.OpId, version.String(), bsConnection.SnScUuid)
+
+	flapping := b.trackConnect(ctx, eui)
 
 	// set the gateway connection
-	if err := b.basestations.set(eui, &bsConnection); err != nil {
-		logger.Error().Err(err).Msg("failed to set connection")
+	if flapping && b.flapQuarantine {
+		logger.Warn().Msg("basestation is flapping, delaying subscription until stable")
+		if err := b.basestations.setQuarantined(eui, &bsConnection); err != nil {
+			logger.Error().Err(err).Msg("failed to set connection")
+		}
+	} else {
+		if err := b.basestations.set(eui, &bsConnection); err != nil {
+			logger.Error().Err(err).Msg("failed to set connection")
+		}
 	}
 
-	logger.Info().Msg("basestation connected")
+	logger.Info().Str("version", version.String()).Msg("basestation connected")
 
 	// setup recurring tasks
 	done := make(chan struct{})
 
 	// remove the basestation on return
 	defer func() {
-		done <- struct{}{}
+		close(done)
 		b.basestations.remove(eui)
 		bsConnection.conn.Close()
 		disconnectCounter(eui.String()).Inc()
-		logger.Info().Msg("basestation disconnected")
+		if b.flapDetector != nil {
+			b.flapDetector.disconnect(eui, time.Now())
+		}
+		b.forwardDisconnect(ctx, eui, &bsConnection, err)
 	}()
 
+	// a flapping basestation is stable again if it stays connected
+	if flapping {
+		go func() {
+			defer common.RecoverPanic(logger, "bssci_v1_flap_detection", nil)
+
+			select {
+			case <-time.After(b.flapDetector.stablePeriod):
+				b.trackStable(ctx, eui, &bsConnection)
+			case <-done:
+			}
+		}()
+	}
+
 	// setup ping and status tickers
 	pingTicker := time.NewTicker(b.pingInterval)
 	defer pingTicker.Stop()
@@ -443,15 +613,23 @@ func (b *Backend) initBasestation(ctx context.Context, con messages.Con, conn ne
 
 	logger.Debug().Msg("scheduling status messages")
 	go func() {
+		// terminate this connection instead of keeping it without scheduled messages
+		defer common.RecoverPanic(logger, "bssci_v1_scheduler", func(error) {
+			bsConnection.Close(events.DisconnectReasonInternalError)
+		})
+
 		for {
 			select {
 			case <-pingTicker.C:
+				bsConnection.operations.expire(time.Now())
+
 				opId := bsConnection.GetAndDecrementOpId()
 				msg := messages.NewPing(opId)
 
 				err := bsConnection.Write(&msg, b.writeTimeout)
 				if err != nil {
 					logger.Error().Err(err).Str("command", string(msg.GetCommand())).Msg("failed to send scheduled ping request")
+					bsConnection.Close(events.DisconnectReasonWriteError)
 					return
 				}
 
@@ -465,6 +643,7 @@ func (b *Backend) initBasestation(ctx context.Context, con messages.Con, conn ne
 				err := bsConnection.Write(&msg, b.writeTimeout)
 				if err != nil {
 					logger.Error().Err(err).Str("command", string(msg.GetCommand())).Msg("failed to send scheduled status request")
+					bsConnection.Close(events.DisconnectReasonWriteError)
 					return
 				}
 
@@ -479,10 +658,11 @@ func (b *Backend) initBasestation(ctx context.Context, con messages.Con, conn ne
 	}()
 
 	// send ConRsp
-	err := bsConnection.Write(&conRsp, b.writeTimeout)
+	err = bsConnection.Write(&conRsp, b.writeTimeout)
 	if err != nil {
 		logger.Error().Err(err).Str("command", string(conRsp.GetCommand())).Msg("failed to send message")
 		// terminate this connection on error
+		bsConnection.Close(events.DisconnectReasonWriteError)
 		return err
 	}
 
@@ -490,8 +670,14 @@ func (b *Backend) initBasestation(ctx context.Context, con messages.Con, conn ne
 
 	messageSendCounter(eui.String(), string(conRsp.GetCommand()))
 
-	// start the message handler
-	err = handler(ctx, eui, &bsConnection)
+	// start the message handler, a panic only terminates this connection
+	err = func() (err error) {
+		defer common.RecoverPanic(logger, "bssci_v1_read_loop", func(p error) {
+			err = p
+			bsConnection.Close(events.DisconnectReasonInternalError)
+		})
+		return handler(ctx, eui, &bsConnection)
+	}()
 	return err
 }
 
@@ -518,6 +704,27 @@ func (b *Backend) handleBasestationMessages(ctx context.Context, eui common.EUI6
 
 		messageReceiveCounter(eui.String(), string(cmd))
 
+		// reject messages which are out of the operation sequence, errors are never answered with errors
+		if err := connection.operations.received(cmd, opId, time.Now()); err != nil && cmd != structs.ClientMsgError && cmd != structs.ClientMsgErrorAck {
+			bssciError := messages.NewBssciError(opId, messages.ErrorCodeEPROTO, err.Error())
+			if err := b.writeResponse(logger, eui, connection, &bssciError); err != nil {
+				// terminate this connection
+				return err
+			}
+			continue
+		}
+
+		// reject commands which are not part of the negotiated protocol version
+		if !connection.SupportsCommand(cmd) {
+			logger.Warn().Str("version", connection.Version().String()).Msg("command not supported by negotiated protocol version")
+			bssciError := messages.NewBssciError(opId, messages.ErrorCodeENOTSUP, "command not supported by negotiated protocol version")
+			if err := b.writeResponse(logger, eui, connection, &bssciError); err != nil {
+				// terminate this connection
+				return err
+			}
+			continue
+		}
+
 		var response messages.MessageMsgp
 		// only match ClientMsg... messages
 		switch cmd {
@@ -529,6 +736,10 @@ func (b *Backend) handleBasestationMessages(ctx context.Context, eui common.EUI6
 				response = log_and_notify_msgp_error(logger, err, opId)
 				break
 			}
+			if err = msg.Validate(); err != nil {
+				response = log_and_notify_validation_error(logger, eui, cmd, err, opId)
+				break
+			}
 			response = b.handleConMessage(ctx, connection, msg)
 		case structs.ClientMsgAtt:
 			// handle attach message
@@ -538,6 +749,10 @@ func (b *Backend) handleBasestationMessages(ctx context.Context, eui common.EUI6
 				response = log_and_notify_msgp_error(logger, err, opId)
 				break
 			}
+			if err = msg.Validate(); err != nil {
+				response = log_and_notify_validation_error(logger, eui, cmd, err, opId)
+				break
+			}
 			response = b.handleAttMessage(ctx, eui, &msg)
 		case structs.ClientMsgDet:
 			// handle detach message
@@ -547,6 +762,10 @@ func (b *Backend) handleBasestationMessages(ctx context.Context, eui common.EUI6
 				response = log_and_notify_msgp_error(logger, err, opId)
 				break
 			}
+			if err = msg.Validate(); err != nil {
+				response = log_and_notify_validation_error(logger, eui, cmd, err, opId)
+				break
+			}
 			response = b.handleDetMessage(ctx, eui, &msg)
 		case structs.ClientMsgUlData:
 			// handle uplink data message
@@ -556,7 +775,11 @@ func (b *Backend) handleBasestationMessages(ctx context.Context, eui common.EUI6
 				response = log_and_notify_msgp_error(logger, err, opId)
 				break
 			}
-			response = b.handleUlDataMessage(ctx, eui, &msg)
+			if err = msg.Validate(); err != nil {
+				response = log_and_notify_validation_error(logger, eui, cmd, err, opId)
+				break
+			}
+			response = b.handleUlDataMessage(ctx, eui, connection, &msg)
 		case structs.ClientMsgVmUlData:
 			// handle variable mac uplink data message
 			var msg messages.VmUlData
@@ -565,7 +788,11 @@ func (b *Backend) handleBasestationMessages(ctx context.Context, eui common.EUI6
 				response = log_and_notify_msgp_error(logger, err, opId)
 				break
 			}
-			response = b.handleVmUlDataMessage(ctx, eui, &msg)
+			if err = msg.Validate(); err != nil {
+				response = log_and_notify_validation_error(logger, eui, cmd, err, opId)
+				break
+			}
+			response = b.handleVmUlDataMessage(ctx, eui, connection, &msg)
 		case structs.ClientMsgDlDataRes:
 			// handle downlink data result response
 			var msg messages.DlDataRes
@@ -574,6 +801,10 @@ func (b *Backend) handleBasestationMessages(ctx context.Context, eui common.EUI6
 				response = log_and_notify_msgp_error(logger, err, opId)
 				break
 			}
+			if err = msg.Validate(); err != nil {
+				response = log_and_notify_validation_error(logger, eui, cmd, err, opId)
+				break
+			}
 			response = b.handleDlDataResMessage(ctx, eui, &msg)
 		case structs.ClientMsgDlRxStat:
 			// handle downlink rx status data message
@@ -583,6 +814,10 @@ func (b *Backend) handleBasestationMessages(ctx context.Context, eui common.EUI6
 				response = log_and_notify_msgp_error(logger, err, opId)
 				break
 			}
+			if err = msg.Validate(); err != nil {
+				response = log_and_notify_validation_error(logger, eui, cmd, err, opId)
+				break
+			}
 			response = b.handleDlRxStatMessage(ctx, eui, &msg)
 		case structs.ClientMsgStatusRsp:
 			// handle status response message
@@ -592,6 +827,10 @@ func (b *Backend) handleBasestationMessages(ctx context.Context, eui common.EUI6
 				response = log_and_notify_msgp_error(logger, err, opId)
 				break
 			}
+			if err = msg.Validate(); err != nil {
+				response = log_and_notify_validation_error(logger, eui, cmd, err, opId)
+				break
+			}
 			response = b.handleStatusRspMessage(ctx, eui, &msg)
 		case structs.ClientMsgPing:
 			// handle ping message
@@ -636,6 +875,10 @@ func (b *Backend) handleBasestationMessages(ctx context.Context, eui common.EUI6
 				response = log_and_notify_msgp_error(logger, err, opId)
 				break
 			}
+			if err = msg.Validate(); err != nil {
+				response = log_and_notify_validation_error(logger, eui, cmd, err, opId)
+				break
+			}
 			response = b.handleVmStatusRspMessage(ctx, eui, &msg)
 		case structs.ClientMsgError:
 			// handle error message
@@ -671,23 +914,150 @@ func (b *Backend) handleBasestationMessages(ctx context.Context, eui common.EUI6
 
 		default:
 			logger.Warn().Msg("unsupported message type")
-			bssciError := messages.NewBssciError(opId, 5, "unsupported message type")
+			bssciError := messages.NewBssciError(opId, messages.ErrorCodeENOTSUP, "unsupported message type")
 			response = &bssciError
 		}
 
 		if response != nil {
-			err := connection.Write(response, b.writeTimeout)
-			if err != nil {
-				logger.Error().Err(err).Msg("failed to write message")
+			if err := b.writeResponse(logger, eui, connection, response); err != nil {
 				// terminate this connection
 				return err
 			}
-			messageSendCounter(eui.String(), string(response.GetCommand()))
-			logger.Debug().Any("json", response).Msg("sent response")
 		}
 	}
 }
 
+// write the response to a message received from a basestation
+func (b *Backend) writeResponse(logger zerolog.Logger, eui common.EUI64, connection *connection, response messages.MessageMsgp) error {
+	err := connection.Write(response, b.writeTimeout)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to write message")
+		// terminate this connection, the read loop ends with the write error as reason
+		connection.Close(events.DisconnectReasonWriteError)
+		return err
+	}
+	messageSendCounter(eui.String(), string(response.GetCommand()))
+	logger.Debug().Any("json", response).Msg("sent response")
+	return nil
+}
+
+// record a basestation connect for flap detection
+//
+// returns true if the basestation is flagged as flapping
+func (b *Backend) trackConnect(ctx context.Context, eui common.EUI64) bool {
+	if b.flapDetector == nil {
+		return false
+	}
+	logger := zerolog.Ctx(ctx)
+
+	now := time.Now()
+	if b.flapDetector.connect(eui, now) {
+		connects, disconnects := b.flapDetector.counts(eui, now)
+		logger.Warn().Int("connects", connects).Int("disconnects", disconnects).Dur("window", b.flapDetector.window).Msg("basestation is flapping")
+		flappingCounter(eui.String()).Inc()
+
+		b.forwardAdapterEvent(ctx, eui, &events.Flapping{
+			BasestationEui:  eui,
+			Ts:              now,
+			Flapping:        true,
+			ConnectCount:    connects,
+			DisconnectCount: disconnects,
+			Window:          b.flapDetector.window,
+		})
+	}
+	return b.flapDetector.isFlapping(eui)
+}
+
+// clear the flapping flag of a basestation after it stayed connected for the stable period
+func (b *Backend) trackStable(ctx context.Context, eui common.EUI64, conn *connection) {
+	logger := zerolog.Ctx(ctx)
+
+	if b.flapDetector.stable(eui) {
+		logger.Info().Msg("basestation is stable again")
+
+		b.forwardAdapterEvent(ctx, eui, &events.Flapping{
+			BasestationEui: eui,
+			Ts:             time.Now(),
+			Flapping:       false,
+			Window:         b.flapDetector.window,
+		})
+	}
+
+	if b.basestations.release(eui, conn) {
+		logger.Info().Msg("released basestation from quarantine")
+	}
+}
+
+// publish the end of a basestation session
+func (b *Backend) forwardDisconnect(ctx context.Context, eui common.EUI64, conn *connection, err error) {
+	logger := zerolog.Ctx(ctx)
+
+	event := conn.DisconnectEvent(eui, err)
+	disconnectReasonCounter(eui.String(), string(event.Reason)).Inc()
+
+	logger.Info().
+		Str("reason", string(event.Reason)).
+		Dur("session_duration", event.SessionDuration).
+		Uint64("messages_received", event.MessagesReceived).
+		Uint64("messages_sent", event.MessagesSent).
+		Msg("basestation disconnected")
+
+	b.forwardAdapterEvent(ctx, eui, &event)
+}
+
+// events generated by the adapter
+func (b *Backend) forwardAdapterEvent(ctx context.Context, eui common.EUI64, event events.AdapterEvent) {
+	logger := zerolog.Ctx(ctx)
+
+	if b.adapterEventHandler != nil {
+		b.adapterEventHandler(eui, event)
+		return
+	}
+
+	logger.Warn().Str("event", string(event.GetEventType())).Msg("adapterEventHandler not set")
+}
+
+// create the handler for the frames of a connection, nil if frames are neither published nor captured.
+//
+// The handler is called while the connection is locked, raw frames are published in order
+// by a queue which is stopped by the returned function.
+func (b *Backend) frameHandler(ctx context.Context, eui common.EUI64, session *capture.Session) (func(events.RawDirection, structs.Command, int64, []byte), func()) {
+	if b.rawFrames == nil && session == nil {
+		return nil, func() {}
+	}
+	logger := zerolog.Ctx(ctx)
+
+	var queue *rawQueue
+	stop := func() {}
+	if b.rawFrames != nil {
+		queue = newRawQueue(rawQueueSize, func(f rawFrame) {
+			defer common.RecoverPanic(logger, "bssci_v1_raw_frames", nil)
+			b.forwardAdapterEvent(ctx, eui, b.rawFrames.event(eui, f.direction, f.cmd, f.opId, f.payload, f.ts))
+		})
+		stop = func() {
+			if !queue.stop(rawStopTimeout) {
+				logger.Warn().Msg("timeout waiting for queued raw frames")
+			}
+		}
+	}
+
+	return func(direction events.RawDirection, cmd structs.Command, opId int64, payload []byte) {
+		now := time.Now()
+		if session != nil {
+			if err := session.Write(capture.Record{Ts: now, Direction: direction, Payload: payload}); err != nil {
+				logger.Error().Err(err).Msg("session capture failed")
+			}
+		}
+		if queue == nil || !b.rawFrames.match(cmd) {
+			return
+		}
+		if !queue.push(rawFrame{ts: now, direction: direction, cmd: cmd, opId: opId, payload: payload}) {
+			rawFrameDroppedCounter(eui.String()).Inc()
+			logger.Warn().Str("command", string(cmd)).Msg("raw frame queue full, dropping frame")
+		}
+	}, stop
+}
+
 // upstream messages from basestations
 func (b *Backend) forwardBasestationMessage(ctx context.Context, eui common.EUI64, msg messages.BasestationMessage) messages.MessageMsgp {
 	logger := zerolog.Ctx(ctx)
@@ -699,7 +1069,7 @@ func (b *Backend) forwardBasestationMessage(ctx context.Context, eui common.EUI6
 	}
 
 	logger.Warn().Msg("basestationMessageHandler not set")
-	response := messages.NewBssciError(msg.GetOpId(), 5, "server unable to handle message")
+	response := messages.NewBssciError(msg.GetOpId(), messages.ErrorCodeEIO, "server unable to handle message")
 	return &response
 
 }
@@ -715,18 +1085,84 @@ func (b *Backend) forwardEndnodeMessage(ctx context.Context, eui common.EUI64, m
 	}
 
 	logger.Warn().Msg("endnodeMessageHandler not set")
-	response := messages.NewBssciError(msg.GetOpId(), 5, "server unable to handle message")
+	response := messages.NewBssciError(msg.GetOpId(), messages.ErrorCodeEIO, "server unable to handle message")
 	return &response
 }
 
+// upstream uplink data from endnodes, rsp acknowledges the uplink.
+//
+// With publish confirmation, the response is written once the publish completed and nil
+// is returned, so the following messages of the basestation are not delayed by the publish.
+func (b *Backend) forwardUplinkData(ctx context.Context, eui common.EUI64, conn *connection, msg messages.EndnodeMessage, rsp messages.MessageMsgp) messages.MessageMsgp {
+	if !b.confirmPublish {
+		if response := b.forwardEndnodeMessage(ctx, eui, msg); response != nil {
+			return response
+		}
+		return rsp
+	}
+
+	logger := zerolog.Ctx(ctx).With().Str("command", string(msg.GetCommand())).Int64("op_id", msg.GetOpId()).Logger()
+	handler := b.confirmedEndnodeMessageHandler
+	if handler == nil {
+		logger.Warn().Msg("confirmedEndnodeMessageHandler not set")
+		response := messages.NewBssciError(msg.GetOpId(), messages.ErrorCodeEIO, "server unable to handle message")
+		return &response
+	}
+
+	data := msg.IntoProto(&eui)
+	pub, joined := b.publishes.start(&logger, uplinkKey(eui, msg), func() error {
+		return handler(eui, msg.GetEventType(), data)
+	})
+	if joined {
+		logger.Info().Msg("retransmitted uplink, joining previous publish")
+	}
+
+	b.sessions.Add(1)
+	go func() {
+		defer b.sessions.Done()
+		defer common.RecoverPanic(&logger, "bssci_v1_ack", nil)
+
+		timer := time.NewTimer(b.confirmTimeout)
+		defer timer.Stop()
+
+		response := rsp
+		select {
+		case <-pub.done:
+			if pub.err != nil {
+				logger.Warn().Err(pub.err).Msg("publish uplink error, rejecting uplink")
+				bssciError := messages.NewBssciError(msg.GetOpId(), messages.ErrorCodeEIO, "server unable to publish message")
+				response = &bssciError
+			}
+		case <-timer.C:
+			// the publish continues, a retransmission of the uplink joins it
+			logger.Warn().Dur("timeout", b.confirmTimeout).Msg("publish uplink timeout, rejecting uplink")
+			bssciError := messages.NewBssciError(msg.GetOpId(), messages.ErrorCodeETIMEDOUT, "server publish timed out")
+			response = &bssciError
+		}
+		if response != rsp {
+			publishRejectedCounter(eui.String(), string(msg.GetCommand())).Inc()
+		}
+		b.writeResponse(logger, eui, conn, response)
+	}()
+	return nil
+}
+
 func (b *Backend) handleConMessage(ctx context.Context, conn *connection, msg messages.Con) messages.MessageMsgp {
 	logger := zerolog.Ctx(ctx)
 
+	version, err := b.versions.Negotiate(msg.Version)
+	if err != nil {
+		logger.Error().Err(err).Str("version", msg.Version).Msg("unsupported protocol version")
+		response := messages.NewBssciError(msg.GetOpId(), messages.ErrorCodeEPROTONOSUPPORT, err.Error())
+		return &response
+	}
+
 	error_response := b.forwardBasestationMessage(ctx, msg.BsEui, &msg)
 	if error_response == nil {
 		resume, snScUuid := conn.ResumeConnection(msg.SnBsUuid.ToUuid(), msg.SnScOpId)
+		conn.SetVersion(version)
 
-		conRsp := messages.NewConRsp(msg.GetOpId(), msg.Version, snScUuid)
+		conRsp := messages.NewConRsp(msg.GetOpId(), version.String(), snScUuid)
 
 		// check if session uuid is identical to current session
 		if resume {
@@ -856,22 +1292,14 @@ func (b *Backend) handleDetMessage(ctx context.Context, eui common.EUI64, msg *m
 	return b.forwardEndnodeMessage(ctx, eui, msg)
 }
 
-func (b *Backend) handleUlDataMessage(ctx context.Context, eui common.EUI64, msg *messages.UlData) messages.MessageMsgp {
-	error_response := b.forwardEndnodeMessage(ctx, eui, msg)
-	if error_response == nil {
-		response := messages.NewUlDataRsp(msg.GetOpId())
-		return &response
-	}
-	return error_response
+func (b *Backend) handleUlDataMessage(ctx context.Context, eui common.EUI64, conn *connection, msg *messages.UlData) messages.MessageMsgp {
+	response := messages.NewUlDataRsp(msg.GetOpId())
+	return b.forwardUplinkData(ctx, eui, conn, msg, &response)
 }
 
-func (b *Backend) handleVmUlDataMessage(ctx context.Context, eui common.EUI64, msg *messages.VmUlData) messages.MessageMsgp {
-	error_response := b.forwardEndnodeMessage(ctx, eui, msg)
-	if error_response == nil {
-		response := messages.NewVmUlDataRsp(msg.GetOpId())
-		return &response
-	}
-	return error_response
+func (b *Backend) handleVmUlDataMessage(ctx context.Context, eui common.EUI64, conn *connection, msg *messages.VmUlData) messages.MessageMsgp {
+	response := messages.NewVmUlDataRsp(msg.GetOpId())
+	return b.forwardUplinkData(ctx, eui, conn, msg, &response)
 }
 
 // sends a server response to a basestation
@@ -887,6 +1315,12 @@ func (b *Backend) sendServerResponseToBasestation(bsEui common.EUI64, msg messag
 			return err
 		}
 
+		if !bsConnection.SupportsCommand(msg.GetCommand()) {
+			err := fmt.Errorf("command not supported by negotiated protocol version %s", bsConnection.Version())
+			logger.Error().Err(err).Msg("unable to send to basestation")
+			return err
+		}
+
 		err = bsConnection.Write(msg, b.writeTimeout)
 		if err != nil {
 			logger.Error().Err(err).Msg("failed to send to basestation")
@@ -947,6 +1381,22 @@ func (b *Backend) sendServerMessageToBasestation(bsEui common.EUI64, msg message
 
 func log_and_notify_msgp_error(logger zerolog.Logger, err error, opId int64) messages.MessageMsgp {
 	logger.Error().Err(err).Msg("unmarshal msgp error")
-	response := messages.NewBssciError(opId, 5, "message pack error")
+	response := messages.NewBssciError(opId, messages.ErrorCodeEBADMSG, "message pack error")
+	return &response
+}
+
+func log_and_notify_validation_error(logger zerolog.Logger, eui common.EUI64, cmd structs.Command, err error, opId int64) messages.MessageMsgp {
+	logger.Error().Err(err).Msg("message validation error")
+
+	field := "unknown"
+	code := messages.ErrorCodeEINVAL
+	var validationErr *messages.ValidationError
+	if errors.As(err, &validationErr) {
+		field = validationErr.Field
+		code = validationErr.Code
+	}
+	validationErrorCounter(eui.String(), string(cmd), field).Inc()
+
+	response := messages.NewBssciError(opId, code, err.Error())
 	return &response
 }
@@ -16,16 +16,19 @@ import (
 
 	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
 
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"github.com/tinylib/msgp/msgp"
 )
 
 type TestBackendSuite struct {
@@ -136,22 +139,28 @@ func (ts *TestBackendSuite) SetupSuite() {
 		},
 		{
 			name:                    "att",
-			payload:                 []byte{77, 73, 79, 84, 89, 66, 48, 49, 0, 1, 0, 0, 222, 0, 18, 167, 99, 111, 109, 109, 97, 110, 100, 163, 97, 116, 116, 164, 111, 112, 73, 100, 0, 165, 101, 112, 69, 117, 105, 211, 8, 7, 6, 5, 4, 3, 2, 1, 166, 114, 120, 84, 105, 109, 101, 1, 170, 114, 120, 68, 117, 114, 97, 116, 105, 111, 110, 205, 1, 244, 169, 97, 116, 116, 97, 99, 104, 67, 110, 116, 2, 163, 115, 110, 114, 203, 64, 8, 0, 0, 0, 0, 0, 0, 164, 114, 115, 115, 105, 203, 192, 89, 0, 0, 0, 0, 0, 0, 165, 101, 113, 83, 110, 114, 203, 64, 16, 0, 0, 0, 0, 0, 0, 167, 112, 114, 111, 102, 105, 108, 101, 162, 101, 117, 170, 115, 117, 98, 112, 97, 99, 107, 101, 116, 115, 132, 163, 115, 110, 114, 147, 1, 2, 3, 164, 114, 115, 115, 105, 147, 4, 5, 6, 169, 102, 114, 101, 113, 117, 101, 110, 99, 121, 147, 7, 8, 9, 165, 112, 104, 97, 115, 101, 147, 10, 11, 12, 165, 110, 111, 110, 99, 101, 196, 4, 4, 5, 6, 7, 164, 115, 105, 103, 110, 196, 4, 1, 2, 3, 4, 166, 115, 104, 65, 100, 100, 114, 205, 255, 255, 168, 100, 117, 97, 108, 67, 104, 97, 110, 194, 170, 114, 101, 112, 101, 116, 105, 116, 105, 111, 110, 194, 171, 119, 105, 100, 101, 67, 97, 114, 114, 79, 102, 102, 194, 171, 108, 111, 110, 103, 66, 108, 107, 68, 105, 115, 116, 194},
+			payload:                 []byte{77, 73, 79, 84, 89, 66, 48, 49, 8, 1, 0, 0, 222, 0, 18, 167, 99, 111, 109, 109, 97, 110, 100, 163, 97, 116, 116, 164, 111, 112, 73, 100, 0, 165, 101, 112, 69, 117, 105, 211, 8, 7, 6, 5, 4, 3, 2, 1, 166, 114, 120, 84, 105, 109, 101, 207, 23, 166, 16, 23, 1, 101, 0, 0, 170, 114, 120, 68, 117, 114, 97, 116, 105, 111, 110, 205, 1, 244, 169, 97, 116, 116, 97, 99, 104, 67, 110, 116, 2, 163, 115, 110, 114, 203, 64, 8, 0, 0, 0, 0, 0, 0, 164, 114, 115, 115, 105, 203, 192, 89, 0, 0, 0, 0, 0, 0, 165, 101, 113, 83, 110, 114, 203, 64, 16, 0, 0, 0, 0, 0, 0, 167, 112, 114, 111, 102, 105, 108, 101, 162, 101, 117, 170, 115, 117, 98, 112, 97, 99, 107, 101, 116, 115, 132, 163, 115, 110, 114, 147, 1, 2, 3, 164, 114, 115, 115, 105, 147, 4, 5, 6, 169, 102, 114, 101, 113, 117, 101, 110, 99, 121, 147, 7, 8, 9, 165, 112, 104, 97, 115, 101, 147, 10, 11, 12, 165, 110, 111, 110, 99, 101, 196, 4, 4, 5, 6, 7, 164, 115, 105, 103, 110, 196, 4, 1, 2, 3, 4, 166, 115, 104, 65, 100, 100, 114, 205, 255, 255, 168, 100, 117, 97, 108, 67, 104, 97, 110, 194, 170, 114, 101, 112, 101, 116, 105, 116, 105, 111, 110, 194, 171, 119, 105, 100, 101, 67, 97, 114, 114, 79, 102, 102, 194, 171, 108, 111, 110, 103, 66, 108, 107, 68, 105, 115, 116, 194},
 			expectResponse:          false,
 			expectedResponseCommand: structs.MsgAtt,
 		},
 		{
 			name:                    "det",
-			payload:                 []byte{77, 73, 79, 84, 89, 66, 48, 49, 184, 0, 0, 0, 140, 167, 99, 111, 109, 109, 97, 110, 100, 163, 100, 101, 116, 164, 111, 112, 73, 100, 0, 165, 101, 112, 69, 117, 105, 211, 8, 7, 6, 5, 4, 3, 2, 1, 166, 114, 120, 84, 105, 109, 101, 1, 170, 114, 120, 68, 117, 114, 97, 116, 105, 111, 110, 205, 1, 244, 169, 112, 97, 99, 107, 101, 116, 67, 110, 116, 2, 163, 115, 110, 114, 203, 64, 8, 0, 0, 0, 0, 0, 0, 164, 114, 115, 115, 105, 203, 192, 89, 0, 0, 0, 0, 0, 0, 165, 101, 113, 83, 110, 114, 203, 64, 16, 0, 0, 0, 0, 0, 0, 167, 112, 114, 111, 102, 105, 108, 101, 162, 101, 117, 170, 115, 117, 98, 112, 97, 99, 107, 101, 116, 115, 132, 163, 115, 110, 114, 147, 1, 2, 3, 164, 114, 115, 115, 105, 147, 4, 5, 6, 169, 102, 114, 101, 113, 117, 101, 110, 99, 121, 147, 7, 8, 9, 165, 112, 104, 97, 115, 101, 147, 10, 11, 12, 164, 115, 105, 103, 110, 196, 4, 1, 2, 3, 4},
+			payload:                 []byte{77, 73, 79, 84, 89, 66, 48, 49, 192, 0, 0, 0, 140, 167, 99, 111, 109, 109, 97, 110, 100, 163, 100, 101, 116, 164, 111, 112, 73, 100, 0, 165, 101, 112, 69, 117, 105, 211, 8, 7, 6, 5, 4, 3, 2, 1, 166, 114, 120, 84, 105, 109, 101, 207, 23, 166, 16, 23, 1, 101, 0, 0, 170, 114, 120, 68, 117, 114, 97, 116, 105, 111, 110, 205, 1, 244, 169, 112, 97, 99, 107, 101, 116, 67, 110, 116, 2, 163, 115, 110, 114, 203, 64, 8, 0, 0, 0, 0, 0, 0, 164, 114, 115, 115, 105, 203, 192, 89, 0, 0, 0, 0, 0, 0, 165, 101, 113, 83, 110, 114, 203, 64, 16, 0, 0, 0, 0, 0, 0, 167, 112, 114, 111, 102, 105, 108, 101, 162, 101, 117, 170, 115, 117, 98, 112, 97, 99, 107, 101, 116, 115, 132, 163, 115, 110, 114, 147, 1, 2, 3, 164, 114, 115, 115, 105, 147, 4, 5, 6, 169, 102, 114, 101, 113, 117, 101, 110, 99, 121, 147, 7, 8, 9, 165, 112, 104, 97, 115, 101, 147, 10, 11, 12, 164, 115, 105, 103, 110, 196, 4, 1, 2, 3, 4},
 			expectResponse:          false,
 			expectedResponseCommand: structs.MsgDet,
 		},
 		{
 			name:                    "ulData",
-			payload:                 []byte{77, 73, 79, 84, 89, 66, 48, 49, 238, 0, 0, 0, 143, 167, 99, 111, 109, 109, 97, 110, 100, 166, 117, 108, 68, 97, 116, 97, 164, 111, 112, 73, 100, 0, 165, 101, 112, 69, 117, 105, 207, 8, 7, 6, 5, 4, 3, 2, 1, 166, 114, 120, 84, 105, 109, 101, 1, 170, 114, 120, 68, 117, 114, 97, 116, 105, 111, 110, 205, 1, 244, 169, 112, 97, 99, 107, 101, 116, 67, 110, 116, 2, 163, 115, 110, 114, 203, 64, 8, 0, 0, 0, 0, 0, 0, 164, 114, 115, 115, 105, 203, 192, 89, 0, 0, 0, 0, 0, 0, 165, 101, 113, 83, 110, 114, 203, 64, 16, 0, 0, 0, 0, 0, 0, 167, 112, 114, 111, 102, 105, 108, 101, 162, 101, 117, 170, 115, 117, 98, 112, 97, 99, 107, 101, 116, 115, 132, 163, 115, 110, 114, 147, 1, 2, 3, 164, 114, 115, 115, 105, 147, 4, 5, 6, 169, 102, 114, 101, 113, 117, 101, 110, 99, 121, 147, 7, 8, 9, 165, 112, 104, 97, 115, 101, 147, 10, 11, 12, 168, 117, 115, 101, 114, 68, 97, 116, 97, 220, 0, 22, 116, 104, 105, 115, 105, 115, 97, 108, 111, 116, 111, 102, 100, 97, 116, 97, 116, 111, 115, 101, 110, 100, 166, 100, 108, 79, 112, 101, 110, 194, 171, 114, 101, 115, 112, 111, 110, 115, 101, 69, 120, 112, 194, 165, 100, 108, 65, 99, 107, 194},
+			payload:                 []byte{77, 73, 79, 84, 89, 66, 48, 49, 246, 0, 0, 0, 143, 167, 99, 111, 109, 109, 97, 110, 100, 166, 117, 108, 68, 97, 116, 97, 164, 111, 112, 73, 100, 0, 165, 101, 112, 69, 117, 105, 207, 8, 7, 6, 5, 4, 3, 2, 1, 166, 114, 120, 84, 105, 109, 101, 207, 23, 166, 16, 23, 1, 101, 0, 0, 170, 114, 120, 68, 117, 114, 97, 116, 105, 111, 110, 205, 1, 244, 169, 112, 97, 99, 107, 101, 116, 67, 110, 116, 2, 163, 115, 110, 114, 203, 64, 8, 0, 0, 0, 0, 0, 0, 164, 114, 115, 115, 105, 203, 192, 89, 0, 0, 0, 0, 0, 0, 165, 101, 113, 83, 110, 114, 203, 64, 16, 0, 0, 0, 0, 0, 0, 167, 112, 114, 111, 102, 105, 108, 101, 162, 101, 117, 170, 115, 117, 98, 112, 97, 99, 107, 101, 116, 115, 132, 163, 115, 110, 114, 147, 1, 2, 3, 164, 114, 115, 115, 105, 147, 4, 5, 6, 169, 102, 114, 101, 113, 117, 101, 110, 99, 121, 147, 7, 8, 9, 165, 112, 104, 97, 115, 101, 147, 10, 11, 12, 168, 117, 115, 101, 114, 68, 97, 116, 97, 220, 0, 22, 116, 104, 105, 115, 105, 115, 97, 108, 111, 116, 111, 102, 100, 97, 116, 97, 116, 111, 115, 101, 110, 100, 166, 100, 108, 79, 112, 101, 110, 194, 171, 114, 101, 115, 112, 111, 110, 115, 101, 69, 120, 112, 194, 165, 100, 108, 65, 99, 107, 194},
 			expectResponse:          true,
 			expectedResponseCommand: structs.MsgUlDataRsp,
 		},
+		{
+			name:                    "ulData invalid rxTime",
+			payload:                 []byte{77, 73, 79, 84, 89, 66, 48, 49, 238, 0, 0, 0, 143, 167, 99, 111, 109, 109, 97, 110, 100, 166, 117, 108, 68, 97, 116, 97, 164, 111, 112, 73, 100, 0, 165, 101, 112, 69, 117, 105, 207, 8, 7, 6, 5, 4, 3, 2, 1, 166, 114, 120, 84, 105, 109, 101, 1, 170, 114, 120, 68, 117, 114, 97, 116, 105, 111, 110, 205, 1, 244, 169, 112, 97, 99, 107, 101, 116, 67, 110, 116, 2, 163, 115, 110, 114, 203, 64, 8, 0, 0, 0, 0, 0, 0, 164, 114, 115, 115, 105, 203, 192, 89, 0, 0, 0, 0, 0, 0, 165, 101, 113, 83, 110, 114, 203, 64, 16, 0, 0, 0, 0, 0, 0, 167, 112, 114, 111, 102, 105, 108, 101, 162, 101, 117, 170, 115, 117, 98, 112, 97, 99, 107, 101, 116, 115, 132, 163, 115, 110, 114, 147, 1, 2, 3, 164, 114, 115, 115, 105, 147, 4, 5, 6, 169, 102, 114, 101, 113, 117, 101, 110, 99, 121, 147, 7, 8, 9, 165, 112, 104, 97, 115, 101, 147, 10, 11, 12, 168, 117, 115, 101, 114, 68, 97, 116, 97, 220, 0, 22, 116, 104, 105, 115, 105, 115, 97, 108, 111, 116, 111, 102, 100, 97, 116, 97, 116, 111, 115, 101, 110, 100, 166, 100, 108, 79, 112, 101, 110, 194, 171, 114, 101, 115, 112, 111, 110, 115, 101, 69, 120, 112, 194, 165, 100, 108, 65, 99, 107, 194},
+			expectResponse:          true,
+			expectedResponseCommand: structs.MsgError,
+		},
 		{
 			name:                    "dlDataRes",
 			payload:                 []byte{77, 73, 79, 84, 89, 66, 48, 49, 91, 0, 0, 0, 135, 167, 99, 111, 109, 109, 97, 110, 100, 169, 100, 108, 68, 97, 116, 97, 82, 101, 115, 164, 111, 112, 73, 100, 0, 165, 101, 112, 69, 117, 105, 211, 8, 7, 6, 5, 4, 3, 2, 1, 165, 113, 117, 101, 73, 100, 206, 0, 188, 97, 78, 166, 114, 101, 115, 117, 108, 116, 167, 115, 117, 99, 99, 101, 115, 115, 166, 116, 120, 84, 105, 109, 101, 206, 0, 188, 97, 78, 169, 112, 97, 99, 107, 101, 116, 67, 110, 116, 205, 4, 210},
@@ -160,7 +169,7 @@ func (ts *TestBackendSuite) SetupSuite() {
 		},
 		{
 			name:                    "dlRxStat",
-			payload:                 []byte{77, 73, 79, 84, 89, 66, 48, 49, 95, 0, 0, 0, 135, 167, 99, 111, 109, 109, 97, 110, 100, 168, 100, 108, 82, 120, 83, 116, 97, 116, 164, 111, 112, 73, 100, 0, 165, 101, 112, 69, 117, 105, 211, 8, 7, 6, 5, 4, 3, 2, 1, 166, 114, 120, 84, 105, 109, 101, 1, 169, 112, 97, 99, 107, 101, 116, 67, 110, 116, 205, 4, 210, 167, 100, 108, 82, 120, 83, 110, 114, 203, 64, 0, 0, 0, 0, 0, 0, 0, 168, 100, 108, 82, 120, 82, 115, 115, 105, 203, 192, 89, 0, 0, 0, 0, 0, 0},
+			payload:                 []byte{77, 73, 79, 84, 89, 66, 48, 49, 103, 0, 0, 0, 135, 167, 99, 111, 109, 109, 97, 110, 100, 168, 100, 108, 82, 120, 83, 116, 97, 116, 164, 111, 112, 73, 100, 0, 165, 101, 112, 69, 117, 105, 211, 8, 7, 6, 5, 4, 3, 2, 1, 166, 114, 120, 84, 105, 109, 101, 207, 23, 166, 16, 23, 1, 101, 0, 0, 169, 112, 97, 99, 107, 101, 116, 67, 110, 116, 205, 4, 210, 167, 100, 108, 82, 120, 83, 110, 114, 203, 64, 0, 0, 0, 0, 0, 0, 0, 168, 100, 108, 82, 120, 82, 115, 115, 105, 203, 192, 89, 0, 0, 0, 0, 0, 0},
 			expectResponse:          true,
 			expectedResponseCommand: structs.MsgDlRxStatRsp,
 		},
@@ -214,7 +223,7 @@ func (ts *TestBackendSuite) SetupSuite() {
 		},
 		{
 			name:                    "vmUlData",
-			payload:                 []byte{77, 73, 79, 84, 89, 66, 48, 49, 213, 0, 0, 0, 143, 167, 99, 111, 109, 109, 97, 110, 100, 169, 118, 109, 46, 117, 108, 68, 97, 116, 97, 164, 111, 112, 73, 100, 10, 167, 109, 97, 99, 84, 121, 112, 101, 0, 168, 117, 115, 101, 114, 68, 97, 116, 97, 147, 1, 2, 3, 167, 116, 114, 120, 84, 105, 109, 101, 1, 167, 115, 121, 115, 84, 105, 109, 101, 1, 167, 102, 114, 101, 113, 79, 102, 102, 203, 64, 78, 0, 0, 0, 0, 0, 0, 163, 115, 110, 114, 203, 64, 8, 0, 0, 0, 0, 0, 0, 164, 114, 115, 115, 105, 203, 192, 89, 0, 0, 0, 0, 0, 0, 165, 101, 113, 83, 110, 114, 203, 64, 16, 0, 0, 0, 0, 0, 0, 170, 115, 117, 98, 112, 97, 99, 107, 101, 116, 115, 132, 163, 115, 110, 114, 147, 1, 2, 3, 164, 114, 115, 115, 105, 147, 4, 5, 6, 169, 102, 114, 101, 113, 117, 101, 110, 99, 121, 147, 7, 8, 9, 165, 112, 104, 97, 115, 101, 147, 10, 11, 12, 169, 99, 97, 114, 114, 83, 112, 97, 99, 101, 2, 167, 112, 97, 116, 116, 71, 114, 112, 3, 167, 112, 97, 116, 116, 78, 117, 109, 5, 163, 99, 114, 99, 146, 6, 77},
+			payload:                 []byte{77, 73, 79, 84, 89, 66, 48, 49, 221, 0, 0, 0, 143, 167, 99, 111, 109, 109, 97, 110, 100, 169, 118, 109, 46, 117, 108, 68, 97, 116, 97, 164, 111, 112, 73, 100, 10, 167, 109, 97, 99, 84, 121, 112, 101, 0, 168, 117, 115, 101, 114, 68, 97, 116, 97, 147, 1, 2, 3, 167, 116, 114, 120, 84, 105, 109, 101, 1, 167, 115, 121, 115, 84, 105, 109, 101, 207, 23, 166, 16, 23, 1, 101, 0, 0, 167, 102, 114, 101, 113, 79, 102, 102, 203, 64, 78, 0, 0, 0, 0, 0, 0, 163, 115, 110, 114, 203, 64, 8, 0, 0, 0, 0, 0, 0, 164, 114, 115, 115, 105, 203, 192, 89, 0, 0, 0, 0, 0, 0, 165, 101, 113, 83, 110, 114, 203, 64, 16, 0, 0, 0, 0, 0, 0, 170, 115, 117, 98, 112, 97, 99, 107, 101, 116, 115, 132, 163, 115, 110, 114, 147, 1, 2, 3, 164, 114, 115, 115, 105, 147, 4, 5, 6, 169, 102, 114, 101, 113, 117, 101, 110, 99, 121, 147, 7, 8, 9, 165, 112, 104, 97, 115, 101, 147, 10, 11, 12, 169, 99, 97, 114, 114, 83, 112, 97, 99, 101, 2, 167, 112, 97, 116, 116, 71, 114, 112, 3, 167, 112, 97, 116, 116, 78, 117, 109, 5, 163, 99, 114, 99, 146, 6, 77},
 			expectResponse:          true,
 			expectedResponseCommand: structs.MsgVmUlDataRsp,
 		},
@@ -693,6 +702,54 @@ func (ts *TestBackendSuite) TestBackend_HandleBasestationMessages() {
 	}
 }
 
+func (ts *TestBackendSuite) TestBackend_HandleBasestationMessagesSequence() {
+	assert := assert.New(ts.T())
+
+	server, client := net.Pipe()
+	bsConnection := newConnection(client, structs.NewSessionUuid(uuid.New()))
+	bsConnection.operations = newOperationTracker(log.Logger, ts.bs_eui, time.Minute)
+
+	go func() {
+		ctx := context.Background()
+		ts.backend.handleBasestationMessages(ctx, ts.bs_eui, &bsConnection)
+	}()
+	server.SetDeadline(time.Now().Add(time.Second))
+
+	// a stray attPrpRsp is rejected
+	rsp := messages.NewAttPrpRsp(-1)
+	assert.NoError(WriteBssciMessage(server, &rsp))
+
+	cmd, raw, err := ReadBssciMessage(server)
+	assert.NoError(err)
+	assert.Equal(structs.MsgError, cmd.Command)
+
+	var bssciError messages.BssciError
+	_, err = bssciError.UnmarshalMsg(raw)
+	assert.NoError(err)
+	assert.Equal(messages.ErrorCodeEPROTO, bssciError.Code)
+	assert.Equal(int64(-1), bssciError.OpId)
+
+	ack := messages.NewBssciErrorAck(-1)
+	assert.NoError(WriteBssciMessage(server, &ack))
+
+	// a ping operation in sequence
+	ping := messages.NewPing(1)
+	assert.NoError(WriteBssciMessage(server, &ping))
+
+	cmd, _, err = ReadBssciMessage(server)
+	assert.NoError(err)
+	assert.Equal(structs.MsgPingRsp, cmd.Command)
+
+	pingCmp := messages.NewPingCmp(1)
+	assert.NoError(WriteBssciMessage(server, &pingCmp))
+
+	assert.Eventually(func() bool {
+		return bsConnection.operations.open() == 0
+	}, time.Second, 10*time.Millisecond)
+
+	server.Close()
+}
+
 func BenchmarkBackend_HandleBasestationMessages(b *testing.B) {
 	ts := new(TestBackendSuite)
 	ts.SetT(&testing.T{})
@@ -845,6 +902,144 @@ func (ts *TestBackendSuite) TestBackend_PropagationCache() {
 
 }
 
+func (ts *TestBackendSuite) TestBackend_PublishConfirmation() {
+	t := ts.T()
+
+	block := make(chan struct{})
+	defer close(block)
+
+	tests := []struct {
+		name     string
+		handler  func(common.EUI64, events.EventType, *bs.EndnodeUplink) error
+		wantCode uint32
+	}{
+		{
+			name:    "published",
+			handler: func(common.EUI64, events.EventType, *bs.EndnodeUplink) error { return nil },
+		},
+		{
+			name:     "publish error",
+			handler:  func(common.EUI64, events.EventType, *bs.EndnodeUplink) error { return errors.New("publish error") },
+			wantCode: messages.ErrorCodeEIO,
+		},
+		{
+			name:     "publish panic",
+			handler:  func(common.EUI64, events.EventType, *bs.EndnodeUplink) error { panic("publish panic") },
+			wantCode: messages.ErrorCodeEIO,
+		},
+		{
+			name: "timeout",
+			handler: func(common.EUI64, events.EventType, *bs.EndnodeUplink) error {
+				<-block
+				return nil
+			},
+			wantCode: messages.ErrorCodeETIMEDOUT,
+		},
+		{
+			name:     "handler not set",
+			wantCode: messages.ErrorCodeEIO,
+		},
+	}
+
+	ts.backend.confirmPublish = true
+	ts.backend.confirmTimeout = 50 * time.Millisecond
+	ctx := context.Background()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+			ts.backend.SetConfirmedEndnodeMessageHandler(tt.handler)
+			ts.backend.publishes = newPublishes()
+
+			server, client := net.Pipe()
+			defer client.Close()
+			conn := newConnection(server, structs.SessionUuid{})
+			defer conn.conn.Close()
+
+			responses := []messages.MessageMsgp{
+				ts.backend.handleUlDataMessage(ctx, ts.bs_eui, &conn, &messages.UlData{OpId: 1}),
+				ts.backend.handleVmUlDataMessage(ctx, ts.bs_eui, &conn, &messages.VmUlData{OpId: 2}),
+			}
+			if tt.handler == nil {
+				for _, rsp := range responses {
+					if assert.IsType(&messages.BssciError{}, rsp) {
+						assert.Equal(tt.wantCode, rsp.(*messages.BssciError).Code)
+					}
+				}
+				return
+			}
+
+			// the responses are written once the publish completed
+			assert.Equal([]messages.MessageMsgp{nil, nil}, responses)
+			written := make(map[int64]structs.CommandHeader)
+			for range 2 {
+				cmd, raw, err := ReadBssciMessage(client)
+				if !assert.NoError(err) {
+					return
+				}
+				written[cmd.GetOpId()] = cmd
+				if tt.wantCode != 0 {
+					var bssciError messages.BssciError
+					_, err := bssciError.UnmarshalMsg(raw)
+					assert.NoError(err)
+					assert.Equal(tt.wantCode, bssciError.Code)
+				}
+			}
+			if tt.wantCode == 0 {
+				assert.Equal(structs.MsgUlDataRsp, written[1].Command)
+				assert.Equal(structs.MsgVmUlDataRsp, written[2].Command)
+			} else {
+				assert.Equal(structs.MsgError, written[1].Command)
+				assert.Equal(structs.MsgError, written[2].Command)
+			}
+		})
+	}
+}
+
+func (ts *TestBackendSuite) TestBackend_PublishConfirmationRetransmission() {
+	assert := assert.New(ts.T())
+
+	release := make(chan struct{})
+	var published atomic.Int32
+	ts.backend.SetConfirmedEndnodeMessageHandler(func(common.EUI64, events.EventType, *bs.EndnodeUplink) error {
+		published.Add(1)
+		<-release
+		return nil
+	})
+	ts.backend.confirmPublish = true
+	ts.backend.confirmTimeout = 50 * time.Millisecond
+	ctx := context.Background()
+
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := newConnection(server, structs.SessionUuid{})
+	defer conn.conn.Close()
+
+	// the publish does not complete in time
+	ul := messages.UlData{OpId: 1, EpEui: common.EUI64{1}, PacketCnt: 7, RxTime: 1}
+	assert.Nil(ts.backend.handleUlDataMessage(ctx, ts.bs_eui, &conn, &ul))
+	cmd, _, err := ReadBssciMessage(client)
+	assert.NoError(err)
+	assert.Equal(structs.MsgError, cmd.GetCommand())
+
+	// the retransmission joins the publish, which completes after all
+	ul.OpId = 2
+	assert.Nil(ts.backend.handleUlDataMessage(ctx, ts.bs_eui, &conn, &ul))
+	close(release)
+	cmd, _, err = ReadBssciMessage(client)
+	assert.NoError(err)
+	assert.Equal(structs.MsgUlDataRsp, cmd.GetCommand())
+	assert.Equal(int64(2), cmd.GetOpId())
+
+	// a retransmission of a published uplink is acknowledged without publishing it again
+	ul.OpId = 3
+	assert.Nil(ts.backend.handleUlDataMessage(ctx, ts.bs_eui, &conn, &ul))
+	cmd, _, err = ReadBssciMessage(client)
+	assert.NoError(err)
+	assert.Equal(structs.MsgUlDataRsp, cmd.GetCommand())
+	assert.Equal(int32(1), published.Load())
+}
+
 func (ts *TestBackendSuite) TestBackend_initBasestation() {
 	t := ts.T()
 
@@ -889,12 +1084,242 @@ func (ts *TestBackendSuite) TestBackend_initBasestation() {
 				assert.Equal(structs.MsgConRsp, cmd.Command)
 			}()
 
-			err := ts.backend.initBasestation(ctx, tt.args.con, server, tt.args.handler)
+			err := ts.backend.initBasestation(ctx, tt.args.con, nil, server, tt.args.handler)
 			assert.NoError(err)
 		})
 	}
 }
 
+func (ts *TestBackendSuite) TestBackend_initBasestationVersion() {
+	t := ts.T()
+
+	tests := []struct {
+		name            string
+		version         string
+		wantErr         bool
+		expectedCommand structs.Command
+		expectedVersion string
+	}{
+		{
+			name:            "supported",
+			version:         "1.0.0",
+			expectedCommand: structs.MsgConRsp,
+			expectedVersion: "1.0.0",
+		},
+		{
+			name:            "newer minor",
+			version:         "1.7.0",
+			expectedCommand: structs.MsgConRsp,
+			expectedVersion: structs.MaxVersion.String(),
+		},
+		{
+			name:            "build number",
+			version:         "1.0.0.1",
+			expectedCommand: structs.MsgConRsp,
+			expectedVersion: "1.0.0",
+		},
+		{
+			name:            "unsupported major",
+			version:         "2.0.0",
+			wantErr:         true,
+			expectedCommand: structs.MsgError,
+		},
+		{
+			name:            "invalid",
+			version:         "v1",
+			wantErr:         true,
+			expectedCommand: structs.MsgError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			ctx := log.Logger.WithContext(context.Background())
+			server, client := net.Pipe()
+
+			received := make(chan struct{})
+			go func() {
+				defer close(received)
+				cmd, raw, err := ReadBssciMessage(client)
+				assert.NoError(err)
+				assert.Equal(tt.expectedCommand, cmd.Command)
+
+				switch cmd.Command {
+				case structs.MsgConRsp:
+					var rsp messages.ConRsp
+					_, err = rsp.UnmarshalMsg(raw)
+					assert.NoError(err)
+					assert.Equal(tt.expectedVersion, rsp.Version)
+				case structs.MsgError:
+					var rsp messages.BssciError
+					_, err = rsp.UnmarshalMsg(raw)
+					assert.NoError(err)
+					assert.Equal(messages.ErrorCodeEPROTONOSUPPORT, rsp.Code)
+				}
+			}()
+
+			con := messages.Con{
+				Command:  structs.MsgCon,
+				Version:  tt.version,
+				BsEui:    common.EUI64{1},
+				SnBsUuid: structs.SessionUuid{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+			}
+			handler := func(ctx context.Context, eui common.EUI64, conn *connection) error {
+				if v, err := structs.ParseVersion(tt.expectedVersion); assert.NoError(err) {
+					assert.Equal(v, conn.Version())
+				}
+				return nil
+			}
+
+			err := ts.backend.initBasestation(ctx, con, nil, server, handler)
+			if tt.wantErr {
+				assert.Error(err)
+			} else {
+				assert.NoError(err)
+			}
+			<-received
+		})
+	}
+}
+
+func (ts *TestBackendSuite) TestBackend_initBasestationRawCon() {
+	assert := assert.New(ts.T())
+
+	var err error
+	ts.backend.rawFrames, err = newRawFrames(rawFormatMsgpack, []string{string(structs.MsgCon)})
+	ts.Require().NoError(err)
+	var raw *events.Raw
+	ts.backend.SetAdapterEventHandler(func(eui common.EUI64, e events.AdapterEvent) {
+		if r, ok := e.(*events.Raw); ok {
+			raw = r
+		}
+	})
+
+	con := messages.Con{
+		Command:  structs.MsgCon,
+		Version:  "1.0.0",
+		BsEui:    common.EUI64{1},
+		SnBsUuid: structs.SessionUuid{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	}
+	payload, err := con.MarshalMsg(nil)
+	ts.Require().NoError(err)
+
+	// a field unknown to the adapter is kept in the published frame
+	sz, rest, err := msgp.ReadMapHeaderBytes(payload)
+	ts.Require().NoError(err)
+	payload = msgp.AppendMapHeader(nil, sz+1)
+	payload = append(payload, rest...)
+	payload = msgp.AppendString(payload, "vendorExt")
+	payload = msgp.AppendString(payload, "value")
+
+	ctx := log.Logger.WithContext(context.Background())
+	server, client := net.Pipe()
+	go func() {
+		ReadBssciMessage(client)
+	}()
+
+	err = ts.backend.initBasestation(ctx, con, payload, server, func(ctx context.Context, eui common.EUI64, conn *connection) error {
+		return nil
+	})
+	assert.NoError(err)
+	if assert.NotNil(raw) {
+		assert.Equal(payload, raw.Payload)
+	}
+}
+
+func (ts *TestBackendSuite) TestBackend_initBasestationDuplicate() {
+	assert := assert.New(ts.T())
+
+	eui := common.EUI64{1}
+	existing, _ := net.Pipe()
+	existingConnection := newConnection(existing, structs.SessionUuid{})
+	ts.Require().NoError(ts.backend.basestations.set(eui, &existingConnection))
+
+	var published []events.EventType
+	ts.backend.SetBasestationMessageHandler(func(eui common.EUI64, event events.EventType, pb *bs.BasestationUplink) {
+		published = append(published, event)
+	})
+	ts.backend.SetAdapterEventHandler(func(eui common.EUI64, e events.AdapterEvent) {
+		published = append(published, e.GetEventType())
+	})
+
+	con := messages.Con{
+		Command:  structs.MsgCon,
+		Version:  "1.0.0",
+		BsEui:    eui,
+		SnBsUuid: structs.SessionUuid{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	}
+	server, client := net.Pipe()
+	defer client.Close()
+
+	err := ts.backend.initBasestation(log.Logger.WithContext(context.Background()), con, nil, server, func(ctx context.Context, eui common.EUI64, conn *connection) error {
+		return nil
+	})
+	assert.Error(err)
+
+	// neither con nor disconnect are published for the rejected connection
+	assert.Empty(published)
+	c, err := ts.backend.basestations.get(eui)
+	if assert.NoError(err) {
+		assert.Same(&existingConnection, c)
+	}
+}
+
+func (ts *TestBackendSuite) TestBackend_writeResponseError() {
+	assert := assert.New(ts.T())
+
+	server, client := net.Pipe()
+	client.Close()
+	conn := newConnection(server, structs.SessionUuid{})
+
+	rsp := messages.NewPingRsp(1)
+	assert.Error(ts.backend.writeResponse(log.Logger, common.EUI64{1}, &conn, &rsp))
+
+	// the connection is closed with the write error as reason
+	_, _, err := conn.Read()
+	assert.Error(err)
+	assert.Equal(events.DisconnectReasonWriteError, conn.DisconnectReason(err))
+}
+
+func (ts *TestBackendSuite) TestBackend_initBasestationPanic() {
+	assert := assert.New(ts.T())
+
+	var disconnect *events.Disconnect
+	ts.backend.SetAdapterEventHandler(func(eui common.EUI64, e events.AdapterEvent) {
+		disconnect, _ = e.(*events.Disconnect)
+	})
+
+	ctx := log.Logger.WithContext(context.Background())
+	server, client := net.Pipe()
+
+	go func() {
+		ReadBssciMessage(client)
+	}()
+
+	con := messages.Con{
+		Command:  structs.MsgCon,
+		Version:  "1.0.0",
+		BsEui:    common.EUI64{1},
+		SnBsUuid: structs.SessionUuid{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	}
+	handler := func(ctx context.Context, eui common.EUI64, conn *connection) error {
+		panic("handler panic")
+	}
+
+	err := ts.backend.initBasestation(ctx, con, nil, server, handler)
+	assert.ErrorContains(err, "handler panic")
+
+	// the connection is removed
+	_, err = ts.backend.basestations.get(con.BsEui)
+	assert.Error(err)
+
+	if assert.NotNil(disconnect) {
+		assert.Equal(events.DisconnectReasonInternalError, disconnect.Reason)
+	}
+}
+
 func (ts *TestBackendSuite) TestBackend_Start() {
 	t := ts.T()
 
@@ -940,3 +1365,59 @@ func (ts *TestBackendSuite) TestBackend_Start() {
 		})
 	}
 }
+
+func (ts *TestBackendSuite) TestBackend_StartInvalidCon() {
+	t := ts.T()
+
+	tests := []struct {
+		name string
+		msg  messages.MessageMsgp
+		code uint32
+	}{
+		{
+			name: "invalid con",
+			msg: &messages.Con{
+				Command: structs.MsgCon,
+				OpId:    0,
+				Version: "1.0.0",
+			},
+			code: messages.ErrorCodeEINVAL,
+		},
+		{
+			name: "not con",
+			msg: &messages.Ping{
+				Command: structs.MsgPing,
+				OpId:    0,
+			},
+			code: messages.ErrorCodeEPROTO,
+		},
+	}
+
+	require.NoError(t, ts.backend.Start())
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			addr := ts.backend.listener.Addr().String()
+			conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+			require.NoError(t, err)
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			require.NoError(t, WriteBssciMessage(conn, tt.msg))
+
+			cmd, raw, err := ReadBssciMessage(conn)
+			require.NoError(t, err)
+			assert.Equal(structs.MsgError, cmd.GetCommand())
+			var bssciError messages.BssciError
+			_, err = bssciError.UnmarshalMsg(raw)
+			require.NoError(t, err)
+			assert.Equal(tt.code, bssciError.Code)
+
+			// the connection is closed after the error
+			_, _, err = ReadBssciMessage(conn)
+			assert.Error(err)
+		})
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
 
-
 	"github.com/pkg/errors"
 )
 
@@ -15,12 +14,14 @@ type basestations struct {
 	basestations          map[common.EUI64]*connection
 	subscribeEventHandler func(events.Subscribe)
 
-
+	// connected basestations for which the subscription is delayed until they are stable
+	quarantined map[common.EUI64]struct{}
 }
 
-func newBasestations() basestations { 
+func newBasestations() basestations {
 	return basestations{
-		basestations:  make(map[common.EUI64]*connection),
+		basestations: make(map[common.EUI64]*connection),
+		quarantined:  make(map[common.EUI64]struct{}),
 	}
 }
 
@@ -47,11 +48,58 @@ func (b *basestations) set(eui common.EUI64, c *connection) error {
 	return nil
 }
 
-func (b *basestations) remove(eui common.EUI64) error {
+// Set the connection without subscribing the basestation, see release.
+func (b *basestations) setQuarantined(eui common.EUI64, c *connection) error {
 	b.Lock()
 	defer b.Unlock()
 
+	if b.quarantined == nil {
+		b.quarantined = make(map[common.EUI64]struct{})
+	}
+
+	b.basestations[eui] = c
+	b.quarantined[eui] = struct{}{}
+	return nil
+}
+
+// Subscribe a quarantined basestation, if the connection is still active.
+func (b *basestations) release(eui common.EUI64, c *connection) bool {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.quarantined[eui]; !ok {
+		return false
+	}
+	if b.basestations[eui] != c {
+		return false
+	}
+
+	delete(b.quarantined, eui)
+
 	if b.subscribeEventHandler != nil {
+		b.subscribeEventHandler(events.Subscribe{Subscribe: true, BasestationEui: eui})
+	}
+	return true
+}
+
+// Close all connections with the given reason
+func (b *basestations) closeAll(reason events.DisconnectReason) {
+	b.RLock()
+	defer b.RUnlock()
+
+	for _, c := range b.basestations {
+		c.Close(reason)
+	}
+}
+
+func (b *basestations) remove(eui common.EUI64) error {
+	b.Lock()
+	defer b.Unlock()
+
+	// quarantined basestations were never subscribed
+	if _, ok := b.quarantined[eui]; ok {
+		delete(b.quarantined, eui)
+	} else if b.subscribeEventHandler != nil {
 		b.subscribeEventHandler(events.Subscribe{Subscribe: false, BasestationEui: eui})
 	}
 
@@ -185,3 +185,50 @@ func (ts *TestBasestationsSuite) TestBasestations_remove() {
 		})
 	}
 }
+
+func (ts *TestBasestationsSuite) TestBasestations_quarantine() {
+	assert := assert.New(ts.T())
+
+	var subscribes []events.Subscribe
+	ts.basestations.subscribeEventHandler = func(s events.Subscribe) {
+		subscribes = append(subscribes, s)
+	}
+
+	eui := common.EUI64{2}
+	serverConn, _ := net.Pipe()
+	c := newConnection(serverConn, structs.NewSessionUuid(uuid.New()))
+
+	err := ts.basestations.setQuarantined(eui, &c)
+	assert.NoError(err)
+	assert.Empty(subscribes)
+
+	// a different connection can not release the basestation
+	assert.False(ts.basestations.release(eui, &ts.connection))
+	assert.Empty(subscribes)
+
+	assert.True(ts.basestations.release(eui, &c))
+	assert.Equal([]events.Subscribe{{Subscribe: true, BasestationEui: eui}}, subscribes)
+
+	// already released
+	assert.False(ts.basestations.release(eui, &c))
+	assert.Len(subscribes, 1)
+}
+
+func (ts *TestBasestationsSuite) TestBasestations_removeQuarantined() {
+	assert := assert.New(ts.T())
+
+	var subscribes []events.Subscribe
+	ts.basestations.subscribeEventHandler = func(s events.Subscribe) {
+		subscribes = append(subscribes, s)
+	}
+
+	err := ts.basestations.setQuarantined(ts.eui, &ts.connection)
+	assert.NoError(err)
+
+	// quarantined basestations were never subscribed
+	err = ts.basestations.remove(ts.eui)
+	assert.NoError(err)
+	assert.Empty(subscribes)
+	assert.Empty(ts.basestations.basestations)
+	assert.False(ts.basestations.release(ts.eui, &ts.connection))
+}
@@ -0,0 +1,198 @@
+// Package capture records the BSSCI frames of basestation sessions.
+//
+// A capture file starts with a header followed by one record per frame:
+//
+//	header: magic "BSSCICAP" | format version (1 byte) | bs eui (8 bytes) | session start (8 bytes)
+//	record: timestamp (8 bytes) | direction (1 byte) | length (4 bytes) | message pack payload
+//
+// Timestamps are unix nanoseconds, all numbers are little endian like the BSSCI header.
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	formatVersion = 1
+
+	headerSize       = 25
+	recordHeaderSize = 13
+
+	// upper bound for a single payload, protects the reader from corrupt files
+	maxPayloadSize = 1 << 24
+)
+
+var magic = [8]byte{'B', 'S', 'S', 'C', 'I', 'C', 'A', 'P'}
+
+const (
+	directionInbound  byte = 1
+	directionOutbound byte = 2
+)
+
+// Header of a capture file
+type Header struct {
+	// Basestation EUI64
+	BasestationEui common.EUI64
+	// Start of the captured session
+	SessionStart time.Time
+}
+
+// A captured BSSCI frame
+type Record struct {
+	// Time the frame was sent or received
+	Ts time.Time
+	// Direction of the frame
+	Direction events.RawDirection
+	// Message pack encoded message, without the BSSCI header
+	Payload []byte
+}
+
+// Writes a capture file
+type Writer struct {
+	w *bufio.Writer
+	// number of bytes written
+	size int64
+}
+
+// Create a capture writer and write the file header
+func NewWriter(w io.Writer, header Header) (*Writer, error) {
+	buf := make([]byte, headerSize)
+	copy(buf, magic[:])
+	buf[8] = formatVersion
+	binary.LittleEndian.PutUint64(buf[9:], common.Eui64toUnsignedInt(header.BasestationEui))
+	binary.LittleEndian.PutUint64(buf[17:], uint64(header.SessionStart.UnixNano()))
+
+	writer := Writer{w: bufio.NewWriter(w)}
+	if _, err := writer.w.Write(buf); err != nil {
+		return nil, errors.Wrap(err, "write header error")
+	}
+	writer.size = headerSize
+	return &writer, writer.w.Flush()
+}
+
+// Write a record, every record is flushed to keep the file usable if the adapter terminates
+func (w *Writer) Write(record Record) error {
+	var direction byte
+	switch record.Direction {
+	case events.RawDirectionInbound:
+		direction = directionInbound
+	case events.RawDirectionOutbound:
+		direction = directionOutbound
+	default:
+		return fmt.Errorf("invalid direction: %s", record.Direction)
+	}
+
+	buf := make([]byte, recordHeaderSize)
+	binary.LittleEndian.PutUint64(buf, uint64(record.Ts.UnixNano()))
+	buf[8] = direction
+	binary.LittleEndian.PutUint32(buf[9:], uint32(len(record.Payload)))
+
+	if _, err := w.w.Write(buf); err != nil {
+		return errors.Wrap(err, "write record error")
+	}
+	if _, err := w.w.Write(record.Payload); err != nil {
+		return errors.Wrap(err, "write record error")
+	}
+	w.size += int64(recordHeaderSize + len(record.Payload))
+	return w.w.Flush()
+}
+
+// Number of bytes written
+func (w *Writer) Size() int64 {
+	return w.size
+}
+
+// Reads a capture file
+type Reader struct {
+	r      *bufio.Reader
+	header Header
+}
+
+// Returns true if the buffer starts with the magic of a capture file
+func IsCapture(buf []byte) bool {
+	return len(buf) >= len(magic) && [8]byte(buf[:8]) == magic
+}
+
+// Create a capture reader and read the file header
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := Reader{r: bufio.NewReader(r)}
+
+	buf := make([]byte, headerSize)
+	if _, err := io.ReadFull(reader.r, buf); err != nil {
+		return nil, errors.Wrap(err, "read header error")
+	}
+	if [8]byte(buf[:8]) != magic {
+		return nil, errors.New("not a bssci capture file")
+	}
+	if buf[8] != formatVersion {
+		return nil, fmt.Errorf("unsupported capture format version %d", buf[8])
+	}
+
+	reader.header = Header{
+		BasestationEui: common.Eui64FromUnsignedInt(binary.LittleEndian.Uint64(buf[9:])),
+		SessionStart:   time.Unix(0, int64(binary.LittleEndian.Uint64(buf[17:]))),
+	}
+	return &reader, nil
+}
+
+// Header of the capture file
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Read the next record.
+//
+// returns io.EOF after the last record
+func (r *Reader) Next() (record Record, err error) {
+	buf := make([]byte, recordHeaderSize)
+	if _, err = io.ReadFull(r.r, buf); err != nil {
+		if err == io.EOF {
+			return record, io.EOF
+		}
+		return record, errors.Wrap(err, "read record error")
+	}
+
+	record.Ts = time.Unix(0, int64(binary.LittleEndian.Uint64(buf)))
+	switch buf[8] {
+	case directionInbound:
+		record.Direction = events.RawDirectionInbound
+	case directionOutbound:
+		record.Direction = events.RawDirectionOutbound
+	default:
+		return record, fmt.Errorf("invalid direction %d", buf[8])
+	}
+
+	length := binary.LittleEndian.Uint32(buf[9:])
+	if length > maxPayloadSize {
+		return record, fmt.Errorf("record length %d exceeds maximum", length)
+	}
+	record.Payload = make([]byte, length)
+	if _, err = io.ReadFull(r.r, record.Payload); err != nil {
+		return record, errors.Wrap(err, "read record payload error")
+	}
+	return record, nil
+}
+
+// Read all remaining records
+func (r *Reader) ReadAll() ([]Record, error) {
+	var records []Record
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, record)
+	}
+}
@@ -0,0 +1,171 @@
+package capture
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterReader(t *testing.T) {
+	assert := assert.New(t)
+
+	header := Header{
+		BasestationEui: common.EUI64{0, 1, 2, 3, 4, 5, 6, 7},
+		SessionStart:   time.Unix(0, 1704067200000000000),
+	}
+	records := []Record{
+		{Ts: time.Unix(0, 1704067200000000001), Direction: events.RawDirectionInbound, Payload: []byte{1, 2, 3}},
+		{Ts: time.Unix(0, 1704067201000000000), Direction: events.RawDirectionOutbound, Payload: []byte{4}},
+		{Ts: time.Unix(0, 1704067202000000000), Direction: events.RawDirectionInbound, Payload: []byte{}},
+	}
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, header)
+	require.NoError(t, err)
+	for _, r := range records {
+		assert.NoError(w.Write(r))
+	}
+	assert.Equal(int64(buf.Len()), w.Size())
+	assert.True(IsCapture(buf.Bytes()))
+	assert.False(IsCapture([]byte("MIOTYB01")))
+
+	assert.Error(w.Write(Record{Direction: "sideways"}))
+
+	r, err := NewReader(&buf)
+	require.NoError(t, err)
+	assert.Equal(header.BasestationEui, r.Header().BasestationEui)
+	assert.True(header.SessionStart.Equal(r.Header().SessionStart))
+
+	got, err := r.ReadAll()
+	assert.NoError(err)
+	if assert.Len(got, len(records)) {
+		for i := range records {
+			assert.True(records[i].Ts.Equal(got[i].Ts))
+			assert.Equal(records[i].Direction, got[i].Direction)
+			assert.Equal(records[i].Payload, got[i].Payload)
+		}
+	}
+
+	_, err = r.Next()
+	assert.Equal(io.EOF, err)
+}
+
+func TestNewReader(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "empty",
+			data: []byte{},
+		},
+		{
+			name: "invalid magic",
+			data: append([]byte("NOTACAPT"), make([]byte, headerSize-8)...),
+		},
+		{
+			name: "unsupported version",
+			data: append(append(magic[:], 99), make([]byte, headerSize-9)...),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(bytes.NewReader(tt.data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestReader_truncated(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Header{})
+	require.NoError(t, err)
+	require.NoError(t, w.Write(Record{Ts: time.Now(), Direction: events.RawDirectionInbound, Payload: []byte{1, 2, 3}}))
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	require.NoError(t, err)
+
+	_, err = r.Next()
+	assert.Error(t, err)
+	assert.NotEqual(t, io.EOF, err)
+}
+
+func TestSession(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	eui := common.EUI64{1}
+	start := time.Unix(0, 1704067200000000000)
+
+	// two records per file
+	options := Options{Directory: dir, MaxSize: headerSize + 2*(recordHeaderSize+10)}
+	s, err := OpenSession(options, eui, start)
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(s.Write(Record{Ts: start.Add(time.Duration(i) * time.Second), Direction: events.RawDirectionInbound, Payload: make([]byte, 10)}))
+	}
+	assert.NoError(s.Close())
+	// writes after closing are dropped
+	assert.NoError(s.Write(Record{Ts: start, Direction: events.RawDirectionInbound}))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+FileExtension))
+	require.NoError(t, err)
+	assert.Equal([]string{
+		filepath.Join(dir, fileName(Header{BasestationEui: eui, SessionStart: start}, 0)),
+		filepath.Join(dir, fileName(Header{BasestationEui: eui, SessionStart: start}, 1)),
+		filepath.Join(dir, fileName(Header{BasestationEui: eui, SessionStart: start}, 2)),
+	}, files)
+
+	var count int
+	for _, file := range files {
+		f, err := os.Open(file)
+		require.NoError(t, err)
+		r, err := NewReader(f)
+		require.NoError(t, err)
+		records, err := r.ReadAll()
+		assert.NoError(err)
+		count += len(records)
+		f.Close()
+	}
+	assert.Equal(5, count)
+}
+
+func TestSession_prune(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	options := Options{Directory: dir, MaxFiles: 2}
+	start := time.Now()
+
+	// other files are kept
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o640))
+
+	for i := 0; i < 4; i++ {
+		s, err := OpenSession(options, common.EUI64{byte(i)}, start)
+		require.NoError(t, err)
+		assert.NoError(s.Close())
+
+		// make the modification times distinct, older than the next created file
+		path := filepath.Join(dir, fileName(Header{BasestationEui: common.EUI64{byte(i)}, SessionStart: start}, 0))
+		mtime := start.Add(-time.Hour + time.Duration(i)*time.Second)
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+FileExtension))
+	require.NoError(t, err)
+	assert.Equal([]string{
+		filepath.Join(dir, fileName(Header{BasestationEui: common.EUI64{2}, SessionStart: start}, 0)),
+		filepath.Join(dir, fileName(Header{BasestationEui: common.EUI64{3}, SessionStart: start}, 0)),
+	}, files)
+	assert.FileExists(filepath.Join(dir, "notes.txt"))
+}
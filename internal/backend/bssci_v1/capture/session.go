@@ -0,0 +1,173 @@
+package capture
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/pkg/errors"
+)
+
+// File extension of capture files
+const FileExtension = ".bscap"
+
+// Capture options
+type Options struct {
+	// Directory for the capture files
+	Directory string
+	// Maximum size of a capture file in bytes, a session is continued in a new file once exceeded, 0 disables the limit
+	MaxSize int64
+	// Maximum number of capture files in the directory, the oldest files are removed, 0 disables the limit
+	MaxFiles int
+}
+
+// Captures the frames of a basestation session into rotated files
+type Session struct {
+	sync.Mutex
+
+	options Options
+	header  Header
+
+	file   *os.File
+	writer *Writer
+	// number of the current file of this session
+	part int
+	// set once the capture failed, no further records are written
+	err error
+}
+
+// Start capturing a basestation session
+func OpenSession(options Options, eui common.EUI64, start time.Time) (*Session, error) {
+	s := Session{
+		options: options,
+		header:  Header{BasestationEui: eui, SessionStart: start},
+	}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Name of the capture file of a session part
+func fileName(header Header, part int) string {
+	return fmt.Sprintf("%s_%s_%03d%s", header.BasestationEui, header.SessionStart.UTC().Format("20060102T150405.000000000Z"), part, FileExtension)
+}
+
+func (s *Session) open() error {
+	path := filepath.Join(s.options.Directory, fileName(s.header, s.part))
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return errors.Wrap(err, "create capture file error")
+	}
+	writer, err := NewWriter(file, s.header)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.writer = writer
+
+	if err := s.prune(); err != nil {
+		file.Close()
+		return err
+	}
+	return nil
+}
+
+// Remove the oldest capture files exceeding MaxFiles
+func (s *Session) prune() error {
+	if s.options.MaxFiles <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(s.options.Directory)
+	if err != nil {
+		return errors.Wrap(err, "read capture directory error")
+	}
+
+	// the file names of a basestation sort by session start, so sort by modification time across basestations
+	type captureFile struct {
+		name    string
+		modTime time.Time
+	}
+	var files []captureFile
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), FileExtension) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, captureFile{name: entry.Name(), modTime: info.ModTime()})
+	}
+	if len(files) <= s.options.MaxFiles {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].modTime.Equal(files[j].modTime) {
+			return files[i].name < files[j].name
+		}
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	current := s.file.Name()
+	for _, f := range files[:len(files)-s.options.MaxFiles] {
+		path := filepath.Join(s.options.Directory, f.name)
+		if path == current {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "remove capture file error")
+		}
+	}
+	return nil
+}
+
+// Write a record, the session continues in a new file if MaxSize is exceeded.
+//
+// After the first error the capture is stopped and all further records are dropped.
+func (s *Session) Write(record Record) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.err != nil {
+		return nil
+	}
+
+	if s.options.MaxSize > 0 && s.writer.Size() > headerSize && s.writer.Size()+int64(recordHeaderSize+len(record.Payload)) > s.options.MaxSize {
+		s.file.Close()
+		s.part++
+		if err := s.open(); err != nil {
+			s.err = err
+			return err
+		}
+	}
+
+	if err := s.writer.Write(record); err != nil {
+		s.err = err
+		s.file.Close()
+		return err
+	}
+	return nil
+}
+
+// Stop capturing the session
+func (s *Session) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.err != nil {
+		return nil
+	}
+	s.err = errors.New("capture closed")
+	return s.file.Close()
+}
@@ -96,6 +96,11 @@ func MarshalBssciMessage(msg messages.MessageMsgp) ([]byte, error) {
 // read the bssci header and extract the raw message pack data
 func UnmarshalBssciMessage(buf []byte) (cmd structs.CommandHeader, raw msgp.Raw, err error) {
 
+	if len(buf) < bssciHeaderSize {
+		err = errors.Errorf("header error: buffer too short: %v", len(buf))
+		return
+	}
+
 	// get length
 	header_buf := buf[:bssciHeaderSize]
 
@@ -104,6 +109,10 @@ func UnmarshalBssciMessage(buf []byte) (cmd structs.CommandHeader, raw msgp.Raw,
 		err = errors.Wrap(err, "header error")
 		return
 	}
+	if length < 0 || int(length) > len(buf)-bssciHeaderSize {
+		err = errors.Errorf("header error: message length %v exceeds buffer", length)
+		return
+	}
 
 	// slice off header
 	buf = buf[bssciHeaderSize : bssciHeaderSize+length]
@@ -205,6 +205,24 @@ func TestUnmarshalBssciMessage(t *testing.T) {
 			wantRaw: nil,
 			wantErr: true,
 		},
+		{
+			name: "short_header",
+			args: args{
+				buf: []byte{77, 73, 79, 84, 89, 66, 48, 49},
+			},
+			wantCmd: structs.CommandHeader{},
+			wantRaw: nil,
+			wantErr: true,
+		},
+		{
+			name: "short_message",
+			args: args{
+				buf: []byte{77, 73, 79, 84, 89, 66, 48, 49, 20, 0, 0, 0, 130, 167, 99, 111, 109, 109, 97, 110, 100},
+			},
+			wantCmd: structs.CommandHeader{},
+			wantRaw: nil,
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
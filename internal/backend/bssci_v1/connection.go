@@ -1,12 +1,16 @@
 package bssci_v1
 
 import (
+	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs/messages"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -21,6 +25,23 @@ type connection struct {
 	SnBsUuid uuid.UUID
 	// Service Center session UUID, used to resume session
 	SnScUuid uuid.UUID
+
+	// session statistics
+	connectedAt time.Time
+	rxCount     atomic.Uint64
+	txCount     atomic.Uint64
+
+	// reason set when the connection is closed by the adapter
+	closeReason events.DisconnectReason
+
+	// open operations, nil if the sequence is not tracked
+	operations *operationTracker
+
+	// negotiated protocol version, zero if not negotiated
+	version structs.Version
+
+	// called for every frame sent or received, nil if frames are not published
+	onFrame func(direction events.RawDirection, cmd structs.Command, opId int64, payload []byte)
 }
 
 func newConnection(conn net.Conn, snBsUuid structs.SessionUuid) connection {
@@ -31,12 +52,34 @@ func newConnection(conn net.Conn, snBsUuid structs.SessionUuid) connection {
 	return connection{
 		conn: conn,
 		// stats:      stats.NewCollector(),
-		opId:     -1,
-		SnBsUuid: snBsUuid.ToUuid(),
-		SnScUuid: snScUuid,
+		opId:        -1,
+		SnBsUuid:    snBsUuid.ToUuid(),
+		SnScUuid:    snScUuid,
+		connectedAt: time.Now(),
 	}
 }
 
+// Get the negotiated protocol version
+func (conn *connection) Version() structs.Version {
+	conn.RLock()
+	defer conn.RUnlock()
+	return conn.version
+}
+
+// Set the negotiated protocol version
+func (conn *connection) SetVersion(v structs.Version) {
+	conn.Lock()
+	defer conn.Unlock()
+	conn.version = v
+}
+
+// Returns true if the command is part of the negotiated protocol version.
+//
+// A connection without a negotiated version supports every command.
+func (conn *connection) SupportsCommand(cmd structs.Command) bool {
+	return messages.Supported(cmd, conn.Version())
+}
+
 // Send the message to this connection
 func (conn *connection) Write(msg messages.MessageMsgp, timeout time.Duration) (err error) {
 	conn.Lock()
@@ -48,12 +91,19 @@ func (conn *connection) Write(msg messages.MessageMsgp, timeout time.Duration) (
 		return errors.Wrap(err, "marshal msgp error")
 	}
 
+	// the basestation may answer before the write returns
+	rollback := conn.operations.sent(msg.GetCommand(), msg.GetOpId(), time.Now())
+
 	conn.conn.SetWriteDeadline(time.Now().Add(timeout))
 	_, err = conn.conn.Write(bb)
 	if err != nil {
-		// conn.conn.Close()
+		rollback()
 		return errors.Wrap(err, "write error")
 	}
+	conn.txCount.Add(1)
+	if conn.onFrame != nil {
+		conn.onFrame(events.RawDirectionOutbound, msg.GetCommand(), msg.GetOpId(), bb[bssciHeaderSize:])
+	}
 
 	return
 }
@@ -67,6 +117,10 @@ func (conn *connection) Read() (cmd structs.CommandHeader, raw msgp.Raw, err err
 	if err != nil {
 		return
 	}
+	conn.rxCount.Add(1)
+	if conn.onFrame != nil {
+		conn.onFrame(events.RawDirectionInbound, cmd.GetCommand(), cmd.GetOpId(), raw)
+	}
 
 	return
 }
@@ -104,3 +158,58 @@ func (conn *connection) ResumeConnection(snBsUuid uuid.UUID, snScOpId *int64) (r
 	return false, snScUuid
 
 }
+
+// Close the connection from the adapter side.
+//
+// Only the first reason is kept, as subsequent errors are caused by closing the connection.
+func (conn *connection) Close(reason events.DisconnectReason) error {
+	conn.Lock()
+	if conn.closeReason == "" {
+		conn.closeReason = reason
+	}
+	conn.Unlock()
+
+	return conn.conn.Close()
+}
+
+// Determine why the session ended, err is the error returned by the message handler.
+func (conn *connection) DisconnectReason(err error) events.DisconnectReason {
+	conn.RLock()
+	reason := conn.closeReason
+	conn.RUnlock()
+
+	if reason != "" {
+		return reason
+	}
+
+	cause := errors.Cause(err)
+
+	var netErr net.Error
+	if errors.As(cause, &netErr) && netErr.Timeout() {
+		return events.DisconnectReasonPingTimeout
+	}
+	if netErr != nil || cause == io.EOF || cause == io.ErrUnexpectedEOF || cause == io.ErrClosedPipe {
+		return events.DisconnectReasonReadError
+	}
+	return events.DisconnectReasonCodecError
+}
+
+// Collect the session statistics into a disconnect event
+func (conn *connection) DisconnectEvent(eui common.EUI64, err error) events.Disconnect {
+	now := time.Now()
+	e := events.Disconnect{
+		BasestationEui:   eui,
+		Ts:               now,
+		Reason:           conn.DisconnectReason(err),
+		SessionDuration:  now.Sub(conn.connectedAt),
+		MessagesReceived: conn.rxCount.Load(),
+		MessagesSent:     conn.txCount.Load(),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if addr := conn.conn.RemoteAddr(); addr != nil {
+		e.RemoteAddr = addr.String()
+	}
+	return e
+}
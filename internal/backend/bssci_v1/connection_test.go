@@ -1,15 +1,21 @@
 package bssci_v1
 
 import (
+	"io"
 	"net"
+	"os"
 
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs/messages"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
 
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
 	"github.com/tinylib/msgp/msgp"
 
 	"github.com/stretchr/testify/assert"
@@ -233,3 +239,141 @@ func (ts *TestConnectionSuite) TestConnection_ResumeConnection() {
 		})
 	}
 }
+
+func (ts *TestConnectionSuite) TestConnection_DisconnectReason() {
+	t := ts.T()
+
+	tests := []struct {
+		name string
+		err  error
+		want events.DisconnectReason
+	}{
+		{
+			name: "eof",
+			err:  errors.Wrap(io.EOF, "io read error on header"),
+			want: events.DisconnectReasonReadError,
+		},
+		{
+			name: "closed pipe",
+			err:  errors.Wrap(io.ErrClosedPipe, "io read error on message"),
+			want: events.DisconnectReasonReadError,
+		},
+		{
+			name: "timeout",
+			err:  errors.Wrap(&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, "io read error on header"),
+			want: events.DisconnectReasonPingTimeout,
+		},
+		{
+			name: "codec",
+			err:  errors.New("message header error: invalid identifier in buffer"),
+			want: events.DisconnectReasonCodecError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ts.connection.DisconnectReason(tt.err))
+		})
+	}
+}
+
+func (ts *TestConnectionSuite) TestConnection_Close() {
+	assert := assert.New(ts.T())
+
+	assert.NoError(ts.connection.Close(events.DisconnectReasonServerShutdown))
+	// the first reason is kept
+	ts.connection.Close(events.DisconnectReasonPingTimeout)
+
+	assert.Equal(events.DisconnectReasonServerShutdown, ts.connection.DisconnectReason(io.EOF))
+}
+
+func (ts *TestConnectionSuite) TestConnection_DisconnectEvent() {
+	assert := assert.New(ts.T())
+
+	eui := common.EUI64{1}
+
+	go func() {
+		WriteBssciMessage(ts.clientConn, &messages.Ping{Command: structs.MsgPing})
+		ReadBssciMessage(ts.clientConn)
+	}()
+
+	_, _, err := ts.connection.Read()
+	assert.NoError(err)
+	ping := messages.NewPingRsp(0)
+	assert.NoError(ts.connection.Write(&ping, time.Second))
+
+	event := ts.connection.DisconnectEvent(eui, io.EOF)
+	assert.Equal(eui, event.BasestationEui)
+	assert.Equal(events.DisconnectReasonReadError, event.Reason)
+	assert.Equal(io.EOF.Error(), event.Error)
+	assert.Equal(uint64(1), event.MessagesReceived)
+	assert.Equal(uint64(1), event.MessagesSent)
+	assert.Equal("pipe", event.RemoteAddr)
+	assert.Positive(event.SessionDuration)
+}
+
+func (ts *TestConnectionSuite) TestConnection_onFrame() {
+	assert := assert.New(ts.T())
+
+	type frame struct {
+		direction events.RawDirection
+		cmd       structs.Command
+		opId      int64
+	}
+	var frames []frame
+	ts.connection.onFrame = func(direction events.RawDirection, cmd structs.Command, opId int64, payload []byte) {
+		frames = append(frames, frame{direction, cmd, opId})
+		assert.NotEmpty(payload)
+	}
+
+	go func() {
+		WriteBssciMessage(ts.clientConn, &messages.Ping{Command: structs.MsgPing, OpId: 3})
+		ReadBssciMessage(ts.clientConn)
+	}()
+
+	_, _, err := ts.connection.Read()
+	assert.NoError(err)
+	ping := messages.NewPingRsp(3)
+	assert.NoError(ts.connection.Write(&ping, time.Second))
+
+	assert.Equal([]frame{
+		{events.RawDirectionInbound, structs.MsgPing, 3},
+		{events.RawDirectionOutbound, structs.MsgPingRsp, 3},
+	}, frames)
+}
+
+// net.Conn which calls onWrite before the write returns
+type answeringConn struct {
+	net.Conn
+	onWrite func()
+}
+
+func (c *answeringConn) Write(b []byte) (int, error) {
+	c.onWrite()
+	return len(b), nil
+}
+
+func (ts *TestConnectionSuite) TestConnection_WriteTracksBeforeWrite() {
+	assert := assert.New(ts.T())
+
+	tracker := newOperationTracker(zerolog.Nop(), common.EUI64{1}, time.Minute)
+
+	// the basestation answers before the write returns
+	var answerErr error
+	conn := answeringConn{Conn: ts.serverConn, onWrite: func() {
+		answerErr = tracker.received(structs.MsgPingRsp, -1, time.Now())
+	}}
+	ts.connection.conn = &conn
+	ts.connection.operations = tracker
+
+	ping := messages.NewPing(-1)
+	assert.NoError(ts.connection.Write(&ping, time.Second))
+	assert.NoError(answerErr)
+
+	// a failed write is not tracked
+	ts.connection.conn = ts.serverConn
+	ts.serverConn.Close()
+	status := messages.NewStatus(-2)
+	assert.Error(ts.connection.Write(&status, time.Second))
+	assert.Equal(1, tracker.open())
+}
@@ -0,0 +1,109 @@
+package bssci_v1
+
+import (
+	"encoding/json"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs/messages"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/pkg/errors"
+	"github.com/tinylib/msgp/msgp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// A BSSCI frame decoded for inspection
+type Frame struct {
+	Command structs.Command
+	OpId    int64
+	// message pack encoded message
+	Payload msgp.Raw
+	// message decoded into the struct of its command, nil if decoding failed
+	Message messages.MessageMsgp
+	// error decoding the message into the struct of its command
+	Err error
+}
+
+// Decode the message pack payload of a frame without the BSSCI header
+func DecodeFrame(payload []byte) (Frame, error) {
+	var cmd structs.CommandHeader
+	if _, err := cmd.UnmarshalMsg(payload); err != nil {
+		return Frame{}, errors.Wrap(err, "command error")
+	}
+
+	frame := Frame{
+		Command: cmd.GetCommand(),
+		OpId:    cmd.GetOpId(),
+		Payload: payload,
+	}
+	frame.Message, frame.Err = messages.UnmarshalMessage(frame.Command, payload)
+	return frame, nil
+}
+
+// Decode consecutive frames including their BSSCI headers
+func DecodeFrames(buf []byte) ([]Frame, error) {
+	var frames []Frame
+	for len(buf) > 0 {
+		_, raw, err := UnmarshalBssciMessage(buf)
+		if err != nil {
+			return frames, errors.Wrapf(err, "frame %d", len(frames))
+		}
+		// the header was validated by UnmarshalBssciMessage
+		length, _ := getBssciMessageLengthFromHeader(buf[:bssciHeaderSize])
+		buf = buf[bssciHeaderSize+int(length):]
+
+		frame, err := DecodeFrame(raw)
+		if err != nil {
+			return frames, errors.Wrapf(err, "frame %d", len(frames))
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// The message decoded generically, for frames which can not be decoded into a struct
+func (f *Frame) Data() (*structpb.Struct, error) {
+	return decodeRawFrame(f.Payload)
+}
+
+// The protobuf message the adapter publishes for the frame, nil if the frame is not published.
+// Invalid messages are rejected by the adapter and nil as well, the conversion expects a valid message.
+func (f *Frame) Proto(bsEui common.EUI64) proto.Message {
+	if f.Validate() != nil {
+		return nil
+	}
+	switch msg := f.Message.(type) {
+	case messages.EndnodeMessage:
+		return msg.IntoProto(&bsEui)
+	case messages.BasestationMessage:
+		return msg.IntoProto(&bsEui)
+	default:
+		return nil
+	}
+}
+
+// Validate the decoded message, nil if the message has no semantic checks
+func (f *Frame) Validate() error {
+	if msg, ok := f.Message.(messages.ValidatableMessage); ok {
+		return msg.Validate()
+	}
+	return nil
+}
+
+// Build a frame including the BSSCI header from a JSON encoded message
+func EncodeFrame(data []byte) ([]byte, error) {
+	var cmd structs.CommandHeader
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return nil, errors.Wrap(err, "command error")
+	}
+
+	msg, err := messages.NewMessage(cmd.GetCommand())
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal %s error", cmd.GetCommand())
+	}
+	return MarshalBssciMessage(msg)
+}
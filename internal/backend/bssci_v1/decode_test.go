@@ -0,0 +1,128 @@
+package bssci_v1
+
+import (
+	"testing"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs/messages"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeFrames(t *testing.T) {
+	assert := assert.New(t)
+
+	epEui := common.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	ulData := messages.NewUlData(2, epEui, 1704067200000000000, nil, 3, 1.5, -100, nil, nil, nil, nil, []byte{0xca, 0xfe}, nil, false, false, false)
+	ping := messages.NewPing(-1)
+
+	var buf []byte
+	for _, msg := range []messages.MessageMsgp{&ulData, &ping} {
+		frame, err := MarshalBssciMessage(msg)
+		require.NoError(t, err)
+		buf = append(buf, frame...)
+	}
+
+	frames, err := DecodeFrames(buf)
+	require.NoError(t, err)
+	if assert.Len(frames, 2) {
+		assert.Equal(structs.MsgUlData, frames[0].Command)
+		assert.Equal(int64(2), frames[0].OpId)
+		assert.NoError(frames[0].Err)
+		assert.Equal(&ulData, frames[0].Message)
+		assert.NoError(frames[0].Validate())
+
+		pb, ok := frames[0].Proto(common.EUI64{8}).(*bs.EndnodeUplink)
+		if assert.True(ok) {
+			assert.Equal(common.EUI64{8}.String(), pb.GetBsEui())
+			assert.Equal([]byte{0xca, 0xfe}, pb.GetUlData().GetData())
+		}
+
+		assert.Equal(structs.MsgPing, frames[1].Command)
+		assert.Equal(&ping, frames[1].Message)
+		assert.Nil(frames[1].Proto(common.EUI64{}))
+	}
+
+	// truncated second frame
+	frames, err = DecodeFrames(buf[:len(buf)-1])
+	assert.Error(err)
+	assert.Len(frames, 1)
+
+	_, err = DecodeFrames([]byte("MIOTY"))
+	assert.Error(err)
+}
+
+func TestDecodeFrame_invalidSubpackets(t *testing.T) {
+	assert := assert.New(t)
+
+	epEui := common.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	phase := []int32{5}
+	subpackets := messages.Subpackets{
+		SNR:       []int32{3},
+		RSSI:      []int32{-100, -101, -102},
+		Frequency: []int32{100},
+		Phase:     &phase,
+	}
+	ulData := messages.NewUlData(2, epEui, 1704067200000000000, nil, 3, 1.5, -100, nil, nil, nil, &subpackets, []byte{0xca, 0xfe}, nil, false, false, false)
+
+	buf, err := MarshalBssciMessage(&ulData)
+	require.NoError(t, err)
+
+	frames, err := DecodeFrames(buf)
+	require.NoError(t, err)
+	if assert.Len(frames, 1) {
+		assert.NoError(frames[0].Err)
+		assert.Error(frames[0].Validate())
+		assert.NotPanics(func() {
+			assert.Nil(frames[0].Proto(common.EUI64{8}))
+		})
+	}
+}
+
+func TestDecodeFrame_unknownCommand(t *testing.T) {
+	assert := assert.New(t)
+
+	payload, err := (&messages.BssciErrorAck{Command: "unknown", OpId: 4}).MarshalMsg(nil)
+	require.NoError(t, err)
+
+	frame, err := DecodeFrame(payload)
+	require.NoError(t, err)
+	assert.Equal(structs.Command("unknown"), frame.Command)
+	assert.Equal(int64(4), frame.OpId)
+	assert.Nil(frame.Message)
+	assert.Error(frame.Err)
+
+	data, err := frame.Data()
+	if assert.NoError(err) {
+		assert.Equal("unknown", data.GetFields()["command"].GetStringValue())
+	}
+
+	_, err = DecodeFrame([]byte{0xc0})
+	assert.Error(err)
+}
+
+func TestEncodeFrame(t *testing.T) {
+	assert := assert.New(t)
+
+	frame, err := EncodeFrame([]byte(`{"command": "vm.activate", "opId": -3, "macType": 2}`))
+	require.NoError(t, err)
+
+	frames, err := DecodeFrames(frame)
+	require.NoError(t, err)
+	if assert.Len(frames, 1) {
+		msg := messages.NewVmActivate(-3, 2)
+		assert.Equal(&msg, frames[0].Message)
+	}
+
+	for _, data := range []string{
+		`{"command": "unknown", "opId": 1}`,
+		`{"command": "ping", "opId": "one"}`,
+		`not json`,
+	} {
+		_, err := EncodeFrame([]byte(data))
+		assert.Error(err, data)
+	}
+}
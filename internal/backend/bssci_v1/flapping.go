@@ -0,0 +1,160 @@
+package bssci_v1
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/pkg/errors"
+)
+
+// Keeps track of the connect history per basestation to detect flapping connections.
+type flapDetector struct {
+	sync.Mutex
+
+	// a basestation is flapping if it connects threshold times within window
+	window    time.Duration
+	threshold int
+	// a flapping basestation is stable again after staying connected for stablePeriod
+	stablePeriod time.Duration
+
+	history map[common.EUI64]*flapHistory
+}
+
+type flapHistory struct {
+	connects    []time.Time
+	disconnects []time.Time
+	// time of the last connect or disconnect
+	last     time.Time
+	flapping bool
+}
+
+func newFlapDetector(window time.Duration, threshold int, stablePeriod time.Duration) (*flapDetector, error) {
+	if window <= 0 {
+		return nil, errors.Errorf("window must be positive, got %s", window)
+	}
+	// a threshold of one would flag every connect
+	if threshold < 2 {
+		return nil, errors.Errorf("threshold must be at least 2, got %d", threshold)
+	}
+
+	return &flapDetector{
+		window:       window,
+		threshold:    threshold,
+		stablePeriod: stablePeriod,
+		history:      make(map[common.EUI64]*flapHistory),
+	}, nil
+}
+
+// Record a connect of the basestation.
+//
+// returns true if the basestation just started flapping
+func (d *flapDetector) connect(eui common.EUI64, now time.Time) (started bool) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.prune(now)
+
+	h, ok := d.history[eui]
+	if !ok {
+		h = &flapHistory{}
+		d.history[eui] = h
+	}
+
+	h.connects = append(h.connects, now)
+	h.last = now
+
+	if !h.flapping && len(h.connects) >= d.threshold {
+		h.flapping = true
+		return true
+	}
+	return false
+}
+
+// Record a disconnect of the basestation.
+func (d *flapDetector) disconnect(eui common.EUI64, now time.Time) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.prune(now)
+
+	h, ok := d.history[eui]
+	if !ok {
+		return
+	}
+
+	h.disconnects = append(h.disconnects, now)
+	h.last = now
+}
+
+// Remove the timestamps outside of the window and the histories without any left.
+//
+// A flapping basestation is kept until it was marked as stable, or for stablePeriod after
+// its last connect or disconnect in case it never becomes stable.
+//
+// The caller must hold the lock.
+func (d *flapDetector) prune(now time.Time) {
+	cutoff := now.Add(-d.window)
+	for eui, h := range d.history {
+		h.connects = pruneBefore(h.connects, cutoff)
+		h.disconnects = pruneBefore(h.disconnects, cutoff)
+
+		if len(h.connects) != 0 || len(h.disconnects) != 0 {
+			continue
+		}
+		if !h.flapping || now.Sub(h.last) > d.stablePeriod {
+			delete(d.history, eui)
+		}
+	}
+}
+
+// Mark the basestation as stable.
+//
+// returns true if the basestation was flapping before
+func (d *flapDetector) stable(eui common.EUI64) (stopped bool) {
+	d.Lock()
+	defer d.Unlock()
+
+	h, ok := d.history[eui]
+	if !ok {
+		return false
+	}
+	// a stable basestation starts with a clean history
+	delete(d.history, eui)
+	return h.flapping
+}
+
+// Check if the basestation is currently flagged as flapping.
+func (d *flapDetector) isFlapping(eui common.EUI64) bool {
+	d.Lock()
+	defer d.Unlock()
+
+	h, ok := d.history[eui]
+	return ok && h.flapping
+}
+
+// Returns the number of connects and disconnects within the window.
+func (d *flapDetector) counts(eui common.EUI64, now time.Time) (connects int, disconnects int) {
+	d.Lock()
+	defer d.Unlock()
+
+	h, ok := d.history[eui]
+	if !ok {
+		return 0, 0
+	}
+
+	cutoff := now.Add(-d.window)
+	h.connects = pruneBefore(h.connects, cutoff)
+	h.disconnects = pruneBefore(h.disconnects, cutoff)
+	return len(h.connects), len(h.disconnects)
+}
+
+// remove all timestamps older than cutoff, timestamps are expected in ascending order
+func pruneBefore(ts []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(ts) && ts[i].Before(cutoff) {
+		i++
+	}
+	return ts[i:]
+}
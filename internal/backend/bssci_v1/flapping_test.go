@@ -0,0 +1,140 @@
+package bssci_v1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlapDetector(t *testing.T) {
+	assert := assert.New(t)
+
+	eui := common.EUI64{1}
+	now := time.Now()
+	d, err := newFlapDetector(time.Minute, 3, time.Minute)
+	require.NoError(t, err)
+
+	assert.False(d.connect(eui, now))
+	d.disconnect(eui, now.Add(time.Second))
+	assert.False(d.connect(eui, now.Add(2*time.Second)))
+	d.disconnect(eui, now.Add(3*time.Second))
+	assert.False(d.isFlapping(eui))
+
+	// third connect within the window
+	assert.True(d.connect(eui, now.Add(4*time.Second)))
+	assert.True(d.isFlapping(eui))
+
+	// only reported once
+	d.disconnect(eui, now.Add(5*time.Second))
+	assert.False(d.connect(eui, now.Add(6*time.Second)))
+
+	connects, disconnects := d.counts(eui, now.Add(6*time.Second))
+	assert.Equal(4, connects)
+	assert.Equal(3, disconnects)
+
+	// other basestations are not affected
+	assert.False(d.isFlapping(common.EUI64{2}))
+	assert.False(d.stable(common.EUI64{2}))
+
+	assert.True(d.stable(eui))
+	assert.False(d.isFlapping(eui))
+	assert.False(d.stable(eui))
+}
+
+func TestFlapDetector_window(t *testing.T) {
+	assert := assert.New(t)
+
+	eui := common.EUI64{1}
+	now := time.Now()
+	d, err := newFlapDetector(time.Minute, 3, time.Minute)
+	require.NoError(t, err)
+
+	// connects outside of the window are not counted
+	assert.False(d.connect(eui, now))
+	assert.False(d.connect(eui, now.Add(40*time.Second)))
+	assert.False(d.connect(eui, now.Add(80*time.Second)))
+	assert.False(d.isFlapping(eui))
+
+	connects, disconnects := d.counts(eui, now.Add(80*time.Second))
+	assert.Equal(2, connects)
+	assert.Equal(0, disconnects)
+
+	connects, _ = d.counts(eui, now.Add(10*time.Minute))
+	assert.Equal(0, connects)
+}
+
+func TestFlapDetector_prune(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	d, err := newFlapDetector(time.Minute, 2, 5*time.Minute)
+	require.NoError(t, err)
+
+	// a basestation which is not flapping is removed once the window passed
+	d.connect(common.EUI64{1}, now)
+	d.disconnect(common.EUI64{1}, now.Add(time.Second))
+
+	// a flapping basestation is kept for the stable period
+	d.connect(common.EUI64{2}, now)
+	assert.True(d.connect(common.EUI64{2}, now.Add(time.Second)))
+	d.disconnect(common.EUI64{2}, now.Add(2*time.Second))
+
+	d.connect(common.EUI64{3}, now.Add(2*time.Minute))
+	assert.NotContains(d.history, common.EUI64{1})
+	assert.Contains(d.history, common.EUI64{2})
+	assert.True(d.isFlapping(common.EUI64{2}))
+
+	// disconnects prune as well
+	d.disconnect(common.EUI64{3}, now.Add(10*time.Minute))
+	assert.Empty(d.history)
+}
+
+func TestNewFlapDetector(t *testing.T) {
+	tests := []struct {
+		name      string
+		window    time.Duration
+		threshold int
+		wantErr   bool
+	}{
+		{name: "valid", window: time.Minute, threshold: 2},
+		{name: "zero window", window: 0, threshold: 2, wantErr: true},
+		{name: "negative window", window: -time.Minute, threshold: 2, wantErr: true},
+		{name: "threshold one", window: time.Minute, threshold: 1, wantErr: true},
+		{name: "zero threshold", window: time.Minute, threshold: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newFlapDetector(tt.window, tt.threshold, time.Minute)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPruneBefore(t *testing.T) {
+	now := time.Now()
+	ts := []time.Time{now, now.Add(time.Second), now.Add(2 * time.Second)}
+
+	tests := []struct {
+		name   string
+		cutoff time.Time
+		want   int
+	}{
+		{name: "none", cutoff: now.Add(-time.Second), want: 3},
+		{name: "equal is kept", cutoff: now, want: 3},
+		{name: "some", cutoff: now.Add(1500 * time.Millisecond), want: 1},
+		{name: "all", cutoff: now.Add(time.Minute), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Len(t, pruneBefore(ts, tt.cutoff), tt.want)
+		})
+	}
+}
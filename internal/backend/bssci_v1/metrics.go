@@ -21,6 +21,26 @@ var (
 		Help: "The number of BSSCI messages sent by the backend (per msgtype).",
 	}, []string{"msgtype", "bs"})
 
+	val = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_bssci_validation_error_count",
+		Help: "The number of BSSCI messages rejected by the backend due to an invalid field (per msgtype, field).",
+	}, []string{"msgtype", "field", "bs"})
+
+	seq = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_bssci_sequence_violation_count",
+		Help: "The number of BSSCI messages sent or received out of the operation sequence (per msgtype, violation).",
+	}, []string{"msgtype", "violation", "bs"})
+
+	opt = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_bssci_operation_timeout_count",
+		Help: "The number of BSSCI operations which did not complete in time (per initiating msgtype).",
+	}, []string{"msgtype", "bs"})
+
+	bsv = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_bssci_basestation_version_rejected_count",
+		Help: "The number of basestation connections rejected because of an unsupported protocol version.",
+	}, []string{"bs"})
+
 	bsc = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name: "backend_bssci_basestation_connect_count",
 		Help: "The number of basestation connections received by the backend.",
@@ -30,6 +50,26 @@ var (
 		Name: "backend_bssci_basestation_disconnect_count",
 		Help: "The number of basestations that disconnected from the backend.",
 	}, []string{"bs"})
+
+	bsr = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_bssci_basestation_disconnect_reason_count",
+		Help: "The number of basestations that disconnected from the backend (per reason).",
+	}, []string{"bs", "reason"})
+
+	bsf = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_bssci_basestation_flapping_count",
+		Help: "The number of times a basestation was flagged as flapping.",
+	}, []string{"bs"})
+
+	pcr = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_bssci_publish_rejected_count",
+		Help: "The number of uplinks rejected because the publish failed or was not confirmed in time (per msgtype).",
+	}, []string{"msgtype", "bs"})
+
+	rfd = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "backend_bssci_raw_frame_dropped_count",
+		Help: "The number of raw frames not published because the queue of the connection was full.",
+	}, []string{"bs"})
 )
 
 func pingPongCounter(src string, bs string) prometheus.Counter {
@@ -44,6 +84,22 @@ func messageSendCounter(bs string, msgtype string) prometheus.Counter {
 	return sent.With(prometheus.Labels{"bs": bs, "msgtype": msgtype})
 }
 
+func validationErrorCounter(bs string, msgtype string, field string) prometheus.Counter {
+	return val.With(prometheus.Labels{"bs": bs, "msgtype": msgtype, "field": field})
+}
+
+func sequenceViolationCounter(bs string, msgtype string, violation string) prometheus.Counter {
+	return seq.With(prometheus.Labels{"bs": bs, "msgtype": msgtype, "violation": violation})
+}
+
+func operationTimeoutCounter(bs string, msgtype string) prometheus.Counter {
+	return opt.With(prometheus.Labels{"bs": bs, "msgtype": msgtype})
+}
+
+func versionRejectedCounter(bs string) prometheus.Counter {
+	return bsv.With(prometheus.Labels{"bs": bs})
+}
+
 func connectCounter(bs string) prometheus.Counter {
 	return bsc.With(prometheus.Labels{"bs": bs})
 }
@@ -51,3 +107,19 @@ func connectCounter(bs string) prometheus.Counter {
 func disconnectCounter(bs string) prometheus.Counter {
 	return bsd.With(prometheus.Labels{"bs": bs})
 }
+
+func disconnectReasonCounter(bs string, reason string) prometheus.Counter {
+	return bsr.With(prometheus.Labels{"bs": bs, "reason": reason})
+}
+
+func flappingCounter(bs string) prometheus.Counter {
+	return bsf.With(prometheus.Labels{"bs": bs})
+}
+
+func publishRejectedCounter(bs string, msgtype string) prometheus.Counter {
+	return pcr.With(prometheus.Labels{"bs": bs, "msgtype": msgtype})
+}
+
+func rawFrameDroppedCounter(bs string) prometheus.Counter {
+	return rfd.With(prometheus.Labels{"bs": bs})
+}
@@ -0,0 +1,320 @@
+package bssci_v1
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/rs/zerolog"
+)
+
+// Participant of a BSSCI operation
+type party int
+
+const (
+	partyServer party = iota
+	partyClient
+)
+
+func (p party) String() string {
+	if p == partyServer {
+		return "server"
+	}
+	return "client"
+}
+
+// Step of a BSSCI operation
+//
+// Every operation follows the sequence initiation -> response -> completion,
+// or error -> error acknowledgement after the initiation or the response.
+type operationStep int
+
+const (
+	stepInit operationStep = iota
+	stepRsp
+	stepCmp
+)
+
+type operationState int
+
+const (
+	stateInitiated operationState = iota
+	stateResponded
+	stateErrored
+)
+
+// Sequence violations
+const (
+	violationUnknownOperation   = "unknown_operation"
+	violationDuplicateOperation = "duplicate_operation"
+	violationWrongInitiator     = "wrong_initiator"
+	violationUnexpectedCommand  = "unexpected_command"
+)
+
+type operationCommand struct {
+	// command which initiates the operation
+	init structs.Command
+	step operationStep
+}
+
+// Maps each message to its operation and step, error and errorAck are not part of this map
+var operationCommands = map[structs.Command]operationCommand{}
+
+// Party which is allowed to initiate an operation, ping may be initiated by both
+var operationInitiators = map[structs.Command][]party{
+	structs.MsgAtt:          {partyClient},
+	structs.MsgCon:          {partyClient},
+	structs.MsgDet:          {partyClient},
+	structs.MsgUlData:       {partyClient},
+	structs.MsgVmUlData:     {partyClient},
+	structs.MsgDlDataRes:    {partyClient},
+	structs.MsgDlRxStat:     {partyClient},
+	structs.MsgAttPrp:       {partyServer},
+	structs.MsgDetPrp:       {partyServer},
+	structs.MsgDlDataQue:    {partyServer},
+	structs.MsgDlDataRev:    {partyServer},
+	structs.MsgDlRxStatQry:  {partyServer},
+	structs.MsgStatus:       {partyServer},
+	structs.MsgVmActivate:   {partyServer},
+	structs.MsgVmDeactivate: {partyServer},
+	structs.MsgVmStatus:     {partyServer},
+	structs.MsgPing:         {partyServer, partyClient},
+}
+
+func init() {
+	for cmd := range operationInitiators {
+		operationCommands[cmd] = operationCommand{init: cmd, step: stepInit}
+		operationCommands[cmd+"Rsp"] = operationCommand{init: cmd, step: stepRsp}
+		operationCommands[cmd+"Cmp"] = operationCommand{init: cmd, step: stepCmp}
+	}
+}
+
+// An operation which is not completed yet
+type operation struct {
+	opId      int64
+	command   structs.Command
+	initiator party
+	state     operationState
+	// party which sent the error, if errored
+	errorBy party
+	started time.Time
+	// duplicate initiations which still await the error rejecting them
+	rejectPending int
+	// rejections of duplicate initiations which still await the errorAck
+	rejectAcks int
+}
+
+// An out of sequence message
+type sequenceError struct {
+	violation string
+	command   structs.Command
+	opId      int64
+	reason    string
+}
+
+func (e *sequenceError) Error() string {
+	return fmt.Sprintf("out of sequence %s (op_id %d): %s", e.command, e.opId, e.reason)
+}
+
+// Keeps track of the open operations of a connection to enforce the BSSCI message sequence.
+//
+// A nil tracker accepts every message.
+type operationTracker struct {
+	sync.Mutex
+
+	logger  zerolog.Logger
+	eui     common.EUI64
+	timeout time.Duration
+
+	operations map[int64]*operation
+}
+
+func newOperationTracker(logger zerolog.Logger, eui common.EUI64, timeout time.Duration) *operationTracker {
+	return &operationTracker{
+		logger:     logger,
+		eui:        eui,
+		timeout:    timeout,
+		operations: make(map[int64]*operation),
+	}
+}
+
+// Track a message received from the basestation.
+//
+// returns a sequenceError if the message is out of sequence
+func (t *operationTracker) received(cmd structs.Command, opId int64, now time.Time) error {
+	return t.track(partyClient, cmd, opId, now)
+}
+
+// Track a message sent to the basestation, must be called before the message is written
+// as the basestation may answer before the write returns.
+//
+// Out of sequence messages are only logged, as the server messages are generated by the adapter.
+//
+// returns a function which restores the previous state of the operation if the write failed
+func (t *operationTracker) sent(cmd structs.Command, opId int64, now time.Time) (rollback func()) {
+	if t == nil {
+		return func() {}
+	}
+	t.Lock()
+	prev, existed := t.operations[opId]
+	var saved operation
+	if existed {
+		saved = *prev
+	}
+	t.Unlock()
+
+	t.track(partyServer, cmd, opId, now)
+
+	return func() {
+		t.Lock()
+		defer t.Unlock()
+		if existed {
+			t.operations[opId] = &saved
+		} else {
+			delete(t.operations, opId)
+		}
+	}
+}
+
+func (t *operationTracker) track(from party, cmd structs.Command, opId int64, now time.Time) error {
+	if t == nil {
+		return nil
+	}
+	t.Lock()
+	defer t.Unlock()
+
+	err := t.step(from, cmd, opId, now)
+	if err != nil {
+		t.logger.Warn().Err(err).Str("from", from.String()).Str("violation", err.violation).Msg("bssci sequence violation")
+		sequenceViolationCounter(t.eui.String(), string(cmd), err.violation).Inc()
+		return err
+	}
+	return nil
+}
+
+func (t *operationTracker) step(from party, cmd structs.Command, opId int64, now time.Time) *sequenceError {
+	op, exists := t.operations[opId]
+
+	violation := func(violation string, reason string) *sequenceError {
+		return &sequenceError{violation: violation, command: cmd, opId: opId, reason: reason}
+	}
+
+	switch cmd {
+	case structs.MsgError:
+		if !exists {
+			// errors for unknown operations are acknowledged
+			t.operations[opId] = &operation{opId: opId, command: cmd, initiator: from, state: stateErrored, errorBy: from, started: now}
+			if from == partyClient {
+				return violation(violationUnknownOperation, "no open operation")
+			}
+			return nil
+		}
+		if from == partyServer && op.rejectPending > 0 {
+			// rejection of a duplicate initiation, the open operation is not affected
+			op.rejectPending--
+			op.rejectAcks++
+			return nil
+		}
+		if op.state == stateErrored {
+			return violation(violationUnexpectedCommand, "operation already errored")
+		}
+		op.state = stateErrored
+		op.errorBy = from
+		return nil
+
+	case structs.MsgErrorAck:
+		if !exists {
+			return violation(violationUnknownOperation, "no open operation")
+		}
+		if from == partyClient && op.rejectAcks > 0 {
+			op.rejectAcks--
+			return nil
+		}
+		if op.state != stateErrored || op.errorBy == from {
+			return violation(violationUnexpectedCommand, "no error to acknowledge")
+		}
+		delete(t.operations, opId)
+		return nil
+	}
+
+	oc, ok := operationCommands[cmd]
+	if !ok {
+		// not an operation message, e.g. an unsupported command
+		return nil
+	}
+
+	switch oc.step {
+	case stepInit:
+		if exists {
+			if from == partyClient {
+				// the duplicate is rejected with an error, which must not abort the open operation
+				op.rejectPending++
+			}
+			return violation(violationDuplicateOperation, fmt.Sprintf("operation %s already in progress", op.command))
+		}
+		allowed := false
+		for _, p := range operationInitiators[cmd] {
+			allowed = allowed || p == from
+		}
+		if !allowed {
+			return violation(violationWrongInitiator, fmt.Sprintf("may not be initiated by the %s", from))
+		}
+		t.operations[opId] = &operation{opId: opId, command: cmd, initiator: from, state: stateInitiated, started: now}
+
+	case stepRsp:
+		if !exists {
+			return violation(violationUnknownOperation, "no open operation")
+		}
+		if op.command != oc.init || op.initiator == from || op.state != stateInitiated {
+			return violation(violationUnexpectedCommand, fmt.Sprintf("does not match open operation %s", op.command))
+		}
+		op.state = stateResponded
+
+	case stepCmp:
+		if !exists {
+			return violation(violationUnknownOperation, "no open operation")
+		}
+		if op.command != oc.init || op.initiator != from || op.state != stateResponded {
+			return violation(violationUnexpectedCommand, fmt.Sprintf("does not match open operation %s", op.command))
+		}
+		delete(t.operations, opId)
+	}
+	return nil
+}
+
+// Remove all operations which did not complete within the timeout.
+//
+// returns the removed operations
+func (t *operationTracker) expire(now time.Time) []operation {
+	if t == nil {
+		return nil
+	}
+	t.Lock()
+	defer t.Unlock()
+
+	var expired []operation
+	for opId, op := range t.operations {
+		if now.Sub(op.started) > t.timeout {
+			expired = append(expired, *op)
+			delete(t.operations, opId)
+
+			t.logger.Warn().Str("command", string(op.command)).Int64("op_id", opId).Str("initiator", op.initiator.String()).Msg("bssci operation did not complete")
+			operationTimeoutCounter(t.eui.String(), string(op.command)).Inc()
+		}
+	}
+	return expired
+}
+
+// Number of open operations
+func (t *operationTracker) open() int {
+	if t == nil {
+		return 0
+	}
+	t.Lock()
+	defer t.Unlock()
+
+	return len(t.operations)
+}
@@ -0,0 +1,233 @@
+package bssci_v1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type trackedMessage struct {
+	from party
+	cmd  structs.Command
+	opId int64
+	// expected violation, empty if the message is in sequence
+	violation string
+}
+
+func TestOperationTracker(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []trackedMessage
+		open     int
+	}{
+		{
+			name: "client operation",
+			messages: []trackedMessage{
+				{from: partyClient, cmd: structs.MsgUlData, opId: 1},
+				{from: partyServer, cmd: structs.MsgUlDataRsp, opId: 1},
+				{from: partyClient, cmd: structs.MsgUlDataCmp, opId: 1},
+			},
+		},
+		{
+			name: "server operation",
+			messages: []trackedMessage{
+				{from: partyServer, cmd: structs.MsgAttPrp, opId: -1},
+				{from: partyClient, cmd: structs.MsgAttPrpRsp, opId: -1},
+				{from: partyServer, cmd: structs.MsgAttPrpCmp, opId: -1},
+			},
+		},
+		{
+			name: "ping in both directions",
+			messages: []trackedMessage{
+				{from: partyServer, cmd: structs.MsgPing, opId: -1},
+				{from: partyClient, cmd: structs.MsgPing, opId: 1},
+				{from: partyServer, cmd: structs.MsgPingRsp, opId: 1},
+				{from: partyClient, cmd: structs.MsgPingRsp, opId: -1},
+				{from: partyServer, cmd: structs.MsgPingCmp, opId: -1},
+				{from: partyClient, cmd: structs.MsgPingCmp, opId: 1},
+			},
+		},
+		{
+			name: "error after initiation",
+			messages: []trackedMessage{
+				{from: partyClient, cmd: structs.MsgAtt, opId: 1},
+				{from: partyServer, cmd: structs.MsgError, opId: 1},
+				{from: partyClient, cmd: structs.MsgErrorAck, opId: 1},
+			},
+		},
+		{
+			name: "error after response",
+			messages: []trackedMessage{
+				{from: partyServer, cmd: structs.MsgDlDataQue, opId: -1},
+				{from: partyClient, cmd: structs.MsgDlDataQueRsp, opId: -1},
+				{from: partyClient, cmd: structs.MsgError, opId: -1},
+				{from: partyServer, cmd: structs.MsgErrorAck, opId: -1},
+			},
+		},
+		{
+			name: "server error for unknown operation",
+			messages: []trackedMessage{
+				{from: partyServer, cmd: structs.MsgError, opId: 1},
+				{from: partyClient, cmd: structs.MsgErrorAck, opId: 1},
+			},
+		},
+		{
+			name: "unsupported commands are ignored",
+			messages: []trackedMessage{
+				{from: partyClient, cmd: "unsupported", opId: 1},
+			},
+		},
+		{
+			name: "stray response",
+			messages: []trackedMessage{
+				{from: partyClient, cmd: structs.MsgAttPrpRsp, opId: -1, violation: violationUnknownOperation},
+			},
+		},
+		{
+			name: "stray completion",
+			messages: []trackedMessage{
+				{from: partyClient, cmd: structs.MsgUlDataCmp, opId: 1, violation: violationUnknownOperation},
+			},
+		},
+		{
+			name: "completion before response",
+			messages: []trackedMessage{
+				{from: partyClient, cmd: structs.MsgUlData, opId: 1},
+				{from: partyClient, cmd: structs.MsgUlDataCmp, opId: 1, violation: violationUnexpectedCommand},
+			},
+			open: 1,
+		},
+		{
+			name: "response of other operation",
+			messages: []trackedMessage{
+				{from: partyServer, cmd: structs.MsgDlDataQue, opId: -1},
+				{from: partyClient, cmd: structs.MsgDlDataRevRsp, opId: -1, violation: violationUnexpectedCommand},
+			},
+			open: 1,
+		},
+		{
+			name: "response by initiator",
+			messages: []trackedMessage{
+				{from: partyServer, cmd: structs.MsgStatus, opId: -1},
+				{from: partyServer, cmd: structs.MsgStatusRsp, opId: -1, violation: violationUnexpectedCommand},
+			},
+			open: 1,
+		},
+		{
+			name: "duplicate opId",
+			messages: []trackedMessage{
+				{from: partyClient, cmd: structs.MsgUlData, opId: 1},
+				{from: partyClient, cmd: structs.MsgDet, opId: 1, violation: violationDuplicateOperation},
+			},
+			open: 1,
+		},
+		{
+			name: "rejected duplicate does not abort the open operation",
+			messages: []trackedMessage{
+				{from: partyClient, cmd: structs.MsgUlData, opId: 1},
+				{from: partyClient, cmd: structs.MsgUlData, opId: 1, violation: violationDuplicateOperation},
+				{from: partyServer, cmd: structs.MsgError, opId: 1},
+				{from: partyClient, cmd: structs.MsgErrorAck, opId: 1},
+				{from: partyServer, cmd: structs.MsgUlDataRsp, opId: 1},
+				{from: partyClient, cmd: structs.MsgUlDataCmp, opId: 1},
+			},
+		},
+		{
+			name: "wrong initiator",
+			messages: []trackedMessage{
+				{from: partyClient, cmd: structs.MsgDlDataQue, opId: 1, violation: violationWrongInitiator},
+			},
+		},
+		{
+			name: "client error for unknown operation",
+			messages: []trackedMessage{
+				{from: partyClient, cmd: structs.MsgError, opId: 1, violation: violationUnknownOperation},
+				{from: partyServer, cmd: structs.MsgErrorAck, opId: 1},
+			},
+		},
+		{
+			name: "errorAck without error",
+			messages: []trackedMessage{
+				{from: partyClient, cmd: structs.MsgAtt, opId: 1},
+				{from: partyClient, cmd: structs.MsgErrorAck, opId: 1, violation: violationUnexpectedCommand},
+			},
+			open: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert := assert.New(t)
+
+			tracker := newOperationTracker(zerolog.Nop(), common.EUI64{1}, time.Minute)
+			now := time.Now()
+
+			for _, m := range tt.messages {
+				err := tracker.track(m.from, m.cmd, m.opId, now)
+				if m.violation == "" {
+					assert.NoError(err, "%s %s", m.from, m.cmd)
+					continue
+				}
+
+				var seqErr *sequenceError
+				if assert.ErrorAs(err, &seqErr, "%s %s", m.from, m.cmd) {
+					assert.Equal(m.violation, seqErr.violation)
+				}
+			}
+			assert.Equal(tt.open, tracker.open())
+		})
+	}
+}
+
+func TestOperationTracker_expire(t *testing.T) {
+	assert := assert.New(t)
+
+	tracker := newOperationTracker(zerolog.Nop(), common.EUI64{1}, time.Minute)
+	now := time.Now()
+
+	assert.NoError(tracker.received(structs.MsgAtt, 1, now))
+	tracker.sent(structs.MsgStatus, -1, now.Add(time.Minute))
+
+	assert.Empty(tracker.expire(now.Add(time.Minute)))
+
+	expired := tracker.expire(now.Add(90 * time.Second))
+	if assert.Len(expired, 1) {
+		assert.Equal(structs.MsgAtt, expired[0].command)
+		assert.Equal(int64(1), expired[0].opId)
+	}
+	assert.Equal(1, tracker.open())
+
+	// a response to an expired operation is out of sequence
+	tracker.sent(structs.MsgAttRsp, 1, now.Add(90*time.Second))
+	assert.Error(tracker.received(structs.MsgAttCmp, 1, now.Add(90*time.Second)))
+}
+
+func TestOperationTracker_rollback(t *testing.T) {
+	assert := assert.New(t)
+
+	tracker := newOperationTracker(zerolog.Nop(), common.EUI64{1}, time.Minute)
+	now := time.Now()
+
+	tracker.sent(structs.MsgStatus, -1, now)()
+	assert.Zero(tracker.open())
+
+	assert.NoError(tracker.received(structs.MsgAtt, 1, now))
+	tracker.sent(structs.MsgAttRsp, 1, now)()
+	// the response was not sent, so the completion is out of sequence
+	assert.Error(tracker.received(structs.MsgAttCmp, 1, now))
+	assert.Equal(1, tracker.open())
+}
+
+func TestOperationTracker_nil(t *testing.T) {
+	var tracker *operationTracker
+
+	assert.NoError(t, tracker.received(structs.MsgAttPrpRsp, 1, time.Now()))
+	tracker.sent(structs.MsgAttRsp, 1, time.Now())
+	assert.Empty(t, tracker.expire(time.Now()))
+	assert.Zero(t, tracker.open())
+}
@@ -0,0 +1,78 @@
+package bssci_v1
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/rs/zerolog"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs/messages"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+)
+
+// time a confirmed publish is remembered to detect retransmissions of the uplink
+const publishRetention = 10 * time.Minute
+
+// A confirmed publish of an uplink
+type publish struct {
+	// closed once the publish completed
+	done chan struct{}
+	err  error
+}
+
+// Keeps track of the confirmed publishes of uplinks.
+//
+// A basestation retransmits an uplink which was rejected, e.g. because the publish did
+// not complete in time. If the publish completes after all, the retransmission joins it
+// instead of publishing the uplink again.
+type publishes struct {
+	mux   sync.Mutex
+	cache *cache.Cache
+}
+
+func newPublishes() *publishes {
+	return &publishes{cache: cache.New(publishRetention, time.Minute)}
+}
+
+// Start the publish of an uplink, returns true if a running or successful publish of the
+// same uplink was joined instead.
+func (p *publishes) start(logger *zerolog.Logger, key string, f func() error) (*publish, bool) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	if v, ok := p.cache.Get(key); ok {
+		pub := v.(*publish)
+		select {
+		case <-pub.done:
+			if pub.err == nil {
+				return pub, true
+			}
+		default:
+			return pub, true
+		}
+	}
+
+	pub := &publish{done: make(chan struct{})}
+	p.cache.SetDefault(key, pub)
+
+	go func() {
+		defer close(pub.done)
+		defer common.RecoverPanic(logger, "bssci_v1_publish", func(err error) { pub.err = err })
+
+		pub.err = f()
+	}()
+	return pub, false
+}
+
+// Identifies an uplink across retransmissions by the basestation
+func uplinkKey(eui common.EUI64, msg messages.EndnodeMessage) string {
+	switch m := msg.(type) {
+	case *messages.UlData:
+		return fmt.Sprintf("%s_%s_%s_%d_%d", eui, m.GetCommand(), m.EpEui, m.PacketCnt, m.RxTime)
+	case *messages.VmUlData:
+		return fmt.Sprintf("%s_%s_%d", eui, m.GetCommand(), m.SysTime)
+	}
+	return fmt.Sprintf("%s_%s_%d", eui, msg.GetCommand(), msg.GetOpId())
+}
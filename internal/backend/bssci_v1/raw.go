@@ -0,0 +1,235 @@
+package bssci_v1
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs/messages"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/tinylib/msgp/msgp"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Formats of published raw frames
+const (
+	rawFormatMsgpack = "msgpack"
+	rawFormatJson    = "json"
+)
+
+// largest integer which is exactly representable as a float64
+const maxSafeInteger = 1 << 53
+
+const (
+	// number of raw frames of a connection waiting to be published
+	rawQueueSize = 1000
+	// time to wait for the queued raw frames of a closed connection
+	rawStopTimeout = 5 * time.Second
+)
+
+// Creates raw events for the BSSCI frames of all connections
+type rawFrames struct {
+	// decode the frames to JSON instead of publishing the message pack bytes
+	decode bool
+	// commands to publish, all commands if empty
+	commands map[structs.Command]struct{}
+}
+
+func newRawFrames(format string, commands []string) (*rawFrames, error) {
+	r := rawFrames{commands: make(map[structs.Command]struct{})}
+
+	switch format {
+	case rawFormatJson, "":
+		r.decode = true
+	case rawFormatMsgpack:
+	default:
+		return nil, fmt.Errorf("unknown raw frame format: %s", format)
+	}
+
+	for _, cmd := range commands {
+		if _, err := messages.NewMessage(structs.Command(cmd)); err != nil {
+			return nil, fmt.Errorf("unknown raw frame command: %s", cmd)
+		}
+		r.commands[structs.Command(cmd)] = struct{}{}
+	}
+	return &r, nil
+}
+
+// Returns true if frames of this command are published
+func (r *rawFrames) match(cmd structs.Command) bool {
+	if len(r.commands) == 0 {
+		return true
+	}
+	_, ok := r.commands[cmd]
+	return ok
+}
+
+// Create the raw event of a frame
+func (r *rawFrames) event(eui common.EUI64, direction events.RawDirection, cmd structs.Command, opId int64, payload []byte, now time.Time) *events.Raw {
+	event := events.Raw{
+		BasestationEui: eui,
+		Ts:             now,
+		Direction:      direction,
+		Command:        string(cmd),
+		OpId:           opId,
+		Payload:        payload,
+	}
+
+	if r.decode {
+		// fall back to the message pack bytes if the frame can not be decoded
+		if data, err := decodeRawFrame(payload); err == nil {
+			event.Data = data
+		}
+	}
+	return &event
+}
+
+// A frame waiting to be published
+type rawFrame struct {
+	ts        time.Time
+	direction events.RawDirection
+	cmd       structs.Command
+	opId      int64
+	payload   []byte
+}
+
+// Publishes the raw frames of a connection in order.
+//
+// Frames are queued while the connection is locked and published by a single worker, a
+// frame is dropped if the queue is full.
+type rawQueue struct {
+	// guards the queue, which is closed on stop
+	sync.RWMutex
+	stopped bool
+
+	frames chan rawFrame
+	done   chan struct{}
+}
+
+// Create the queue and start the worker which calls publish for each frame
+func newRawQueue(size int, publish func(rawFrame)) *rawQueue {
+	q := rawQueue{
+		frames: make(chan rawFrame, size),
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(q.done)
+		for f := range q.frames {
+			publish(f)
+		}
+	}()
+	return &q
+}
+
+// Queue a frame, returns false if it was dropped
+func (q *rawQueue) push(f rawFrame) bool {
+	q.RLock()
+	defer q.RUnlock()
+
+	if q.stopped {
+		return false
+	}
+	select {
+	case q.frames <- f:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop accepting frames and wait up to timeout for the queued frames to be published.
+//
+// returns false on timeout
+func (q *rawQueue) stop(timeout time.Duration) bool {
+	q.Lock()
+	if !q.stopped {
+		q.stopped = true
+		close(q.frames)
+	}
+	q.Unlock()
+
+	select {
+	case <-q.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Decode a message pack encoded message into a struct
+func decodeRawFrame(payload []byte) (*structpb.Struct, error) {
+	v, _, err := msgp.ReadIntfBytes(payload)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected map, got %T", v)
+	}
+
+	s := structpb.Struct{Fields: make(map[string]*structpb.Value, len(m))}
+	for k, v := range m {
+		s.Fields[k] = rawValue(v)
+	}
+	return &s, nil
+}
+
+// Convert a decoded message pack value.
+//
+// Integers which can not be represented as a float64, e.g. EUI64s, are converted to strings.
+func rawValue(v interface{}) *structpb.Value {
+	switch v := v.(type) {
+	case nil:
+		return structpb.NewNullValue()
+	case bool:
+		return structpb.NewBoolValue(v)
+	case string:
+		return structpb.NewStringValue(v)
+	case []byte:
+		return structpb.NewStringValue(base64.StdEncoding.EncodeToString(v))
+	case int64:
+		if v > maxSafeInteger || v < -maxSafeInteger {
+			return structpb.NewStringValue(fmt.Sprint(v))
+		}
+		return structpb.NewNumberValue(float64(v))
+	case uint64:
+		if v > maxSafeInteger {
+			return structpb.NewStringValue(fmt.Sprint(v))
+		}
+		return structpb.NewNumberValue(float64(v))
+	case float32:
+		return rawFloat(float64(v))
+	case float64:
+		return rawFloat(v)
+	case time.Time:
+		return structpb.NewStringValue(v.UTC().Format(time.RFC3339Nano))
+	case []interface{}:
+		l := structpb.ListValue{Values: make([]*structpb.Value, len(v))}
+		for i, e := range v {
+			l.Values[i] = rawValue(e)
+		}
+		return structpb.NewListValue(&l)
+	case map[string]interface{}:
+		s := structpb.Struct{Fields: make(map[string]*structpb.Value, len(v))}
+		for k, e := range v {
+			s.Fields[k] = rawValue(e)
+		}
+		return structpb.NewStructValue(&s)
+	default:
+		return structpb.NewStringValue(fmt.Sprint(v))
+	}
+}
+
+// NaN and infinity are not valid JSON numbers
+func rawFloat(v float64) *structpb.Value {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return structpb.NewStringValue(fmt.Sprint(v))
+	}
+	return structpb.NewNumberValue(v)
+}
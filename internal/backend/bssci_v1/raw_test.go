@@ -0,0 +1,173 @@
+package bssci_v1
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs/messages"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRawFrames(t *testing.T) {
+	tests := []struct {
+		name       string
+		format     string
+		commands   []string
+		wantDecode bool
+		wantErr    bool
+	}{
+		{
+			name:       "default",
+			wantDecode: true,
+		},
+		{
+			name:       "json",
+			format:     rawFormatJson,
+			commands:   []string{"con"},
+			wantDecode: true,
+		},
+		{
+			name:   "msgpack",
+			format: rawFormatMsgpack,
+		},
+		{
+			name:    "unknown",
+			format:  "xml",
+			wantErr: true,
+		},
+		{
+			name:     "unknown command",
+			commands: []string{"con", "conn"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newRawFrames(tt.format, tt.commands)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantDecode, got.decode)
+			assert.Len(t, got.commands, len(tt.commands))
+		})
+	}
+}
+
+func TestRawFrames_match(t *testing.T) {
+	assert := assert.New(t)
+
+	all, err := newRawFrames(rawFormatJson, nil)
+	require.NoError(t, err)
+	assert.True(all.match(structs.MsgCon))
+	assert.True(all.match(structs.MsgPing))
+
+	filtered, err := newRawFrames(rawFormatJson, []string{"con", "ulData"})
+	require.NoError(t, err)
+	assert.True(filtered.match(structs.MsgCon))
+	assert.True(filtered.match(structs.MsgUlData))
+	assert.False(filtered.match(structs.MsgPing))
+}
+
+func TestRawQueue(t *testing.T) {
+	assert := assert.New(t)
+
+	var published []int64
+	release := make(chan struct{})
+	q := newRawQueue(2, func(f rawFrame) {
+		<-release
+		published = append(published, f.opId)
+	})
+
+	// the worker blocks on the first frame, the queue holds two more
+	assert.True(q.push(rawFrame{opId: 1}))
+	assert.Eventually(func() bool { return len(q.frames) == 0 }, time.Second, time.Millisecond)
+	assert.True(q.push(rawFrame{opId: 2}))
+	assert.True(q.push(rawFrame{opId: 3}))
+	assert.False(q.push(rawFrame{opId: 4}))
+
+	close(release)
+	assert.True(q.stop(time.Second))
+	assert.Equal([]int64{1, 2, 3}, published)
+
+	assert.False(q.push(rawFrame{opId: 5}))
+	assert.True(q.stop(time.Second))
+}
+
+func TestRawFrames_event(t *testing.T) {
+	eui := common.EUI64{0xfc, 0xc2, 0x3d, 0xff, 0xfe, 0x0a, 0x00, 0x01}
+	vendor := "vendor"
+	con := messages.Con{
+		Command: structs.MsgCon,
+		OpId:    0,
+		Version: "1.0.0",
+		BsEui:   eui,
+		Vendor:  &vendor,
+		Info:    map[string]any{"fw": "1.2.3", "channels": int64(2)},
+	}
+	payload, err := con.MarshalMsg(nil)
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	t.Run("json", func(t *testing.T) {
+		assert := assert.New(t)
+
+		r, err := newRawFrames(rawFormatJson, nil)
+		require.NoError(t, err)
+
+		event := r.event(eui, events.RawDirectionInbound, structs.MsgCon, 0, payload, now)
+		assert.Equal(events.EventTypeBsRaw, event.GetEventType())
+
+		pb := event.IntoProto()
+		assert.Equal("inbound", pb.Fields["direction"].GetStringValue())
+		assert.Equal("con", pb.Fields["command"].GetStringValue())
+		assert.Equal(eui.String(), pb.Fields["bsEui"].GetStringValue())
+		assert.Nil(pb.Fields["payload"])
+
+		data := pb.Fields["data"].GetStructValue()
+		if assert.NotNil(data) {
+			assert.Equal("1.0.0", data.Fields["version"].GetStringValue())
+			assert.Equal("vendor", data.Fields["vendor"].GetStringValue())
+			// the eui exceeds the float64 precision
+			assert.Equal(fmt.Sprint(common.Eui64toUnsignedInt(eui)), data.Fields["bsEui"].GetStringValue())
+
+			info := data.Fields["info"].GetStructValue()
+			if assert.NotNil(info) {
+				assert.Equal("1.2.3", info.Fields["fw"].GetStringValue())
+				assert.Equal(float64(2), info.Fields["channels"].GetNumberValue())
+			}
+		}
+	})
+
+	t.Run("msgpack", func(t *testing.T) {
+		assert := assert.New(t)
+
+		r, err := newRawFrames(rawFormatMsgpack, nil)
+		require.NoError(t, err)
+
+		pb := r.event(eui, events.RawDirectionOutbound, structs.MsgCon, 0, payload, now).IntoProto()
+		assert.Equal("outbound", pb.Fields["direction"].GetStringValue())
+		assert.Nil(pb.Fields["data"])
+		assert.Equal(base64.StdEncoding.EncodeToString(payload), pb.Fields["payload"].GetStringValue())
+	})
+
+	t.Run("undecodable", func(t *testing.T) {
+		assert := assert.New(t)
+
+		r, err := newRawFrames(rawFormatJson, nil)
+		require.NoError(t, err)
+
+		pb := r.event(eui, events.RawDirectionInbound, structs.MsgCon, 0, []byte{0xc1}, now).IntoProto()
+		assert.Nil(pb.Fields["data"])
+		assert.Equal(base64.StdEncoding.EncodeToString([]byte{0xc1}), pb.Fields["payload"].GetStringValue())
+	})
+}
@@ -0,0 +1,343 @@
+package bssci_v1
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/capture"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs/messages"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
+
+	"github.com/pkg/errors"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// time to wait for the adapter to respond to a replayed operation if not configured
+const defaultReplayResponseTimeout = 5 * time.Second
+
+// Options for replaying a captured session
+type ReplayOptions struct {
+	// Speed factor, the recorded delays between frames are divided by it. 0 replays without delays.
+	Speed float64
+	// Time to wait for responses after the last frame
+	Linger time.Duration
+	// Time to wait for the response of the adapter before the completion of an operation
+	// is sent, 5 seconds if 0
+	ResponseTimeout time.Duration
+	// Called for every frame received from the adapter, optional
+	OnReceive func(cmd structs.CommandHeader, raw msgp.Raw)
+}
+
+// Statistics of a replayed session
+type ReplayStats struct {
+	// Number of frames sent to the adapter
+	Sent int
+	// Number of frames received from the adapter
+	Received int
+	// Number of operations initiated by the adapter which were answered
+	Answered int
+	// Number of operations initiated by the adapter without a captured response
+	Unanswered int
+	// Number of captured completions which were not sent, as the adapter did not respond
+	// to the operation or rejected it
+	Skipped int
+}
+
+// A captured frame sent by the basestation
+type replayFrame struct {
+	ts      time.Time
+	cmd     structs.Command
+	opId    int64
+	payload []byte
+}
+
+// Response of the adapter to an operation initiated by the replayed basestation
+type replayResponse struct {
+	// closed once the adapter responded
+	done chan struct{}
+	// false if the adapter rejected the operation
+	ok bool
+}
+
+type replayer struct {
+	conn    net.Conn
+	options ReplayOptions
+
+	writeMux sync.Mutex
+
+	mux sync.Mutex
+	// captured responses to the operations initiated by the adapter, per initiating command
+	answers map[structs.Command][][]byte
+	// responses of the adapter to the replayed operations
+	responses map[int64]*replayResponse
+	stats     ReplayStats
+}
+
+// Replay the inbound frames of a captured session to an adapter.
+//
+// The operations initiated by the basestation are replayed in the captured timing, the
+// completion of an operation is only sent once the adapter responded to it. The operations
+// initiated by the adapter are answered with the captured response to an operation of the
+// same command, with the operation ID issued by the adapter. Pings are answered even if no
+// response was captured, errors are always acknowledged.
+//
+// The connection is closed on return.
+func Replay(ctx context.Context, conn net.Conn, records []capture.Record, options ReplayOptions) (ReplayStats, error) {
+	if options.ResponseTimeout == 0 {
+		options.ResponseTimeout = defaultReplayResponseTimeout
+	}
+	r := replayer{
+		conn:      conn,
+		options:   options,
+		answers:   make(map[structs.Command][][]byte),
+		responses: make(map[int64]*replayResponse),
+	}
+
+	frames, err := r.prepare(records)
+	if err != nil {
+		conn.Close()
+		return ReplayStats{}, err
+	}
+
+	readDone := make(chan struct{})
+	var readErr error
+	go func() {
+		defer close(readDone)
+		readErr = r.read()
+	}()
+
+	err = r.replay(ctx, frames, readDone, &readErr)
+
+	// stop the reader before returning
+	conn.Close()
+	<-readDone
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.stats, err
+}
+
+// Split the captured frames into the frames to replay and the responses to operations
+// initiated by the adapter
+func (r *replayer) prepare(records []capture.Record) ([]replayFrame, error) {
+	// captured operations initiated by the adapter, by captured operation ID
+	serverOps := make(map[int64]structs.Command)
+
+	var frames []replayFrame
+	for _, record := range records {
+		var header structs.CommandHeader
+		if _, err := header.UnmarshalMsg(record.Payload); err != nil {
+			return nil, errors.Wrap(err, "decode captured frame error")
+		}
+		oc, isOperation := operationCommands[header.Command]
+
+		if record.Direction != events.RawDirectionInbound {
+			if isOperation && oc.step == stepInit {
+				serverOps[header.OpId] = header.Command
+			}
+			continue
+		}
+
+		switch {
+		case header.Command == structs.MsgErrorAck:
+			// errors of the adapter are acknowledged when received
+			continue
+		case header.Command == structs.MsgError:
+			if init, ok := serverOps[header.OpId]; ok {
+				r.answers[init] = append(r.answers[init], record.Payload)
+				continue
+			}
+		case isOperation && oc.step == stepRsp:
+			r.answers[oc.init] = append(r.answers[oc.init], record.Payload)
+			continue
+		}
+		frames = append(frames, replayFrame{ts: record.Ts, cmd: header.Command, opId: header.OpId, payload: record.Payload})
+	}
+	return frames, nil
+}
+
+// Send the frames in the captured timing
+func (r *replayer) replay(ctx context.Context, frames []replayFrame, readDone <-chan struct{}, readErr *error) error {
+	var last time.Time
+	for _, frame := range frames {
+		if !last.IsZero() && r.options.Speed > 0 {
+			delay := time.Duration(float64(frame.ts.Sub(last)) / r.options.Speed)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-readDone:
+				return errors.Wrap(*readErr, "connection closed by adapter")
+			}
+		}
+		last = frame.ts
+
+		oc, isOperation := operationCommands[frame.cmd]
+		if isOperation && oc.step == stepCmp {
+			if !r.responded(ctx, frame.opId, readDone) {
+				r.mux.Lock()
+				r.stats.Skipped++
+				r.mux.Unlock()
+				continue
+			}
+		}
+		if isOperation && oc.step == stepInit {
+			r.mux.Lock()
+			r.responses[frame.opId] = &replayResponse{done: make(chan struct{})}
+			r.mux.Unlock()
+		}
+
+		if err := r.write(frame.payload); err != nil {
+			return errors.Wrap(err, "write frame error")
+		}
+		r.mux.Lock()
+		r.stats.Sent++
+		r.mux.Unlock()
+	}
+
+	// wait for the responses to the last frames
+	select {
+	case <-time.After(r.options.Linger):
+	case <-ctx.Done():
+	case <-readDone:
+	}
+	return nil
+}
+
+// Wait for the response of the adapter to a replayed operation, false if it was rejected
+// or did not arrive in time
+func (r *replayer) responded(ctx context.Context, opId int64, readDone <-chan struct{}) bool {
+	r.mux.Lock()
+	rsp, ok := r.responses[opId]
+	r.mux.Unlock()
+	if !ok {
+		return false
+	}
+
+	select {
+	case <-rsp.done:
+	case <-time.After(r.options.ResponseTimeout):
+	case <-ctx.Done():
+	case <-readDone:
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	delete(r.responses, opId)
+	return rsp.ok
+}
+
+// Read the frames of the adapter and answer the operations it initiates
+func (r *replayer) read() error {
+	for {
+		cmd, raw, err := ReadBssciMessage(r.conn)
+		if err != nil {
+			return err
+		}
+		r.mux.Lock()
+		r.stats.Received++
+		r.mux.Unlock()
+		if r.options.OnReceive != nil {
+			r.options.OnReceive(cmd, raw)
+		}
+
+		answer, err := r.answer(cmd.Command, cmd.OpId)
+		if err != nil {
+			return err
+		}
+		if answer == nil {
+			continue
+		}
+		if err := r.write(answer); err != nil {
+			return err
+		}
+	}
+}
+
+// Track the response to a replayed operation or build the answer to an operation
+// initiated by the adapter, nil if nothing is answered
+func (r *replayer) answer(cmd structs.Command, opId int64) ([]byte, error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if cmd == structs.MsgError {
+		r.resolve(opId, false)
+		ack := messages.NewBssciErrorAck(opId)
+		return ack.MarshalMsg(nil)
+	}
+
+	oc, ok := operationCommands[cmd]
+	if !ok {
+		return nil, nil
+	}
+	switch oc.step {
+	case stepRsp:
+		r.resolve(opId, true)
+	case stepInit:
+		if answers := r.answers[cmd]; len(answers) > 0 {
+			r.answers[cmd] = answers[1:]
+			r.stats.Answered++
+			return setOpId(answers[0], opId)
+		}
+		if cmd == structs.MsgPing {
+			r.stats.Answered++
+			rsp := messages.NewPingRsp(opId)
+			return rsp.MarshalMsg(nil)
+		}
+		r.stats.Unanswered++
+	}
+	return nil, nil
+}
+
+func (r *replayer) resolve(opId int64, ok bool) {
+	if rsp, exists := r.responses[opId]; exists {
+		select {
+		case <-rsp.done:
+		default:
+			rsp.ok = ok
+			close(rsp.done)
+		}
+	}
+}
+
+func (r *replayer) write(payload []byte) error {
+	r.writeMux.Lock()
+	defer r.writeMux.Unlock()
+
+	buf := prepareBssciMessage(len(payload))
+	buf = append(buf, payload...)
+	_, err := r.conn.Write(buf)
+	return err
+}
+
+// Replace the operation ID of a message, the other fields are kept as they are
+func setOpId(payload []byte, opId int64) ([]byte, error) {
+	sz, rest, err := msgp.ReadMapHeaderBytes(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "read map error")
+	}
+
+	out := msgp.AppendMapHeader(nil, sz)
+	for range sz {
+		var key []byte
+		key, rest, err = msgp.ReadMapKeyZC(rest)
+		if err != nil {
+			return nil, errors.Wrap(err, "read key error")
+		}
+		out = msgp.AppendStringFromBytes(out, key)
+
+		value := rest
+		if rest, err = msgp.Skip(rest); err != nil {
+			return nil, errors.Wrap(err, "read value error")
+		}
+		if string(key) == "opId" {
+			out = msgp.AppendInt64(out, opId)
+			continue
+		}
+		out = append(out, value[:len(value)-len(rest)]...)
+	}
+	return out, nil
+}
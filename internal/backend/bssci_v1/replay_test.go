@@ -0,0 +1,149 @@
+package bssci_v1
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/capture"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs/messages"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tinylib/msgp/msgp"
+)
+
+func TestReplay(t *testing.T) {
+	assert := assert.New(t)
+
+	marshal := func(msg messages.MessageMsgp) []byte {
+		b, err := msg.MarshalMsg(nil)
+		require.NoError(t, err)
+		return b
+	}
+	ping := messages.NewPing(1)
+	pingRsp := messages.NewPingRsp(1)
+	pingCmp := messages.NewPingCmp(1)
+	status := messages.NewStatus(-3)
+	statusRsp := messages.NewStatusRsp(-3, 0, "ok", 1, 0.5, nil, nil, nil, nil, nil)
+	statusCmp := messages.NewStatusCmp(-3)
+	att := messages.Att{Command: structs.MsgAtt, OpId: 2, EpEui: common.EUI64{1}}
+	attCmp := messages.NewAttCmp(2)
+
+	start := time.Now()
+	records := []capture.Record{
+		{Ts: start, Direction: events.RawDirectionInbound, Payload: marshal(&ping)},
+		{Ts: start.Add(time.Millisecond), Direction: events.RawDirectionOutbound, Payload: marshal(&pingRsp)},
+		{Ts: start.Add(2 * time.Millisecond), Direction: events.RawDirectionOutbound, Payload: marshal(&status)},
+		{Ts: start.Add(3 * time.Millisecond), Direction: events.RawDirectionInbound, Payload: marshal(&statusRsp)},
+		{Ts: start.Add(4 * time.Millisecond), Direction: events.RawDirectionOutbound, Payload: marshal(&statusCmp)},
+		{Ts: start.Add(200 * time.Millisecond), Direction: events.RawDirectionInbound, Payload: marshal(&pingCmp)},
+		{Ts: start.Add(201 * time.Millisecond), Direction: events.RawDirectionInbound, Payload: marshal(&att)},
+		{Ts: start.Add(202 * time.Millisecond), Direction: events.RawDirectionInbound, Payload: marshal(&attCmp)},
+	}
+
+	server, client := net.Pipe()
+
+	// answer like an adapter, which issues its own operation IDs
+	var mux sync.Mutex
+	var commands []structs.CommandHeader
+	var answer messages.StatusRsp
+	adapterDone := make(chan struct{})
+	go func() {
+		defer close(adapterDone)
+		for {
+			cmd, raw, err := ReadBssciMessage(server)
+			if err != nil {
+				return
+			}
+			mux.Lock()
+			commands = append(commands, cmd)
+			mux.Unlock()
+
+			switch cmd.Command {
+			case structs.MsgPing:
+				rsp := messages.NewPingRsp(cmd.OpId)
+				WriteBssciMessage(server, &rsp)
+				req := messages.NewStatus(-7)
+				WriteBssciMessage(server, &req)
+			case structs.MsgStatusRsp:
+				mux.Lock()
+				_, err := answer.UnmarshalMsg(raw)
+				mux.Unlock()
+				assert.NoError(err)
+				ping := messages.NewPing(-8)
+				WriteBssciMessage(server, &ping)
+			case structs.MsgAtt:
+				rsp := messages.NewBssciError(cmd.OpId, messages.ErrorCodeEIO, "rejected")
+				WriteBssciMessage(server, &rsp)
+			}
+		}
+	}()
+
+	var received []structs.Command
+	replayStart := time.Now()
+	stats, err := Replay(context.Background(), client, records, ReplayOptions{
+		Speed:           2,
+		Linger:          50 * time.Millisecond,
+		ResponseTimeout: time.Second,
+		OnReceive: func(cmd structs.CommandHeader, raw msgp.Raw) {
+			received = append(received, cmd.GetCommand())
+		},
+	})
+	assert.NoError(err)
+	<-adapterDone
+
+	// the 200ms between the inbound frames are replayed at double speed
+	assert.GreaterOrEqual(time.Since(replayStart), 100*time.Millisecond)
+
+	assert.Equal(ReplayStats{Sent: 3, Received: 4, Answered: 2, Skipped: 1}, stats)
+	assert.Equal([]structs.Command{structs.MsgPingRsp, structs.MsgStatus, structs.MsgPing, structs.MsgError}, received)
+
+	// the adapter operations are answered with the issued operation IDs
+	mux.Lock()
+	defer mux.Unlock()
+	assert.ElementsMatch([]structs.CommandHeader{
+		{Command: structs.MsgPing, OpId: 1},
+		{Command: structs.MsgStatusRsp, OpId: -7},
+		{Command: structs.MsgPingRsp, OpId: -8},
+		{Command: structs.MsgPingCmp, OpId: 1},
+		{Command: structs.MsgAtt, OpId: 2},
+		{Command: structs.MsgErrorAck, OpId: 2},
+	}, commands)
+	statusRsp.OpId = -7
+	assert.Equal(statusRsp, answer)
+}
+
+func TestReplay_closed(t *testing.T) {
+	server, client := net.Pipe()
+	server.Close()
+
+	ping := messages.NewPing(1)
+	payload, err := ping.MarshalMsg(nil)
+	require.NoError(t, err)
+
+	_, err = Replay(context.Background(), client, []capture.Record{
+		{Ts: time.Now(), Direction: events.RawDirectionInbound, Payload: payload},
+	}, ReplayOptions{})
+	assert.Error(t, err)
+}
+
+func TestSetOpId(t *testing.T) {
+	rsp := messages.NewStatusRsp(-3, 0, "ok", 1, 0.5, nil, nil, nil, nil, nil)
+	payload, err := rsp.MarshalMsg(nil)
+	require.NoError(t, err)
+
+	payload, err = setOpId(payload, -9)
+	require.NoError(t, err)
+
+	var got messages.StatusRsp
+	_, err = got.UnmarshalMsg(payload)
+	require.NoError(t, err)
+	rsp.OpId = -9
+	assert.Equal(t, rsp, got)
+}
@@ -1323,6 +1323,25 @@ func (ts *TestMessageSuite) TestMessage_MarshalJson() {
 	}
 }
 
+func (ts *TestMessageSuite) TestMessage_UnmarshalMessage() {
+	t := ts.T()
+
+	for _, tt := range ts.data {
+		if tt.wantErr {
+			continue
+		}
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := UnmarshalMessage(tt.msg.GetCommand(), tt.raw)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tt.msg, msg)
+			}
+		})
+	}
+
+	_, err := UnmarshalMessage("unknown", nil)
+	assert.Error(t, err)
+}
+
 func BenchmarkMessage_UnmarshalMessagePack(b *testing.B) {
 	ts := new(TestMessageSuite)
 	ts.SetT(&testing.T{})
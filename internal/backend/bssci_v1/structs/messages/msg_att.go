@@ -111,6 +111,17 @@ func (m *Att) GetEventType() events.EventType {
 	return events.EventTypeEpOtaa
 }
 
+// implements ValidatableMessage.Validate()
+func (m *Att) Validate() error {
+	if err := validateEui("epEui", m.EpEui); err != nil {
+		return err
+	}
+	if err := validateTime("rxTime", m.RxTime); err != nil {
+		return err
+	}
+	return m.Subpackets.Validate()
+}
+
 // implements EndnodeMessage.IntoProto()
 func (m *Att) IntoProto(bsEui *common.EUI64) *bs.EndnodeUplink {
 	bsEuiB := bsEui.String()
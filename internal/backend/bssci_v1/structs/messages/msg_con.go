@@ -70,6 +70,17 @@ func (m *Con) GetEventType() events.EventType {
 	return events.EventTypeBsCon
 }
 
+// implements ValidatableMessage.Validate()
+func (m *Con) Validate() error {
+	if err := validateEui("bsEui", m.BsEui); err != nil {
+		return err
+	}
+	if m.Version == "" {
+		return invalidField("version", "must not be empty")
+	}
+	return nil
+}
+
 // implements BasestationMessage.IntoProto()
 func (m *Con) IntoProto(bsEui *common.EUI64) *bs.BasestationUplink {
 	_ = bsEui
@@ -94,6 +94,25 @@ func (m *DlDataRes) GetEventType() events.EventType {
 	return events.EventTypeBsDl
 }
 
+// implements ValidatableMessage.Validate()
+func (m *DlDataRes) Validate() error {
+	if err := validateEui("epEui", m.EpEui); err != nil {
+		return err
+	}
+	if m.Result == dlDataResult_Sent {
+		if m.TxTime == nil {
+			return protocolError("txTime", "required if result is sent")
+		}
+		if m.PacketCnt == nil {
+			return protocolError("packetCnt", "required if result is sent")
+		}
+		if err := validateTime("txTime", *m.TxTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // implements BasestationMessage.IntoProto()
 func (m *DlDataRes) IntoProto(bsEui *common.EUI64) *bs.BasestationUplink {
 	bsEuiB := bsEui.String()
@@ -66,6 +66,14 @@ func (m *DlRxStat) GetEventType() events.EventType {
 	return events.EventTypeEpRx
 }
 
+// implements ValidatableMessage.Validate()
+func (m *DlRxStat) Validate() error {
+	if err := validateEui("epEui", m.EpEui); err != nil {
+		return err
+	}
+	return validateTime("rxTime", m.RxTime)
+}
+
 // implements BasestationMessage.IntoProto()
 func (m *DlRxStat) IntoProto(bsEui *common.EUI64) *bs.BasestationUplink {
 	var message bs.BasestationUplink
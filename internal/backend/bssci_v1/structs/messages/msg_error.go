@@ -24,6 +24,26 @@ type BssciError struct {
 	Message string `msg:"message" json:"message"`
 }
 
+// POSIX error numbers used as error codes
+const (
+	// I/O error
+	ErrorCodeEIO uint32 = 5
+	// permission denied
+	ErrorCodeEACCES uint32 = 13
+	// invalid argument
+	ErrorCodeEINVAL uint32 = 22
+	// protocol error
+	ErrorCodeEPROTO uint32 = 71
+	// bad message
+	ErrorCodeEBADMSG uint32 = 74
+	// protocol not supported
+	ErrorCodeEPROTONOSUPPORT uint32 = 93
+	// operation not supported
+	ErrorCodeENOTSUP uint32 = 95
+	// connection timed out
+	ErrorCodeETIMEDOUT uint32 = 110
+)
+
 func NewBssciError(opId int64, code uint32, message string) BssciError {
 	return BssciError{OpId: opId, Command: structs.MsgError, Code: code, Message: message}
 }
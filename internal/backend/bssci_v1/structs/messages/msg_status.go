@@ -106,6 +106,14 @@ func (m *StatusRsp) GetEventType() events.EventType {
 	return events.EventTypeBsStatus
 }
 
+// implements ValidatableMessage.Validate()
+func (m *StatusRsp) Validate() error {
+	if m.DutyCycle < 0 || m.DutyCycle > 1 {
+		return invalidField("dutyCycle", "must be within [0, 1]")
+	}
+	return nil
+}
+
 // implements BasestationMessage.IntoProto()
 func (m *StatusRsp) IntoProto(bsEui *common.EUI64) *bs.BasestationUplink {
 
@@ -105,6 +105,20 @@ func (m *UlData) GetEventType() events.EventType {
 	return events.EventTypeEpUl
 }
 
+// implements ValidatableMessage.Validate()
+func (m *UlData) Validate() error {
+	if err := validateEui("epEui", m.EpEui); err != nil {
+		return err
+	}
+	if err := validateTime("rxTime", m.RxTime); err != nil {
+		return err
+	}
+	if m.ResponseExp && !m.DlOpen {
+		return protocolError("responseExp", "requires dlOpen")
+	}
+	return m.Subpackets.Validate()
+}
+
 // implements EndnodeMessage.IntoProto()
 func (m *UlData) IntoProto(bsEui *common.EUI64) *bs.EndnodeUplink {
 	bsEuiB := bsEui.String()
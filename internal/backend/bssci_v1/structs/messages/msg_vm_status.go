@@ -2,6 +2,7 @@ package messages
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
@@ -74,6 +75,16 @@ func (m *VmStatusRsp) GetEventType() events.EventType {
 	return events.EventTypeBsVmStatus
 }
 
+// implements ValidatableMessage.Validate()
+func (m *VmStatusRsp) Validate() error {
+	for _, macType := range m.MacTypes {
+		if macType < 0 || macType > 255 {
+			return invalidField("macTypes", fmt.Sprintf("invalid mac type %d", macType))
+		}
+	}
+	return nil
+}
+
 // implements BasestationMessage.IntoProto()
 func (m *VmStatusRsp) IntoProto(bsEui *common.EUI64) *bs.BasestationUplink {
 
@@ -94,6 +94,14 @@ func (m *VmUlData) GetEventType() events.EventType {
 	return events.EventTypeEpUl
 }
 
+// implements ValidatableMessage.Validate()
+func (m *VmUlData) Validate() error {
+	if err := validateTime("sysTime", m.SysTime); err != nil {
+		return err
+	}
+	return m.Subpackets.Validate()
+}
+
 // implements EndnodeMessage.IntoProto()
 func (m *VmUlData) IntoProto(bsEui *common.EUI64) *bs.EndnodeUplink {
 	bsEuiB := bsEui.String()
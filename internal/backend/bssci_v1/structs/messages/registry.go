@@ -0,0 +1,100 @@
+package messages
+
+import (
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+
+	"github.com/pkg/errors"
+)
+
+// message struct of each command
+var commandMessages = map[structs.Command]func() MessageMsgp{
+	structs.MsgAtt:             func() MessageMsgp { return &Att{} },
+	structs.MsgAttRsp:          func() MessageMsgp { return &AttRsp{} },
+	structs.MsgAttCmp:          func() MessageMsgp { return &AttCmp{} },
+	structs.MsgAttPrp:          func() MessageMsgp { return &AttPrp{} },
+	structs.MsgAttPrpRsp:       func() MessageMsgp { return &AttPrpRsp{} },
+	structs.MsgAttPrpCmp:       func() MessageMsgp { return &AttPrpCmp{} },
+	structs.MsgCon:             func() MessageMsgp { return &Con{} },
+	structs.MsgConRsp:          func() MessageMsgp { return &ConRsp{} },
+	structs.MsgConCmp:          func() MessageMsgp { return &ConCmp{} },
+	structs.MsgDet:             func() MessageMsgp { return &Det{} },
+	structs.MsgDetRsp:          func() MessageMsgp { return &DetRsp{} },
+	structs.MsgDetCmp:          func() MessageMsgp { return &DetCmp{} },
+	structs.MsgDetPrp:          func() MessageMsgp { return &DetPrp{} },
+	structs.MsgDetPrpRsp:       func() MessageMsgp { return &DetPrpRsp{} },
+	structs.MsgDetPrpCmp:       func() MessageMsgp { return &DetPrpCmp{} },
+	structs.MsgDlDataQue:       func() MessageMsgp { return &DlDataQue{} },
+	structs.MsgDlDataQueRsp:    func() MessageMsgp { return &DlDataQueRsp{} },
+	structs.MsgDlDataQueCmp:    func() MessageMsgp { return &DlDataQueCmp{} },
+	structs.MsgDlDataRes:       func() MessageMsgp { return &DlDataRes{} },
+	structs.MsgDlDataResRsp:    func() MessageMsgp { return &DlDataResRsp{} },
+	structs.MsgDlDataResCmp:    func() MessageMsgp { return &DlDataResCmp{} },
+	structs.MsgDlDataRev:       func() MessageMsgp { return &DlDataRev{} },
+	structs.MsgDlDataRevRsp:    func() MessageMsgp { return &DlDataRevRsp{} },
+	structs.MsgDlDataRevCmp:    func() MessageMsgp { return &DlDataRevCmp{} },
+	structs.MsgDlRxStat:        func() MessageMsgp { return &DlRxStat{} },
+	structs.MsgDlRxStatRsp:     func() MessageMsgp { return &DlRxStatRsp{} },
+	structs.MsgDlRxStatCmp:     func() MessageMsgp { return &DlRxStatCmp{} },
+	structs.MsgDlRxStatQry:     func() MessageMsgp { return &DlRxStatQry{} },
+	structs.MsgDlRxStatQryRsp:  func() MessageMsgp { return &DlRxStatQryRsp{} },
+	structs.MsgDlRxStatQryCmp:  func() MessageMsgp { return &DlRxStatQryCmp{} },
+	structs.MsgPing:            func() MessageMsgp { return &Ping{} },
+	structs.MsgPingRsp:         func() MessageMsgp { return &PingRsp{} },
+	structs.MsgPingCmp:         func() MessageMsgp { return &PingCmp{} },
+	structs.MsgStatus:          func() MessageMsgp { return &Status{} },
+	structs.MsgStatusRsp:       func() MessageMsgp { return &StatusRsp{} },
+	structs.MsgStatusCmp:       func() MessageMsgp { return &StatusCmp{} },
+	structs.MsgUlData:          func() MessageMsgp { return &UlData{} },
+	structs.MsgUlDataRsp:       func() MessageMsgp { return &UlDataRsp{} },
+	structs.MsgUlDataCmp:       func() MessageMsgp { return &UlDataCmp{} },
+	structs.MsgError:           func() MessageMsgp { return &BssciError{} },
+	structs.MsgErrorAck:        func() MessageMsgp { return &BssciErrorAck{} },
+	structs.MsgVmActivate:      func() MessageMsgp { return &VmActivate{} },
+	structs.MsgVmActivateRsp:   func() MessageMsgp { return &VmActivateRsp{} },
+	structs.MsgVmActivateCmp:   func() MessageMsgp { return &VmActivateCmp{} },
+	structs.MsgVmDeactivate:    func() MessageMsgp { return &VmDeactivate{} },
+	structs.MsgVmDeactivateRsp: func() MessageMsgp { return &VmDeactivateRsp{} },
+	structs.MsgVmDeactivateCmp: func() MessageMsgp { return &VmDeactivateCmp{} },
+	structs.MsgVmStatus:        func() MessageMsgp { return &VmStatus{} },
+	structs.MsgVmStatusRsp:     func() MessageMsgp { return &VmStatusRsp{} },
+	structs.MsgVmStatusCmp:     func() MessageMsgp { return &VmStatusCmp{} },
+	structs.MsgVmUlData:        func() MessageMsgp { return &VmUlData{} },
+	structs.MsgVmUlDataRsp:     func() MessageMsgp { return &VmUlDataRsp{} },
+	structs.MsgVmUlDataCmp:     func() MessageMsgp { return &VmUlDataCmp{} },
+	structs.MsgPrpAck:          func() MessageMsgp { return &PrpAck{} },
+}
+
+// Protocol version which introduced a command.
+//
+// Commands which are not listed are part of every version, a minor version adding a
+// command registers it here so it is only exchanged with basestations which negotiated it.
+var commandVersions = map[structs.Command]structs.Version{}
+
+// Returns true if the command is part of the protocol version.
+//
+// The zero version, i.e. no negotiated version, supports every command.
+func Supported(cmd structs.Command, v structs.Version) bool {
+	since, ok := commandVersions[cmd]
+	return !ok || v.IsZero() || v.Compare(since) >= 0
+}
+
+// Create an empty message of the command
+func NewMessage(cmd structs.Command) (MessageMsgp, error) {
+	newMessage, ok := commandMessages[cmd]
+	if !ok {
+		return nil, errors.Errorf("unknown command: %s", cmd)
+	}
+	return newMessage(), nil
+}
+
+// Decode a message pack encoded message into the struct of its command
+func UnmarshalMessage(cmd structs.Command, raw []byte) (MessageMsgp, error) {
+	msg, err := NewMessage(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := msg.UnmarshalMsg(raw); err != nil {
+		return nil, errors.Wrapf(err, "unmarshal %s error", cmd)
+	}
+	return msg, nil
+}
@@ -0,0 +1,32 @@
+package messages
+
+import (
+	"testing"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSupported(t *testing.T) {
+	assert := assert.New(t)
+
+	commandVersions["test.cmd"] = structs.Version{Major: 1, Minor: 1}
+	t.Cleanup(func() {
+		delete(commandVersions, "test.cmd")
+	})
+
+	v1_0 := structs.Version{Major: 1}
+	v1_1 := structs.Version{Major: 1, Minor: 1}
+	v1_2 := structs.Version{Major: 1, Minor: 2}
+
+	// commands without a version are part of every version
+	assert.True(Supported(structs.MsgUlData, v1_0))
+
+	assert.False(Supported("test.cmd", v1_0))
+	assert.True(Supported("test.cmd", v1_1))
+	assert.True(Supported("test.cmd", v1_2))
+
+	// no negotiated version
+	assert.True(Supported("test.cmd", structs.Version{}))
+}
@@ -0,0 +1,81 @@
+package messages
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+)
+
+// Messages received from a basestation which can be checked for semantic errors
+type ValidatableMessage interface {
+	Message
+	// check the decoded message for semantic errors
+	Validate() error
+}
+
+// Semantic error of a single message field
+type ValidationError struct {
+	// name of the invalid field as used in the message pack encoding
+	Field string
+	// description of the error
+	Reason string
+	// POSIX error number reported to the basestation
+	Code uint32
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Reason)
+}
+
+// the field has an invalid value
+func invalidField(field string, reason string) *ValidationError {
+	return &ValidationError{Field: field, Reason: reason, Code: ErrorCodeEINVAL}
+}
+
+// the field contradicts the protocol
+func protocolError(field string, reason string) *ValidationError {
+	return &ValidationError{Field: field, Reason: reason, Code: ErrorCodeEPROTO}
+}
+
+// reception times before this are implausible
+var minPlausibleTime = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// maximum tolerated clock difference to the basestation for reception times in the future
+var maxClockSkew = 24 * time.Hour
+
+func validateEui(field string, eui common.EUI64) error {
+	if eui == (common.EUI64{}) {
+		return invalidField(field, "must not be zero")
+	}
+	return nil
+}
+
+func validateTime(field string, ns uint64) error {
+	ts := time.Unix(0, int64(ns))
+	if ns > uint64(1<<63-1) || ts.Before(minPlausibleTime) {
+		return invalidField(field, "implausible time "+ts.UTC().Format(time.RFC3339Nano))
+	}
+	if ts.After(getNow().Add(maxClockSkew)) {
+		return invalidField(field, "time in the future "+ts.UTC().Format(time.RFC3339Nano))
+	}
+	return nil
+}
+
+// Check that all subpacket arrays have the same length
+func (subpackets *Subpackets) Validate() error {
+	if subpackets == nil {
+		return nil
+	}
+	n := len(subpackets.RSSI)
+	if len(subpackets.SNR) != n {
+		return invalidField("subpackets.snr", fmt.Sprintf("length %d does not match rssi length %d", len(subpackets.SNR), n))
+	}
+	if len(subpackets.Frequency) != n {
+		return invalidField("subpackets.frequency", fmt.Sprintf("length %d does not match rssi length %d", len(subpackets.Frequency), n))
+	}
+	if subpackets.Phase != nil && len(*subpackets.Phase) != n {
+		return invalidField("subpackets.phase", fmt.Sprintf("length %d does not match rssi length %d", len(*subpackets.Phase), n))
+	}
+	return nil
+}
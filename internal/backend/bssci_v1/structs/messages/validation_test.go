@@ -0,0 +1,154 @@
+package messages
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	fakeNow := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	getNow = func() time.Time { return fakeNow }
+
+	rxTime := uint64(fakeNow.UnixNano())
+	epEui := common.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	txTime := rxTime
+	packetCnt := uint32(1)
+	phase := []int32{1}
+
+	tests := []struct {
+		name      string
+		msg       ValidatableMessage
+		wantField string
+		wantCode  uint32
+	}{
+		{
+			name: "con",
+			msg:  &Con{BsEui: epEui, Version: "1.0.0"},
+		},
+		{
+			name:      "con zero bsEui",
+			msg:       &Con{Version: "1.0.0"},
+			wantField: "bsEui",
+			wantCode:  ErrorCodeEINVAL,
+		},
+		{
+			name:      "con empty version",
+			msg:       &Con{BsEui: epEui},
+			wantField: "version",
+			wantCode:  ErrorCodeEINVAL,
+		},
+		{
+			name: "att",
+			msg:  &Att{EpEui: epEui, RxTime: rxTime},
+		},
+		{
+			name:      "att zero epEui",
+			msg:       &Att{RxTime: rxTime},
+			wantField: "epEui",
+			wantCode:  ErrorCodeEINVAL,
+		},
+		{
+			name:      "att subpackets",
+			msg:       &Att{EpEui: epEui, RxTime: rxTime, Subpackets: &Subpackets{SNR: []int32{1, 2}, RSSI: []int32{1}, Frequency: []int32{1}}},
+			wantField: "subpackets.snr",
+			wantCode:  ErrorCodeEINVAL,
+		},
+		{
+			name:      "det implausible rxTime",
+			msg:       &Det{EpEui: epEui, RxTime: 1},
+			wantField: "rxTime",
+			wantCode:  ErrorCodeEINVAL,
+		},
+		{
+			name: "ulData",
+			msg:  &UlData{EpEui: epEui, RxTime: rxTime, DlOpen: true, ResponseExp: true, Subpackets: &Subpackets{SNR: []int32{1}, RSSI: []int32{1}, Frequency: []int32{1}, Phase: &phase}},
+		},
+		{
+			name:      "ulData rxTime in the future",
+			msg:       &UlData{EpEui: epEui, RxTime: uint64(fakeNow.Add(48 * time.Hour).UnixNano())},
+			wantField: "rxTime",
+			wantCode:  ErrorCodeEINVAL,
+		},
+		{
+			name:      "ulData rxTime overflow",
+			msg:       &UlData{EpEui: epEui, RxTime: 1 << 63},
+			wantField: "rxTime",
+			wantCode:  ErrorCodeEINVAL,
+		},
+		{
+			name:      "ulData responseExp without dlOpen",
+			msg:       &UlData{EpEui: epEui, RxTime: rxTime, ResponseExp: true},
+			wantField: "responseExp",
+			wantCode:  ErrorCodeEPROTO,
+		},
+		{
+			name:      "ulData subpackets phase",
+			msg:       &UlData{EpEui: epEui, RxTime: rxTime, Subpackets: &Subpackets{SNR: []int32{1, 2}, RSSI: []int32{1, 2}, Frequency: []int32{1, 2}, Phase: &phase}},
+			wantField: "subpackets.phase",
+			wantCode:  ErrorCodeEINVAL,
+		},
+		{
+			name:      "vmUlData subpackets frequency",
+			msg:       &VmUlData{SysTime: rxTime, Subpackets: &Subpackets{SNR: []int32{1}, RSSI: []int32{1}}},
+			wantField: "subpackets.frequency",
+			wantCode:  ErrorCodeEINVAL,
+		},
+		{
+			name: "dlDataRes sent",
+			msg:  &DlDataRes{EpEui: epEui, Result: dlDataResult_Sent, TxTime: &txTime, PacketCnt: &packetCnt},
+		},
+		{
+			name: "dlDataRes expired",
+			msg:  &DlDataRes{EpEui: epEui, Result: dlDataResult_Expired},
+		},
+		{
+			name:      "dlDataRes sent without txTime",
+			msg:       &DlDataRes{EpEui: epEui, Result: dlDataResult_Sent, PacketCnt: &packetCnt},
+			wantField: "txTime",
+			wantCode:  ErrorCodeEPROTO,
+		},
+		{
+			name:      "dlDataRes sent without packetCnt",
+			msg:       &DlDataRes{EpEui: epEui, Result: dlDataResult_Sent, TxTime: &txTime},
+			wantField: "packetCnt",
+			wantCode:  ErrorCodeEPROTO,
+		},
+		{
+			name:      "dlRxStat zero epEui",
+			msg:       &DlRxStat{RxTime: rxTime},
+			wantField: "epEui",
+			wantCode:  ErrorCodeEINVAL,
+		},
+		{
+			name:      "statusRsp dutyCycle",
+			msg:       &StatusRsp{DutyCycle: 1.5},
+			wantField: "dutyCycle",
+			wantCode:  ErrorCodeEINVAL,
+		},
+		{
+			name:      "vmStatusRsp macTypes",
+			msg:       &VmStatusRsp{MacTypes: []int64{1, 256}},
+			wantField: "macTypes",
+			wantCode:  ErrorCodeEINVAL,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.msg.Validate()
+			if tt.wantField == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var validationErr *ValidationError
+			if assert.ErrorAs(t, err, &validationErr) {
+				assert.Equal(t, tt.wantField, validationErr.Field)
+				assert.Equal(t, tt.wantCode, validationErr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package structs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BSSCI protocol version, major.minor.patch
+type Version struct {
+	Major uint32
+	Minor uint32
+	Patch uint32
+}
+
+// Protocol versions implemented by the adapter
+var (
+	MinVersion = Version{Major: 1, Minor: 0, Patch: 0}
+	MaxVersion = Version{Major: 1, Minor: 0, Patch: 0}
+)
+
+// Parse a major.minor.patch version string.
+//
+// Basestations report versions like 1.0.0.1 or 1.0.0-rc1, so only the major and minor
+// version are required. A missing or invalid patch version is 0, further components and
+// pre-release or build suffixes are ignored.
+func ParseVersion(s string) (v Version, err error) {
+	core, _, _ := strings.Cut(strings.TrimSpace(s), "-")
+	core, _, _ = strings.Cut(core, "+")
+	parts := strings.Split(core, ".")
+	if len(parts) < 2 {
+		return v, fmt.Errorf("invalid version %q, expected major.minor.patch", s)
+	}
+
+	major, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return v, fmt.Errorf("invalid major version in %q", s)
+	}
+	minor, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return v, fmt.Errorf("invalid minor version in %q", s)
+	}
+	v = Version{Major: uint32(major), Minor: uint32(minor)}
+
+	if len(parts) > 2 {
+		if patch, err := strconv.ParseUint(parts[2], 10, 32); err == nil {
+			v.Patch = uint32(patch)
+		}
+	}
+	return v, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Returns true if the version was not set
+func (v Version) IsZero() bool {
+	return v == Version{}
+}
+
+// Compare two versions, returns -1 if v < o, 0 if v == o and 1 if v > o
+func (v Version) Compare(o Version) int {
+	for _, d := range [][2]uint32{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if d[0] < d[1] {
+			return -1
+		}
+		if d[0] > d[1] {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Range of protocol versions accepted from basestations
+type VersionRange struct {
+	Min Version
+	Max Version
+}
+
+// The versions implemented by the adapter
+var ImplementedVersions = VersionRange{Min: MinVersion, Max: MaxVersion}
+
+// Create a version range, empty bounds default to the versions implemented by the adapter
+func NewVersionRange(min string, max string) (r VersionRange, err error) {
+	r = ImplementedVersions
+
+	if min != "" {
+		if r.Min, err = ParseVersion(min); err != nil {
+			return r, fmt.Errorf("parse min_version error: %w", err)
+		}
+	}
+	if max != "" {
+		if r.Max, err = ParseVersion(max); err != nil {
+			return r, fmt.Errorf("parse max_version error: %w", err)
+		}
+	}
+
+	if r.Min.Compare(MinVersion) < 0 {
+		return r, fmt.Errorf("min_version %s is below the lowest implemented version %s", r.Min, MinVersion)
+	}
+	if r.Max.Compare(MaxVersion) > 0 {
+		return r, fmt.Errorf("max_version %s exceeds the highest implemented version %s", r.Max, MaxVersion)
+	}
+	if r.Min.Compare(r.Max) > 0 {
+		return r, fmt.Errorf("min_version %s exceeds max_version %s", r.Min, r.Max)
+	}
+	return r, nil
+}
+
+// Negotiate the protocol version requested by a basestation.
+//
+// A request for a newer minor or patch version of a supported major version is answered
+// with the highest supported version, the basestation has to fall back to it.
+func (r VersionRange) Negotiate(requested string) (Version, error) {
+	v, err := ParseVersion(requested)
+	if err != nil {
+		return v, err
+	}
+
+	if v.Major < r.Min.Major || v.Major > r.Max.Major {
+		return v, fmt.Errorf("unsupported protocol major version %d, supported %s - %s", v.Major, r.Min, r.Max)
+	}
+	if v.Compare(r.Min) < 0 {
+		return v, fmt.Errorf("unsupported protocol version %s, supported %s - %s", v, r.Min, r.Max)
+	}
+	if v.Compare(r.Max) > 0 {
+		return r.Max, nil
+	}
+	return v, nil
+}
@@ -0,0 +1,232 @@
+package structs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    Version
+		wantErr bool
+	}{
+		{
+			name:    "1.0.0",
+			version: "1.0.0",
+			want:    Version{Major: 1},
+		},
+		{
+			name:    "multiple digits",
+			version: "2.13.104",
+			want:    Version{Major: 2, Minor: 13, Patch: 104},
+		},
+		{
+			name:    "surrounding spaces",
+			version: " 1.2.3 ",
+			want:    Version{Major: 1, Minor: 2, Patch: 3},
+		},
+		{
+			name:    "empty",
+			version: "",
+			wantErr: true,
+		},
+		{
+			name:    "missing patch",
+			version: "1.0",
+			want:    Version{Major: 1},
+		},
+		{
+			name:    "build number",
+			version: "1.0.0.1",
+			want:    Version{Major: 1},
+		},
+		{
+			name:    "pre-release",
+			version: "1.0.0-rc1",
+			want:    Version{Major: 1},
+		},
+		{
+			name:    "build metadata",
+			version: "1.2.3+b5",
+			want:    Version{Major: 1, Minor: 2, Patch: 3},
+		},
+		{
+			name:    "invalid patch",
+			version: "1.2.x",
+			want:    Version{Major: 1, Minor: 2},
+		},
+		{
+			name:    "major only",
+			version: "1",
+			wantErr: true,
+		},
+		{
+			name:    "not a number",
+			version: "1.x.0",
+			wantErr: true,
+		},
+		{
+			name:    "negative",
+			version: "1.-1.0",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseVersion(tt.version)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.want.String(), got.String())
+		})
+	}
+}
+
+func TestVersion_Compare(t *testing.T) {
+	tests := []struct {
+		name string
+		v    Version
+		o    Version
+		want int
+	}{
+		{name: "equal", v: Version{1, 2, 3}, o: Version{1, 2, 3}, want: 0},
+		{name: "major", v: Version{2, 0, 0}, o: Version{1, 9, 9}, want: 1},
+		{name: "minor", v: Version{1, 1, 0}, o: Version{1, 2, 0}, want: -1},
+		{name: "patch", v: Version{1, 2, 4}, o: Version{1, 2, 3}, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.v.Compare(tt.o))
+			assert.Equal(t, -tt.want, tt.o.Compare(tt.v))
+		})
+	}
+}
+
+func TestNewVersionRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		min     string
+		max     string
+		want    VersionRange
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: ImplementedVersions,
+		},
+		{
+			name: "configured",
+			min:  MinVersion.String(),
+			max:  MaxVersion.String(),
+			want: ImplementedVersions,
+		},
+		{
+			name:    "invalid min",
+			min:     "1",
+			wantErr: true,
+		},
+		{
+			name:    "invalid max",
+			max:     "one",
+			wantErr: true,
+		},
+		{
+			name:    "min below implemented",
+			min:     "0.9.0",
+			wantErr: true,
+		},
+		{
+			name:    "max above implemented",
+			max:     "99.0.0",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewVersionRange(tt.min, tt.max)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestVersionRange_Negotiate(t *testing.T) {
+	r := VersionRange{
+		Min: Version{Major: 1, Minor: 1, Patch: 0},
+		Max: Version{Major: 1, Minor: 3, Patch: 2},
+	}
+
+	tests := []struct {
+		name      string
+		requested string
+		want      Version
+		wantErr   bool
+	}{
+		{
+			name:      "minimum",
+			requested: "1.1.0",
+			want:      Version{Major: 1, Minor: 1, Patch: 0},
+		},
+		{
+			name:      "in range",
+			requested: "1.2.7",
+			want:      Version{Major: 1, Minor: 2, Patch: 7},
+		},
+		{
+			name:      "newer minor",
+			requested: "1.9.0",
+			want:      r.Max,
+		},
+		{
+			name:      "newer patch",
+			requested: "1.3.5",
+			want:      r.Max,
+		},
+		{
+			name:      "below minimum",
+			requested: "1.0.9",
+			wantErr:   true,
+		},
+		{
+			name:      "unsupported major",
+			requested: "2.0.0",
+			wantErr:   true,
+		},
+		{
+			name:      "pre-release of newer minor",
+			requested: "1.4.0-rc1",
+			want:      r.Max,
+		},
+		{
+			name:      "build number",
+			requested: "1.2.7.3",
+			want:      Version{Major: 1, Minor: 2, Patch: 7},
+		},
+		{
+			name:      "invalid",
+			requested: "1",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Negotiate(tt.requested)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
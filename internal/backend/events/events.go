@@ -1,20 +1,77 @@
 package events
 
-import "github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
 
 type EventType string
 
 const (
-	EventTypeBsStatus   EventType = "status"
-	EventTypeBsCon      EventType = "con"
-	EventTypeBsVmStatus EventType = "vm"
-	EventTypeBsDl       EventType = "dl"
-	EventTypeBsPrpAck   EventType = "prp_ack"
-	EventTypeEpOtaa     EventType = "otaa"
-	EventTypeEpUl       EventType = "ul"
-	EventTypeEpRx       EventType = "rx"
+	EventTypeBsStatus     EventType = "status"
+	EventTypeBsCon        EventType = "con"
+	EventTypeBsVmStatus   EventType = "vm"
+	EventTypeBsDl         EventType = "dl"
+	EventTypeBsPrpAck     EventType = "prp_ack"
+	EventTypeBsFlapping   EventType = "flapping"
+	EventTypeBsDisconnect EventType = "disconnect"
+	EventTypeBsRaw        EventType = "raw"
+	EventTypeEpOtaa       EventType = "otaa"
+	EventTypeEpUl         EventType = "ul"
+	EventTypeEpRx         EventType = "rx"
 )
 
+// event types of adapter events, published as generic structs instead of a protobuf message
+var adapterEventTypes = map[EventType]struct{}{
+	EventTypeBsFlapping:   {},
+	EventTypeBsDisconnect: {},
+	EventTypeBsRaw:        {},
+}
+
+// Returns true if events of this type are adapter events
+func IsAdapterEvent(t EventType) bool {
+	_, ok := adapterEventTypes[t]
+	return ok
+}
+
+// event types of endnode events, the other events are basestation events
+var endnodeEventTypes = map[EventType]struct{}{
+	EventTypeEpOtaa: {},
+	EventTypeEpUl:   {},
+	EventTypeEpRx:   {},
+}
+
+// Returns true if events of this type are endnode events
+func IsEndnodeEvent(t EventType) bool {
+	_, ok := endnodeEventTypes[t]
+	return ok
+}
+
+// all event types published by the adapter
+var eventTypes = map[EventType]struct{}{
+	EventTypeBsStatus:     {},
+	EventTypeBsCon:        {},
+	EventTypeBsVmStatus:   {},
+	EventTypeBsDl:         {},
+	EventTypeBsPrpAck:     {},
+	EventTypeBsFlapping:   {},
+	EventTypeBsDisconnect: {},
+	EventTypeBsRaw:        {},
+	EventTypeEpOtaa:       {},
+	EventTypeEpUl:         {},
+	EventTypeEpRx:         {},
+}
+
+// Returns true if events of this type are published by the adapter
+func IsEventType(t EventType) bool {
+	_, ok := eventTypes[t]
+	return ok
+}
+
 // Subscribe event
 type Subscribe struct {
 	// Basestation EUI64.
@@ -23,3 +80,163 @@ type Subscribe struct {
 	// Subscribe (true) or unsubscribe (false) the gateway.
 	Subscribe bool
 }
+
+// Event generated by the adapter itself, without a BSSCI message counterpart.
+//
+// As there is no protobuf definition for these events, they are encoded as a generic struct.
+type AdapterEvent interface {
+	GetEventType() EventType
+	IntoProto() *structpb.Struct
+}
+
+// Flapping event
+//
+// Published when a basestation is flagged as flapping and again once it is stable.
+type Flapping struct {
+	// Basestation EUI64.
+	BasestationEui common.EUI64
+	// Time of the event
+	Ts time.Time
+	// True if the basestation is flapping, false if it is stable again
+	Flapping bool
+	// Number of connects within the detection window
+	ConnectCount int
+	// Number of disconnects within the detection window
+	DisconnectCount int
+	// Length of the detection window
+	Window time.Duration
+}
+
+// implements AdapterEvent.GetEventType()
+func (e *Flapping) GetEventType() EventType {
+	return EventTypeBsFlapping
+}
+
+// implements AdapterEvent.IntoProto()
+func (e *Flapping) IntoProto() *structpb.Struct {
+	return &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"ts":              structpb.NewStringValue(e.Ts.UTC().Format(time.RFC3339Nano)),
+			"bsEui":           structpb.NewStringValue(e.BasestationEui.String()),
+			"flapping":        structpb.NewBoolValue(e.Flapping),
+			"connectCount":    structpb.NewNumberValue(float64(e.ConnectCount)),
+			"disconnectCount": structpb.NewNumberValue(float64(e.DisconnectCount)),
+			"window":          structpb.NewStringValue(e.Window.String()),
+		},
+	}
+}
+
+// Reason for a basestation disconnect
+type DisconnectReason string
+
+const (
+	// the connection could not be read from, e.g. closed by the basestation
+	DisconnectReasonReadError DisconnectReason = "read_error"
+	// a message could not be written to the connection
+	DisconnectReasonWriteError DisconnectReason = "write_error"
+	// a received message could not be decoded
+	DisconnectReasonCodecError DisconnectReason = "codec_error"
+	// the basestation did not respond in time
+	DisconnectReasonPingTimeout DisconnectReason = "ping_timeout"
+	// the adapter is shutting down
+	DisconnectReasonServerShutdown DisconnectReason = "server_shutdown"
+	// the connection was closed after a recovered panic
+	DisconnectReasonInternalError DisconnectReason = "internal_error"
+)
+
+// Disconnect event
+//
+// Published when the connection to a basestation is closed.
+type Disconnect struct {
+	// Basestation EUI64.
+	BasestationEui common.EUI64
+	// Time of the event
+	Ts time.Time
+	// Reason for the disconnect
+	Reason DisconnectReason
+	// Error message of the error which caused the disconnect, if any
+	Error string
+	// Remote address of the basestation
+	RemoteAddr string
+	// Duration of the session
+	SessionDuration time.Duration
+	// Number of messages received during the session
+	MessagesReceived uint64
+	// Number of messages sent during the session
+	MessagesSent uint64
+}
+
+// implements AdapterEvent.GetEventType()
+func (e *Disconnect) GetEventType() EventType {
+	return EventTypeBsDisconnect
+}
+
+// implements AdapterEvent.IntoProto()
+func (e *Disconnect) IntoProto() *structpb.Struct {
+	return &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"ts":               structpb.NewStringValue(e.Ts.UTC().Format(time.RFC3339Nano)),
+			"bsEui":            structpb.NewStringValue(e.BasestationEui.String()),
+			"reason":           structpb.NewStringValue(string(e.Reason)),
+			"error":            structpb.NewStringValue(e.Error),
+			"remoteAddr":       structpb.NewStringValue(e.RemoteAddr),
+			"sessionDuration":  structpb.NewStringValue(e.SessionDuration.String()),
+			"messagesReceived": structpb.NewNumberValue(float64(e.MessagesReceived)),
+			"messagesSent":     structpb.NewNumberValue(float64(e.MessagesSent)),
+		},
+	}
+}
+
+// Direction of a raw BSSCI frame
+type RawDirection string
+
+const (
+	// frame received from the basestation
+	RawDirectionInbound RawDirection = "inbound"
+	// frame sent to the basestation
+	RawDirectionOutbound RawDirection = "outbound"
+)
+
+// Raw event
+//
+// Published for every BSSCI frame sent or received if raw frame publishing is enabled.
+type Raw struct {
+	// Basestation EUI64.
+	BasestationEui common.EUI64
+	// Time of the event
+	Ts time.Time
+	// Direction of the frame
+	Direction RawDirection
+	// BSSCI command of the frame
+	Command string
+	// BSSCI operation ID of the frame
+	OpId int64
+	// Message pack encoded message, without the BSSCI header
+	Payload []byte
+	// Decoded message, if set it is published instead of the payload
+	Data *structpb.Struct
+}
+
+// implements AdapterEvent.GetEventType()
+func (e *Raw) GetEventType() EventType {
+	return EventTypeBsRaw
+}
+
+// implements AdapterEvent.IntoProto()
+func (e *Raw) IntoProto() *structpb.Struct {
+	pb := &structpb.Struct{
+		Fields: map[string]*structpb.Value{
+			"ts":        structpb.NewStringValue(e.Ts.UTC().Format(time.RFC3339Nano)),
+			"bsEui":     structpb.NewStringValue(e.BasestationEui.String()),
+			"direction": structpb.NewStringValue(string(e.Direction)),
+			"command":   structpb.NewStringValue(e.Command),
+			"opId":      structpb.NewNumberValue(float64(e.OpId)),
+		},
+	}
+	if e.Data != nil {
+		pb.Fields["data"] = structpb.NewStructValue(e.Data)
+	} else {
+		pb.Fields["payload"] = structpb.NewStringValue(base64.StdEncoding.EncodeToString(e.Payload))
+	}
+	return pb
+}
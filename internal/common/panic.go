@@ -0,0 +1,40 @@
+package common
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
+)
+
+var (
+	pan = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "panics_total",
+		Help: "The number of recovered panics (per component).",
+	}, []string{"component"})
+)
+
+func panicCounter(component string) prometheus.Counter {
+	return pan.With(prometheus.Labels{"component": component})
+}
+
+// RecoverPanic recovers a panic of the calling goroutine.
+//
+// It must be deferred directly. The panic is logged with a stack trace, counted and
+// passed to onPanic (optional) as an error to clean up after the failed operation.
+func RecoverPanic(logger *zerolog.Logger, component string, onPanic func(err error)) {
+	p := recover()
+	if p == nil {
+		return
+	}
+
+	err := fmt.Errorf("panic: %v", p)
+	panicCounter(component).Inc()
+	logger.Error().Err(err).Str("component", component).Bytes("stack", debug.Stack()).Msg("recovered from panic")
+
+	if onPanic != nil {
+		onPanic(err)
+	}
+}
@@ -0,0 +1,39 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	assert := assert.New(t)
+	logger := zerolog.Nop()
+
+	var recovered error
+	func() {
+		defer RecoverPanic(&logger, "test", func(err error) {
+			recovered = err
+		})
+		var s []int
+		_ = s[1]
+	}()
+
+	assert.ErrorContains(recovered, "index out of range")
+
+	// no panic, onPanic is not called
+	recovered = nil
+	func() {
+		defer RecoverPanic(&logger, "test", func(err error) {
+			recovered = err
+		})
+	}()
+	assert.NoError(recovered)
+
+	// without callback
+	assert.NotPanics(func() {
+		defer RecoverPanic(&logger, "test", nil)
+		panic("test")
+	})
+}
@@ -18,29 +18,66 @@ type Config struct {
 		Type string `mapstructure:"type"`
 
 		BssciV1 struct {
-			Bind            string        `mapstructure:"bind"`
-			TLSCert         string        `mapstructure:"tls_cert"`
-			TLSKey          string        `mapstructure:"tls_key"`
-			CACert          string        `mapstructure:"ca_cert"`
-			PingInterval    time.Duration `mapstructure:"ping_interval"`
-			StatsInterval   time.Duration `mapstructure:"stats_interval"`
-			KeepAlivePeriod time.Duration `mapstructure:"keep_alive_period"`
+			Bind             string        `mapstructure:"bind"`
+			TLSCert          string        `mapstructure:"tls_cert"`
+			TLSKey           string        `mapstructure:"tls_key"`
+			CACert           string        `mapstructure:"ca_cert"`
+			PingInterval     time.Duration `mapstructure:"ping_interval"`
+			StatsInterval    time.Duration `mapstructure:"stats_interval"`
+			KeepAlivePeriod  time.Duration `mapstructure:"keep_alive_period"`
+			OperationTimeout time.Duration `mapstructure:"operation_timeout"`
+			MinVersion       string        `mapstructure:"min_version"`
+			MaxVersion       string        `mapstructure:"max_version"`
+
+			FlapDetection struct {
+				Enabled      bool          `mapstructure:"enabled"`
+				Window       time.Duration `mapstructure:"window"`
+				Threshold    int           `mapstructure:"threshold"`
+				StablePeriod time.Duration `mapstructure:"stable_period"`
+				Quarantine   bool          `mapstructure:"quarantine"`
+			} `mapstructure:"flap_detection"`
+
+			Raw struct {
+				Enabled  bool     `mapstructure:"enabled"`
+				Format   string   `mapstructure:"format"`
+				Commands []string `mapstructure:"commands"`
+			} `mapstructure:"raw"`
+
+			Capture struct {
+				Enabled   bool   `mapstructure:"enabled"`
+				Directory string `mapstructure:"directory"`
+				MaxSize   int64  `mapstructure:"max_size"`
+				MaxFiles  int    `mapstructure:"max_files"`
+			} `mapstructure:"capture"`
+
+			PublishConfirmation struct {
+				Enabled bool          `mapstructure:"enabled"`
+				Timeout time.Duration `mapstructure:"timeout"`
+			} `mapstructure:"publish_confirmation"`
 		} `mapstructure:"bssci_v1"`
 	} `mapstructure:"backend"`
 
 	Integration struct {
-		Marshaler string `mapstructure:"marshaler"`
-		MQTTV3    struct {
-			StateRetained           bool          `mapstructure:"state_retained"`
-			KeepAlive               time.Duration `mapstructure:"keep_alive"`
-			MaxReconnectInterval    time.Duration `mapstructure:"max_reconnect_interval"`
-			MaxTokenWait            time.Duration `mapstructure:"max_token_wait"`
-			TerminateOnConnectError bool          `mapstructure:"terminate_on_connect_error"`
-			EventTopicTemplate      string        `mapstructure:"event_topic_template"`
-			CommandTopicTemplate    string        `mapstructure:"command_topic_template"`
-			ResponseTopicTemplate    string        `mapstructure:"response_topic_template"`
-			StateTopicTemplate      string        `mapstructure:"state_topic_template"`
-			Auth struct {
+		Type              string              `mapstructure:"type"`
+		Types             []string            `mapstructure:"types"`
+		EventFilters      map[string][]string `mapstructure:"event_filters"`
+		Required          []string            `mapstructure:"required"`
+		OptionalQueueSize int                 `mapstructure:"optional_queue_size"`
+		Marshaler         string              `mapstructure:"marshaler"`
+		MQTTV3            struct {
+			StateRetained           bool             `mapstructure:"state_retained"`
+			KeepAlive               time.Duration    `mapstructure:"keep_alive"`
+			MaxReconnectInterval    time.Duration    `mapstructure:"max_reconnect_interval"`
+			MaxTokenWait            time.Duration    `mapstructure:"max_token_wait"`
+			TerminateOnConnectError bool             `mapstructure:"terminate_on_connect_error"`
+			EventTopicTemplate      string           `mapstructure:"event_topic_template"`
+			CommandTopicTemplate    string           `mapstructure:"command_topic_template"`
+			ResponseTopicTemplate   string           `mapstructure:"response_topic_template"`
+			StateTopicTemplate      string           `mapstructure:"state_topic_template"`
+			EventQOS                map[string]uint8 `mapstructure:"event_qos"`
+			RetainedEvents          []string         `mapstructure:"retained_events"`
+			SubscribeQOS            int              `mapstructure:"subscribe_qos"`
+			Auth                    struct {
 				Type    string `mapstructure:"type"`
 				Generic struct {
 					Servers      []string `mapstructure:"servers"`
@@ -55,6 +92,114 @@ type Config struct {
 				} `mapstructure:"generic"`
 			} `mapstructure:"auth"`
 		} `mapstructure:"mqtt_v3"`
+		MQTTV5 struct {
+			StateRetained           bool             `mapstructure:"state_retained"`
+			KeepAlive               time.Duration    `mapstructure:"keep_alive"`
+			ConnectRetryDelay       time.Duration    `mapstructure:"connect_retry_delay"`
+			ConnectTimeout          time.Duration    `mapstructure:"connect_timeout"`
+			PublishTimeout          time.Duration    `mapstructure:"publish_timeout"`
+			TerminateOnConnectError bool             `mapstructure:"terminate_on_connect_error"`
+			SessionExpiryInterval   time.Duration    `mapstructure:"session_expiry_interval"`
+			CommandResultTimeout    time.Duration    `mapstructure:"command_result_timeout"`
+			TopicAliasEvents        []string         `mapstructure:"topic_alias_events"`
+			EventTopicTemplate      string           `mapstructure:"event_topic_template"`
+			CommandTopicTemplate    string           `mapstructure:"command_topic_template"`
+			ResponseTopicTemplate   string           `mapstructure:"response_topic_template"`
+			StateTopicTemplate      string           `mapstructure:"state_topic_template"`
+			EventQOS                map[string]uint8 `mapstructure:"event_qos"`
+			RetainedEvents          []string         `mapstructure:"retained_events"`
+			SubscribeQOS            int              `mapstructure:"subscribe_qos"`
+			Auth                    struct {
+				Type    string `mapstructure:"type"`
+				Generic struct {
+					Servers    []string `mapstructure:"servers"`
+					Username   string   `mapstructure:"username"`
+					Password   string   `mapstructure:"password"`
+					CACert     string   `mapstructure:"ca_cert"`
+					TLSCert    string   `mapstructure:"tls_cert"`
+					TLSKey     string   `mapstructure:"tls_key"`
+					QOS        uint8    `mapstructure:"qos"`
+					CleanStart bool     `mapstructure:"clean_start"`
+					ClientID   string   `mapstructure:"client_id"`
+				} `mapstructure:"generic"`
+			} `mapstructure:"auth"`
+		} `mapstructure:"mqtt_v5"`
+		Webhook struct {
+			EventURLTemplate string        `mapstructure:"event_url_template"`
+			StateURLTemplate string        `mapstructure:"state_url_template"`
+			Timeout          time.Duration `mapstructure:"timeout"`
+			MaxRetries       int           `mapstructure:"max_retries"`
+			RetryBackoff     time.Duration `mapstructure:"retry_backoff"`
+			MaxRetryBackoff  time.Duration `mapstructure:"max_retry_backoff"`
+			SigningSecret    string        `mapstructure:"signing_secret"`
+			CACert           string        `mapstructure:"ca_cert"`
+			TLSCert          string        `mapstructure:"tls_cert"`
+			TLSKey           string        `mapstructure:"tls_key"`
+			Inbound          struct {
+				Bind    string `mapstructure:"bind"`
+				TLSCert string `mapstructure:"tls_cert"`
+				TLSKey  string `mapstructure:"tls_key"`
+			} `mapstructure:"inbound"`
+		} `mapstructure:"webhook"`
+		GRPC struct {
+			Bind          string `mapstructure:"bind"`
+			TLSCert       string `mapstructure:"tls_cert"`
+			TLSKey        string `mapstructure:"tls_key"`
+			CACert        string `mapstructure:"ca_cert"`
+			SendQueueSize int    `mapstructure:"send_queue_size"`
+		} `mapstructure:"grpc"`
+		NATS struct {
+			Servers                 []string      `mapstructure:"servers"`
+			Name                    string        `mapstructure:"name"`
+			Username                string        `mapstructure:"username"`
+			Password                string        `mapstructure:"password"`
+			Token                   string        `mapstructure:"token"`
+			CredentialsFile         string        `mapstructure:"credentials_file"`
+			CACert                  string        `mapstructure:"ca_cert"`
+			TLSCert                 string        `mapstructure:"tls_cert"`
+			TLSKey                  string        `mapstructure:"tls_key"`
+			ConnectTimeout          time.Duration `mapstructure:"connect_timeout"`
+			ReconnectWait           time.Duration `mapstructure:"reconnect_wait"`
+			EventSubjectTemplate    string        `mapstructure:"event_subject_template"`
+			StateSubjectTemplate    string        `mapstructure:"state_subject_template"`
+			CommandSubjectTemplate  string        `mapstructure:"command_subject_template"`
+			ResponseSubjectTemplate string        `mapstructure:"response_subject_template"`
+			JetStream               struct {
+				Enabled        bool          `mapstructure:"enabled"`
+				Stream         string        `mapstructure:"stream"`
+				CreateStream   bool          `mapstructure:"create_stream"`
+				StreamSubjects []string      `mapstructure:"stream_subjects"`
+				Events         []string      `mapstructure:"events"`
+				AckTimeout     time.Duration `mapstructure:"ack_timeout"`
+				MaxPending     int           `mapstructure:"max_pending"`
+				MaxRetries     int           `mapstructure:"max_retries"`
+				RetryWait      time.Duration `mapstructure:"retry_wait"`
+			} `mapstructure:"jetstream"`
+		} `mapstructure:"nats"`
+		WebSocket struct {
+			Bind           string        `mapstructure:"bind"`
+			Path           string        `mapstructure:"path"`
+			TLSCert        string        `mapstructure:"tls_cert"`
+			TLSKey         string        `mapstructure:"tls_key"`
+			AllowedOrigins []string      `mapstructure:"allowed_origins"`
+			SendBufferSize int           `mapstructure:"send_buffer_size"`
+			WriteTimeout   time.Duration `mapstructure:"write_timeout"`
+		} `mapstructure:"websocket"`
+		File struct {
+			Output       string `mapstructure:"output"`
+			MaxSizeMB    int    `mapstructure:"max_size_mb"`
+			MaxBackups   int    `mapstructure:"max_backups"`
+			CommandInput string `mapstructure:"command_input"`
+		} `mapstructure:"file"`
+		StoreForward struct {
+			Integrations  []string      `mapstructure:"integrations"`
+			Dir           string        `mapstructure:"dir"`
+			MaxSizeMB     int           `mapstructure:"max_size_mb"`
+			SegmentSizeMB int           `mapstructure:"segment_size_mb"`
+			MaxAge        time.Duration `mapstructure:"max_age"`
+			RetryInterval time.Duration `mapstructure:"retry_interval"`
+			SyncWrites    bool          `mapstructure:"sync_writes"`
+		} `mapstructure:"store_forward"`
 	} `mapstructure:"integration"`
 
 	Metrics struct {
@@ -0,0 +1,284 @@
+package conformance
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs/messages"
+
+	"github.com/pkg/errors"
+)
+
+// A scripted scenario run against the connected basestation
+type testCase struct {
+	name string
+	run  func(r *runner) error
+}
+
+// all cases except connect, in the order they are run
+var cases = []testCase{
+	{"ping", testPing},
+	{"status", testStatus},
+	{"att_prp", testAttPrp},
+	{"dl_data_que", testDlDataQue},
+	{"dl_data_rev", testDlDataRev},
+	{"dl_rx_stat_qry", testDlRxStatQry},
+	{"det_prp", testDetPrp},
+	{"vm", testVm},
+	{"server_error", testServerError},
+	{"bs_error", testBsError},
+	{"resume", testResume},
+}
+
+func findCase(name string) *testCase {
+	for i := range cases {
+		if cases[i].name == name {
+			return &cases[i]
+		}
+	}
+	return nil
+}
+
+// number of status requests of the status case
+const statusPolls = 3
+
+// counter dependent downlink data is queued for this many packet counters
+const dlPacketCnts = 3
+
+// the basestation connects with a valid con and completes the connect operation
+func (r *runner) connect() error {
+	conn, err := r.accept()
+	if err != nil {
+		return err
+	}
+	session, con, err := r.handshake(conn, false)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	r.session = session
+	r.con = con
+	return nil
+}
+
+func testPing(r *runner) error {
+	s := r.session
+	opId := s.nextOpId()
+	req := messages.NewPing(opId)
+	cmp := messages.NewPingCmp(opId)
+	_, err := s.operation(&req, structs.MsgPingRsp, &cmp)
+	return err
+}
+
+// repeated status requests are answered with a valid status and advancing time
+func testStatus(r *runner) error {
+	s := r.session
+	var last uint64
+	for i := 0; i < statusPolls; i++ {
+		opId := s.nextOpId()
+		req := messages.NewStatus(opId)
+		cmp := messages.NewStatusCmp(opId)
+		rsp, err := s.operation(&req, structs.MsgStatusRsp, &cmp)
+		if err != nil {
+			return errors.Wrapf(err, "poll %d", i+1)
+		}
+		status := rsp.(*messages.StatusRsp)
+		if status.Time < last {
+			return errors.Errorf("poll %d: status time went backwards", i+1)
+		}
+		last = status.Time
+	}
+	return nil
+}
+
+func testAttPrp(r *runner) error {
+	s := r.session
+	opId := s.nextOpId()
+	var key [16]byte
+	copy(key[:], bytes.Repeat([]byte{0xa5}, len(key)))
+	req := messages.NewAttPrp(opId, r.config.Endnode, true, key, 0x1234, 0, false, false, false, false)
+	cmp := messages.NewAttPrpCmp(opId)
+	_, err := s.operation(&req, structs.MsgAttPrpRsp, &cmp)
+	return err
+}
+
+// queue a downlink, once with plain and once with counter dependent user data
+func testDlDataQue(r *runner) error {
+	if err := r.queueDownlink(false); err != nil {
+		return errors.Wrap(err, "plain user data")
+	}
+	if err := r.queueDownlink(true); err != nil {
+		return errors.Wrap(err, "counter dependent user data")
+	}
+	return nil
+}
+
+func (r *runner) queueDownlink(cntDepend bool) error {
+	s := r.session
+	opId := s.nextOpId()
+	queId := r.queId
+	r.queId++
+
+	var req messages.DlDataQue
+	if cntDepend {
+		packetCnts := make([]uint32, dlPacketCnts)
+		userData := make([][]byte, dlPacketCnts)
+		for i := range packetCnts {
+			packetCnts[i] = uint32(i + 1)
+			userData[i] = []byte{0xc0, byte(i + 1)}
+		}
+		req = messages.NewDlDataQueEnc(opId, r.config.Endnode, queId, nil, nil, packetCnts, userData, nil, nil, nil, nil)
+	} else {
+		req = messages.NewDlDataQue(opId, r.config.Endnode, queId, nil, nil, []byte{0xca, 0xfe}, nil, nil, nil, nil)
+	}
+	cmp := messages.NewDlDataQueCmp(opId)
+	_, err := s.operation(&req, structs.MsgDlDataQueRsp, &cmp)
+	return err
+}
+
+// revoke a queued downlink
+func testDlDataRev(r *runner) error {
+	queId := r.queId
+	if err := r.queueDownlink(false); err != nil {
+		return errors.Wrap(err, "queue downlink")
+	}
+
+	s := r.session
+	opId := s.nextOpId()
+	req := messages.NewDlDataRev(opId, r.config.Endnode, queId)
+	cmp := messages.NewDlDataRevCmp(opId)
+	_, err := s.operation(&req, structs.MsgDlDataRevRsp, &cmp)
+	return err
+}
+
+func testDlRxStatQry(r *runner) error {
+	s := r.session
+	opId := s.nextOpId()
+	req := messages.NewDlRxStatQry(opId, r.config.Endnode)
+	cmp := messages.NewDlRxStatQryCmp(opId)
+	_, err := s.operation(&req, structs.MsgDlRxStatQryRsp, &cmp)
+	return err
+}
+
+func testDetPrp(r *runner) error {
+	s := r.session
+	opId := s.nextOpId()
+	req := messages.NewDetPrp(opId, r.config.Endnode)
+	cmp := messages.NewDetPrpCmp(opId)
+	_, err := s.operation(&req, structs.MsgDetPrpRsp, &cmp)
+	return err
+}
+
+// activate a variable MAC, check the status, deactivate it and check the status again
+func testVm(r *runner) error {
+	s := r.session
+	macType := r.config.MacType
+
+	opId := s.nextOpId()
+	activate := messages.NewVmActivate(opId, macType)
+	activateCmp := messages.NewVmActivateCmp(opId)
+	if _, err := s.operation(&activate, structs.MsgVmActivateRsp, &activateCmp); err != nil {
+		return errors.Wrap(err, "activate")
+	}
+	if active, err := r.vmActive(macType); err != nil {
+		return err
+	} else if !active {
+		return errors.Errorf("mac type %d not active after activation", macType)
+	}
+
+	opId = s.nextOpId()
+	deactivate := messages.NewVmDeactivate(opId, macType)
+	deactivateCmp := messages.NewVmDeactivateCmp(opId)
+	if _, err := s.operation(&deactivate, structs.MsgVmDeactivateRsp, &deactivateCmp); err != nil {
+		return errors.Wrap(err, "deactivate")
+	}
+	if active, err := r.vmActive(macType); err != nil {
+		return err
+	} else if active {
+		return errors.Errorf("mac type %d still active after deactivation", macType)
+	}
+	return nil
+}
+
+func (r *runner) vmActive(macType uint32) (bool, error) {
+	s := r.session
+	opId := s.nextOpId()
+	req := messages.NewVmStatus(opId)
+	cmp := messages.NewVmStatusCmp(opId)
+	rsp, err := s.operation(&req, structs.MsgVmStatusRsp, &cmp)
+	if err != nil {
+		return false, errors.Wrap(err, "status")
+	}
+	return slices.Contains(rsp.(*messages.VmStatusRsp).MacTypes, int64(macType)), nil
+}
+
+// an error sent instead of the completion is acknowledged
+func testServerError(r *runner) error {
+	s := r.session
+	opId := s.nextOpId()
+	req := messages.NewStatus(opId)
+	if err := s.write(&req); err != nil {
+		return err
+	}
+	rsp, err := s.receive(opId)
+	if err != nil {
+		return err
+	}
+	if err := expectMessage(rsp, structs.MsgStatusRsp); err != nil {
+		return err
+	}
+
+	bssciError := messages.NewBssciError(opId, messages.ErrorCodeEIO, "conformance test error")
+	if err := s.write(&bssciError); err != nil {
+		return err
+	}
+	rsp, err = s.receive(opId)
+	if err != nil {
+		return err
+	}
+	return expectMessage(rsp, structs.MsgErrorAck)
+}
+
+// an unknown command is answered with an error, the session stays usable after the error acknowledgement
+func testBsError(r *runner) error {
+	s := r.session
+	opId := s.nextOpId()
+	req := messages.NewPing(opId)
+	req.Command = "conformance.unknown"
+	if err := s.write(&req); err != nil {
+		return err
+	}
+	rsp, err := s.receive(opId)
+	if err != nil {
+		return err
+	}
+	if err := expectMessage(rsp, structs.MsgError); err != nil {
+		return err
+	}
+	ack := messages.NewBssciErrorAck(opId)
+	if err := s.write(&ack); err != nil {
+		return err
+	}
+	return errors.Wrap(testPing(r), "ping after error")
+}
+
+// the basestation reconnects after the connection is closed and resumes the session
+func testResume(r *runner) error {
+	r.session.close()
+
+	conn, err := r.accept()
+	if err != nil {
+		return errors.Wrap(err, "reconnect")
+	}
+	session, con, err := r.handshake(conn, true)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	r.session = session
+	if con.BsEui != r.con.BsEui {
+		return errors.Errorf("reconnected with bsEui %s instead of %s", con.BsEui, r.con.BsEui)
+	}
+	return errors.Wrap(testPing(r), "ping after resume")
+}
@@ -0,0 +1,256 @@
+// Package conformance checks whether a basestation implements the BSSCI operations of the service center side.
+//
+// The runner takes the role of the service center, runs a scripted suite of cases against a
+// connecting basestation and reports the result of each case.
+package conformance
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs/messages"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+)
+
+// Configuration of a conformance run
+type Config struct {
+	// Timeout of a single message exchange
+	Timeout time.Duration
+	// Time to wait for the basestation to connect or reconnect
+	ConnectTimeout time.Duration
+	// Endnode used by the endnode operations
+	Endnode common.EUI64
+	// Variable MAC type used by the vm case
+	MacType uint32
+	// Names of the cases to run, all cases if empty
+	Cases []string
+}
+
+// Result of a case
+type Status string
+
+const (
+	StatusPassed  Status = "passed"
+	StatusFailed  Status = "failed"
+	StatusSkipped Status = "skipped"
+)
+
+type Result struct {
+	Name     string        `json:"name"`
+	Status   Status        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Results of a conformance run
+type Report struct {
+	BsEui    string        `json:"bsEui,omitempty"`
+	Vendor   string        `json:"vendor,omitempty"`
+	Model    string        `json:"model,omitempty"`
+	Name     string        `json:"name,omitempty"`
+	Version  string        `json:"version,omitempty"`
+	Results  []Result      `json:"results"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Number of failed cases
+func (r *Report) Failed() int {
+	failed := 0
+	for _, result := range r.Results {
+		if result.Status == StatusFailed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Name of the connect case, run before all other cases
+const caseConnect = "connect"
+
+// Names of all cases in the order they are run
+func Cases() []string {
+	names := []string{caseConnect}
+	for _, c := range cases {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// State of a conformance run
+type runner struct {
+	ctx      context.Context
+	listener net.Listener
+	config   Config
+	logger   zerolog.Logger
+
+	session  *session
+	con      messages.Con
+	version  structs.Version
+	snScUuid uuid.UUID
+	// next downlink queue id
+	queId uint64
+}
+
+// Run the conformance cases against the first basestation connecting to the listener.
+//
+// An error is returned if the configuration is invalid, failed cases are part of the report.
+func Run(ctx context.Context, listener net.Listener, config Config, logger zerolog.Logger) (Report, error) {
+	var report Report
+
+	selected := make(map[string]bool)
+	for _, name := range config.Cases {
+		selected[name] = true
+	}
+	for name := range selected {
+		if name != caseConnect && findCase(name) == nil {
+			return report, errors.Errorf("unknown case: %s", name)
+		}
+	}
+	if config.Timeout <= 0 || config.ConnectTimeout <= 0 {
+		return report, errors.New("timeouts must be positive")
+	}
+
+	r := runner{
+		ctx:      ctx,
+		listener: listener,
+		config:   config,
+		logger:   logger,
+		queId:    1,
+	}
+	defer func() {
+		if r.session != nil {
+			r.session.close()
+		}
+	}()
+
+	start := time.Now()
+	connect := r.runCase(caseConnect, (*runner).connect)
+	report.Results = append(report.Results, connect)
+	if connect.Status == StatusPassed {
+		report.BsEui = r.con.BsEui.String()
+		report.Vendor = stringValue(r.con.Vendor)
+		report.Model = stringValue(r.con.Model)
+		report.Name = stringValue(r.con.Name)
+		report.Version = r.version.String()
+	}
+
+	for _, c := range cases {
+		if len(selected) != 0 && !selected[c.name] {
+			continue
+		}
+		if connect.Status != StatusPassed {
+			report.Results = append(report.Results, Result{Name: c.name, Status: StatusSkipped, Error: "basestation not connected"})
+			continue
+		}
+		report.Results = append(report.Results, r.runCase(c.name, c.run))
+	}
+	report.Duration = time.Since(start)
+	return report, nil
+}
+
+func (r *runner) runCase(name string, run func(r *runner) error) Result {
+	start := time.Now()
+	r.logger.Info().Str("case", name).Msg("running case")
+
+	err := run(r)
+	result := Result{Name: name, Status: StatusPassed, Duration: time.Since(start)}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+		r.logger.Error().Err(err).Str("case", name).Msg("case failed")
+	}
+	return result
+}
+
+// Wait for a basestation to connect
+func (r *runner) accept() (net.Conn, error) {
+	type accepted struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan accepted, 1)
+	go func() {
+		conn, err := r.listener.Accept()
+		ch <- accepted{conn, err}
+	}()
+
+	select {
+	case a := <-ch:
+		return a.conn, errors.Wrap(a.err, "accept error")
+	case <-time.After(r.config.ConnectTimeout):
+		return nil, errors.Errorf("no basestation connected within %s", r.config.ConnectTimeout)
+	case <-r.ctx.Done():
+		return nil, r.ctx.Err()
+	}
+}
+
+// Run the connect operation on a new connection, resuming the current session if requested
+func (r *runner) handshake(conn net.Conn, resume bool) (*session, messages.Con, error) {
+	var con messages.Con
+
+	conn.SetReadDeadline(time.Now().Add(r.config.Timeout))
+	cmd, raw, err := bssci_v1.ReadBssciMessage(conn)
+	if err != nil {
+		return nil, con, errors.Wrap(err, "read con error")
+	}
+	if cmd.GetCommand() != structs.MsgCon {
+		return nil, con, errors.Errorf("expected con, got %s", cmd.GetCommand())
+	}
+	if _, err := con.UnmarshalMsg(raw); err != nil {
+		return nil, con, errors.Wrap(err, "unmarshal con error")
+	}
+	if con.OpId != 0 {
+		return nil, con, errors.Errorf("con must use opId 0, got %d", con.OpId)
+	}
+	if err := con.Validate(); err != nil {
+		return nil, con, errors.Wrap(err, "invalid con")
+	}
+	version, err := structs.ImplementedVersions.Negotiate(con.Version)
+	if err != nil {
+		return nil, con, err
+	}
+
+	opId := int64(0)
+	snScUuid := uuid.New()
+	if resume {
+		if con.SnBsUuid.ToUuid() != r.con.SnBsUuid.ToUuid() {
+			return nil, con, errors.Errorf("snBsUuid changed from %s to %s, the session can not be resumed", r.con.SnBsUuid.ToUuid(), con.SnBsUuid.ToUuid())
+		}
+		snScUuid = r.snScUuid
+		opId = r.session.opId.Load()
+	}
+	conRsp := messages.NewConRsp(con.OpId, version.String(), snScUuid)
+	conRsp.SnResume = resume
+
+	conn.SetWriteDeadline(time.Now().Add(r.config.Timeout))
+	if err := bssci_v1.WriteBssciMessage(conn, &conRsp); err != nil {
+		return nil, con, errors.Wrap(err, "write conRsp error")
+	}
+	cmd, _, err = bssci_v1.ReadBssciMessage(conn)
+	if err != nil {
+		return nil, con, errors.Wrap(err, "read conCmp error")
+	}
+	if cmd.GetCommand() != structs.MsgConCmp || cmd.GetOpId() != con.OpId {
+		return nil, con, errors.Errorf("expected conCmp with opId %d, got %s with opId %d", con.OpId, cmd.GetCommand(), cmd.GetOpId())
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	r.snScUuid = snScUuid
+	r.version = version
+	logger := r.logger.With().Str("bs_eui", con.BsEui.String()).Logger()
+	return newSession(conn, logger, r.config.Timeout, opId), con, nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
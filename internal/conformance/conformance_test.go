@@ -0,0 +1,120 @@
+package conformance
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/simulator"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testConfig = Config{
+	Timeout:        2 * time.Second,
+	ConnectTimeout: 5 * time.Second,
+	Endnode:        common.EUI64{1, 2, 3, 4, 5, 6, 7, 8},
+	MacType:        3,
+}
+
+// connect a simulated basestation with uplink traffic to the listener, reconnecting until the test ends
+func startSimulator(t *testing.T, listener net.Listener) *simulator.Basestation {
+	scenario, err := simulator.NewBenchScenario(simulator.BenchConfig{Basestations: 1, Endnodes: 2, Rate: 20, PayloadSize: 4})
+	require.NoError(t, err)
+	bs := simulator.NewBasestation(scenario.Basestations[0], zerolog.Nop())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() {
+		for ctx.Err() == nil {
+			if conn, err := net.Dial("tcp", listener.Addr().String()); err == nil {
+				bs.Run(ctx, conn)
+			}
+			select {
+			case <-time.After(50 * time.Millisecond):
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return bs
+}
+
+func newTestListener(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	return listener
+}
+
+func TestRun_simulator(t *testing.T) {
+	listener := newTestListener(t)
+	bs := startSimulator(t, listener)
+
+	report, err := Run(context.Background(), listener, testConfig, zerolog.Nop())
+	require.NoError(t, err)
+
+	for _, result := range report.Results {
+		assert.Equal(t, StatusPassed, result.Status, "%s: %s", result.Name, result.Error)
+	}
+	assert.Equal(t, Cases(), resultNames(report))
+	assert.Zero(t, report.Failed())
+	assert.Equal(t, bs.Eui().String(), report.BsEui)
+	assert.Equal(t, structs.MaxVersion.String(), report.Version)
+}
+
+func TestRun_selectedCases(t *testing.T) {
+	listener := newTestListener(t)
+	startSimulator(t, listener)
+
+	config := testConfig
+	config.Cases = []string{"vm", "ping"}
+	report, err := Run(context.Background(), listener, config, zerolog.Nop())
+	require.NoError(t, err)
+
+	// connect is always run, the cases keep the suite order
+	assert.Equal(t, []string{"connect", "ping", "vm"}, resultNames(report))
+	assert.Zero(t, report.Failed())
+}
+
+func TestRun_notConnected(t *testing.T) {
+	listener := newTestListener(t)
+
+	config := testConfig
+	config.ConnectTimeout = 50 * time.Millisecond
+	config.Cases = []string{"ping", "status"}
+	report, err := Run(context.Background(), listener, config, zerolog.Nop())
+	require.NoError(t, err)
+
+	require.Len(t, report.Results, 3)
+	assert.Equal(t, StatusFailed, report.Results[0].Status)
+	assert.Equal(t, StatusSkipped, report.Results[1].Status)
+	assert.Equal(t, StatusSkipped, report.Results[2].Status)
+	assert.Equal(t, 1, report.Failed())
+}
+
+func TestRun_invalidConfig(t *testing.T) {
+	listener := newTestListener(t)
+
+	config := testConfig
+	config.Cases = []string{"unknown"}
+	_, err := Run(context.Background(), listener, config, zerolog.Nop())
+	assert.Error(t, err)
+
+	config = testConfig
+	config.Timeout = 0
+	_, err = Run(context.Background(), listener, config, zerolog.Nop())
+	assert.Error(t, err)
+}
+
+func resultNames(report Report) []string {
+	var names []string
+	for _, result := range report.Results {
+		names = append(names, result.Name)
+	}
+	return names
+}
@@ -0,0 +1,193 @@
+package conformance
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs/messages"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// A message received in an operation initiated by the runner
+type response struct {
+	opId int64
+	cmd  structs.Command
+	msg  messages.MessageMsgp
+	err  error
+}
+
+// A connected basestation session, operations initiated by the basestation are answered automatically
+type session struct {
+	conn    net.Conn
+	logger  zerolog.Logger
+	timeout time.Duration
+
+	writeMux sync.Mutex
+	// last opId used by the runner, counting down from -1
+	opId atomic.Int64
+
+	responses chan response
+	// closed when reading from the connection fails
+	closed chan struct{}
+	err    error
+
+	// operations initiated by the basestation
+	answered atomic.Int64
+}
+
+func newSession(conn net.Conn, logger zerolog.Logger, timeout time.Duration, opId int64) *session {
+	s := session{
+		conn:      conn,
+		logger:    logger,
+		timeout:   timeout,
+		responses: make(chan response, 16),
+		closed:    make(chan struct{}),
+	}
+	s.opId.Store(opId)
+	go s.read()
+	return &s
+}
+
+func (s *session) nextOpId() int64 {
+	return s.opId.Add(-1)
+}
+
+func (s *session) read() {
+	for {
+		cmd, raw, err := bssci_v1.ReadBssciMessage(s.conn)
+		if err != nil {
+			s.err = err
+			close(s.closed)
+			return
+		}
+
+		opId := cmd.GetOpId()
+		if opId >= 0 {
+			if err := s.answer(cmd.GetCommand(), opId, raw); err != nil {
+				s.logger.Error().Err(err).Str("command", string(cmd.GetCommand())).Msg("failed to answer basestation operation")
+			}
+			continue
+		}
+
+		msg, err := messages.UnmarshalMessage(cmd.GetCommand(), raw)
+		select {
+		case s.responses <- response{opId: opId, cmd: cmd.GetCommand(), msg: msg, err: err}:
+		default:
+			s.logger.Warn().Str("command", string(cmd.GetCommand())).Int64("op_id", opId).Msg("dropped unexpected message")
+		}
+	}
+}
+
+// answer an operation initiated by the basestation, these are not part of the test cases
+func (s *session) answer(cmd structs.Command, opId int64, raw msgp.Raw) error {
+	var rsp messages.MessageMsgp
+	switch cmd {
+	case structs.MsgUlData:
+		m := messages.NewUlDataRsp(opId)
+		rsp = &m
+	case structs.MsgVmUlData:
+		m := messages.NewVmUlDataRsp(opId)
+		rsp = &m
+	case structs.MsgDlRxStat:
+		m := messages.NewDlRxStatRsp(opId)
+		rsp = &m
+	case structs.MsgDlDataRes:
+		m := messages.NewDlDataResRsp(opId)
+		rsp = &m
+	case structs.MsgPing:
+		m := messages.NewPingRsp(opId)
+		rsp = &m
+	case structs.MsgError:
+		m := messages.NewBssciErrorAck(opId)
+		rsp = &m
+	case structs.MsgUlDataCmp, structs.MsgVmUlDataCmp, structs.MsgDlRxStatCmp, structs.MsgDlDataResCmp,
+		structs.MsgPingCmp, structs.MsgErrorAck, structs.MsgAttCmp, structs.MsgDetCmp:
+		return nil
+	default:
+		// attach and detach require a network server
+		m := messages.NewBssciError(opId, messages.ErrorCodeENOTSUP, "not supported by the conformance runner")
+		rsp = &m
+	}
+
+	s.answered.Add(1)
+	s.logger.Debug().Str("command", string(cmd)).Int64("op_id", opId).Msg("answered basestation operation")
+	return s.write(rsp)
+}
+
+func (s *session) write(msg messages.MessageMsgp) error {
+	s.writeMux.Lock()
+	defer s.writeMux.Unlock()
+
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	return errors.Wrapf(bssci_v1.WriteBssciMessage(s.conn, msg), "write %s error", msg.GetCommand())
+}
+
+// wait for the next message of an operation initiated by the runner
+func (s *session) receive(opId int64) (messages.MessageMsgp, error) {
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+
+	select {
+	case rsp := <-s.responses:
+		if rsp.opId != opId {
+			return nil, errors.Errorf("unexpected %s with opId %d, expected opId %d", rsp.cmd, rsp.opId, opId)
+		}
+		if rsp.err != nil {
+			return nil, errors.Wrapf(rsp.err, "decode %s error", rsp.cmd)
+		}
+		return rsp.msg, nil
+	case <-s.closed:
+		return nil, errors.Wrap(s.err, "connection closed")
+	case <-timer.C:
+		return nil, errors.Errorf("no response to opId %d within %s", opId, s.timeout)
+	}
+}
+
+// Run an operation initiated by the runner: send the request, expect the response and complete it.
+//
+// Errors of the basestation are acknowledged.
+func (s *session) operation(req messages.MessageMsgp, rspCmd structs.Command, cmp messages.MessageMsgp) (messages.MessageMsgp, error) {
+	if err := s.write(req); err != nil {
+		return nil, err
+	}
+	rsp, err := s.receive(req.GetOpId())
+	if err != nil {
+		return nil, err
+	}
+	if err := expectMessage(rsp, rspCmd); err != nil {
+		if _, ok := rsp.(*messages.BssciError); ok {
+			ack := messages.NewBssciErrorAck(req.GetOpId())
+			s.write(&ack)
+		}
+		return rsp, err
+	}
+	return rsp, s.write(cmp)
+}
+
+func (s *session) close() {
+	s.conn.Close()
+	<-s.closed
+}
+
+// check the command of a message and validate it
+func expectMessage(msg messages.MessageMsgp, cmd structs.Command) error {
+	if e, ok := msg.(*messages.BssciError); ok && cmd != structs.MsgError {
+		return errors.Errorf("expected %s, got error %d: %s", cmd, e.Code, e.Message)
+	}
+	if msg.GetCommand() != cmd {
+		return errors.Errorf("expected %s, got %s", cmd, msg.GetCommand())
+	}
+	if v, ok := msg.(messages.ValidatableMessage); ok {
+		if err := v.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid %s", cmd)
+		}
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package forwarder
 
 import (
+	"sync"
+	"time"
+
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend"
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
@@ -12,6 +15,9 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// events passed to the integration which are not yet published
+var pending sync.WaitGroup
+
 // Setup configures the forwarder.
 func Setup(conf config.Config) error {
 	b := backend.GetBackend()
@@ -29,6 +35,8 @@ func Setup(conf config.Config) error {
 	b.SetSubscribeEventHandler(gatewaySubscribeEventHandler)
 	b.SetBasestationMessageHandler(basestationMessageHandler)
 	b.SetEndnodeMessageHandler(endnodeMessageHandler)
+	b.SetConfirmedEndnodeMessageHandler(confirmedEndnodeMessageHandler)
+	b.SetAdapterEventHandler(adapterEventHandler)
 
 	// setup integration callbacks
 	i.SetServerCommandHandler(serverCommandHandler)
@@ -37,8 +45,29 @@ func Setup(conf config.Config) error {
 	return nil
 }
 
+// Wait until the events passed to the integration are published, at most for the timeout.
+//
+// Returns false on timeout.
+func Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
 func gatewaySubscribeEventHandler(pl events.Subscribe) {
+	pending.Add(1)
 	go func(pl events.Subscribe) {
+		defer pending.Done()
+		defer common.RecoverPanic(&log.Logger, "forwarder", nil)
+
 		if err := integration.GetIntegration().SetBasestationSubscription(pl.Subscribe, pl.BasestationEui); err != nil {
 			log.Error().Err(err).Msg("set basestation subscription error")
 		}
@@ -46,7 +75,12 @@ func gatewaySubscribeEventHandler(pl events.Subscribe) {
 }
 
 func basestationMessageHandler(eui common.EUI64, event events.EventType, pb *bs.BasestationUplink) {
+	pending.Add(1)
 	go func(eui common.EUI64, event events.EventType, pb *bs.BasestationUplink) {
+		defer pending.Done()
+		logger := log.With().Str("bs_eui", eui.String()).Str("event", string(event)).Logger()
+		defer common.RecoverPanic(&logger, "forwarder", nil)
+
 		if err := integration.GetIntegration().PublishBasestationEvent(eui, string(event), pb); err != nil {
 			log.Error().Err(err).Str("bs_eui", eui.String()).Str("event", string(event)).Msg("publish basestation event error")
 		}
@@ -54,7 +88,11 @@ func basestationMessageHandler(eui common.EUI64, event events.EventType, pb *bs.
 }
 
 func endnodeMessageHandler(eui common.EUI64, event events.EventType, pb *bs.EndnodeUplink) {
+	pending.Add(1)
 	go func(eui common.EUI64, event events.EventType, pb *bs.EndnodeUplink) {
+		defer pending.Done()
+		logger := log.With().Str("bs_eui", eui.String()).Str("event", string(event)).Logger()
+		defer common.RecoverPanic(&logger, "forwarder", nil)
 
 		if err := integration.GetIntegration().PublishEndnodeEvent(eui, string(event), pb); err != nil {
 			log.Error().Err(err).Str("bs_eui", eui.String()).Str("event", string(event)).Msg("publish endnode event error")
@@ -62,8 +100,45 @@ func endnodeMessageHandler(eui common.EUI64, event events.EventType, pb *bs.Endn
 	}(eui, event, pb)
 }
 
+// Publishes the message synchronously, the backend acknowledges the uplink on success
+func confirmedEndnodeMessageHandler(eui common.EUI64, event events.EventType, pb *bs.EndnodeUplink) (err error) {
+	logger := log.With().Str("bs_eui", eui.String()).Str("event", string(event)).Logger()
+	defer common.RecoverPanic(&logger, "forwarder", func(e error) { err = e })
+
+	if err := integration.GetIntegration().PublishEndnodeEvent(eui, string(event), pb); err != nil {
+		log.Error().Err(err).Str("bs_eui", eui.String()).Str("event", string(event)).Msg("publish endnode event error")
+		return err
+	}
+	return nil
+}
+
+// Raw frames are published synchronously to keep their order, the backend queues them per connection
+func adapterEventHandler(eui common.EUI64, event events.AdapterEvent) {
+	if event.GetEventType() == events.EventTypeBsRaw {
+		publishAdapterEvent(eui, event)
+		return
+	}
+
+	pending.Add(1)
+	go func(eui common.EUI64, event events.AdapterEvent) {
+		defer pending.Done()
+		publishAdapterEvent(eui, event)
+	}(eui, event)
+}
+
+func publishAdapterEvent(eui common.EUI64, event events.AdapterEvent) {
+	logger := log.With().Str("bs_eui", eui.String()).Str("event", string(event.GetEventType())).Logger()
+	defer common.RecoverPanic(&logger, "forwarder", nil)
+
+	if err := integration.GetIntegration().PublishAdapterEvent(eui, string(event.GetEventType()), event.IntoProto()); err != nil {
+		log.Error().Err(err).Str("bs_eui", eui.String()).Str("event", string(event.GetEventType())).Msg("publish adapter event error")
+	}
+}
+
 func serverCommandHandler(pb *bs.ServerCommand) {
 	go func(pb *bs.ServerCommand) {
+		defer common.RecoverPanic(&log.Logger, "forwarder", nil)
+
 		if err := backend.GetBackend().HandleServerCommand(pb); err != nil {
 			log.Error().Err(err).Msg("failed to handle server command")
 		}
@@ -72,6 +147,8 @@ func serverCommandHandler(pb *bs.ServerCommand) {
 
 func serverResponseHandler(pb *bs.ServerResponse) {
 	go func(pb *bs.ServerResponse) {
+		defer common.RecoverPanic(&log.Logger, "forwarder", nil)
+
 		if err := backend.GetBackend().HandleServerResponse(pb); err != nil {
 			log.Error().Err(err).Msg("failed to handle server response")
 		}
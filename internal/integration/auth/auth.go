@@ -28,7 +28,8 @@ type Authentication interface {
 	ReconnectAfter() time.Duration
 }
 
-func newTLSConfig(cafile string, certFile string, certKeyFile string) (*tls.Config, error) {
+// NewTLSConfig returns the TLS configuration for the given files, nil if none is set.
+func NewTLSConfig(cafile string, certFile string, certKeyFile string) (*tls.Config, error) {
 	if cafile == "" && certFile == "" && certKeyFile == "" {
 		return nil, nil
 	}
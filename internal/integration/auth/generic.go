@@ -26,7 +26,7 @@ type GenericAuthentication struct {
 
 // NewGenericAuthentication creates a GenericAuthentication.
 func NewGenericAuthentication(conf config.Config) (Authentication, error) {
-	tlsConfig, err := newTLSConfig(
+	tlsConfig, err := NewTLSConfig(
 		conf.Integration.MQTTV3.Auth.Generic.CACert,
 		conf.Integration.MQTTV3.Auth.Generic.TLSCert,
 		conf.Integration.MQTTV3.Auth.Generic.TLSKey,
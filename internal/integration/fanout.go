@@ -0,0 +1,300 @@
+package integration
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+)
+
+// time to wait for the publishes of optional integrations on stop
+const fanOutStopTimeout = 5 * time.Second
+
+// An integration of the fan-out with the events it publishes
+type member struct {
+	name        string
+	integration Integration
+	// event types published by the integration, all if nil
+	events map[string]struct{}
+	// whether a publish waits for the integration and fails with it
+	required bool
+
+	// publishes of an optional integration, handled by its worker
+	queue chan task
+	// closed once the worker returned
+	done chan struct{}
+}
+
+// A queued publish of an optional integration
+type task struct {
+	operation string
+	fn        func(Integration) error
+}
+
+func (m *member) publishes(event string) bool {
+	if m.events == nil {
+		return true
+	}
+	_, ok := m.events[event]
+	return ok
+}
+
+// Publish the queued events of an optional integration until the queue is closed
+func (m *member) work() {
+	defer close(m.done)
+	for t := range m.queue {
+		if err := run(m, t.fn); err != nil {
+			fanOutErrorCounter(m.name, t.operation).Inc()
+			log.Error().Err(err).Str("integration", m.name).Str("operation", t.operation).Msg("optional integration error")
+		}
+	}
+}
+
+// Publishes to multiple integrations at once.
+//
+// Each integration is called concurrently, an error or panic of one integration does not
+// prevent the call of the others. A publish returns once the required integrations
+// returned and fails if one of them failed. The publishes of the other integrations are
+// queued per integration, they are dropped once the queue is full and their errors are
+// only logged. Subscriptions and stop wait for all integrations and only fail with the
+// required ones. Start fails if a required integration fails to start, the integrations
+// which started are stopped again.
+//
+// Members are named by their integration type, which is configured at most once.
+type fanOut struct {
+	members []*member
+
+	// guards the queues, which are closed on stop
+	mux     sync.RWMutex
+	stopped bool
+}
+
+// Create a fan-out, filters maps integration names to the event types they publish,
+// required lists the integrations a publish waits for, all if empty. The publishes of
+// the other integrations are queued up to queueSize.
+func newFanOut(integrations map[string]Integration, order []string, filters map[string][]string, required []string, queueSize int) (*fanOut, error) {
+	for name := range filters {
+		if _, ok := integrations[name]; !ok {
+			return nil, errors.Errorf("event filter for unconfigured integration: %s", name)
+		}
+	}
+	for _, name := range required {
+		if _, ok := integrations[name]; !ok {
+			return nil, errors.Errorf("required integration not configured: %s", name)
+		}
+	}
+	if len(required) != 0 && len(required) < len(order) && queueSize < 1 {
+		return nil, errors.New("optional_queue_size must be at least 1")
+	}
+
+	var f fanOut
+	for _, name := range order {
+		m := member{
+			name:        name,
+			integration: integrations[name],
+			required:    len(required) == 0 || slices.Contains(required, name),
+		}
+		if events, ok := filters[name]; ok {
+			m.events = make(map[string]struct{})
+			for _, event := range events {
+				m.events[event] = struct{}{}
+			}
+		}
+		if !m.required {
+			m.queue = make(chan task, queueSize)
+			m.done = make(chan struct{})
+			go m.work()
+		}
+		f.members = append(f.members, &m)
+	}
+	return &f, nil
+}
+
+// Call fn for the given members concurrently, returns the error of each member
+func (f *fanOut) call(members []*member, fn func(Integration) error) []error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(members))
+	for i, m := range members {
+		wg.Add(1)
+		go func(i int, m *member) {
+			defer wg.Done()
+			errs[i] = run(m, fn)
+		}(i, m)
+	}
+	wg.Wait()
+	return errs
+}
+
+// Count and log the errors of the optional members, returns the errors of the required ones
+func (f *fanOut) result(operation string, members []*member, errs []error) error {
+	var msgs []string
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		m := members[i]
+		fanOutErrorCounter(m.name, operation).Inc()
+		if !m.required {
+			log.Error().Err(err).Str("integration", m.name).Str("operation", operation).Msg("optional integration error")
+			continue
+		}
+		msgs = append(msgs, m.name+": "+err.Error())
+	}
+	if len(msgs) != 0 {
+		return errors.New(strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+// Call fn for each integration and wait for all of them
+func (f *fanOut) each(operation string, fn func(Integration) error) error {
+	return f.result(operation, f.members, f.call(f.members, fn))
+}
+
+// Call fn for each integration publishing the event, "" selects all integrations. Waits
+// for the required integrations, the publishes of the other ones are queued.
+func (f *fanOut) publish(operation string, event string, fn func(Integration) error) error {
+	var required []*member
+	for _, m := range f.members {
+		if event != "" && !m.publishes(event) {
+			continue
+		}
+		if m.required {
+			required = append(required, m)
+		} else {
+			f.enqueue(m, task{operation: operation, fn: fn})
+		}
+	}
+	return f.result(operation, required, f.call(required, fn))
+}
+
+// Queue a publish of an optional integration, it is dropped if the queue is full
+func (f *fanOut) enqueue(m *member, t task) {
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+
+	if f.stopped {
+		return
+	}
+	select {
+	case m.queue <- t:
+	default:
+		fanOutDroppedCounter(m.name).Inc()
+		log.Warn().Str("integration", m.name).Str("operation", t.operation).Msg("optional integration queue full, dropping publish")
+	}
+}
+
+// Call fn for the integration of a member, a panic is returned as error
+func run(m *member, fn func(Integration) error) (err error) {
+	defer common.RecoverPanic(&log.Logger, "integration", func(e error) {
+		err = e
+	})
+	return fn(m.integration)
+}
+
+func (f *fanOut) SetBasestationSubscription(subscribe bool, bsEui common.EUI64) error {
+	return f.each("subscription", func(i Integration) error {
+		return i.SetBasestationSubscription(subscribe, bsEui)
+	})
+}
+
+func (f *fanOut) PublishState(ctx context.Context, bsEui common.EUI64, pb *bs.BasestationState) error {
+	return f.publish("state", "", func(i Integration) error {
+		return i.PublishState(ctx, bsEui, pb)
+	})
+}
+
+func (f *fanOut) PublishEndnodeEvent(bsEui common.EUI64, event string, pb *bs.EndnodeUplink) error {
+	return f.publish("event", event, func(i Integration) error {
+		return i.PublishEndnodeEvent(bsEui, event, pb)
+	})
+}
+
+func (f *fanOut) PublishBasestationEvent(bsEui common.EUI64, event string, pb *bs.BasestationUplink) error {
+	return f.publish("event", event, func(i Integration) error {
+		return i.PublishBasestationEvent(bsEui, event, pb)
+	})
+}
+
+func (f *fanOut) PublishAdapterEvent(bsEui common.EUI64, event string, pb *structpb.Struct) error {
+	return f.publish("event", event, func(i Integration) error {
+		return i.PublishAdapterEvent(bsEui, event, pb)
+	})
+}
+
+// Commands are accepted from all integrations
+func (f *fanOut) SetServerCommandHandler(fn func(*bs.ServerCommand)) {
+	for _, m := range f.members {
+		m.integration.SetServerCommandHandler(fn)
+	}
+}
+
+// Responses are accepted from all integrations
+func (f *fanOut) SetServerResponseHandler(fn func(*bs.ServerResponse)) {
+	for _, m := range f.members {
+		m.integration.SetServerResponseHandler(fn)
+	}
+}
+
+// Start all integrations, if a required integration fails the started ones are stopped
+func (f *fanOut) Start() error {
+	errs := f.call(f.members, func(i Integration) error {
+		return i.Start()
+	})
+	err := f.result("start", f.members, errs)
+	if err == nil {
+		return nil
+	}
+
+	var started []*member
+	for i, m := range f.members {
+		if errs[i] == nil {
+			started = append(started, m)
+		}
+	}
+	if stopErr := f.result("stop", started, f.call(started, func(i Integration) error {
+		return i.Stop()
+	})); stopErr != nil {
+		log.Error().Err(stopErr).Msg("stop integrations after failed start error")
+	}
+	return err
+}
+
+// Stop the integrations once the queued publishes of the optional integrations completed
+func (f *fanOut) Stop() error {
+	f.mux.Lock()
+	if !f.stopped {
+		f.stopped = true
+		for _, m := range f.members {
+			if m.queue != nil {
+				close(m.queue)
+			}
+		}
+	}
+	f.mux.Unlock()
+
+	timeout := time.After(fanOutStopTimeout)
+	for _, m := range f.members {
+		if m.done == nil {
+			continue
+		}
+		select {
+		case <-m.done:
+		case <-timeout:
+			log.Warn().Str("integration", m.name).Msg("timeout waiting for publishes of optional integration")
+		}
+	}
+
+	return f.each("stop", func(i Integration) error {
+		return i.Stop()
+	})
+}
@@ -0,0 +1,229 @@
+package integration
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+)
+
+// records the published events
+type testIntegration struct {
+	mux    sync.Mutex
+	events []string
+	states int
+	err    error
+	panic  bool
+	// publishes block until closed, if set
+	block chan struct{}
+	// number of Stop calls
+	stopped int
+
+	commandHandler func(*bs.ServerCommand)
+}
+
+func (i *testIntegration) record(event string) error {
+	if i.panic {
+		panic("test panic")
+	}
+	if i.block != nil {
+		<-i.block
+	}
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.events = append(i.events, event)
+	return i.err
+}
+
+func (i *testIntegration) SetBasestationSubscription(subscribe bool, bsEui common.EUI64) error {
+	return i.err
+}
+
+func (i *testIntegration) PublishState(ctx context.Context, bsEui common.EUI64, pb *bs.BasestationState) error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.states++
+	return i.err
+}
+
+func (i *testIntegration) PublishEndnodeEvent(bsEui common.EUI64, event string, pb *bs.EndnodeUplink) error {
+	return i.record(event)
+}
+
+func (i *testIntegration) PublishBasestationEvent(bsEui common.EUI64, event string, pb *bs.BasestationUplink) error {
+	return i.record(event)
+}
+
+func (i *testIntegration) PublishAdapterEvent(bsEui common.EUI64, event string, pb *structpb.Struct) error {
+	return i.record(event)
+}
+
+func (i *testIntegration) SetServerCommandHandler(f func(*bs.ServerCommand)) {
+	i.commandHandler = f
+}
+
+func (i *testIntegration) SetServerResponseHandler(f func(*bs.ServerResponse)) {}
+
+func (i *testIntegration) Start() error { return i.err }
+
+func (i *testIntegration) Stop() error {
+	i.mux.Lock()
+	defer i.mux.Unlock()
+	i.stopped++
+	return i.err
+}
+
+func TestFanOut_filters(t *testing.T) {
+	a := &testIntegration{}
+	b := &testIntegration{}
+	f, err := newFanOut(map[string]Integration{"a": a, "b": b}, []string{"a", "b"}, map[string][]string{"b": {"ul"}}, nil, 0)
+	require.NoError(t, err)
+
+	var bsEui common.EUI64
+	assert.NoError(t, f.PublishEndnodeEvent(bsEui, "ul", &bs.EndnodeUplink{}))
+	assert.NoError(t, f.PublishBasestationEvent(bsEui, "status", &bs.BasestationUplink{}))
+	assert.NoError(t, f.PublishAdapterEvent(bsEui, "flapping", &structpb.Struct{}))
+	assert.NoError(t, f.PublishState(context.Background(), bsEui, &bs.BasestationState{}))
+
+	assert.Equal(t, []string{"ul", "status", "flapping"}, a.events)
+	assert.Equal(t, []string{"ul"}, b.events)
+
+	// states are published to all integrations
+	assert.Equal(t, 1, a.states)
+	assert.Equal(t, 1, b.states)
+}
+
+func TestFanOut_independentFailures(t *testing.T) {
+	a := &testIntegration{err: errors.New("broker down")}
+	b := &testIntegration{}
+	c := &testIntegration{panic: true}
+	f, err := newFanOut(map[string]Integration{"a": a, "b": b, "c": c}, []string{"a", "b", "c"}, nil, nil, 0)
+	require.NoError(t, err)
+
+	err = f.PublishEndnodeEvent(common.EUI64{}, "ul", &bs.EndnodeUplink{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "a: broker down")
+	assert.Contains(t, err.Error(), "c: panic: test panic")
+	assert.NotContains(t, err.Error(), "b:")
+
+	// the other integrations still published
+	assert.Equal(t, []string{"ul"}, a.events)
+	assert.Equal(t, []string{"ul"}, b.events)
+}
+
+func TestFanOut_required(t *testing.T) {
+	a := &testIntegration{}
+	b := &testIntegration{err: errors.New("broker down"), block: make(chan struct{})}
+	f, err := newFanOut(map[string]Integration{"a": a, "b": b}, []string{"a", "b"}, nil, []string{"a"}, 10)
+	require.NoError(t, err)
+
+	// the publish does not wait for the optional integration and ignores its error
+	assert.NoError(t, f.PublishEndnodeEvent(common.EUI64{}, "ul", &bs.EndnodeUplink{}))
+	assert.Equal(t, []string{"ul"}, a.events)
+
+	// errors of the optional integration are only logged
+	assert.NoError(t, f.SetBasestationSubscription(true, common.EUI64{}))
+
+	close(b.block)
+	assert.NoError(t, f.Stop())
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	assert.Equal(t, []string{"ul"}, b.events)
+
+	_, err = newFanOut(map[string]Integration{"a": a}, []string{"a"}, nil, []string{"b"}, 10)
+	assert.Error(t, err)
+	_, err = newFanOut(map[string]Integration{"a": a, "b": b}, []string{"a", "b"}, nil, []string{"a"}, 0)
+	assert.Error(t, err)
+}
+
+func TestFanOut_queueFull(t *testing.T) {
+	a := &testIntegration{}
+	b := &testIntegration{block: make(chan struct{})}
+	f, err := newFanOut(map[string]Integration{"a": a, "b": b}, []string{"a", "b"}, nil, []string{"a"}, 1)
+	require.NoError(t, err)
+
+	// the first publish blocks the worker, the second is queued and the third dropped
+	require.NoError(t, f.PublishEndnodeEvent(common.EUI64{}, "ul", &bs.EndnodeUplink{}))
+	require.Eventually(t, func() bool { return len(f.members[1].queue) == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, f.PublishEndnodeEvent(common.EUI64{}, "ul", &bs.EndnodeUplink{}))
+	require.NoError(t, f.PublishEndnodeEvent(common.EUI64{}, "ul", &bs.EndnodeUplink{}))
+	assert.Len(t, a.events, 3)
+
+	close(b.block)
+	assert.NoError(t, f.Stop())
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	assert.Len(t, b.events, 2)
+
+	// publishes after stop are not queued
+	assert.NoError(t, f.PublishEndnodeEvent(common.EUI64{}, "ul", &bs.EndnodeUplink{}))
+}
+
+func TestFanOut_start(t *testing.T) {
+	a := &testIntegration{}
+	b := &testIntegration{err: errors.New("broker down")}
+	c := &testIntegration{err: errors.New("broker down")}
+	f, err := newFanOut(map[string]Integration{"a": a, "b": b, "c": c}, []string{"a", "b", "c"}, nil, []string{"a", "b"}, 10)
+	require.NoError(t, err)
+
+	// the failed start of a required integration stops the started ones
+	err = f.Start()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "b: broker down")
+	assert.NotContains(t, err.Error(), "c:")
+	assert.Equal(t, 1, a.stopped)
+	assert.Equal(t, 0, b.stopped)
+
+	// an optional integration failing does not fail the start
+	b.err = nil
+	a.stopped = 0
+	assert.NoError(t, f.Start())
+	assert.Equal(t, 0, a.stopped)
+
+	// only required integrations fail subscriptions
+	assert.NoError(t, f.SetBasestationSubscription(true, common.EUI64{}))
+	b.err = errors.New("broker down")
+	assert.Error(t, f.SetBasestationSubscription(true, common.EUI64{}))
+}
+
+func TestFanOut_handlers(t *testing.T) {
+	a := &testIntegration{}
+	b := &testIntegration{}
+	f, err := newFanOut(map[string]Integration{"a": a, "b": b}, []string{"a", "b"}, nil, nil, 0)
+	require.NoError(t, err)
+
+	var commands int
+	f.SetServerCommandHandler(func(*bs.ServerCommand) { commands++ })
+	a.commandHandler(&bs.ServerCommand{})
+	b.commandHandler(&bs.ServerCommand{})
+	assert.Equal(t, 2, commands)
+}
+
+func TestFanOut_unknownFilter(t *testing.T) {
+	_, err := newFanOut(map[string]Integration{"a": &testIntegration{}}, []string{"a"}, map[string][]string{"b": {"ul"}}, nil, 0)
+	assert.Error(t, err)
+}
+
+func TestSetup_invalidTypes(t *testing.T) {
+	var conf config.Config
+	conf.Integration.Types = []string{"unknown"}
+	assert.Error(t, Setup(conf))
+
+	conf.Integration.Marshaler = "json"
+	conf.Integration.MQTTV5.Auth.Type = "generic"
+	conf.Integration.Types = []string{"mqtt_v5"}
+	assert.NoError(t, Setup(conf))
+
+	conf.Integration.Types = []string{"mqtt_v5", "mqtt_v5"}
+	assert.ErrorContains(t, Setup(conf), "duplicate")
+}
@@ -0,0 +1,382 @@
+// Package file implements a file integration.
+//
+// Events and states are written as JSON encoded bssci.AdapterMessage lines to stdout or
+// a rotating file. Server commands are read as JSON encoded bs.ServerCommand lines from a
+// named pipe or a file that is followed like tail -f.
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/api/go/bssci"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/mqtt"
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+)
+
+const (
+	eventSourceEndpoint    = "ep"
+	eventSourceBasestation = "bs"
+
+	// output writing to stdout instead of a file
+	outputStdout = "stdout"
+)
+
+// Integration implements a file integration.
+type Integration struct {
+	marshal func(msg proto.Message) ([]byte, error)
+
+	output       string
+	maxSize      int64
+	maxBackups   int
+	commandInput string
+
+	// interval for checking a followed input file for new lines
+	pollInterval time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	serverCommandHandler  func(*bs.ServerCommand)
+	serverResponseHandler func(*bs.ServerResponse)
+
+	writerMux sync.Mutex
+	writer    io.Writer
+
+	input  *os.File
+	reader sync.WaitGroup
+
+	basestationsMux sync.RWMutex
+	basestations    map[common.EUI64]struct{}
+}
+
+// NewIntegration creates a new Integration.
+func NewIntegration(conf config.Config) (*Integration, error) {
+	c := conf.Integration.File
+
+	marshal, err := mqtt.Marshaler("json")
+	if err != nil {
+		return nil, err
+	}
+
+	integ := Integration{
+		marshal:      marshal,
+		output:       c.Output,
+		maxSize:      int64(c.MaxSizeMB) << 20,
+		maxBackups:   c.MaxBackups,
+		commandInput: c.CommandInput,
+		pollInterval: 500 * time.Millisecond,
+		basestations: make(map[common.EUI64]struct{}),
+	}
+	integ.ctx, integ.cancel = context.WithCancel(context.Background())
+
+	if integ.output == "" {
+		integ.output = outputStdout
+	}
+
+	return &integ, nil
+}
+
+// Start the integration.
+func (integ *Integration) Start() error {
+	if integ.output == outputStdout {
+		integ.writer = os.Stdout
+	} else {
+		f, err := openRotatingFile(integ.output, integ.maxSize, integ.maxBackups)
+		if err != nil {
+			return errors.Wrap(err, "open output error")
+		}
+		integ.writer = f
+	}
+	log.Info().Str("output", integ.output).Msg("writing events to file")
+
+	if integ.commandInput == "" {
+		return nil
+	}
+
+	info, err := os.Stat(integ.commandInput)
+	if err != nil {
+		return errors.Wrap(err, "stat command input error")
+	}
+
+	// a named pipe opened for writing as well does not block on open and does not
+	// reach EOF when writers close
+	follow := info.Mode()&os.ModeNamedPipe == 0
+	flag := os.O_RDONLY
+	if !follow {
+		flag = os.O_RDWR
+	}
+	integ.input, err = os.OpenFile(integ.commandInput, flag, 0)
+	if err != nil {
+		return errors.Wrap(err, "open command input error")
+	}
+
+	// commands already in the file are not replayed
+	if follow {
+		if _, err := integ.input.Seek(0, io.SeekEnd); err != nil {
+			integ.input.Close()
+			return errors.Wrap(err, "seek command input error")
+		}
+	}
+
+	log.Info().Str("input", integ.commandInput).Bool("follow", follow).Msg("reading commands from file")
+	integ.reader.Add(1)
+	go func() {
+		defer integ.reader.Done()
+		integ.readCommands(integ.input, follow)
+	}()
+	return nil
+}
+
+// Stop the integration.
+func (integ *Integration) Stop() error {
+	integ.basestationsMux.RLock()
+	basestations := make([]common.EUI64, 0, len(integ.basestations))
+	for bsEui := range integ.basestations {
+		basestations = append(basestations, bsEui)
+	}
+	integ.basestationsMux.RUnlock()
+
+	// setup ctx logger
+	logger := log.With().Logger()
+	ctx := context.Background()
+	ctx = logger.WithContext(ctx)
+
+	// Set gateway state to offline for all gateways.
+	for _, bsEui := range basestations {
+		pl := bs.BasestationState{
+			BsEui: bsEui.String(),
+			State: bs.BasestationState_OFFLINE,
+		}
+		if err := integ.PublishState(ctx, bsEui, &pl); err != nil {
+			logger.Error().Err(err).Str("bs_eui", bsEui.String()).Msg("publish state error")
+		}
+	}
+
+	integ.cancel()
+	if integ.input != nil {
+		// interrupts a blocked read of a named pipe
+		integ.input.Close()
+		integ.reader.Wait()
+	}
+
+	integ.writerMux.Lock()
+	defer integ.writerMux.Unlock()
+	if c, ok := integ.writer.(io.Closer); ok && integ.writer != os.Stdout {
+		if err := c.Close(); err != nil {
+			return errors.Wrap(err, "close output error")
+		}
+	}
+	integ.writer = nil
+	return nil
+}
+
+// Updates the subscription for the given EUI.
+//
+// Commands are only accepted for subscribed basestations.
+func (integ *Integration) SetBasestationSubscription(subscribe bool, bsEui common.EUI64) error {
+	logger := log.With().Str("bs_eui", bsEui.String()).Bool("subscribe", subscribe).Logger()
+	logger.Debug().Msg("updating basestation subscription")
+
+	integ.basestationsMux.Lock()
+	defer integ.basestationsMux.Unlock()
+
+	if subscribe {
+		integ.basestations[bsEui] = struct{}{}
+	} else {
+		delete(integ.basestations, bsEui)
+	}
+	return nil
+}
+
+// Set handler for server command messages
+func (integ *Integration) SetServerCommandHandler(f func(*bs.ServerCommand)) {
+	integ.serverCommandHandler = f
+}
+
+// Set handler for server command messages
+//
+// The file integration does not read responses.
+func (integ *Integration) SetServerResponseHandler(f func(*bs.ServerResponse)) {
+	integ.serverResponseHandler = f
+}
+
+// Publish basestation messages.
+func (integ *Integration) PublishState(ctx context.Context, bsEui common.EUI64, pb *bs.BasestationState) error {
+	return integ.write(ctx, "state", &bssci.AdapterMessage{
+		BsEui:   bsEui.String(),
+		Message: &bssci.AdapterMessage_State{State: pb},
+	})
+}
+
+// Publish endnode messages.
+func (integ *Integration) PublishEndnodeEvent(bsEui common.EUI64, event string, pb *bs.EndnodeUplink) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceEndpoint).Logger()
+	ctx := logger.WithContext(context.Background())
+
+	return integ.write(ctx, event, &bssci.AdapterMessage{
+		BsEui:       bsEui.String(),
+		EventSource: eventSourceEndpoint,
+		EventType:   event,
+		Message:     &bssci.AdapterMessage_EndnodeUplink{EndnodeUplink: pb},
+	})
+}
+
+// Publish basestation messages.
+func (integ *Integration) PublishBasestationEvent(bsEui common.EUI64, event string, pb *bs.BasestationUplink) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceBasestation).Logger()
+	ctx := logger.WithContext(context.Background())
+
+	return integ.write(ctx, event, &bssci.AdapterMessage{
+		BsEui:       bsEui.String(),
+		EventSource: eventSourceBasestation,
+		EventType:   event,
+		Message:     &bssci.AdapterMessage_BasestationUplink{BasestationUplink: pb},
+	})
+}
+
+// Publish events generated by the adapter.
+func (integ *Integration) PublishAdapterEvent(bsEui common.EUI64, event string, pb *structpb.Struct) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceBasestation).Logger()
+	ctx := logger.WithContext(context.Background())
+
+	return integ.write(ctx, event, &bssci.AdapterMessage{
+		BsEui:       bsEui.String(),
+		EventSource: eventSourceBasestation,
+		EventType:   event,
+		Message:     &bssci.AdapterMessage_AdapterEvent{AdapterEvent: pb},
+	})
+}
+
+// Write a message as a single line
+func (integ *Integration) write(ctx context.Context, message string, msg *bssci.AdapterMessage) error {
+	b, err := integ.marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "marshal message error")
+	}
+	b = append(b, '\n')
+
+	integ.writerMux.Lock()
+	defer integ.writerMux.Unlock()
+
+	if integ.writer == nil {
+		return errors.New("integration not started")
+	}
+	if _, err := integ.writer.Write(b); err != nil {
+		return errors.Wrap(err, "write error")
+	}
+
+	fileLineCounter(message).Inc()
+	zerolog.Ctx(ctx).Debug().Msg("wrote message")
+	return nil
+}
+
+// Read command lines until the input is closed.
+//
+// A followed file is checked for new lines at the poll interval and read from the
+// start again when truncated.
+func (integ *Integration) readCommands(f *os.File, follow bool) {
+	reader := bufio.NewReader(f)
+	var line []byte
+
+	for {
+		b, err := reader.ReadBytes('\n')
+		line = append(line, b...)
+		if err == nil {
+			integ.handleCommand(line)
+			line = nil
+			continue
+		}
+
+		if err != io.EOF || !follow {
+			if integ.ctx.Err() == nil {
+				log.Error().Err(err).Str("input", integ.commandInput).Msg("read command input error")
+			}
+			return
+		}
+
+		select {
+		case <-integ.ctx.Done():
+			return
+		case <-time.After(integ.pollInterval):
+		}
+
+		pos, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			log.Error().Err(err).Str("input", integ.commandInput).Msg("seek command input error")
+			return
+		}
+		info, err := f.Stat()
+		if err != nil {
+			log.Error().Err(err).Str("input", integ.commandInput).Msg("stat command input error")
+			return
+		}
+		if info.Size() < pos {
+			log.Info().Str("input", integ.commandInput).Msg("command input truncated, reading from start")
+			if _, err := f.Seek(0, io.SeekStart); err != nil {
+				log.Error().Err(err).Str("input", integ.commandInput).Msg("seek command input error")
+				return
+			}
+			reader.Reset(f)
+			line = nil
+		}
+	}
+}
+
+// Pass a command line to the handler
+func (integ *Integration) handleCommand(line []byte) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+
+	var pb bs.ServerCommand
+	if err := protojson.Unmarshal(line, &pb); err != nil {
+		log.Error().Err(err).Msg("unmarshal command error")
+		fileCommandCounter("invalid").Inc()
+		return
+	}
+
+	bsEui, err := common.Eui64FromHexString(pb.GetBsEui())
+	if err != nil {
+		log.Error().Err(err).Msg("invalid bs eui")
+		fileCommandCounter("invalid").Inc()
+		return
+	}
+	logger := log.With().Str("bs_eui", bsEui.String()).Logger()
+
+	integ.basestationsMux.RLock()
+	_, ok := integ.basestations[bsEui]
+	integ.basestationsMux.RUnlock()
+	if !ok {
+		logger.Warn().Msg("basestation not subscribed, ignoring command")
+		fileCommandCounter("unsubscribed").Inc()
+		return
+	}
+	if integ.serverCommandHandler == nil {
+		logger.Warn().Msg("no handler set, ignoring command")
+		fileCommandCounter("unhandled").Inc()
+		return
+	}
+
+	fileCommandCounter("accepted").Inc()
+	integ.serverCommandHandler(&pb)
+}
@@ -0,0 +1,189 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/api/go/bssci"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+)
+
+type IntegrationTestSuite struct {
+	suite.Suite
+
+	conf     config.Config
+	integ    *Integration
+	dir      string
+	bsEui    common.EUI64
+	commands chan *bs.ServerCommand
+}
+
+func (ts *IntegrationTestSuite) SetupTest() {
+	ts.bsEui = common.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	ts.commands = make(chan *bs.ServerCommand, 10)
+	ts.dir = ts.T().TempDir()
+
+	ts.conf = config.Config{}
+	ts.conf.Integration.File.Output = filepath.Join(ts.dir, "events.jsonl")
+	ts.conf.Integration.File.MaxSizeMB = 1
+	ts.conf.Integration.File.MaxBackups = 1
+}
+
+func (ts *IntegrationTestSuite) TearDownTest() {
+	if ts.integ != nil {
+		ts.integ.Stop()
+		ts.integ = nil
+	}
+}
+
+func (ts *IntegrationTestSuite) start() {
+	var err error
+	ts.integ, err = NewIntegration(ts.conf)
+	ts.Require().NoError(err)
+	ts.integ.pollInterval = 10 * time.Millisecond
+	ts.integ.SetServerCommandHandler(func(pb *bs.ServerCommand) { ts.commands <- pb })
+	ts.Require().NoError(ts.integ.Start())
+}
+
+// Messages written to the output file
+func (ts *IntegrationTestSuite) lines() []*bssci.AdapterMessage {
+	f, err := os.Open(ts.conf.Integration.File.Output)
+	ts.Require().NoError(err)
+	defer f.Close()
+
+	var msgs []*bssci.AdapterMessage
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var msg bssci.AdapterMessage
+		ts.Require().NoError(protojson.Unmarshal(scanner.Bytes(), &msg))
+		msgs = append(msgs, &msg)
+	}
+	ts.Require().NoError(scanner.Err())
+	return msgs
+}
+
+func (ts *IntegrationTestSuite) commandLine() string {
+	b, err := protojson.Marshal(&bs.ServerCommand{
+		BsEui:   ts.bsEui.String(),
+		Command: &bs.ServerCommand_ReqStatus{ReqStatus: &bs.RequestStatus{}},
+	})
+	ts.Require().NoError(err)
+	return string(b) + "\n"
+}
+
+func (ts *IntegrationTestSuite) receiveCommand() {
+	select {
+	case pb := <-ts.commands:
+		ts.Assert().Equal(ts.bsEui.String(), pb.BsEui)
+		ts.Assert().NotNil(pb.GetReqStatus())
+	case <-time.After(time.Second):
+		ts.Fail("command not received")
+	}
+}
+
+func (ts *IntegrationTestSuite) TestWrite() {
+	assert := ts.Assert()
+	ts.start()
+
+	assert.NoError(ts.integ.PublishEndnodeEvent(ts.bsEui, "ul", &bs.EndnodeUplink{BsEui: ts.bsEui.String()}))
+	assert.NoError(ts.integ.PublishBasestationEvent(ts.bsEui, "status", &bs.BasestationUplink{BsEui: ts.bsEui.String()}))
+	assert.NoError(ts.integ.PublishState(context.Background(), ts.bsEui, &bs.BasestationState{BsEui: ts.bsEui.String(), State: bs.BasestationState_ONLINE}))
+
+	msgs := ts.lines()
+	ts.Require().Len(msgs, 3)
+	assert.Equal("ep", msgs[0].EventSource)
+	assert.Equal("ul", msgs[0].EventType)
+	assert.NotNil(msgs[0].GetEndnodeUplink())
+	assert.Equal("status", msgs[1].EventType)
+	assert.NotNil(msgs[1].GetBasestationUplink())
+	assert.Equal(bs.BasestationState_ONLINE, msgs[2].GetState().GetState())
+}
+
+func (ts *IntegrationTestSuite) TestCommandFile() {
+	input := filepath.Join(ts.dir, "commands.jsonl")
+	ts.Require().NoError(os.WriteFile(input, []byte(ts.commandLine()), 0o644))
+	ts.conf.Integration.File.CommandInput = input
+	ts.start()
+	ts.Require().NoError(ts.integ.SetBasestationSubscription(true, ts.bsEui))
+
+	f, err := os.OpenFile(input, os.O_WRONLY|os.O_APPEND, 0)
+	ts.Require().NoError(err)
+	defer f.Close()
+
+	// lines already in the file are not replayed, partial lines wait for completion
+	line := ts.commandLine()
+	_, err = f.WriteString(line[:10])
+	ts.Require().NoError(err)
+	time.Sleep(50 * time.Millisecond)
+	_, err = f.WriteString(line[10:])
+	ts.Require().NoError(err)
+	ts.receiveCommand()
+	ts.Assert().Empty(ts.commands)
+
+	// invalid lines and commands of unsubscribed basestations are skipped
+	_, err = f.WriteString("{\n" + strings.Replace(line, ts.bsEui.String(), "0807060504030201", 1) + line)
+	ts.Require().NoError(err)
+	ts.receiveCommand()
+	ts.Assert().Empty(ts.commands)
+}
+
+func (ts *IntegrationTestSuite) TestCommandFileTruncated() {
+	input := filepath.Join(ts.dir, "commands.jsonl")
+	ts.Require().NoError(os.WriteFile(input, []byte(strings.Repeat(" ", 1000)+"\n"), 0o644))
+	ts.conf.Integration.File.CommandInput = input
+	ts.start()
+	ts.Require().NoError(ts.integ.SetBasestationSubscription(true, ts.bsEui))
+
+	ts.Require().NoError(os.WriteFile(input, []byte(ts.commandLine()), 0o644))
+	ts.receiveCommand()
+}
+
+func (ts *IntegrationTestSuite) TestCommandPipe() {
+	input := filepath.Join(ts.dir, "commands")
+	ts.Require().NoError(syscall.Mkfifo(input, 0o600))
+	ts.conf.Integration.File.CommandInput = input
+	ts.start()
+	ts.Require().NoError(ts.integ.SetBasestationSubscription(true, ts.bsEui))
+
+	// the pipe is read again after a writer closed it
+	for range 2 {
+		f, err := os.OpenFile(input, os.O_WRONLY, 0)
+		ts.Require().NoError(err)
+		_, err = f.WriteString(ts.commandLine())
+		ts.Require().NoError(err)
+		ts.Require().NoError(f.Close())
+		ts.receiveCommand()
+	}
+}
+
+func (ts *IntegrationTestSuite) TestStop() {
+	input := filepath.Join(ts.dir, "commands")
+	ts.Require().NoError(syscall.Mkfifo(input, 0o600))
+	ts.conf.Integration.File.CommandInput = input
+	ts.start()
+
+	ts.Require().NoError(ts.integ.SetBasestationSubscription(true, ts.bsEui))
+	ts.Require().NoError(ts.integ.Stop())
+	ts.Assert().Error(ts.integ.PublishEndnodeEvent(ts.bsEui, "ul", &bs.EndnodeUplink{}))
+	ts.integ = nil
+
+	msgs := ts.lines()
+	ts.Require().Len(msgs, 1)
+	ts.Assert().Equal(bs.BasestationState_OFFLINE, msgs[0].GetState().GetState())
+}
+
+func TestIntegration(t *testing.T) {
+	suite.Run(t, new(IntegrationTestSuite))
+}
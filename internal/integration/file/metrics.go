@@ -0,0 +1,35 @@
+package file
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	lc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_file_line_count",
+		Help: "The number of lines written by the file integration (per message).",
+	}, []string{"message"})
+
+	rc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_file_rotation_count",
+		Help: "The number of times the output file was rotated.",
+	})
+
+	ic = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_file_command_count",
+		Help: "The number of command lines read by the file integration (per result).",
+	}, []string{"result"})
+)
+
+func fileLineCounter(message string) prometheus.Counter {
+	return lc.With(prometheus.Labels{"message": message})
+}
+
+func fileRotationCounter() prometheus.Counter {
+	return rc
+}
+
+func fileCommandCounter(result string) prometheus.Counter {
+	return ic.With(prometheus.Labels{"result": result})
+}
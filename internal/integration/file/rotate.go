@@ -0,0 +1,96 @@
+package file
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// A file rotated once it exceeds its maximum size.
+//
+// Rotated files are renamed to <path>.1 to <path>.<maxBackups>, the oldest is removed.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	f    *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	r := rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "open file error")
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrap(err, "stat file error")
+	}
+	r.f = f
+	r.size = info.Size()
+	return nil
+}
+
+// Write implements io.Writer, rotates the file before a write exceeding the maximum size.
+//
+// If the rotation fails, the write continues in the current file and the rotation is
+// retried on the next write.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			log.Error().Err(err).Str("path", r.path).Msg("rotate file error, continuing in the current file")
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Move the file to the first backup and open a new one. The current file is only closed
+// once the new one is open, so that it stays writable on error.
+func (r *rotatingFile) rotate() error {
+	if r.maxBackups > 0 {
+		for i := r.maxBackups - 1; i > 0; i-- {
+			if err := os.Rename(r.backup(i), r.backup(i+1)); err != nil && !os.IsNotExist(err) {
+				return errors.Wrap(err, "rename backup error")
+			}
+		}
+		if err := os.Rename(r.path, r.backup(1)); err != nil {
+			return errors.Wrap(err, "rename file error")
+		}
+	} else if err := os.Remove(r.path); err != nil {
+		return errors.Wrap(err, "remove file error")
+	}
+
+	old := r.f
+	if err := r.open(); err != nil {
+		return err
+	}
+	if err := old.Close(); err != nil {
+		log.Warn().Err(err).Str("path", r.path).Msg("close rotated file error")
+	}
+
+	fileRotationCounter().Inc()
+	return nil
+}
+
+func (r *rotatingFile) backup(i int) string {
+	return fmt.Sprintf("%s.%d", r.path, i)
+}
+
+// Close implements io.Closer.
+func (r *rotatingFile) Close() error {
+	return r.f.Close()
+}
@@ -0,0 +1,117 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxBackups int
+		writes     []string
+		files      map[string]string
+	}{
+		{
+			name:       "no rotation",
+			maxBackups: 2,
+			writes:     []string{"aaa\n", "bbb\n"},
+			files:      map[string]string{"out": "aaa\nbbb\n"},
+		},
+		{
+			name:       "rotation",
+			maxBackups: 2,
+			writes:     []string{"aaa\n", "bbb\n", "ccc\n", "ddd\n", "eee\n"},
+			files:      map[string]string{"out": "eee\n", "out.1": "ccc\nddd\n", "out.2": "aaa\nbbb\n"},
+		},
+		{
+			name:       "oldest removed",
+			maxBackups: 1,
+			writes:     []string{"aaa\n", "bbb\n", "ccc\n", "ddd\n", "eee\n"},
+			files:      map[string]string{"out": "eee\n", "out.1": "ccc\nddd\n"},
+		},
+		{
+			name:       "no backups",
+			maxBackups: 0,
+			writes:     []string{"aaa\n", "bbb\n", "ccc\n"},
+			files:      map[string]string{"out": "ccc\n"},
+		},
+		{
+			name:       "larger than maximum",
+			maxBackups: 1,
+			writes:     []string{"aaaaaaaaaaaa\n", "b\n"},
+			files:      map[string]string{"out": "b\n", "out.1": "aaaaaaaaaaaa\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			r, err := openRotatingFile(filepath.Join(dir, "out"), 8, tt.maxBackups)
+			require.NoError(t, err)
+
+			for _, w := range tt.writes {
+				_, err := r.Write([]byte(w))
+				require.NoError(t, err)
+			}
+			require.NoError(t, r.Close())
+
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			files := make(map[string]string)
+			for _, e := range entries {
+				b, err := os.ReadFile(filepath.Join(dir, e.Name()))
+				require.NoError(t, err)
+				files[e.Name()] = string(b)
+			}
+			assert.Equal(t, tt.files, files)
+		})
+	}
+}
+
+func TestRotatingFile_append(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out")
+	require.NoError(t, os.WriteFile(path, []byte("aaaaaa\n"), 0o644))
+
+	// the size of an existing file counts towards the maximum
+	r, err := openRotatingFile(path, 8, 1)
+	require.NoError(t, err)
+	_, err = r.Write([]byte("bb\n"))
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+
+	b, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, "aaaaaa\n", string(b))
+}
+
+func TestRotatingFile_rotateError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out")
+
+	// the backup can not be replaced by the file
+	require.NoError(t, os.MkdirAll(filepath.Join(path+".1", "blocked"), 0o750))
+
+	r, err := openRotatingFile(path, 8, 1)
+	require.NoError(t, err)
+	for _, w := range []string{"aaaaaa\n", "bbb\n"} {
+		_, err = r.Write([]byte(w))
+		require.NoError(t, err)
+	}
+
+	// the rotation is retried once the backup can be written
+	require.NoError(t, os.RemoveAll(path+".1"))
+	_, err = r.Write([]byte("ccc\n"))
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+
+	b, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, "aaaaaa\nbbb\n", string(b))
+	b, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "ccc\n", string(b))
+}
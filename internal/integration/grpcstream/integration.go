@@ -0,0 +1,435 @@
+// Package grpcstream implements a gRPC integration.
+//
+// Subscribers open a bidirectional stream of the bssci.Adapter service. Events of the
+// subscribed basestations are sent as the bs protobuf messages, server commands and responses
+// are received. Like the retained states of the MQTT integrations, the last state of each
+// basestation is sent on subscribe.
+package grpcstream
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/api/go/bssci"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+)
+
+const (
+	eventSourceEndpoint    = "ep"
+	eventSourceBasestation = "bs"
+)
+
+// Integration implements a gRPC integration.
+type Integration struct {
+	bssci.UnimplementedAdapterServer
+
+	server *grpc.Server
+	bind   string
+	// whether subscribers must present a client certificate
+	clientAuth bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	serverCommandHandler  func(*bs.ServerCommand)
+	serverResponseHandler func(*bs.ServerResponse)
+
+	// size of the send queue of a stream
+	sendQueueSize int
+
+	mux          sync.RWMutex
+	subscribers  map[*subscriber]struct{}
+	basestations map[common.EUI64]struct{}
+	states       map[common.EUI64]*bs.BasestationState
+}
+
+// NewIntegration creates a new Integration.
+func NewIntegration(conf config.Config) (*Integration, error) {
+	c := conf.Integration.GRPC
+	if c.SendQueueSize < 1 {
+		return nil, errors.Errorf("invalid send queue size: %d", c.SendQueueSize)
+	}
+
+	integ := Integration{
+		bind:          c.Bind,
+		sendQueueSize: c.SendQueueSize,
+		subscribers:   make(map[*subscriber]struct{}),
+		basestations:  make(map[common.EUI64]struct{}),
+		states:        make(map[common.EUI64]*bs.BasestationState),
+	}
+	integ.ctx, integ.cancel = context.WithCancel(context.Background())
+
+	var opts []grpc.ServerOption
+	if c.TLSCert != "" || c.TLSKey != "" {
+		tlsConfig, err := newTLSConfig(c.CACert, c.TLSCert, c.TLSKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "new tls config error")
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+		integ.clientAuth = c.CACert != ""
+	}
+	integ.server = grpc.NewServer(opts...)
+	bssci.RegisterAdapterServer(integ.server, &integ)
+
+	return &integ, nil
+}
+
+// Server TLS config, client certificates are required if a CA certificate is set
+func newTLSConfig(caCert string, tlsCert string, tlsKey string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(tlsCert, tlsKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "load key-pair error")
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if caCert != "" {
+		b, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, errors.Wrap(err, "load ca cert error")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.New("append ca cert to pool error")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// Start the integration.
+func (integ *Integration) Start() error {
+	ln, err := net.Listen("tcp", integ.bind)
+	if err != nil {
+		return errors.Wrap(err, "listen error")
+	}
+	log.Info().Str("bind", ln.Addr().String()).Msg("starting grpc server")
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok && !addr.IP.IsLoopback() && !integ.clientAuth {
+		log.Warn().Str("bind", ln.Addr().String()).Msg("grpc server accepts commands from unauthenticated subscribers, configure ca_cert to require client certificates")
+	}
+	integ.serve(ln)
+	return nil
+}
+
+func (integ *Integration) serve(ln net.Listener) {
+	go func() {
+		if err := integ.server.Serve(ln); err != nil {
+			log.Error().Err(err).Msg("grpc server error")
+		}
+	}()
+}
+
+// Stop the integration.
+func (integ *Integration) Stop() error {
+	integ.mux.RLock()
+	basestations := make([]common.EUI64, 0, len(integ.basestations))
+	for bsEui := range integ.basestations {
+		basestations = append(basestations, bsEui)
+	}
+	integ.mux.RUnlock()
+
+	// setup ctx logger
+	logger := log.With().Logger()
+	ctx := context.Background()
+	ctx = logger.WithContext(ctx)
+
+	// Set gateway state to offline for all gateways.
+	for _, bsEui := range basestations {
+		pl := bs.BasestationState{
+			BsEui: bsEui.String(),
+			State: bs.BasestationState_OFFLINE,
+		}
+		if err := integ.PublishState(ctx, bsEui, &pl); err != nil {
+			logger.Error().Err(err).Str("bs_eui", bsEui.String()).Msg("publish state error")
+		}
+	}
+
+	// streams send their queued messages and end
+	integ.cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		integ.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		log.Warn().Msg("grpc graceful stop timeout")
+		integ.server.Stop()
+	}
+	return nil
+}
+
+// Updates the subscription for the given EUI.
+//
+// Commands and responses are only accepted for subscribed basestations.
+func (integ *Integration) SetBasestationSubscription(subscribe bool, bsEui common.EUI64) error {
+	logger := log.With().Str("bs_eui", bsEui.String()).Bool("subscribe", subscribe).Logger()
+	logger.Debug().Msg("updating basestation subscription")
+
+	integ.mux.Lock()
+	defer integ.mux.Unlock()
+
+	if subscribe {
+		integ.basestations[bsEui] = struct{}{}
+	} else {
+		delete(integ.basestations, bsEui)
+	}
+	return nil
+}
+
+// Set handler for server command messages
+func (integ *Integration) SetServerCommandHandler(f func(*bs.ServerCommand)) {
+	integ.serverCommandHandler = f
+}
+
+// Set handler for server command messages
+func (integ *Integration) SetServerResponseHandler(f func(*bs.ServerResponse)) {
+	integ.serverResponseHandler = f
+}
+
+// Publish basestation messages.
+func (integ *Integration) PublishState(ctx context.Context, bsEui common.EUI64, pb *bs.BasestationState) error {
+	integ.mux.Lock()
+	integ.states[bsEui] = pb
+	integ.mux.Unlock()
+
+	// the state is kept and sent on subscribe, so it is not lost if the queues are full
+	_ = integ.publish(ctx, bsEui, "state", &bssci.AdapterMessage{
+		BsEui:   bsEui.String(),
+		Message: &bssci.AdapterMessage_State{State: pb},
+	})
+	return nil
+}
+
+// Publish endnode messages.
+func (integ *Integration) PublishEndnodeEvent(bsEui common.EUI64, event string, pb *bs.EndnodeUplink) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceEndpoint).Logger()
+	ctx := logger.WithContext(context.Background())
+
+	return integ.publish(ctx, bsEui, event, &bssci.AdapterMessage{
+		BsEui:       bsEui.String(),
+		EventSource: eventSourceEndpoint,
+		EventType:   event,
+		Message:     &bssci.AdapterMessage_EndnodeUplink{EndnodeUplink: pb},
+	})
+}
+
+// Publish basestation messages.
+func (integ *Integration) PublishBasestationEvent(bsEui common.EUI64, event string, pb *bs.BasestationUplink) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceBasestation).Logger()
+	ctx := logger.WithContext(context.Background())
+
+	return integ.publish(ctx, bsEui, event, &bssci.AdapterMessage{
+		BsEui:       bsEui.String(),
+		EventSource: eventSourceBasestation,
+		EventType:   event,
+		Message:     &bssci.AdapterMessage_BasestationUplink{BasestationUplink: pb},
+	})
+}
+
+// Publish events generated by the adapter.
+func (integ *Integration) PublishAdapterEvent(bsEui common.EUI64, event string, pb *structpb.Struct) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceBasestation).Logger()
+	ctx := logger.WithContext(context.Background())
+
+	return integ.publish(ctx, bsEui, event, &bssci.AdapterMessage{
+		BsEui:       bsEui.String(),
+		EventSource: eventSourceBasestation,
+		EventType:   event,
+		Message:     &bssci.AdapterMessage_AdapterEvent{AdapterEvent: pb},
+	})
+}
+
+// Queue a message for all streams subscribed to the basestation.
+//
+// Fails if the streams subscribed to the basestation dropped the message as their queues
+// are full. Without subscribed streams the message is not published, like events of the
+// MQTT integrations without subscribers.
+func (integ *Integration) publish(ctx context.Context, bsEui common.EUI64, message string, msg *bssci.AdapterMessage) error {
+	logger := zerolog.Ctx(ctx)
+
+	integ.mux.RLock()
+	defer integ.mux.RUnlock()
+
+	var subscribed, queued int
+	for sub := range integ.subscribers {
+		if !sub.subscribed(bsEui) {
+			continue
+		}
+		subscribed++
+		if !sub.queue(msg) {
+			logger.Warn().Str("peer", sub.peer).Msg("send queue full, dropping message")
+			grpcDroppedCounter().Inc()
+			continue
+		}
+		grpcMessageCounter(message).Inc()
+		queued++
+	}
+	if queued == 0 && subscribed != 0 {
+		return errors.New("no subscriber accepted the message")
+	}
+	logger.Debug().Int("subscribers", queued).Any("data", msg).Msg("published message")
+	return nil
+}
+
+// Stream implements the bssci.AdapterServer interface.
+func (integ *Integration) Stream(stream bssci.Adapter_StreamServer) error {
+	sub := newSubscriber(integ.sendQueueSize)
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		sub.peer = p.Addr.String()
+	}
+	logger := log.With().Str("peer", sub.peer).Logger()
+	logger.Info().Msg("grpc stream opened")
+
+	integ.mux.Lock()
+	integ.subscribers[sub] = struct{}{}
+	integ.mux.Unlock()
+	grpcSubscriberGauge().Inc()
+
+	defer func() {
+		integ.mux.Lock()
+		delete(integ.subscribers, sub)
+		integ.mux.Unlock()
+		grpcSubscriberGauge().Dec()
+		logger.Info().Msg("grpc stream closed")
+	}()
+
+	received := make(chan error, 1)
+	go func() {
+		received <- integ.receive(stream, sub)
+	}()
+
+	for {
+		select {
+		case msg := <-sub.send:
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		case err := <-received:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-integ.ctx.Done():
+			// send the queued messages before ending the stream
+			for {
+				select {
+				case msg := <-sub.send:
+					if err := stream.Send(msg); err != nil {
+						return err
+					}
+				default:
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// Receive messages of a stream until it ends
+func (integ *Integration) receive(stream bssci.Adapter_StreamServer, sub *subscriber) error {
+	logger := log.With().Str("peer", sub.peer).Logger()
+
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		switch m := msg.GetMessage().(type) {
+		case *bssci.SubscriberMessage_Subscribe:
+			if err := integ.subscribe(sub, m.Subscribe); err != nil {
+				logger.Error().Err(err).Msg("subscribe error")
+				grpcInboundCounter("subscribe", "invalid").Inc()
+				continue
+			}
+			grpcInboundCounter("subscribe", "accepted").Inc()
+		case *bssci.SubscriberMessage_Command:
+			if !integ.accepted(&logger, "command", m.Command.GetBsEui(), integ.serverCommandHandler != nil) {
+				continue
+			}
+			integ.serverCommandHandler(m.Command)
+		case *bssci.SubscriberMessage_Response:
+			if !integ.accepted(&logger, "response", m.Response.GetBsEui(), integ.serverResponseHandler != nil) {
+				continue
+			}
+			integ.serverResponseHandler(m.Response)
+		default:
+			logger.Warn().Msg("ignoring empty subscriber message")
+		}
+	}
+}
+
+// Replace the subscription of a stream, queues the last states of the subscribed basestations
+func (integ *Integration) subscribe(sub *subscriber, pb *bssci.Subscribe) error {
+	euis := make(map[common.EUI64]struct{}, len(pb.GetBsEuis()))
+	for _, s := range pb.GetBsEuis() {
+		bsEui, err := common.Eui64FromHexString(s)
+		if err != nil {
+			return errors.Wrapf(err, "invalid bs eui: %s", s)
+		}
+		euis[bsEui] = struct{}{}
+	}
+	sub.set(euis)
+	log.Info().Str("peer", sub.peer).Int("bs_euis", len(euis)).Msg("grpc stream subscription updated")
+
+	integ.mux.RLock()
+	defer integ.mux.RUnlock()
+	for bsEui, state := range integ.states {
+		if sub.subscribed(bsEui) && !sub.queue(&bssci.AdapterMessage{
+			BsEui:   bsEui.String(),
+			Message: &bssci.AdapterMessage_State{State: state},
+		}) {
+			grpcDroppedCounter().Inc()
+		}
+	}
+	return nil
+}
+
+// Whether an inbound command or response is passed to its handler
+func (integ *Integration) accepted(logger *zerolog.Logger, message string, eui string, handled bool) bool {
+	bsEui, err := common.Eui64FromHexString(eui)
+	if err != nil {
+		logger.Error().Err(err).Str("message", message).Msg("invalid bs eui")
+		grpcInboundCounter(message, "invalid").Inc()
+		return false
+	}
+
+	integ.mux.RLock()
+	_, ok := integ.basestations[bsEui]
+	integ.mux.RUnlock()
+	if !ok {
+		logger.Warn().Str("message", message).Str("bs_eui", bsEui.String()).Msg("basestation not subscribed, ignoring message")
+		grpcInboundCounter(message, "unsubscribed").Inc()
+		return false
+	}
+	if !handled {
+		logger.Warn().Str("message", message).Msg("no handler set, ignoring message")
+		grpcInboundCounter(message, "unhandled").Inc()
+		return false
+	}
+	grpcInboundCounter(message, "accepted").Inc()
+	return true
+}
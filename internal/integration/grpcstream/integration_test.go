@@ -0,0 +1,197 @@
+package grpcstream
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/api/go/bssci"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+)
+
+type IntegrationTestSuite struct {
+	suite.Suite
+
+	integ  *Integration
+	conn   *grpc.ClientConn
+	bsEuiA common.EUI64
+	bsEuiB common.EUI64
+
+	commands chan *bs.ServerCommand
+}
+
+func (ts *IntegrationTestSuite) SetupTest() {
+	ts.bsEuiA = common.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	ts.bsEuiB = common.EUI64{8, 7, 6, 5, 4, 3, 2, 1}
+	ts.commands = make(chan *bs.ServerCommand, 10)
+
+	var conf config.Config
+	conf.Integration.GRPC.SendQueueSize = 10
+
+	var err error
+	ts.integ, err = NewIntegration(conf)
+	ts.Require().NoError(err)
+	ts.integ.SetServerCommandHandler(func(pb *bs.ServerCommand) { ts.commands <- pb })
+
+	ln := bufconn.Listen(1 << 20)
+	ts.integ.serve(ln)
+
+	ts.conn, err = grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, s string) (net.Conn, error) { return ln.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	ts.Require().NoError(err)
+}
+
+func (ts *IntegrationTestSuite) TearDownTest() {
+	ts.conn.Close()
+	ts.integ.server.Stop()
+	ts.integ.cancel()
+}
+
+// Open a stream subscribed to the given basestations
+func (ts *IntegrationTestSuite) subscribe(bsEuis ...common.EUI64) bssci.Adapter_StreamClient {
+	stream, err := bssci.NewAdapterClient(ts.conn).Stream(ts.T().Context())
+	ts.Require().NoError(err)
+
+	var euis []string
+	for _, bsEui := range bsEuis {
+		euis = append(euis, bsEui.String())
+	}
+	ts.Require().NoError(stream.Send(&bssci.SubscriberMessage{
+		Message: &bssci.SubscriberMessage_Subscribe{Subscribe: &bssci.Subscribe{BsEuis: euis}},
+	}))
+	ts.waitSubscribed(len(bsEuis))
+	return stream
+}
+
+// Wait until a stream with the given number of basestations is subscribed
+func (ts *IntegrationTestSuite) waitSubscribed(n int) {
+	ts.Require().Eventually(func() bool {
+		ts.integ.mux.RLock()
+		defer ts.integ.mux.RUnlock()
+		for sub := range ts.integ.subscribers {
+			sub.mux.RLock()
+			ok := sub.active && len(sub.bsEuis) == n
+			sub.mux.RUnlock()
+			if ok {
+				return true
+			}
+		}
+		return false
+	}, time.Second, time.Millisecond)
+}
+
+func (ts *IntegrationTestSuite) TestFilter() {
+	assert := ts.Assert()
+
+	streamA := ts.subscribe(ts.bsEuiA)
+	streamAll := ts.subscribe()
+
+	assert.NoError(ts.integ.PublishEndnodeEvent(ts.bsEuiB, "ul", &bs.EndnodeUplink{BsEui: ts.bsEuiB.String()}))
+	assert.NoError(ts.integ.PublishBasestationEvent(ts.bsEuiA, "status", &bs.BasestationUplink{BsEui: ts.bsEuiA.String()}))
+
+	// the first stream only receives events of basestation A
+	msg, err := streamA.Recv()
+	ts.Require().NoError(err)
+	assert.Equal(ts.bsEuiA.String(), msg.BsEui)
+	assert.Equal("bs", msg.EventSource)
+	assert.Equal("status", msg.EventType)
+	assert.NotNil(msg.GetBasestationUplink())
+
+	msg, err = streamAll.Recv()
+	ts.Require().NoError(err)
+	assert.Equal("ul", msg.EventType)
+	assert.NotNil(msg.GetEndnodeUplink())
+	msg, err = streamAll.Recv()
+	ts.Require().NoError(err)
+	assert.Equal("status", msg.EventType)
+}
+
+func (ts *IntegrationTestSuite) TestStateOnSubscribe() {
+	ts.Require().NoError(ts.integ.PublishState(context.Background(), ts.bsEuiA, &bs.BasestationState{BsEui: ts.bsEuiA.String(), State: bs.BasestationState_ONLINE}))
+	ts.Require().NoError(ts.integ.PublishState(context.Background(), ts.bsEuiB, &bs.BasestationState{BsEui: ts.bsEuiB.String(), State: bs.BasestationState_ONLINE}))
+
+	stream := ts.subscribe(ts.bsEuiB)
+	msg, err := stream.Recv()
+	ts.Require().NoError(err)
+	ts.Assert().Equal(ts.bsEuiB.String(), msg.BsEui)
+	ts.Assert().Equal(bs.BasestationState_ONLINE, msg.GetState().GetState())
+}
+
+func (ts *IntegrationTestSuite) TestCommand() {
+	stream := ts.subscribe()
+	send := func(bsEui common.EUI64) {
+		ts.Require().NoError(stream.Send(&bssci.SubscriberMessage{
+			Message: &bssci.SubscriberMessage_Command{Command: &bs.ServerCommand{BsEui: bsEui.String()}},
+		}))
+	}
+
+	// commands for basestations without subscription are ignored
+	send(ts.bsEuiA)
+
+	ts.Require().NoError(ts.integ.SetBasestationSubscription(true, ts.bsEuiB))
+	send(ts.bsEuiB)
+
+	select {
+	case pb := <-ts.commands:
+		ts.Assert().Equal(ts.bsEuiB.String(), pb.BsEui)
+	case <-time.After(time.Second):
+		ts.Fail("command not received")
+	}
+	ts.Assert().Empty(ts.commands)
+}
+
+func (ts *IntegrationTestSuite) TestDropWhenFull() {
+	ts.integ.mux.Lock()
+	sub := newSubscriber(1)
+	sub.set(nil)
+	ts.integ.subscribers[sub] = struct{}{}
+	ts.integ.mux.Unlock()
+
+	ts.Assert().NoError(ts.integ.PublishEndnodeEvent(ts.bsEuiA, "ul", &bs.EndnodeUplink{}))
+	ts.Assert().Error(ts.integ.PublishEndnodeEvent(ts.bsEuiA, "ul", &bs.EndnodeUplink{}))
+	ts.Assert().Len(sub.send, 1)
+}
+
+func (ts *IntegrationTestSuite) TestNoSubscriber() {
+	// uplinks are not rejected while no client is attached
+	ts.Assert().NoError(ts.integ.PublishEndnodeEvent(ts.bsEuiA, "ul", &bs.EndnodeUplink{}))
+
+	// the state is sent on subscribe
+	ts.Assert().NoError(ts.integ.PublishState(context.Background(), ts.bsEuiA, &bs.BasestationState{BsEui: ts.bsEuiA.String()}))
+}
+
+func (ts *IntegrationTestSuite) TestStop() {
+	stream := ts.subscribe()
+	ts.Require().NoError(ts.integ.SetBasestationSubscription(true, ts.bsEuiA))
+	ts.Require().NoError(ts.integ.Stop())
+
+	// the offline state is sent before the stream ends
+	msg, err := stream.Recv()
+	ts.Require().NoError(err)
+	ts.Assert().Equal(bs.BasestationState_OFFLINE, msg.GetState().GetState())
+	_, err = stream.Recv()
+	ts.Assert().Equal(io.EOF, err)
+}
+
+func TestNewIntegration_invalidQueueSize(t *testing.T) {
+	var conf config.Config
+	_, err := NewIntegration(conf)
+	assert.Error(t, err)
+}
+
+func TestIntegration(t *testing.T) {
+	suite.Run(t, new(IntegrationTestSuite))
+}
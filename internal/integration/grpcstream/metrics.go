@@ -0,0 +1,44 @@
+package grpcstream
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	sg = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "integration_grpc_subscriber_count",
+		Help: "The number of open streams.",
+	})
+
+	mc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_grpc_message_count",
+		Help: "The number of messages queued for subscribers (per message).",
+	}, []string{"message"})
+
+	dc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_grpc_dropped_count",
+		Help: "The number of messages dropped because the queue of a subscriber was full.",
+	})
+
+	ic = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_grpc_inbound_count",
+		Help: "The number of messages received from subscribers (per message, result).",
+	}, []string{"message", "result"})
+)
+
+func grpcSubscriberGauge() prometheus.Gauge {
+	return sg
+}
+
+func grpcMessageCounter(message string) prometheus.Counter {
+	return mc.With(prometheus.Labels{"message": message})
+}
+
+func grpcDroppedCounter() prometheus.Counter {
+	return dc
+}
+
+func grpcInboundCounter(message string, result string) prometheus.Counter {
+	return ic.With(prometheus.Labels{"message": message, "result": result})
+}
@@ -0,0 +1,55 @@
+package grpcstream
+
+import (
+	"sync"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/api/go/bssci"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+)
+
+// An open stream
+type subscriber struct {
+	peer string
+	send chan *bssci.AdapterMessage
+
+	mux    sync.RWMutex
+	active bool
+	// subscribed basestations, all if empty
+	bsEuis map[common.EUI64]struct{}
+}
+
+func newSubscriber(queueSize int) *subscriber {
+	return &subscriber{send: make(chan *bssci.AdapterMessage, queueSize)}
+}
+
+// Replace the subscribed basestations
+func (s *subscriber) set(bsEuis map[common.EUI64]struct{}) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.active = true
+	s.bsEuis = bsEuis
+}
+
+// Whether the stream receives events of a basestation
+func (s *subscriber) subscribed(bsEui common.EUI64) bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	if !s.active {
+		return false
+	}
+	if len(s.bsEuis) == 0 {
+		return true
+	}
+	_, ok := s.bsEuis[bsEui]
+	return ok
+}
+
+// Queue a message without blocking, false if the queue is full
+func (s *subscriber) queue(msg *bssci.AdapterMessage) bool {
+	select {
+	case s.send <- msg:
+		return true
+	default:
+		return false
+	}
+}
@@ -2,14 +2,22 @@ package integration
 
 import (
 	"context"
+	"slices"
 
 	"github.com/pkg/errors"
 
 	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/file"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/grpcstream"
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/mqtt"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/mqttv5"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/natsio"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/webhook"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/websocket"
 )
 
 // Event types.
@@ -22,14 +30,84 @@ const (
 
 var integration Integration
 
+// Constructors of the integration types
+var registry = map[string]func(conf config.Config) (Integration, error){
+	"mqtt_v3": func(conf config.Config) (Integration, error) {
+		return mqtt.NewIntegration(conf)
+	},
+	"mqtt_v5": func(conf config.Config) (Integration, error) {
+		return mqttv5.NewIntegration(conf)
+	},
+	"webhook": func(conf config.Config) (Integration, error) {
+		return webhook.NewIntegration(conf)
+	},
+	"grpc": func(conf config.Config) (Integration, error) {
+		return grpcstream.NewIntegration(conf)
+	},
+	"nats": func(conf config.Config) (Integration, error) {
+		return natsio.NewIntegration(conf)
+	},
+	"websocket": func(conf config.Config) (Integration, error) {
+		return websocket.NewIntegration(conf)
+	},
+	"file": func(conf config.Config) (Integration, error) {
+		return file.NewIntegration(conf)
+	},
+}
+
 // Setup configures the integration.
+//
+// Integrations selected for store-and-forward journal their events to disk. With
+// multiple integrations types, event filters or required integrations configured, the
+// integrations are combined in a fan-out.
 func Setup(conf config.Config) error {
-	var err error
-	integration, err = mqtt.NewIntegration(conf)
-	if err != nil {
-		return errors.Wrap(err, "setup mqtt integration error")
+	types := conf.Integration.Types
+	if len(types) == 0 {
+		types = []string{conf.Integration.Type}
+	}
+
+	integrations := make(map[string]Integration)
+	var order []string
+	for _, t := range types {
+		if t == "" {
+			t = "mqtt_v3"
+		}
+		if _, ok := integrations[t]; ok {
+			return errors.Errorf("duplicate integration type: %s", t)
+		}
+		newIntegration, ok := registry[t]
+		if !ok {
+			return errors.Errorf("unknown integration type: %s", t)
+		}
+		i, err := newIntegration(conf)
+		if err != nil {
+			return errors.Wrapf(err, "setup %s integration error", t)
+		}
+		if slices.Contains(conf.Integration.StoreForward.Integrations, t) {
+			if i, err = newStoreForward(t, i, conf); err != nil {
+				return errors.Wrapf(err, "setup %s store-and-forward error", t)
+			}
+		}
+		integrations[t] = i
+		order = append(order, t)
+	}
+
+	for _, name := range conf.Integration.StoreForward.Integrations {
+		if _, ok := integrations[name]; !ok {
+			return errors.Errorf("store-and-forward for unconfigured integration: %s", name)
+		}
+	}
+
+	if len(order) == 1 && len(conf.Integration.EventFilters) == 0 && len(conf.Integration.Required) == 0 {
+		integration = integrations[order[0]]
+		return nil
 	}
 
+	f, err := newFanOut(integrations, order, conf.Integration.EventFilters, conf.Integration.Required, conf.Integration.OptionalQueueSize)
+	if err != nil {
+		return errors.Wrap(err, "setup fan-out error")
+	}
+	integration = f
 	return nil
 }
 
@@ -52,6 +130,9 @@ type Integration interface {
 	// Publish basestation messages.
 	PublishBasestationEvent(bsEui common.EUI64, event string, pb *bs.BasestationUplink) error
 
+	// Publish events generated by the adapter.
+	PublishAdapterEvent(bsEui common.EUI64, event string, pb *structpb.Struct) error
+
 	// Set handler for server command messages
 	SetServerCommandHandler(func(*bs.ServerCommand))
 
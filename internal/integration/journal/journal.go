@@ -0,0 +1,507 @@
+// Package journal implements a persistent FIFO queue of records.
+//
+// Records are appended to segment files in a directory. The position of the oldest
+// record is stored in a cursor file, consumed segments are removed. A partially
+// written record at the end of the journal, e.g. after a crash, is discarded on open.
+package journal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// length, crc32 of time and data, unix time in nanoseconds
+	headerSize = 16
+
+	segmentExt = ".seg"
+	cursorFile = "cursor"
+)
+
+var errCorrupt = errors.New("corrupt record")
+
+// A queued record.
+type Record struct {
+	Time time.Time
+	Data []byte
+
+	// position of the record, used by Pop
+	seq    uint64
+	offset int64
+}
+
+// Options of a journal.
+type Options struct {
+	// Size after which a new segment file is started
+	SegmentSize int64
+	// Maximum size of all records, the oldest records are dropped once exceeded.
+	// Unlimited if 0.
+	MaxSize int64
+	// Sync segment files after each append
+	SyncWrites bool
+}
+
+type segment struct {
+	seq  uint64
+	size int64
+}
+
+// The file records are appended to
+type segmentWriter interface {
+	io.Writer
+	Sync() error
+	Close() error
+}
+
+// Journal is a persistent FIFO queue.
+type Journal struct {
+	dir  string
+	opts Options
+
+	mux      sync.Mutex
+	segments []segment
+	writer   segmentWriter
+	reader   *os.File
+	cursor   *os.File
+	// position of the oldest record in the first segment
+	offset int64
+	count  int
+
+	// the oldest record, read by Peek
+	head     *Record
+	headSize int64
+}
+
+// Open a journal, the directory is created if it does not exist.
+func Open(dir string, opts Options) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, errors.Wrap(err, "create directory error")
+	}
+
+	j := Journal{dir: dir, opts: opts}
+
+	var err error
+	j.cursor, err = os.OpenFile(filepath.Join(dir, cursorFile), os.O_RDWR|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, errors.Wrap(err, "open cursor error")
+	}
+	if err := j.load(); err != nil {
+		j.Close()
+		return nil, err
+	}
+	return &j, nil
+}
+
+// Read the segments and the cursor, count the records
+func (j *Journal) load() error {
+	seqs, err := j.listSegments()
+	if err != nil {
+		return err
+	}
+
+	var b [16]byte
+	var cursorSeq uint64
+	if _, err := j.cursor.ReadAt(b[:], 0); err == nil {
+		cursorSeq = binary.LittleEndian.Uint64(b[0:8])
+		j.offset = int64(binary.LittleEndian.Uint64(b[8:16]))
+	} else if err != io.EOF {
+		return errors.Wrap(err, "read cursor error")
+	}
+
+	for _, seq := range seqs {
+		// segments before the cursor are consumed
+		if seq < cursorSeq {
+			if err := os.Remove(j.segmentPath(seq)); err != nil {
+				return errors.Wrap(err, "remove segment error")
+			}
+			continue
+		}
+		j.segments = append(j.segments, segment{seq: seq})
+	}
+	if len(j.segments) == 0 || j.segments[0].seq != cursorSeq {
+		j.offset = 0
+	}
+
+	for i := range j.segments {
+		start := int64(0)
+		if i == 0 {
+			start = j.offset
+		}
+		end, count, err := j.scan(j.segments[i].seq, start)
+		if err != nil {
+			return err
+		}
+		if i == 0 && end < start {
+			j.offset = end
+		}
+		j.segments[i].size = end
+		j.count += count
+	}
+
+	if len(j.segments) == 0 {
+		seq := cursorSeq
+		if seq == 0 {
+			seq = 1
+		}
+		j.segments = append(j.segments, segment{seq: seq})
+	}
+
+	last := j.segments[len(j.segments)-1]
+	f, err := j.openWriter(last.seq)
+	if err != nil {
+		return err
+	}
+	j.writer = f
+	return j.writeCursor()
+}
+
+func (j *Journal) openWriter(seq uint64) (*os.File, error) {
+	f, err := os.OpenFile(j.segmentPath(seq), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, errors.Wrap(err, "open segment error")
+	}
+	return f, nil
+}
+
+// Sequence numbers of the segment files in ascending order
+func (j *Journal) listSegments() ([]uint64, error) {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "read directory error")
+	}
+
+	var seqs []uint64
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), segmentExt)
+		if !ok || e.IsDir() {
+			continue
+		}
+		seq, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(a, b int) bool { return seqs[a] < seqs[b] })
+	return seqs, nil
+}
+
+// Count the valid records of a segment from start, truncates the segment after the last one
+func (j *Journal) scan(seq uint64, start int64) (int64, int, error) {
+	path := j.segmentPath(seq)
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "open segment error")
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "stat segment error")
+	}
+	if start > info.Size() {
+		start = info.Size()
+	}
+
+	offset := start
+	var count int
+	for offset < info.Size() {
+		_, size, err := readRecord(f, offset, info.Size())
+		if err != nil {
+			log.Warn().Err(err).Str("segment", path).Int64("offset", offset).Msg("discarding journal records")
+			if err := f.Truncate(offset); err != nil {
+				return 0, 0, errors.Wrap(err, "truncate segment error")
+			}
+			break
+		}
+		offset += size
+		count++
+	}
+	return offset, count, nil
+}
+
+// Read the record at the offset, returns the size of the record.
+//
+// The record must end before limit, the size of the segment.
+func readRecord(f *os.File, offset int64, limit int64) (Record, int64, error) {
+	var header [headerSize]byte
+	if _, err := f.ReadAt(header[:], offset); err != nil {
+		if err == io.EOF {
+			return Record{}, 0, errCorrupt
+		}
+		return Record{}, 0, err
+	}
+
+	length := binary.LittleEndian.Uint32(header[0:4])
+	sum := binary.LittleEndian.Uint32(header[4:8])
+	if offset+headerSize+int64(length) > limit {
+		return Record{}, 0, errCorrupt
+	}
+
+	data := make([]byte, length)
+	if _, err := f.ReadAt(data, offset+headerSize); err != nil {
+		if err == io.EOF {
+			return Record{}, 0, errCorrupt
+		}
+		return Record{}, 0, err
+	}
+	if checksum(header[8:16], data) != sum {
+		return Record{}, 0, errCorrupt
+	}
+
+	t := int64(binary.LittleEndian.Uint64(header[8:16]))
+	return Record{Time: time.Unix(0, t), Data: data}, headerSize + int64(length), nil
+}
+
+func checksum(t []byte, data []byte) uint32 {
+	crc := crc32.ChecksumIEEE(t)
+	return crc32.Update(crc, crc32.IEEETable, data)
+}
+
+func (j *Journal) segmentPath(seq uint64) string {
+	return filepath.Join(j.dir, fmt.Sprintf("%020d%s", seq, segmentExt))
+}
+
+func (j *Journal) writeCursor() error {
+	var b [16]byte
+	binary.LittleEndian.PutUint64(b[0:8], j.segments[0].seq)
+	binary.LittleEndian.PutUint64(b[8:16], uint64(j.offset))
+	if _, err := j.cursor.WriteAt(b[:], 0); err != nil {
+		return errors.Wrap(err, "write cursor error")
+	}
+	return nil
+}
+
+// Size of the queued records in bytes
+func (j *Journal) size() int64 {
+	var size int64
+	for _, s := range j.segments {
+		size += s.size
+	}
+	return size - j.offset
+}
+
+// Append a record, returns the number of old records dropped to stay within the maximum size.
+func (j *Journal) Append(t time.Time, data []byte) (int, error) {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	size := headerSize + int64(len(data))
+	if j.opts.MaxSize > 0 && size > j.opts.MaxSize {
+		return 0, errors.New("record exceeds the maximum journal size")
+	}
+
+	var dropped int
+	for j.opts.MaxSize > 0 && j.count > 0 && j.size()+size > j.opts.MaxSize {
+		if err := j.pop(); err != nil {
+			return dropped, err
+		}
+		dropped++
+	}
+
+	last := &j.segments[len(j.segments)-1]
+	if j.opts.SegmentSize > 0 && last.size > 0 && last.size+size > j.opts.SegmentSize {
+		if err := j.rotate(); err != nil {
+			return dropped, err
+		}
+		last = &j.segments[len(j.segments)-1]
+	}
+
+	b := make([]byte, size)
+	binary.LittleEndian.PutUint32(b[0:4], uint32(len(data)))
+	binary.LittleEndian.PutUint64(b[8:16], uint64(t.UnixNano()))
+	binary.LittleEndian.PutUint32(b[4:8], checksum(b[8:16], data))
+	copy(b[headerSize:], data)
+
+	if _, err := j.writer.Write(b); err != nil {
+		j.discardPartial(last)
+		return dropped, errors.Wrap(err, "write segment error")
+	}
+	if j.opts.SyncWrites {
+		if err := j.writer.Sync(); err != nil {
+			j.discardPartial(last)
+			return dropped, errors.Wrap(err, "sync segment error")
+		}
+	}
+	last.size += size
+	j.count++
+	return dropped, nil
+}
+
+// Remove a partially written record from the end of the segment after a failed append,
+// the next append continues after the last complete record.
+func (j *Journal) discardPartial(last *segment) {
+	path := j.segmentPath(last.seq)
+	if err := os.Truncate(path, last.size); err != nil {
+		// records are only read up to the size of their segment, continue in a new one
+		log.Error().Err(err).Str("segment", path).Msg("truncate journal segment error")
+		if err := j.rotate(); err != nil {
+			log.Error().Err(err).Msg("rotate journal segment error")
+		}
+		return
+	}
+
+	f, err := j.openWriter(last.seq)
+	if err != nil {
+		log.Error().Err(err).Str("segment", path).Msg("reopen journal segment error")
+		return
+	}
+	if err := j.writer.Close(); err != nil {
+		log.Warn().Err(err).Str("segment", path).Msg("close journal segment error")
+	}
+	j.writer = f
+}
+
+// Start a new segment, the current segment is kept for appending if this fails
+func (j *Journal) rotate() error {
+	seq := j.segments[len(j.segments)-1].seq + 1
+	f, err := j.openWriter(seq)
+	if err != nil {
+		return errors.Wrap(err, "create segment error")
+	}
+	if err := j.writer.Close(); err != nil {
+		log.Warn().Err(err).Str("segment", j.segmentPath(seq-1)).Msg("close journal segment error")
+	}
+	j.writer = f
+	j.segments = append(j.segments, segment{seq: seq})
+	return nil
+}
+
+// Peek returns the oldest record, false if the journal is empty.
+func (j *Journal) Peek() (Record, bool, error) {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	if err := j.peek(); err != nil {
+		return Record{}, false, err
+	}
+	if j.head == nil {
+		return Record{}, false, nil
+	}
+	return *j.head, true, nil
+}
+
+func (j *Journal) peek() error {
+	if j.head != nil || j.count == 0 {
+		return nil
+	}
+
+	// skip consumed segments
+	for j.offset >= j.segments[0].size && len(j.segments) > 1 {
+		if err := j.removeHeadSegment(); err != nil {
+			return err
+		}
+	}
+
+	if j.reader == nil {
+		f, err := os.Open(j.segmentPath(j.segments[0].seq))
+		if err != nil {
+			return errors.Wrap(err, "open segment error")
+		}
+		j.reader = f
+	}
+
+	rec, size, err := readRecord(j.reader, j.offset, j.segments[0].size)
+	if err != nil {
+		return errors.Wrap(err, "read record error")
+	}
+	rec.seq = j.segments[0].seq
+	rec.offset = j.offset
+	j.head = &rec
+	j.headSize = size
+	return nil
+}
+
+func (j *Journal) removeHeadSegment() error {
+	if j.reader != nil {
+		j.reader.Close()
+		j.reader = nil
+	}
+	if err := os.Remove(j.segmentPath(j.segments[0].seq)); err != nil {
+		return errors.Wrap(err, "remove segment error")
+	}
+	j.segments = j.segments[1:]
+	j.offset = 0
+	return j.writeCursor()
+}
+
+// Pop removes a record returned by Peek.
+//
+// Nothing is removed if the record was already dropped by Append to stay within the
+// maximum size, so a record which was not peeked is never removed.
+func (j *Journal) Pop(rec Record) error {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	if err := j.peek(); err != nil {
+		return err
+	}
+	if j.head == nil || j.head.seq != rec.seq || j.head.offset != rec.offset {
+		return nil
+	}
+	return j.pop()
+}
+
+func (j *Journal) pop() error {
+	if err := j.peek(); err != nil {
+		return err
+	}
+	if j.head == nil {
+		return nil
+	}
+
+	j.offset += j.headSize
+	j.count--
+	j.head = nil
+
+	if j.offset >= j.segments[0].size && len(j.segments) > 1 {
+		return j.removeHeadSegment()
+	}
+	return j.writeCursor()
+}
+
+// Len returns the number of queued records.
+func (j *Journal) Len() int {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	return j.count
+}
+
+// Size returns the size of the queued records in bytes.
+func (j *Journal) Size() int64 {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	return j.size()
+}
+
+// Close the journal.
+func (j *Journal) Close() error {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+
+	var err error
+	if j.writer != nil {
+		err = j.writer.Close()
+	}
+	for _, f := range []*os.File{j.reader, j.cursor} {
+		if f == nil {
+			continue
+		}
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
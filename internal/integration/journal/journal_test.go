@@ -0,0 +1,223 @@
+package journal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type JournalTestSuite struct {
+	suite.Suite
+
+	dir  string
+	opts Options
+	j    *Journal
+}
+
+func (ts *JournalTestSuite) SetupTest() {
+	ts.dir = ts.T().TempDir()
+	ts.opts = Options{SegmentSize: 64}
+	ts.open()
+}
+
+func (ts *JournalTestSuite) TearDownTest() {
+	ts.j.Close()
+}
+
+func (ts *JournalTestSuite) open() {
+	var err error
+	ts.j, err = Open(ts.dir, ts.opts)
+	ts.Require().NoError(err)
+}
+
+func (ts *JournalTestSuite) reopen() {
+	ts.Require().NoError(ts.j.Close())
+	ts.open()
+}
+
+func (ts *JournalTestSuite) append(n int) {
+	for i := range n {
+		_, err := ts.j.Append(time.Unix(int64(i), 0), []byte(fmt.Sprintf("record %02d", i)))
+		ts.Require().NoError(err)
+	}
+}
+
+// Pop the given number of records and return their data
+func (ts *JournalTestSuite) pop(n int) []string {
+	var out []string
+	for range n {
+		rec, ok, err := ts.j.Peek()
+		ts.Require().NoError(err)
+		ts.Require().True(ok)
+		out = append(out, string(rec.Data))
+		ts.Require().NoError(ts.j.Pop(rec))
+	}
+	return out
+}
+
+func (ts *JournalTestSuite) segmentFiles() int {
+	matches, err := filepath.Glob(filepath.Join(ts.dir, "*"+segmentExt))
+	ts.Require().NoError(err)
+	return len(matches)
+}
+
+func (ts *JournalTestSuite) TestOrder() {
+	ts.append(10)
+	ts.Assert().Equal(10, ts.j.Len())
+	ts.Assert().Greater(ts.segmentFiles(), 1)
+
+	rec, ok, err := ts.j.Peek()
+	ts.Require().NoError(err)
+	ts.Require().True(ok)
+	ts.Assert().Equal(time.Unix(0, 0), rec.Time)
+
+	ts.Assert().Equal([]string{"record 00", "record 01", "record 02"}, ts.pop(3))
+	ts.append(1)
+	ts.Assert().Equal("record 03", ts.pop(1)[0])
+	ts.Assert().Equal(7, ts.j.Len())
+}
+
+func (ts *JournalTestSuite) TestEmpty() {
+	rec, ok, err := ts.j.Peek()
+	ts.Require().NoError(err)
+	ts.Assert().False(ok)
+	ts.Assert().NoError(ts.j.Pop(rec))
+	ts.Assert().Equal(int64(0), ts.j.Size())
+}
+
+func (ts *JournalTestSuite) TestSegmentsRemoved() {
+	ts.append(10)
+	ts.pop(10)
+	ts.Assert().Equal(0, ts.j.Len())
+	ts.Assert().Equal(int64(0), ts.j.Size())
+	ts.Assert().Equal(1, ts.segmentFiles())
+}
+
+func (ts *JournalTestSuite) TestReopen() {
+	ts.append(10)
+	ts.pop(4)
+	ts.reopen()
+
+	ts.Assert().Equal(6, ts.j.Len())
+	ts.Assert().Equal([]string{"record 04", "record 05"}, ts.pop(2))
+
+	ts.append(2)
+	ts.reopen()
+	ts.Assert().Equal(6, ts.j.Len())
+	ts.Assert().Equal([]string{"record 06", "record 07", "record 08", "record 09", "record 00", "record 01"}, ts.pop(6))
+}
+
+func (ts *JournalTestSuite) TestMaxSize() {
+	ts.opts.MaxSize = 3 * (headerSize + 9)
+	ts.reopen()
+
+	ts.append(3)
+	dropped, err := ts.j.Append(time.Now(), []byte("record 03"))
+	ts.Require().NoError(err)
+	ts.Assert().Equal(1, dropped)
+	ts.Assert().Equal(3, ts.j.Len())
+	ts.Assert().Equal([]string{"record 01", "record 02", "record 03"}, ts.pop(3))
+
+	_, err = ts.j.Append(time.Now(), make([]byte, ts.opts.MaxSize))
+	ts.Assert().Error(err)
+}
+
+func (ts *JournalTestSuite) TestPopDropped() {
+	ts.opts.MaxSize = 2 * (headerSize + 9)
+	ts.reopen()
+
+	ts.append(2)
+	rec, ok, err := ts.j.Peek()
+	ts.Require().NoError(err)
+	ts.Require().True(ok)
+
+	// the peeked record is dropped while it is published
+	dropped, err := ts.j.Append(time.Now(), []byte("record 02"))
+	ts.Require().NoError(err)
+	ts.Assert().Equal(1, dropped)
+
+	ts.Require().NoError(ts.j.Pop(rec))
+	ts.Assert().Equal(2, ts.j.Len())
+	ts.Assert().Equal([]string{"record 01", "record 02"}, ts.pop(2))
+}
+
+func (ts *JournalTestSuite) TestRotateError() {
+	ts.append(2)
+
+	// the next segment can not be created
+	next := filepath.Join(ts.dir, fmt.Sprintf("%020d%s", 2, segmentExt))
+	ts.Require().NoError(os.Mkdir(next, 0o750))
+	_, err := ts.j.Append(time.Now(), []byte("record 02"))
+	ts.Require().Error(err)
+
+	ts.Require().NoError(os.Remove(next))
+	ts.append(1)
+	ts.Assert().Equal(3, ts.j.Len())
+}
+
+func (ts *JournalTestSuite) TestPartialRecord() {
+	ts.append(2)
+	ts.Require().NoError(ts.j.Close())
+
+	// a record cut short by a crash is discarded
+	path := filepath.Join(ts.dir, fmt.Sprintf("%020d%s", 1, segmentExt))
+	info, err := os.Stat(path)
+	ts.Require().NoError(err)
+	ts.Require().NoError(os.Truncate(path, info.Size()-3))
+
+	ts.open()
+	ts.Assert().Equal(1, ts.j.Len())
+	ts.append(1)
+	ts.Assert().Equal([]string{"record 00", "record 00"}, ts.pop(2))
+}
+
+func (ts *JournalTestSuite) TestCorruptRecord() {
+	ts.append(2)
+	ts.Require().NoError(ts.j.Close())
+
+	path := filepath.Join(ts.dir, fmt.Sprintf("%020d%s", 1, segmentExt))
+	b, err := os.ReadFile(path)
+	ts.Require().NoError(err)
+	b[len(b)-1] ^= 0xff
+	ts.Require().NoError(os.WriteFile(path, b, 0o640))
+
+	ts.open()
+	ts.Assert().Equal(1, ts.j.Len())
+}
+
+// Writes only a part of the data, e.g. when the disk is full
+type failingWriter struct {
+	segmentWriter
+	n int
+}
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	n, _ := w.segmentWriter.Write(b[:w.n])
+	return n, io.ErrShortWrite
+}
+
+func (ts *JournalTestSuite) TestWriteError() {
+	ts.append(1)
+
+	ts.j.writer = &failingWriter{segmentWriter: ts.j.writer, n: 5}
+	_, err := ts.j.Append(time.Now(), []byte("record 01"))
+	ts.Require().Error(err)
+	ts.Assert().Equal(1, ts.j.Len())
+
+	// the partial record is removed, the following records are readable
+	ts.append(2)
+	ts.Assert().Equal([]string{"record 00", "record 00", "record 01"}, ts.pop(3))
+
+	ts.append(1)
+	ts.reopen()
+	ts.Assert().Equal(1, ts.j.Len())
+}
+
+func TestJournal(t *testing.T) {
+	suite.Run(t, new(JournalTestSuite))
+}
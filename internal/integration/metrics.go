@@ -0,0 +1,71 @@
+package integration
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	fe = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_fanout_error_count",
+		Help: "The number of failed calls to an integration of the fan-out (per integration, operation).",
+	}, []string{"integration", "operation"})
+
+	fd = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_fanout_dropped_count",
+		Help: "The number of publishes to an optional integration dropped as its queue was full (per integration).",
+	}, []string{"integration"})
+
+	sfd = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "integration_store_forward_queue_depth",
+		Help: "The number of events journaled for an integration (per integration).",
+	}, []string{"integration"})
+
+	sfa = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "integration_store_forward_oldest_age_seconds",
+		Help: "The age of the oldest event journaled for an integration (per integration).",
+	}, []string{"integration"})
+
+	sff = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_store_forward_forwarded_count",
+		Help: "The number of journaled events published by an integration (per integration).",
+	}, []string{"integration"})
+
+	sfr = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_store_forward_retry_count",
+		Help: "The number of failed publishes of journaled events (per integration).",
+	}, []string{"integration"})
+
+	sfx = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_store_forward_dropped_count",
+		Help: "The number of journaled events dropped (per integration, reason).",
+	}, []string{"integration", "reason"})
+)
+
+func fanOutErrorCounter(integration string, operation string) prometheus.Counter {
+	return fe.With(prometheus.Labels{"integration": integration, "operation": operation})
+}
+
+func fanOutDroppedCounter(integration string) prometheus.Counter {
+	return fd.With(prometheus.Labels{"integration": integration})
+}
+
+func storeForwardDepthGauge(integration string) prometheus.Gauge {
+	return sfd.With(prometheus.Labels{"integration": integration})
+}
+
+func storeForwardAgeGauge(integration string) prometheus.Gauge {
+	return sfa.With(prometheus.Labels{"integration": integration})
+}
+
+func storeForwardForwardedCounter(integration string) prometheus.Counter {
+	return sff.With(prometheus.Labels{"integration": integration})
+}
+
+func storeForwardRetryCounter(integration string) prometheus.Counter {
+	return sfr.With(prometheus.Labels{"integration": integration})
+}
+
+func storeForwardDroppedCounter(integration string, reason string) prometheus.Counter {
+	return sfx.With(prometheus.Labels{"integration": integration, "reason": reason})
+}
@@ -0,0 +1,81 @@
+package mqtt
+
+import (
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+)
+
+// Matches the basestation event carrying the result of a server command
+type CommandResult struct {
+	// Event type of the result
+	EventType events.EventType
+	// Reports whether an event of the type is the result of the command
+	Match func(*bs.BasestationUplink) bool
+}
+
+// The result event of a server command, false if no result event is published for the command
+func CommandResultOf(pb *bs.ServerCommand) (CommandResult, bool) {
+	switch cmd := pb.GetCommand().(type) {
+	case *bs.ServerCommand_DlDataQue:
+		return downlinkResult(cmd.DlDataQue.GetEndnodeEui(), cmd.DlDataQue.GetDlQueId()), true
+	case *bs.ServerCommand_DlDataRev:
+		return downlinkResult(cmd.DlDataRev.GetEndnodeEui(), cmd.DlDataRev.GetDlQueId()), true
+	case *bs.ServerCommand_DlRxStatQry:
+		endnodeEui := cmd.DlRxStatQry.GetEndnodeEui()
+		return CommandResult{
+			EventType: events.EventTypeEpRx,
+			Match: func(up *bs.BasestationUplink) bool {
+				return sameEui(up.GetDlRxStat().GetEpEui(), endnodeEui)
+			},
+		}, true
+	case *bs.ServerCommand_AttPrp:
+		return propagationResult(cmd.AttPrp.GetEndnodeEui()), true
+	case *bs.ServerCommand_DetPrp:
+		return propagationResult(cmd.DetPrp.GetEndnodeEui()), true
+	case *bs.ServerCommand_ReqStatus:
+		return CommandResult{
+			EventType: events.EventTypeBsStatus,
+			Match: func(up *bs.BasestationUplink) bool {
+				return up.GetStatus() != nil
+			},
+		}, true
+	case *bs.ServerCommand_VmStatus:
+		return CommandResult{
+			EventType: events.EventTypeBsVmStatus,
+			Match: func(up *bs.BasestationUplink) bool {
+				return up.GetVmStatus() != nil
+			},
+		}, true
+	default:
+		// variable MAC activation only completes the operation
+		return CommandResult{}, false
+	}
+}
+
+func downlinkResult(endnodeEui string, dlQueId uint64) CommandResult {
+	return CommandResult{
+		EventType: events.EventTypeBsDl,
+		Match: func(up *bs.BasestationUplink) bool {
+			res := up.GetDlRes()
+			return sameEui(res.GetEpEui(), endnodeEui) && res.GetDlQueId() == dlQueId
+		},
+	}
+}
+
+func propagationResult(endnodeEui string) CommandResult {
+	return CommandResult{
+		EventType: events.EventTypeBsPrpAck,
+		Match: func(up *bs.BasestationUplink) bool {
+			return sameEui(up.GetPrpAck().GetEpEui(), endnodeEui)
+		},
+	}
+}
+
+// compare EUIs independent of their string representation
+func sameEui(a string, b string) bool {
+	euiA, errA := common.Eui64FromHexString(a)
+	euiB, errB := common.Eui64FromHexString(b)
+	return a != "" && b != "" && errA == nil && errB == nil && euiA == euiB
+}
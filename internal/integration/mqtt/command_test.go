@@ -0,0 +1,79 @@
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
+
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandResultOf(t *testing.T) {
+	const endnodeEui = "0102030405060708"
+
+	dlRes := &bs.BasestationUplink{Message: &bs.BasestationUplink_DlRes{
+		DlRes: &bs.BasestationDownlinkResult{EpEui: "0x0102030405060708", DlQueId: 7},
+	}}
+	prpAck := &bs.BasestationUplink{Message: &bs.BasestationUplink_PrpAck{
+		PrpAck: &bs.BasestationPropagationAck{EpEui: endnodeEui},
+	}}
+
+	tests := []struct {
+		name      string
+		command   *bs.ServerCommand
+		wantOk    bool
+		wantType  events.EventType
+		event     *bs.BasestationUplink
+		wantMatch bool
+	}{
+		{
+			name:      "downlink",
+			command:   &bs.ServerCommand{Command: &bs.ServerCommand_DlDataQue{DlDataQue: &bs.EnqueDownlink{EndnodeEui: endnodeEui, DlQueId: 7}}},
+			wantOk:    true,
+			wantType:  events.EventTypeBsDl,
+			event:     dlRes,
+			wantMatch: true,
+		},
+		{
+			name:      "other downlink",
+			command:   &bs.ServerCommand{Command: &bs.ServerCommand_DlDataQue{DlDataQue: &bs.EnqueDownlink{EndnodeEui: endnodeEui, DlQueId: 8}}},
+			wantOk:    true,
+			wantType:  events.EventTypeBsDl,
+			event:     dlRes,
+			wantMatch: false,
+		},
+		{
+			name:      "detach",
+			command:   &bs.ServerCommand{Command: &bs.ServerCommand_DetPrp{DetPrp: &bs.DetachPropagate{EndnodeEui: endnodeEui}}},
+			wantOk:    true,
+			wantType:  events.EventTypeBsPrpAck,
+			event:     prpAck,
+			wantMatch: true,
+		},
+		{
+			name:      "status",
+			command:   &bs.ServerCommand{Command: &bs.ServerCommand_ReqStatus{ReqStatus: &bs.RequestStatus{}}},
+			wantOk:    true,
+			wantType:  events.EventTypeBsStatus,
+			event:     prpAck,
+			wantMatch: false,
+		},
+		{
+			name:    "vm activate",
+			command: &bs.ServerCommand{Command: &bs.ServerCommand_VmActivate{VmActivate: &bs.EnableVariableMac{MacType: 1}}},
+			wantOk:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, ok := CommandResultOf(tt.command)
+			assert.Equal(t, tt.wantOk, ok)
+			if !ok {
+				return
+			}
+			assert.Equal(t, tt.wantType, result.EventType)
+			assert.Equal(t, tt.wantMatch, result.Match(tt.event))
+		})
+	}
+}
@@ -3,6 +3,7 @@ package mqtt
 import (
 	"bytes"
 	"context"
+	"slices"
 	"sync"
 	"text/template"
 	"time"
@@ -13,8 +14,8 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
-	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
 
 	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/auth"
 
@@ -26,6 +27,9 @@ import (
 const (
 	eventSourceEndpoint    = "ep"
 	eventSourceBasestation = "bs"
+
+	// suback return code of a rejected subscription
+	subackFailure = 0x80
 )
 
 // Integration implements a MQTT Integration.
@@ -40,15 +44,18 @@ type Integration struct {
 	serverCommandHandler  func(*bs.ServerCommand)
 	serverResponseHandler func(*bs.ServerResponse)
 
-	basestationsMux           sync.RWMutex
-	basestations              map[common.EUI64]struct{}
-	basestationsSubscribedMux sync.Mutex
-	basestationsSubscribed    map[common.EUI64]struct{}
-	terminateOnConnectError   bool
-	stateRetained             bool
-	maxTokenWait              time.Duration
+	basestationsMux         sync.RWMutex
+	basestations            map[common.EUI64]struct{}
+	subscriptions           *Subscriptions
+	terminateOnConnectError bool
+	stateRetained           bool
+	maxTokenWait            time.Duration
 
 	qos uint8
+	// qos of the command and response subscriptions
+	subscribeQOS uint8
+	// qos and retain flag per event type
+	eventOptions EventOptions
 
 	eventTopicTemplate    *template.Template
 	stateTopicTemplate    *template.Template
@@ -68,7 +75,6 @@ func NewIntegration(conf config.Config) (*Integration, error) {
 		terminateOnConnectError: conf.Integration.MQTTV3.TerminateOnConnectError,
 		clientOpts:              paho.NewClientOptions(),
 		basestations:            make(map[common.EUI64]struct{}),
-		basestationsSubscribed:  make(map[common.EUI64]struct{}),
 		stateRetained:           conf.Integration.MQTTV3.StateRetained,
 		maxTokenWait:            conf.Integration.MQTTV3.MaxTokenWait,
 	}
@@ -84,30 +90,30 @@ func NewIntegration(conf config.Config) (*Integration, error) {
 		return nil, errors.Errorf("unknown auth type: %s", conf.Integration.MQTTV3.Auth.Type)
 	}
 
-	// set marshaler
-	switch conf.Integration.Marshaler {
-	case "json":
-		integ.marshal = func(msg proto.Message) ([]byte, error) {
-			return protojson.MarshalOptions{
-				EmitUnpopulated: false,
-			}.Marshal(msg)
-		}
-		integ.unmarshal = func(b []byte, msg proto.Message) error {
-			return protojson.UnmarshalOptions{
-				DiscardUnknown: true,
-				AllowPartial:   true,
-			}.Unmarshal(b, msg)
-		}
-	case "protobuf":
-		integ.marshal = func(msg proto.Message) ([]byte, error) {
-			return proto.Marshal(msg)
-		}
+	integ.subscriptions = NewSubscriptions(SubscriptionOptions{
+		Subscribe:   integ.subscribeBasestations,
+		Unsubscribe: integ.unsubscribeBasestations,
+		OnChange:    integ.publishSubscriptionState,
+		IsConnected: integ.IsConnected,
+		Pending:     mqttSubscriptionPendingGauge(),
+	})
 
-		integ.unmarshal = func(b []byte, msg proto.Message) error {
-			return proto.Unmarshal(b, msg)
-		}
-	default:
-		return nil, errors.Errorf("unknown marshaler: %s", conf.Integration.Marshaler)
+	// set event options
+	integ.eventOptions, err = NewEventOptions(integ.qos, conf.Integration.MQTTV3.EventQOS, conf.Integration.MQTTV3.RetainedEvents)
+	if err != nil {
+		return nil, errors.Wrap(err, "event qos error")
+	}
+	integ.subscribeQOS, err = SubscribeQOS(integ.qos, conf.Integration.MQTTV3.SubscribeQOS)
+	if err != nil {
+		return nil, err
+	}
+
+	// set marshaler
+	if integ.marshal, err = Marshaler(conf.Integration.Marshaler); err != nil {
+		return nil, err
+	}
+	if integ.unmarshal, err = Unmarshaler(conf.Integration.Marshaler); err != nil {
+		return nil, err
 	}
 
 	// set topic templates
@@ -153,6 +159,9 @@ func (integ *Integration) Start() error {
 
 		// Add basestation EUI to list of gateways we must subscribe to.
 		integ.basestations[*bsEui] = struct{}{}
+		if err := integ.subscriptions.Set(true, *bsEui); err != nil {
+			return errors.Wrap(err, "subscribe basestation error")
+		}
 
 		// set last will and testament.
 		pl := bs.BasestationState{
@@ -179,12 +188,14 @@ func (integ *Integration) Start() error {
 
 	integ.connectLoop()
 	go integ.reconnectLoop()
-	go integ.subscribeLoop()
+	integ.subscriptions.Start()
 	return nil
 }
 
 // Stop the integration.
 func (integ *Integration) Stop() error {
+	integ.subscriptions.Stop()
+
 	integ.connMux.Lock()
 	defer integ.connMux.Unlock()
 
@@ -228,19 +239,46 @@ func (integ *Integration) SetBasestationSubscription(subscribe bool, bsEui commo
 	logger.Debug().Msg("updating basestation subscription")
 
 	integ.basestationsMux.Lock()
-	defer integ.basestationsMux.Unlock()
+	if err := integ.subscriptions.Set(subscribe, bsEui); err != nil {
+		integ.basestationsMux.Unlock()
+		return err
+	}
 
 	if subscribe {
 		integ.basestations[bsEui] = struct{}{}
 	} else {
 		delete(integ.basestations, bsEui)
 	}
-
+	integ.basestationsMux.Unlock()
 	logger.Info().Msg("basestation subscription updated")
 
+	if !subscribe {
+		integ.clearRetainedEvents(logger, bsEui)
+	}
 	return nil
 }
 
+// Remove the retained events of a basestation by publishing empty retained messages
+func (integ *Integration) clearRetainedEvents(logger zerolog.Logger, bsEui common.EUI64) {
+	for _, event := range integ.eventOptions.RetainedEvents() {
+		source := EventSource(event)
+		topic := bytes.NewBuffer(nil)
+		if err := integ.eventTopicTemplate.Execute(topic, struct {
+			BsEui       common.EUI64
+			EventSource string
+			EventType   string
+		}{bsEui, source, event}); err != nil {
+			logger.Error().Err(err).Str("event", event).Msg("execute event template error")
+			continue
+		}
+		if err := tokenWrapper(integ.conn.Publish(topic.String(), integ.eventOptions.QOS(event), true, []byte{}), integ.maxTokenWait); err != nil {
+			logger.Error().Err(err).Str("topic", topic.String()).Msg("clear retained event error")
+			continue
+		}
+		logger.Debug().Str("topic", topic.String()).Msg("cleared retained event")
+	}
+}
+
 // Set handler for server command messages
 func (integ *Integration) SetServerCommandHandler(f func(*bs.ServerCommand)) {
 	integ.serverCommandHandler = f
@@ -304,6 +342,16 @@ func (integ *Integration) PublishBasestationEvent(bsEui common.EUI64, event stri
 	return integ.publishEvent(ctx, bsEui, eventSourceBasestation, event, pb)
 }
 
+// Publish events generated by the adapter.
+func (integ *Integration) PublishAdapterEvent(bsEui common.EUI64, event string, pb *structpb.Struct) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceBasestation).Logger()
+	ctx := context.Background()
+	ctx = logger.WithContext(ctx)
+
+	return integ.publishEvent(ctx, bsEui, eventSourceBasestation, event, pb)
+}
+
 func (integ *Integration) publishEvent(ctx context.Context, bsEui common.EUI64, source string, event string, pb proto.Message) error {
 	logger := zerolog.Ctx(ctx)
 
@@ -324,12 +372,14 @@ func (integ *Integration) publishEvent(ctx context.Context, bsEui common.EUI64,
 		return errors.Wrap(err, "marshal message error")
 	}
 
-	logger.Info().Str("topic", topicStr).Uint8("qos", integ.qos).Msg("publishing event")
+	qos := integ.eventOptions.QOS(event)
+	retain := integ.eventOptions.Retain(event)
+	logger.Info().Str("topic", topicStr).Uint8("qos", qos).Bool("retain", retain).Msg("publishing event")
 
-	if err := tokenWrapper(integ.conn.Publish(topicStr, integ.qos, false, bytes), integ.maxTokenWait); err != nil {
+	if err := tokenWrapper(integ.conn.Publish(topicStr, qos, retain, bytes), integ.maxTokenWait); err != nil {
 		return err
 	}
-	logger.Debug().Str("topic", topicStr).Uint8("qos", integ.qos).Any("data", pb).Msg("published event")
+	logger.Debug().Str("topic", topicStr).Uint8("qos", qos).Any("data", pb).Msg("published event")
 	return nil
 }
 
@@ -366,10 +416,7 @@ func (integ *Integration) onConnected(c paho.Client) {
 	mqttConnectCounter().Inc()
 	log.Info().Msg("connected to mqtt broker")
 
-	integ.basestationsSubscribedMux.Lock()
-	defer integ.basestationsSubscribedMux.Unlock()
-
-	integ.basestationsSubscribed = make(map[common.EUI64]struct{})
+	integ.subscriptions.Reset()
 }
 
 func (integ *Integration) onConnectionLost(c paho.Client, err error) {
@@ -415,125 +462,82 @@ func (integ *Integration) reconnectLoop() {
 	}
 }
 
-func (integ *Integration) subscribeLoop() {
-	for {
-		time.Sleep(time.Millisecond * 100)
-
-		if integ.isClosed() {
-			break
-		}
-
-		if !integ.conn.IsConnected() {
-			continue
-		}
-
-		var subscribe []common.EUI64
-		var unsubscribe []common.EUI64
+// Publish the state of a basestation after its subscription changed
+func (integ *Integration) publishSubscriptionState(bsEui common.EUI64, subscribed bool) error {
+	logger := log.With().Str("bs_eui", bsEui.String()).Logger()
+	ctx := logger.WithContext(context.Background())
 
-		integ.basestationsMux.RLock()
-		integ.basestationsSubscribedMux.Lock()
-
-		// subscribe
-		for bsEui := range integ.basestations {
-			if _, ok := integ.basestationsSubscribed[bsEui]; !ok {
-				subscribe = append(subscribe, bsEui)
-			}
-		}
-
-		// unsubscribe
-		for bsEui := range integ.basestationsSubscribed {
-			if _, ok := integ.basestations[bsEui]; !ok {
-				unsubscribe = append(unsubscribe, bsEui)
-			}
-		}
-
-		// unlock gatewaysMux so that SetGatewaySubscription can write again
-		// to the map, in which case changes are picked up in the next run
-		integ.basestationsMux.RUnlock()
-
-		// setup ctx logger
-		logger := log.With().Logger()
-		ctx := context.Background()
-		ctx = logger.WithContext(ctx)
-
-		// subscribe to all basestations
-		for _, bsEui := range subscribe {
-			logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
-				return c.Str("bs_eui", bsEui.String())
-			})
-
-			pl := bs.BasestationState{
-				BsEui: bsEui.String(),
-				State: bs.BasestationState_ONLINE,
-			}
-
-			if err := integ.subscribeBasestation(ctx, bsEui); err != nil {
-				logger.Error().Err(err).Msg("mqtt subscribe basestation error")
-			} else {
-				if err := integ.PublishState(ctx, bsEui, &pl); err != nil {
-					logger.Error().Err(err).Msg("publish basestation error")
-				} else {
-					integ.basestationsSubscribed[bsEui] = struct{}{}
-				}
-			}
-		}
-
-		// unsubscribe from all remaining basestations
-		for _, bsEui := range unsubscribe {
-			logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
-				return c.Str("bs_eui", bsEui.String())
-			})
-
-			pl := bs.BasestationState{
-				BsEui: bsEui.String(),
-				State: bs.BasestationState_OFFLINE,
-			}
-
-			if err := integ.unsubscribeBasestation(ctx, bsEui); err != nil {
-				logger.Error().Err(err).Msg("mqtt unsubscribe basestation error")
-			} else {
-				if err := integ.PublishState(ctx, bsEui, &pl); err != nil {
-					logger.Error().Err(err).Msg("publish basestation error")
-				} else {
-					delete(integ.basestationsSubscribed, bsEui)
-				}
-			}
-		}
+	pl := bs.BasestationState{
+		BsEui: bsEui.String(),
+		State: bs.BasestationState_OFFLINE,
+	}
+	if subscribed {
+		pl.State = bs.BasestationState_ONLINE
+	}
 
-		integ.basestationsSubscribedMux.Unlock()
+	if err := integ.PublishState(ctx, bsEui, &pl); err != nil {
+		logger.Error().Err(err).Msg("publish basestation error")
+		return err
 	}
+	return nil
 }
 
-func (integ *Integration) subscribeBasestation(ctx context.Context, bsEui common.EUI64) error {
-	logger := zerolog.Ctx(ctx)
-
-	// subscribe to server commands
+// Command and response topic of a basestation
+func (integ *Integration) basestationTopics(bsEui common.EUI64) (string, string, error) {
 	topic := bytes.NewBuffer(nil)
 	if err := integ.commandTopicTemplate.Execute(topic, struct{ BsEui common.EUI64 }{bsEui}); err != nil {
-		return errors.Wrap(err, "execute command topic template error")
-	}
-	topicStr := topic.String()
-	logger.Info().Str("topic", topicStr).Uint8("qos", integ.qos).Msg("subscribing to topic")
-
-	if err := tokenWrapper(integ.conn.Subscribe(topicStr, integ.qos, integ.handleServerCommand), integ.maxTokenWait); err != nil {
-		return errors.Wrap(err, "subscribe command topic error")
+		return "", "", errors.Wrap(err, "execute command topic template error")
 	}
-	logger.Debug().Str("topic", topicStr).Uint8("qos", integ.qos).Msg("subscribed to topic")
+	commandTopic := topic.String()
 
-	// subscribe to server responses
 	topic = bytes.NewBuffer(nil)
 	if err := integ.responseTopicTemplate.Execute(topic, struct{ BsEui common.EUI64 }{bsEui}); err != nil {
-		return errors.Wrap(err, "execute response topic template error")
+		return "", "", errors.Wrap(err, "execute response topic template error")
 	}
-	topicStr = topic.String()
-	logger.Info().Str("topic", topicStr).Uint8("qos", integ.qos).Msg("subscribing to topic")
+	return commandTopic, topic.String(), nil
+}
 
-	if err := tokenWrapper(integ.conn.Subscribe(topicStr, integ.qos, integ.handleServerResponse), integ.maxTokenWait); err != nil {
-		return errors.Wrap(err, "subscribe response topic error")
+// Subscribe to the command and response topics of the basestations with one SUBSCRIBE packet,
+// returns the basestations with a rejected topic
+func (integ *Integration) subscribeBasestations(bsEuis []common.EUI64) ([]common.EUI64, error) {
+	filters := make(map[string]byte, 2*len(bsEuis))
+	// basestation of each topic
+	topics := make(map[string]common.EUI64, 2*len(bsEuis))
+	for _, bsEui := range bsEuis {
+		commandTopic, responseTopic, err := integ.basestationTopics(bsEui)
+		if err != nil {
+			return nil, err
+		}
+		integ.conn.AddRoute(commandTopic, integ.handleServerCommand)
+		integ.conn.AddRoute(responseTopic, integ.handleServerResponse)
+		filters[commandTopic] = integ.subscribeQOS
+		filters[responseTopic] = integ.subscribeQOS
+		topics[commandTopic] = bsEui
+		topics[responseTopic] = bsEui
 	}
-	logger.Debug().Str("topic", topicStr).Uint8("qos", integ.qos).Msg("subscribed to topic")
 
-	return nil
+	log.Info().Int("basestations", len(bsEuis)).Uint8("qos", integ.subscribeQOS).Msg("subscribing to topics")
+
+	token := integ.conn.SubscribeMultiple(filters, nil)
+	if err := tokenWrapper(token, integ.maxTokenWait); err != nil {
+		return nil, errors.Wrap(err, "subscribe topics error")
+	}
+
+	var rejected []common.EUI64
+	if st, ok := token.(*paho.SubscribeToken); ok {
+		for topic, qos := range st.Result() {
+			if qos != subackFailure {
+				continue
+			}
+			log.Error().Str("topic", topic).Msg("subscribe topic rejected")
+			if bsEui, ok := topics[topic]; ok && !slices.Contains(rejected, bsEui) {
+				rejected = append(rejected, bsEui)
+			}
+		}
+	}
+
+	log.Debug().Int("basestations", len(bsEuis)-len(rejected)).Uint8("qos", integ.subscribeQOS).Msg("subscribed to topics")
+	return rejected, nil
 }
 
 func (integ *Integration) handleServerCommand(c paho.Client, msg paho.Message) {
@@ -564,24 +568,34 @@ func (integ *Integration) handleServerResponse(c paho.Client, msg paho.Message)
 	integ.serverResponseHandler(&pb)
 }
 
-func (b *Integration) unsubscribeBasestation(ctx context.Context, bsEui common.EUI64) error {
-	logger := zerolog.Ctx(ctx)
-
-	topic := bytes.NewBuffer(nil)
-	if err := b.commandTopicTemplate.Execute(topic, struct{ BsEui common.EUI64 }{bsEui}); err != nil {
-		return errors.Wrap(err, "execute command topic template error")
+// Unsubscribe from the command and response topics of the basestations with one UNSUBSCRIBE packet.
+//
+// MQTT v3 does not report the result per topic, so no basestation is rejected.
+func (integ *Integration) unsubscribeBasestations(bsEuis []common.EUI64) ([]common.EUI64, error) {
+	topics := make([]string, 0, 2*len(bsEuis))
+	for _, bsEui := range bsEuis {
+		commandTopic, responseTopic, err := integ.basestationTopics(bsEui)
+		if err != nil {
+			return nil, err
+		}
+		topics = append(topics, commandTopic, responseTopic)
 	}
-	topicStr := topic.String()
 
-	logger.Info().Str("topic", topicStr).Msg("unsubscribing from topic")
+	log.Info().Int("basestations", len(bsEuis)).Msg("unsubscribing from topics")
 
-	if err := tokenWrapper(b.conn.Unsubscribe(topicStr), b.maxTokenWait); err != nil {
-		return errors.Wrap(err, "unsubscribe topic error")
+	if err := tokenWrapper(integ.conn.Unsubscribe(topics...), integ.maxTokenWait); err != nil {
+		return nil, errors.Wrap(err, "unsubscribe topics error")
 	}
 
-	logger.Debug().Str("topic", topicStr).Msg("unsubscribed from topic")
+	log.Debug().Int("basestations", len(bsEuis)).Msg("unsubscribed from topics")
+	return nil, nil
+}
 
-	return nil
+// IsConnected returns true when the client is connected to the broker.
+func (integ *Integration) IsConnected() bool {
+	integ.connMux.RLock()
+	defer integ.connMux.RUnlock()
+	return integ.conn != nil && integ.conn.IsConnectionOpen()
 }
 
 // isClosed returns true when the integration is shutting down.
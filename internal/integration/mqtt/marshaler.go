@@ -0,0 +1,68 @@
+package mqtt
+
+import (
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Marshal function of a marshaler, json or protobuf
+func Marshaler(marshaler string) (func(msg proto.Message) ([]byte, error), error) {
+	switch marshaler {
+	case "json":
+		return func(msg proto.Message) ([]byte, error) {
+			return protojson.MarshalOptions{
+				EmitUnpopulated: false,
+			}.Marshal(msg)
+		}, nil
+	case "protobuf":
+		return func(msg proto.Message) ([]byte, error) {
+			return proto.Marshal(msg)
+		}, nil
+	default:
+		return nil, errors.Errorf("unknown marshaler: %s", marshaler)
+	}
+}
+
+// Unmarshal function of a marshaler, json or protobuf
+func Unmarshaler(marshaler string) (func(b []byte, msg proto.Message) error, error) {
+	switch marshaler {
+	case "json":
+		return func(b []byte, msg proto.Message) error {
+			return protojson.UnmarshalOptions{
+				DiscardUnknown: true,
+				AllowPartial:   true,
+			}.Unmarshal(b, msg)
+		}, nil
+	case "protobuf":
+		return func(b []byte, msg proto.Message) error {
+			return proto.Unmarshal(b, msg)
+		}, nil
+	default:
+		return nil, errors.Errorf("unknown marshaler: %s", marshaler)
+	}
+}
+
+// Media type of the payloads of a marshaler
+func ContentType(marshaler string) string {
+	switch marshaler {
+	case "json":
+		return "application/json"
+	case "protobuf":
+		return "application/x-protobuf"
+	default:
+		return ""
+	}
+}
+
+// Marshaler of a media type, empty if unknown
+func MarshalerOfContentType(contentType string) string {
+	switch contentType {
+	case "application/json":
+		return "json"
+	case "application/x-protobuf", "application/protobuf":
+		return "protobuf"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,40 @@
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshaler(t *testing.T) {
+	msg := bs.BasestationState{BsEui: "0102030405060708"}
+
+	for _, marshaler := range []string{"protobuf", "json"} {
+		marshal, err := Marshaler(marshaler)
+		require.NoError(t, err)
+		unmarshal, err := Unmarshaler(marshaler)
+		require.NoError(t, err)
+
+		b, err := marshal(&msg)
+		require.NoError(t, err, marshaler)
+
+		var got bs.BasestationState
+		assert.NoError(t, unmarshal(b, &got), marshaler)
+		assert.Equal(t, msg.GetBsEui(), got.GetBsEui(), marshaler)
+	}
+
+	_, err := Marshaler("xml")
+	assert.Error(t, err)
+	_, err = Unmarshaler("xml")
+	assert.Error(t, err)
+}
+
+func TestContentType(t *testing.T) {
+	for _, marshaler := range []string{"protobuf", "json"} {
+		assert.Equal(t, marshaler, MarshalerOfContentType(ContentType(marshaler)))
+	}
+	assert.Empty(t, ContentType("xml"))
+	assert.Empty(t, MarshalerOfContentType("text/plain"))
+}
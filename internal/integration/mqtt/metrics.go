@@ -40,6 +40,11 @@ var (
 		Name: "integration_mqtt_reconnect_count",
 		Help: "The number of times the integration reconnected to the MQTT broker (this also increments the disconnect and connect counters).",
 	})
+
+	mqttsp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "integration_mqtt_subscription_pending_count",
+		Help: "The number of basestations with a pending subscribe or unsubscribe.",
+	})
 )
 
 func mqttEventCounter(c string, s string, e string) prometheus.Counter {
@@ -69,3 +74,7 @@ func mqttDisconnectCounter() prometheus.Counter {
 func mqttReconnectCounter() prometheus.Counter {
 	return mqttr
 }
+
+func mqttSubscriptionPendingGauge() prometheus.Gauge {
+	return mqttsp
+}
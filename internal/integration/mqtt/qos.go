@@ -0,0 +1,86 @@
+package mqtt
+
+import (
+	"slices"
+
+	"github.com/pkg/errors"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/events"
+)
+
+const maxQOS = 2
+
+// Publish options of the event types
+type EventOptions struct {
+	qos      uint8
+	eventQOS map[string]uint8
+	retained map[string]struct{}
+}
+
+// Event options using qos for event types without a configured qos
+func NewEventOptions(qos uint8, eventQOS map[string]uint8, retainedEvents []string) (EventOptions, error) {
+	o := EventOptions{
+		qos:      qos,
+		eventQOS: make(map[string]uint8, len(eventQOS)),
+		retained: make(map[string]struct{}, len(retainedEvents)),
+	}
+	for event, q := range eventQOS {
+		if !events.IsEventType(events.EventType(event)) {
+			return EventOptions{}, errors.Errorf("unknown event %s in event qos", event)
+		}
+		if q > maxQOS {
+			return EventOptions{}, errors.Errorf("invalid qos %d for event %s", q, event)
+		}
+		o.eventQOS[event] = q
+	}
+	for _, event := range retainedEvents {
+		if !events.IsEventType(events.EventType(event)) {
+			return EventOptions{}, errors.Errorf("unknown retained event %s", event)
+		}
+		o.retained[event] = struct{}{}
+	}
+	return o, nil
+}
+
+// QoS of an event type
+func (o EventOptions) QOS(event string) uint8 {
+	if q, ok := o.eventQOS[event]; ok {
+		return q
+	}
+	return o.qos
+}
+
+// True if events of the type are published retained
+func (o EventOptions) Retain(event string) bool {
+	_, ok := o.retained[event]
+	return ok
+}
+
+// Event types published retained, sorted
+func (o EventOptions) RetainedEvents() []string {
+	retained := make([]string, 0, len(o.retained))
+	for event := range o.retained {
+		retained = append(retained, event)
+	}
+	slices.Sort(retained)
+	return retained
+}
+
+// Source of an event type, ep for endnode events and bs for all others
+func EventSource(event string) string {
+	if events.IsEndnodeEvent(events.EventType(event)) {
+		return eventSourceEndpoint
+	}
+	return eventSourceBasestation
+}
+
+// QoS of the command and response subscriptions, qos if subscribeQOS is negative
+func SubscribeQOS(qos uint8, subscribeQOS int) (uint8, error) {
+	if subscribeQOS < 0 {
+		return qos, nil
+	}
+	if subscribeQOS > maxQOS {
+		return 0, errors.Errorf("invalid subscribe qos %d", subscribeQOS)
+	}
+	return uint8(subscribeQOS), nil
+}
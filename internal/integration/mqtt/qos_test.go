@@ -0,0 +1,74 @@
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	o, err := NewEventOptions(1, map[string]uint8{"status": 0, "ul": 2}, []string{"con"})
+	require.NoError(t, err)
+
+	assert.Equal(uint8(0), o.QOS("status"))
+	assert.Equal(uint8(2), o.QOS("ul"))
+	assert.Equal(uint8(1), o.QOS("con"))
+	assert.True(o.Retain("con"))
+	assert.False(o.Retain("ul"))
+
+	o, err = NewEventOptions(1, nil, []string{"ul", "con"})
+	require.NoError(t, err)
+	assert.Equal([]string{"con", "ul"}, o.RetainedEvents())
+
+	_, err = NewEventOptions(1, map[string]uint8{"ul": 3}, nil)
+	assert.Error(err)
+	_, err = NewEventOptions(1, map[string]uint8{"uplink": 1}, nil)
+	assert.Error(err)
+	_, err = NewEventOptions(1, nil, []string{"connect"})
+	assert.Error(err)
+}
+
+func TestEventSource(t *testing.T) {
+	assert.Equal(t, "ep", EventSource("ul"))
+	assert.Equal(t, "bs", EventSource("con"))
+	assert.Equal(t, "bs", EventSource("disconnect"))
+}
+
+func TestSubscribeQOS(t *testing.T) {
+	tests := []struct {
+		name         string
+		subscribeQOS int
+		want         uint8
+		wantErr      bool
+	}{
+		{
+			name:         "default",
+			subscribeQOS: -1,
+			want:         1,
+		},
+		{
+			name:         "configured",
+			subscribeQOS: 2,
+			want:         2,
+		},
+		{
+			name:         "invalid",
+			subscribeQOS: 3,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SubscribeQOS(1, tt.subscribeQOS)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
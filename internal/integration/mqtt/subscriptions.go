@@ -0,0 +1,255 @@
+package mqtt
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+)
+
+const (
+	// size of the subscription change queue
+	subscriptionQueueSize = 1024
+	// maximum number of basestations per SUBSCRIBE or UNSUBSCRIBE packet
+	subscriptionBatchSize = 100
+	// delay before failed changes are retried, doubled for every consecutive failure
+	subscriptionRetryInterval = 2 * time.Second
+	// maximum delay before failed changes are retried
+	subscriptionMaxRetryInterval = time.Minute
+)
+
+// Applies the subscription of a batch of basestations at the broker.
+//
+// Returns the basestations whose topics were rejected by the broker, an error if the
+// whole batch failed.
+type SubscriptionFunc func(bsEuis []common.EUI64) (rejected []common.EUI64, err error)
+
+// Options of a subscription manager
+type SubscriptionOptions struct {
+	// Subscribe the command and response topics of the basestations
+	Subscribe SubscriptionFunc
+	// Unsubscribe the command and response topics of the basestations
+	Unsubscribe SubscriptionFunc
+	// Called for each applied change, e.g. to publish the basestation state. The change
+	// is retried on error.
+	OnChange func(bsEui common.EUI64, subscribed bool) error
+	// True if connected to the broker
+	IsConnected func() bool
+	// Number of pending subscription changes
+	Pending prometheus.Gauge
+}
+
+type subscriptionChange struct {
+	bsEui     common.EUI64
+	subscribe bool
+}
+
+// Subscriptions manages the command and response subscriptions of the basestations.
+//
+// Changes are queued and applied by a single goroutine. Changes queued while a batch
+// is sent are coalesced, the topics of many basestations are sent in one packet.
+// Failed changes are retried and all subscriptions are restored after a reconnect. A
+// basestation rejected by the broker does not affect the others in the same batch.
+type Subscriptions struct {
+	opts             SubscriptionOptions
+	batchSize        int
+	retryInterval    time.Duration
+	maxRetryInterval time.Duration
+
+	changes chan subscriptionChange
+	reset   chan struct{}
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+
+	// owned by the run goroutine
+	wanted     map[common.EUI64]struct{}
+	subscribed map[common.EUI64]struct{}
+}
+
+// Create a subscription manager, changes are applied once started
+func NewSubscriptions(opts SubscriptionOptions) *Subscriptions {
+	s := Subscriptions{
+		opts:             opts,
+		batchSize:        subscriptionBatchSize,
+		retryInterval:    subscriptionRetryInterval,
+		maxRetryInterval: subscriptionMaxRetryInterval,
+		changes:          make(chan subscriptionChange, subscriptionQueueSize),
+		reset:            make(chan struct{}, 1),
+		wanted:           make(map[common.EUI64]struct{}),
+		subscribed:       make(map[common.EUI64]struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return &s
+}
+
+// Start applying changes
+func (s *Subscriptions) Start() {
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		s.run()
+	}()
+}
+
+// Stop applying changes, waits for a running batch
+func (s *Subscriptions) Stop() {
+	s.cancel()
+	s.running.Wait()
+}
+
+// Queue a subscription change of a basestation
+func (s *Subscriptions) Set(subscribe bool, bsEui common.EUI64) error {
+	if s.ctx.Err() != nil {
+		return errors.New("subscriptions stopped")
+	}
+	select {
+	case s.changes <- subscriptionChange{bsEui: bsEui, subscribe: subscribe}:
+		return nil
+	case <-s.ctx.Done():
+		return errors.New("subscriptions stopped")
+	}
+}
+
+// Restore all subscriptions, called after the connection to the broker was established
+func (s *Subscriptions) Reset() {
+	select {
+	case s.reset <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Subscriptions) run() {
+	var retry <-chan time.Time
+	retryInterval := s.retryInterval
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case c := <-s.changes:
+			s.apply(c)
+			s.coalesce()
+		case <-s.reset:
+			s.subscribed = make(map[common.EUI64]struct{})
+			retry = nil
+			retryInterval = s.retryInterval
+		case <-retry:
+			retry = nil
+		}
+
+		if retry != nil || s.pending() == 0 {
+			s.opts.Pending.Set(float64(s.pending()))
+			continue
+		}
+		if !s.opts.IsConnected() {
+			retry = time.After(s.retryInterval)
+		} else if err := s.sync(); err != nil {
+			log.Error().Err(err).Int("pending", s.pending()).Dur("retry_interval", retryInterval).Msg("mqtt subscription error, retrying")
+			retry = time.After(retryInterval)
+			retryInterval = min(2*retryInterval, s.maxRetryInterval)
+		} else {
+			retryInterval = s.retryInterval
+		}
+		s.opts.Pending.Set(float64(s.pending()))
+	}
+}
+
+func (s *Subscriptions) apply(c subscriptionChange) {
+	if c.subscribe {
+		s.wanted[c.bsEui] = struct{}{}
+	} else {
+		delete(s.wanted, c.bsEui)
+	}
+}
+
+// Apply all queued changes
+func (s *Subscriptions) coalesce() {
+	for {
+		select {
+		case c := <-s.changes:
+			s.apply(c)
+		default:
+			return
+		}
+	}
+}
+
+// Number of basestations whose subscription differs from the wanted one
+func (s *Subscriptions) pending() int {
+	var n int
+	for bsEui := range s.wanted {
+		if _, ok := s.subscribed[bsEui]; !ok {
+			n++
+		}
+	}
+	for bsEui := range s.subscribed {
+		if _, ok := s.wanted[bsEui]; !ok {
+			n++
+		}
+	}
+	return n
+}
+
+// Send the pending changes in batches, stops at the first failed batch. Rejected
+// basestations stay pending, the remaining batches are sent.
+func (s *Subscriptions) sync() error {
+	var subscribe, unsubscribe []common.EUI64
+	for bsEui := range s.wanted {
+		if _, ok := s.subscribed[bsEui]; !ok {
+			subscribe = append(subscribe, bsEui)
+		}
+	}
+	for bsEui := range s.subscribed {
+		if _, ok := s.wanted[bsEui]; !ok {
+			unsubscribe = append(unsubscribe, bsEui)
+		}
+	}
+
+	var failed int
+	for batch := range slices.Chunk(subscribe, s.batchSize) {
+		rejected, err := s.opts.Subscribe(batch)
+		if err != nil {
+			return errors.Wrap(err, "subscribe error")
+		}
+		failed += len(rejected)
+		for _, bsEui := range batch {
+			if slices.Contains(rejected, bsEui) {
+				continue
+			}
+			if err := s.opts.OnChange(bsEui, true); err != nil {
+				failed++
+				continue
+			}
+			s.subscribed[bsEui] = struct{}{}
+		}
+	}
+	for batch := range slices.Chunk(unsubscribe, s.batchSize) {
+		rejected, err := s.opts.Unsubscribe(batch)
+		if err != nil {
+			return errors.Wrap(err, "unsubscribe error")
+		}
+		failed += len(rejected)
+		for _, bsEui := range batch {
+			if slices.Contains(rejected, bsEui) {
+				continue
+			}
+			if err := s.opts.OnChange(bsEui, false); err != nil {
+				failed++
+				continue
+			}
+			delete(s.subscribed, bsEui)
+		}
+	}
+	if failed != 0 {
+		return errors.Errorf("%d subscription changes failed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package mqtt
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+)
+
+type SubscriptionsTestSuite struct {
+	suite.Suite
+
+	subs    *Subscriptions
+	pending prometheus.Gauge
+
+	connected atomic.Bool
+	// closed once a subscribe is blocked and to release it
+	blocked chan struct{}
+	release chan struct{}
+
+	mux          sync.Mutex
+	block        bool
+	subscribeErr error
+	changeErr    error
+	rejected     map[common.EUI64]bool
+	batches      [][]common.EUI64
+	subscribed   map[common.EUI64]bool
+}
+
+func (ts *SubscriptionsTestSuite) SetupTest() {
+	ts.blocked = make(chan struct{})
+	ts.release = make(chan struct{})
+	ts.block = false
+	ts.subscribeErr = nil
+	ts.changeErr = nil
+	ts.rejected = make(map[common.EUI64]bool)
+	ts.batches = nil
+	ts.subscribed = make(map[common.EUI64]bool)
+	ts.connected.Store(true)
+
+	ts.pending = prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_pending"})
+	ts.subs = NewSubscriptions(SubscriptionOptions{
+		Subscribe:   ts.subscribe,
+		Unsubscribe: ts.unsubscribe,
+		OnChange:    ts.onChange,
+		IsConnected: ts.connected.Load,
+		Pending:     ts.pending,
+	})
+	ts.subs.batchSize = 2
+	ts.subs.retryInterval = 10 * time.Millisecond
+	ts.subs.maxRetryInterval = 10 * time.Millisecond
+}
+
+func (ts *SubscriptionsTestSuite) TearDownTest() {
+	ts.subs.Stop()
+}
+
+func (ts *SubscriptionsTestSuite) subscribe(bsEuis []common.EUI64) ([]common.EUI64, error) {
+	ts.mux.Lock()
+	block := ts.block
+	ts.block = false
+	ts.mux.Unlock()
+	if block {
+		close(ts.blocked)
+		<-ts.release
+	}
+
+	ts.mux.Lock()
+	defer ts.mux.Unlock()
+	ts.batches = append(ts.batches, append([]common.EUI64(nil), bsEuis...))
+	if ts.subscribeErr != nil {
+		return nil, ts.subscribeErr
+	}
+	var rejected []common.EUI64
+	for _, bsEui := range bsEuis {
+		if ts.rejected[bsEui] {
+			rejected = append(rejected, bsEui)
+		}
+	}
+	return rejected, nil
+}
+
+func (ts *SubscriptionsTestSuite) unsubscribe(bsEuis []common.EUI64) ([]common.EUI64, error) {
+	ts.mux.Lock()
+	defer ts.mux.Unlock()
+	ts.batches = append(ts.batches, append([]common.EUI64(nil), bsEuis...))
+	return nil, nil
+}
+
+func (ts *SubscriptionsTestSuite) onChange(bsEui common.EUI64, subscribed bool) error {
+	ts.mux.Lock()
+	defer ts.mux.Unlock()
+	if ts.changeErr != nil {
+		return ts.changeErr
+	}
+	ts.subscribed[bsEui] = subscribed
+	return nil
+}
+
+func (ts *SubscriptionsTestSuite) set(subscribe bool, n int) {
+	for i := range n {
+		ts.Require().NoError(ts.subs.Set(subscribe, common.EUI64{byte(i)}))
+	}
+}
+
+// Wait until the number of subscribed basestations matches
+func (ts *SubscriptionsTestSuite) waitSubscribed(n int) {
+	ts.Require().Eventually(func() bool {
+		ts.mux.Lock()
+		defer ts.mux.Unlock()
+		var count int
+		for _, subscribed := range ts.subscribed {
+			if subscribed {
+				count++
+			}
+		}
+		return count == n && testutil.ToFloat64(ts.pending) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func (ts *SubscriptionsTestSuite) batchCount() int {
+	ts.mux.Lock()
+	defer ts.mux.Unlock()
+	return len(ts.batches)
+}
+
+func (ts *SubscriptionsTestSuite) TestBatches() {
+	ts.subs.Start()
+	ts.set(true, 5)
+	ts.waitSubscribed(5)
+
+	ts.mux.Lock()
+	defer ts.mux.Unlock()
+	for _, batch := range ts.batches {
+		ts.Assert().LessOrEqual(len(batch), 2)
+	}
+}
+
+func (ts *SubscriptionsTestSuite) TestCoalesce() {
+	ts.block = true
+	ts.subs.Start()
+
+	// changes queued while a batch is sent are coalesced
+	ts.set(true, 1)
+	<-ts.blocked
+	ts.Require().NoError(ts.subs.Set(true, common.EUI64{1}))
+	ts.Require().NoError(ts.subs.Set(true, common.EUI64{2}))
+	ts.Require().NoError(ts.subs.Set(false, common.EUI64{2}))
+	close(ts.release)
+
+	ts.waitSubscribed(2)
+	ts.Assert().Equal(2, ts.batchCount())
+	ts.Assert().NotContains(ts.subscribed, common.EUI64{2})
+}
+
+func (ts *SubscriptionsTestSuite) TestUnsubscribe() {
+	ts.subs.Start()
+	ts.set(true, 3)
+	ts.waitSubscribed(3)
+
+	ts.set(false, 2)
+	ts.waitSubscribed(1)
+	ts.Assert().False(ts.subscribed[common.EUI64{0}])
+	ts.Assert().True(ts.subscribed[common.EUI64{2}])
+}
+
+func (ts *SubscriptionsTestSuite) TestRetry() {
+	ts.subscribeErr = errors.New("subscribe error")
+	ts.subs.Start()
+	ts.set(true, 1)
+
+	ts.Require().Eventually(func() bool { return ts.batchCount() >= 2 }, time.Second, time.Millisecond)
+	ts.Assert().Equal(float64(1), testutil.ToFloat64(ts.pending))
+
+	ts.mux.Lock()
+	ts.subscribeErr = nil
+	ts.mux.Unlock()
+	ts.waitSubscribed(1)
+}
+
+func (ts *SubscriptionsTestSuite) TestRejected() {
+	ts.rejected[common.EUI64{0}] = true
+	ts.subs.Start()
+	ts.set(true, 5)
+
+	// the other basestations of the batches are subscribed
+	ts.Require().Eventually(func() bool {
+		ts.mux.Lock()
+		defer ts.mux.Unlock()
+		return len(ts.subscribed) == 4 && testutil.ToFloat64(ts.pending) == 1
+	}, time.Second, time.Millisecond)
+
+	ts.mux.Lock()
+	ts.rejected = nil
+	ts.mux.Unlock()
+	ts.waitSubscribed(5)
+}
+
+func (ts *SubscriptionsTestSuite) TestRetryChange() {
+	ts.changeErr = errors.New("publish error")
+	ts.subs.Start()
+	ts.set(true, 1)
+
+	// the subscription is repeated until the change is applied
+	ts.Require().Eventually(func() bool { return ts.batchCount() >= 2 }, time.Second, time.Millisecond)
+	ts.mux.Lock()
+	ts.changeErr = nil
+	ts.mux.Unlock()
+	ts.waitSubscribed(1)
+}
+
+func (ts *SubscriptionsTestSuite) TestReconnect() {
+	ts.connected.Store(false)
+	ts.subs.Start()
+	ts.set(true, 3)
+
+	time.Sleep(50 * time.Millisecond)
+	ts.Assert().Equal(0, ts.batchCount())
+	ts.Assert().Equal(float64(3), testutil.ToFloat64(ts.pending))
+
+	ts.connected.Store(true)
+	ts.subs.Reset()
+	ts.waitSubscribed(3)
+	count := ts.batchCount()
+
+	// all subscriptions are restored after a reconnect
+	ts.subs.Reset()
+	ts.Require().Eventually(func() bool { return ts.batchCount() == 2*count }, time.Second, time.Millisecond)
+}
+
+func (ts *SubscriptionsTestSuite) TestStopped() {
+	ts.subs.Start()
+	ts.subs.Stop()
+	ts.Assert().Error(ts.subs.Set(true, common.EUI64{1}))
+}
+
+func TestSubscriptions(t *testing.T) {
+	suite.Run(t, new(SubscriptionsTestSuite))
+}
@@ -0,0 +1,108 @@
+package mqtt
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// Fields of the topic templates
+const (
+	TopicFieldBsEui       = "BsEui"
+	TopicFieldEventSource = "EventSource"
+	TopicFieldEventType   = "EventType"
+)
+
+// Event sources of the event topic
+const (
+	EventSourceEndpoint    = eventSourceEndpoint
+	EventSourceBasestation = eventSourceBasestation
+)
+
+var topicFields = []string{TopicFieldBsEui, TopicFieldEventSource, TopicFieldEventType}
+
+// Topic of a topic template, fields without a value are replaced by single level wildcards
+func SubscriptionTopic(tmpl string, values map[string]string) (string, error) {
+	data := make(map[string]string, len(topicFields))
+	for _, field := range topicFields {
+		data[field] = "+"
+		if v := values[field]; v != "" {
+			data[field] = v
+		}
+	}
+	return executeTopicTemplate(tmpl, data)
+}
+
+// Topic to publish to for a subscription topic template, wildcards are replaced by the name
+func PublishTopic(tmpl string, values map[string]string, name string) (string, error) {
+	topic, err := executeTopicTemplate(tmpl, values)
+	if err != nil {
+		return "", err
+	}
+	levels := strings.Split(topic, "/")
+	for i, level := range levels {
+		if level == "#" || level == "+" {
+			levels[i] = name
+		}
+	}
+	return strings.Join(levels, "/"), nil
+}
+
+// Extracts the fields from topics created by a topic template
+type TopicMatcher struct {
+	re *regexp.Regexp
+}
+
+func NewTopicMatcher(tmpl string) (*TopicMatcher, error) {
+	// render the template with markers which are replaced by capture groups
+	data := make(map[string]string, len(topicFields))
+	for _, field := range topicFields {
+		data[field] = "\x00" + field + "\x00"
+	}
+	topic, err := executeTopicTemplate(tmpl, data)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := regexp.QuoteMeta(topic)
+	for _, field := range topicFields {
+		pattern = strings.Replace(pattern, data[field], "(?P<"+field+">[^/]+)", 1)
+		// a repeated field must have the same value, which regexp can not express
+		pattern = strings.ReplaceAll(pattern, data[field], "[^/]+")
+	}
+	re, err := regexp.Compile("^" + pattern + "$")
+	if err != nil {
+		return nil, errors.Wrap(err, "compile topic pattern error")
+	}
+	return &TopicMatcher{re: re}, nil
+}
+
+// Returns the template fields of a topic, false if the topic does not match the template
+func (m *TopicMatcher) Match(topic string) (map[string]string, bool) {
+	match := m.re.FindStringSubmatch(topic)
+	if match == nil {
+		return nil, false
+	}
+	values := make(map[string]string)
+	for i, name := range m.re.SubexpNames() {
+		if name != "" {
+			values[name] = match[i]
+		}
+	}
+	return values, true
+}
+
+func executeTopicTemplate(tmpl string, data map[string]string) (string, error) {
+	t, err := template.New("topic").Parse(tmpl)
+	if err != nil {
+		return "", errors.Wrap(err, "parse topic template error")
+	}
+	topic := bytes.NewBuffer(nil)
+	if err := t.Execute(topic, data); err != nil {
+		return "", errors.Wrap(err, "execute topic template error")
+	}
+	return topic.String(), nil
+}
@@ -0,0 +1,135 @@
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriptionTopic(t *testing.T) {
+	tests := []struct {
+		name    string
+		tmpl    string
+		values  map[string]string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "all",
+			tmpl: testEventTopicTemplate,
+			want: "test/bssci/+/event/+/+",
+		},
+		{
+			name:   "filtered",
+			tmpl:   testEventTopicTemplate,
+			values: map[string]string{TopicFieldBsEui: "0102030405060708", TopicFieldEventType: "ul"},
+			want:   "test/bssci/0102030405060708/event/+/ul",
+		},
+		{
+			name: "state",
+			tmpl: testStateTopicTemplate,
+			want: "test/bssci/+/state",
+		},
+		{
+			name:    "invalid",
+			tmpl:    "{{ .BsEui",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SubscriptionTopic(tt.tmpl, tt.values)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPublishTopic(t *testing.T) {
+	values := map[string]string{TopicFieldBsEui: "0102030405060708"}
+
+	got, err := PublishTopic(testCommandTopicTemplate, values, "vm_activate")
+	assert.NoError(t, err)
+	assert.Equal(t, "test/bssci/0102030405060708/command/vm_activate", got)
+
+	got, err = PublishTopic("cmd/{{ .BsEui }}/+/x", values, "status")
+	assert.NoError(t, err)
+	assert.Equal(t, "cmd/0102030405060708/status/x", got)
+
+	_, err = PublishTopic("{{ .BsEui", values, "status")
+	assert.Error(t, err)
+}
+
+func TestTopicMatcher(t *testing.T) {
+	tests := []struct {
+		name   string
+		tmpl   string
+		topic  string
+		want   map[string]string
+		wantOk bool
+	}{
+		{
+			name:  "event",
+			tmpl:  testEventTopicTemplate,
+			topic: "test/bssci/0102030405060708/event/ep/ul",
+			want: map[string]string{
+				TopicFieldBsEui:       "0102030405060708",
+				TopicFieldEventSource: "ep",
+				TopicFieldEventType:   "ul",
+			},
+			wantOk: true,
+		},
+		{
+			name:   "state",
+			tmpl:   testStateTopicTemplate,
+			topic:  "test/bssci/0102030405060708/state",
+			want:   map[string]string{TopicFieldBsEui: "0102030405060708"},
+			wantOk: true,
+		},
+		{
+			name:  "special characters",
+			tmpl:  "a.b+/{{ .BsEui }}/{{ .EventType }}",
+			topic: "a.b+/0102030405060708/ul",
+			want: map[string]string{
+				TopicFieldBsEui:     "0102030405060708",
+				TopicFieldEventType: "ul",
+			},
+			wantOk: true,
+		},
+		{
+			name:  "repeated field",
+			tmpl:  "{{ .BsEui }}/{{ .EventType }}/{{ .BsEui }}",
+			topic: "0102030405060708/ul/0102030405060708",
+			want: map[string]string{
+				TopicFieldBsEui:     "0102030405060708",
+				TopicFieldEventType: "ul",
+			},
+			wantOk: true,
+		},
+		{
+			name:  "other topic",
+			tmpl:  testEventTopicTemplate,
+			topic: "test/bssci/0102030405060708/state",
+		},
+		{
+			name:  "multiple levels",
+			tmpl:  testEventTopicTemplate,
+			topic: "test/bssci/0102030405060708/event/ep/ul/extra",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewTopicMatcher(tt.tmpl)
+			require.NoError(t, err)
+
+			got, ok := m.Match(tt.topic)
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package mqttv5
+
+import (
+	"sync"
+
+	"github.com/eclipse/paho.golang/paho"
+)
+
+// Assigns topic aliases to the topics of high volume events.
+//
+// The broker only learns an alias from a message carrying both the topic and the alias,
+// aliased messages are therefore sent one at a time and an alias is only used without
+// its topic after it was published successfully. Aliases are only valid for the current
+// connection and are not used with qos > 0, as those messages may be resent on a new
+// connection.
+type topicAliases struct {
+	mux     sync.Mutex
+	events  map[string]struct{}
+	maximum uint16
+	aliases map[string]uint16
+}
+
+func newTopicAliases(events []string) *topicAliases {
+	a := topicAliases{
+		events:  make(map[string]struct{}),
+		aliases: make(map[string]uint16),
+	}
+	for _, event := range events {
+		a.events[event] = struct{}{}
+	}
+	return &a
+}
+
+// Forget all aliases, maximum is the topic alias maximum of the new connection
+func (a *topicAliases) reset(maximum uint16) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	a.maximum = maximum
+	a.aliases = make(map[string]uint16)
+}
+
+// Publish the message of an event, using a topic alias if enabled for the event
+func (a *topicAliases) publish(event string, p *paho.Publish, publish func(*paho.Publish) error) error {
+	if _, ok := a.events[event]; !ok || p.QoS != 0 {
+		return publish(p)
+	}
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	topic := p.Topic
+	if p.Properties == nil {
+		p.Properties = &paho.PublishProperties{}
+	}
+
+	if alias, ok := a.aliases[topic]; ok {
+		p.Topic = ""
+		p.Properties.TopicAlias = &alias
+		return publish(p)
+	}
+
+	// all aliases in use, fall back to the plain topic
+	if len(a.aliases) >= int(a.maximum) {
+		return publish(p)
+	}
+
+	alias := uint16(len(a.aliases) + 1)
+	p.Properties.TopicAlias = &alias
+	if err := publish(p); err != nil {
+		return err
+	}
+	a.aliases[topic] = alias
+	return nil
+}
@@ -0,0 +1,125 @@
+package mqttv5
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/stretchr/testify/assert"
+)
+
+// records the topic and alias of each published message
+type aliasRecorder struct {
+	topics  []string
+	aliases []uint16
+	err     error
+}
+
+func (r *aliasRecorder) publish(p *paho.Publish) error {
+	if r.err != nil {
+		return r.err
+	}
+	var alias uint16
+	if p.Properties != nil && p.Properties.TopicAlias != nil {
+		alias = *p.Properties.TopicAlias
+	}
+	r.topics = append(r.topics, p.Topic)
+	r.aliases = append(r.aliases, alias)
+	return nil
+}
+
+func TestTopicAliases(t *testing.T) {
+	tests := []struct {
+		name        string
+		maximum     uint16
+		event       string
+		qos         byte
+		topics      []string
+		wantTopics  []string
+		wantAliases []uint16
+	}{
+		{
+			name:        "alias after first publish",
+			maximum:     10,
+			event:       "ul",
+			topics:      []string{"a", "a", "b", "a", "b"},
+			wantTopics:  []string{"a", "", "b", "", ""},
+			wantAliases: []uint16{1, 1, 2, 1, 2},
+		},
+		{
+			name:        "event not selected",
+			maximum:     10,
+			event:       "status",
+			topics:      []string{"a", "a"},
+			wantTopics:  []string{"a", "a"},
+			wantAliases: []uint16{0, 0},
+		},
+		{
+			name:        "qos 1",
+			maximum:     10,
+			event:       "ul",
+			qos:         1,
+			topics:      []string{"a", "a"},
+			wantTopics:  []string{"a", "a"},
+			wantAliases: []uint16{0, 0},
+		},
+		{
+			name:        "not supported by broker",
+			maximum:     0,
+			event:       "ul",
+			topics:      []string{"a", "a"},
+			wantTopics:  []string{"a", "a"},
+			wantAliases: []uint16{0, 0},
+		},
+		{
+			name:        "maximum reached",
+			maximum:     1,
+			event:       "ul",
+			topics:      []string{"a", "b", "b", "a"},
+			wantTopics:  []string{"a", "b", "b", ""},
+			wantAliases: []uint16{1, 0, 0, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newTopicAliases([]string{"ul"})
+			a.reset(tt.maximum)
+
+			var r aliasRecorder
+			for _, topic := range tt.topics {
+				err := a.publish(tt.event, &paho.Publish{Topic: topic, QoS: tt.qos}, r.publish)
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantTopics, r.topics)
+			assert.Equal(t, tt.wantAliases, r.aliases)
+		})
+	}
+}
+
+func TestTopicAliases_failedPublish(t *testing.T) {
+	a := newTopicAliases([]string{"ul"})
+	a.reset(10)
+
+	// the alias is not known to the broker if the publish failed
+	r := aliasRecorder{err: errors.New("connection lost")}
+	assert.Error(t, a.publish("ul", &paho.Publish{Topic: "a"}, r.publish))
+
+	r.err = nil
+	assert.NoError(t, a.publish("ul", &paho.Publish{Topic: "a"}, r.publish))
+	assert.Equal(t, []string{"a"}, r.topics)
+	assert.Equal(t, []uint16{1}, r.aliases)
+}
+
+func TestTopicAliases_reset(t *testing.T) {
+	a := newTopicAliases([]string{"ul"})
+	a.reset(10)
+
+	var r aliasRecorder
+	assert.NoError(t, a.publish("ul", &paho.Publish{Topic: "a"}, r.publish))
+
+	// a new connection does not know the aliases of the previous one
+	a.reset(10)
+	assert.NoError(t, a.publish("ul", &paho.Publish{Topic: "a"}, r.publish))
+	assert.Equal(t, []string{"a", "a"}, r.topics)
+	assert.Equal(t, []uint16{1, 1}, r.aliases)
+}
@@ -0,0 +1,856 @@
+// Package mqttv5 implements an MQTT 5 integration.
+//
+// Topics and payloads are the same as for the MQTT 3.1.1 integration. Additionally, messages
+// carry user properties and a content type, commands may request their result on a response
+// topic, downlink commands are revoked once their message expiry passed and high volume events
+// are published using topic aliases.
+package mqttv5
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/auth"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/mqtt"
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+)
+
+const (
+	eventSourceEndpoint    = "ep"
+	eventSourceBasestation = "bs"
+)
+
+// User properties set on published messages
+const (
+	userPropertyBsEui       = "bs_eui"
+	userPropertyEventSource = "event_source"
+	userPropertyEventType   = "event_type"
+)
+
+// Integration implements a MQTT 5 Integration.
+type Integration struct {
+	conn       *autopaho.ConnectionManager
+	connConfig autopaho.ClientConfig
+	connected  atomic.Bool
+	router     *paho.StandardRouter
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	serverCommandHandler  func(*bs.ServerCommand)
+	serverResponseHandler func(*bs.ServerResponse)
+
+	// basestation served exclusively, set if the client id is a basestation EUI
+	bsEui *common.EUI64
+
+	basestationsMux         sync.RWMutex
+	basestations            map[common.EUI64]struct{}
+	subscriptions           *mqtt.Subscriptions
+	terminateOnConnectError bool
+	stateRetained           bool
+	publishTimeout          time.Duration
+	commandResultTimeout    time.Duration
+
+	qos uint8
+	// qos of the command and response subscriptions
+	subscribeQOS uint8
+	// qos and retain flag per event type
+	eventOptions mqtt.EventOptions
+
+	eventTopicTemplate    *template.Template
+	stateTopicTemplate    *template.Template
+	commandTopicTemplate  *template.Template
+	responseTopicTemplate *template.Template
+
+	marshal     func(msg proto.Message) ([]byte, error)
+	unmarshal   func(b []byte, msg proto.Message) error
+	contentType string
+
+	aliases  *topicAliases
+	requests requests
+}
+
+// NewIntegration creates a new Integration.
+func NewIntegration(conf config.Config) (*Integration, error) {
+	var err error
+	c := conf.Integration.MQTTV5
+
+	integ := Integration{
+		router:                  paho.NewStandardRouter(),
+		qos:                     c.Auth.Generic.QOS,
+		terminateOnConnectError: c.TerminateOnConnectError,
+		basestations:            make(map[common.EUI64]struct{}),
+		stateRetained:           c.StateRetained,
+		publishTimeout:          c.PublishTimeout,
+		commandResultTimeout:    c.CommandResultTimeout,
+		aliases:                 newTopicAliases(c.TopicAliasEvents),
+	}
+	integ.ctx, integ.cancel = context.WithCancel(context.Background())
+	integ.subscriptions = mqtt.NewSubscriptions(mqtt.SubscriptionOptions{
+		Subscribe:   integ.subscribeBasestations,
+		Unsubscribe: integ.unsubscribeBasestations,
+		OnChange:    integ.publishSubscriptionState,
+		IsConnected: integ.IsConnected,
+		Pending:     mqttSubscriptionPendingGauge(),
+	})
+
+	// set event options
+	integ.eventOptions, err = mqtt.NewEventOptions(integ.qos, c.EventQOS, c.RetainedEvents)
+	if err != nil {
+		return nil, errors.Wrap(err, "event qos error")
+	}
+	integ.subscribeQOS, err = mqtt.SubscribeQOS(integ.qos, c.SubscribeQOS)
+	if err != nil {
+		return nil, err
+	}
+
+	// set marshaler
+	if integ.marshal, err = mqtt.Marshaler(conf.Integration.Marshaler); err != nil {
+		return nil, err
+	}
+	if integ.unmarshal, err = mqtt.Unmarshaler(conf.Integration.Marshaler); err != nil {
+		return nil, err
+	}
+	integ.contentType = mqtt.ContentType(conf.Integration.Marshaler)
+
+	// set topic templates
+	integ.eventTopicTemplate, err = template.New("event").Parse(c.EventTopicTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse event topic template error")
+	}
+	integ.stateTopicTemplate, err = template.New("state").Parse(c.StateTopicTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse state topic template error")
+	}
+	integ.commandTopicTemplate, err = template.New("command").Parse(c.CommandTopicTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse command topic template error")
+	}
+	integ.responseTopicTemplate, err = template.New("response").Parse(c.ResponseTopicTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse response topic template error")
+	}
+
+	// set authentication
+	if c.Auth.Type != "generic" {
+		return nil, errors.Errorf("unknown auth type: %s", c.Auth.Type)
+	}
+	tlsConfig, err := auth.NewTLSConfig(c.Auth.Generic.CACert, c.Auth.Generic.TLSCert, c.Auth.Generic.TLSKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "new tls config error")
+	}
+	var serverUrls []*url.URL
+	for _, server := range c.Auth.Generic.Servers {
+		u, err := url.Parse(server)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse server url error: %s", server)
+		}
+		serverUrls = append(serverUrls, u)
+	}
+
+	if clientID := c.Auth.Generic.ClientID; clientID != "" {
+		var bsEui common.EUI64
+		if err := bsEui.UnmarshalText([]byte(clientID)); err == nil {
+			integ.bsEui = &bsEui
+		}
+	}
+
+	// set mqtt parameters
+	integ.connConfig = autopaho.ClientConfig{
+		ServerUrls:                    serverUrls,
+		TlsCfg:                        tlsConfig,
+		KeepAlive:                     uint16(c.KeepAlive / time.Second),
+		CleanStartOnInitialConnection: c.Auth.Generic.CleanStart,
+		SessionExpiryInterval:         uint32(c.SessionExpiryInterval / time.Second),
+		ConnectRetryDelay:             c.ConnectRetryDelay,
+		ConnectTimeout:                c.ConnectTimeout,
+		ConnectUsername:               c.Auth.Generic.Username,
+		ConnectPassword:               []byte(c.Auth.Generic.Password),
+		ConnectPacketBuilder:          integ.onConnecting,
+		OnConnectionUp:                integ.onConnected,
+		OnConnectionDown:              integ.onConnectionLost,
+		OnConnectError:                integ.onConnectError,
+		ClientConfig: paho.ClientConfig{
+			ClientID:           c.Auth.Generic.ClientID,
+			OnServerDisconnect: integ.onServerDisconnect,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				func(pr paho.PublishReceived) (bool, error) {
+					integ.router.Route(pr.Packet.Packet())
+					return true, nil
+				},
+			},
+		},
+	}
+
+	return &integ, nil
+}
+
+// Start the integration.
+func (integ *Integration) Start() error {
+
+	if bsEui := integ.bsEui; bsEui != nil {
+		logger := log.With().Str("bs_eui", bsEui.String()).Logger()
+
+		logger.Info().Msg("basestation EUI provided by client id")
+
+		// Add basestation EUI to list of gateways we must subscribe to.
+		integ.basestations[*bsEui] = struct{}{}
+		if err := integ.subscriptions.Set(true, *bsEui); err != nil {
+			return errors.Wrap(err, "subscribe basestation error")
+		}
+
+		// set last will and testament.
+		pl := bs.BasestationState{
+			BsEui: bsEui.String(),
+			State: bs.BasestationState_OFFLINE,
+		}
+		bb, err := integ.marshal(&pl)
+		if err != nil {
+			return errors.Wrap(err, "marshal error")
+		}
+
+		topic, err := integ.stateTopic(*bsEui)
+		if err != nil {
+			return err
+		}
+
+		logger.Info().Str("topic", topic).Msg("setting last will and testament")
+
+		props := integ.properties(*bsEui, "", "")
+		integ.connConfig.WillMessage = &paho.WillMessage{Retain: true, QoS: integ.qos, Topic: topic, Payload: bb}
+		integ.connConfig.WillProperties = &paho.WillProperties{ContentType: props.ContentType, User: props.User}
+	}
+
+	var err error
+	integ.conn, err = autopaho.NewConnection(integ.ctx, integ.connConfig)
+	if err != nil {
+		return errors.Wrap(err, "new connection error")
+	}
+
+	// block until the client is connected
+	if err := integ.conn.AwaitConnection(integ.ctx); err != nil {
+		return errors.Wrap(err, "await connection error")
+	}
+
+	integ.subscriptions.Start()
+	go integ.requestLoop()
+	return nil
+}
+
+// Stop the integration.
+func (integ *Integration) Stop() error {
+	integ.subscriptions.Stop()
+
+	integ.basestationsMux.Lock()
+	defer integ.basestationsMux.Unlock()
+
+	// setup ctx logger
+	logger := log.With().Logger()
+	ctx := context.Background()
+	ctx = logger.WithContext(ctx)
+
+	// Set gateway state to offline for all gateways.
+	for bsEui := range integ.basestations {
+		logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+			return c.Str("bs_eui", bsEui.String())
+		})
+
+		pl := bs.BasestationState{
+			BsEui: bsEui.String(),
+			State: bs.BasestationState_OFFLINE,
+		}
+		if err := integ.PublishState(ctx, bsEui, &pl); err != nil {
+			logger.Error().Err(err).Msg("publish state error")
+		}
+	}
+
+	disconnectCtx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+	if err := integ.conn.Disconnect(disconnectCtx); err != nil {
+		log.Warn().Err(err).Msg("mqtt disconnect error")
+	}
+	integ.cancel()
+	return nil
+}
+
+// Updates the subscription for the given EUI.
+func (integ *Integration) SetBasestationSubscription(subscribe bool, bsEui common.EUI64) error {
+
+	logger := log.With().Str("bs_eui", bsEui.String()).Bool("subscribe", subscribe).Logger()
+
+	if id := integ.bsEui; id != nil && *id == bsEui {
+		logger.Debug().Msg("ignoring SetBasestationSubscription as EUI is set by client id")
+		return nil
+	}
+	logger.Debug().Msg("updating basestation subscription")
+
+	integ.basestationsMux.Lock()
+	if err := integ.subscriptions.Set(subscribe, bsEui); err != nil {
+		integ.basestationsMux.Unlock()
+		return err
+	}
+
+	if subscribe {
+		integ.basestations[bsEui] = struct{}{}
+	} else {
+		delete(integ.basestations, bsEui)
+	}
+	integ.basestationsMux.Unlock()
+	logger.Info().Msg("basestation subscription updated")
+
+	if !subscribe {
+		integ.clearRetainedEvents(logger, bsEui)
+	}
+	return nil
+}
+
+// Remove the retained events of a basestation by publishing empty retained messages
+func (integ *Integration) clearRetainedEvents(logger zerolog.Logger, bsEui common.EUI64) {
+	for _, event := range integ.eventOptions.RetainedEvents() {
+		source := mqtt.EventSource(event)
+		topic := bytes.NewBuffer(nil)
+		if err := integ.eventTopicTemplate.Execute(topic, struct {
+			BsEui       common.EUI64
+			EventSource string
+			EventType   string
+		}{bsEui, source, event}); err != nil {
+			logger.Error().Err(err).Str("event", event).Msg("execute event template error")
+			continue
+		}
+		if err := integ.publish(logger.WithContext(context.Background()), event, &paho.Publish{
+			QoS:        integ.eventOptions.QOS(event),
+			Retain:     true,
+			Topic:      topic.String(),
+			Properties: integ.properties(bsEui, source, event),
+		}); err != nil {
+			logger.Error().Err(err).Str("topic", topic.String()).Msg("clear retained event error")
+			continue
+		}
+		logger.Debug().Str("topic", topic.String()).Msg("cleared retained event")
+	}
+}
+
+// Set handler for server command messages
+func (integ *Integration) SetServerCommandHandler(f func(*bs.ServerCommand)) {
+	integ.serverCommandHandler = f
+}
+
+// Set handler for server command messages
+func (integ *Integration) SetServerResponseHandler(f func(*bs.ServerResponse)) {
+	integ.serverResponseHandler = f
+}
+
+// Publish basestation messages.
+func (integ *Integration) PublishState(ctx context.Context, bsEui common.EUI64, pb *bs.BasestationState) error {
+	logger := zerolog.Ctx(ctx)
+
+	if integ.stateTopicTemplate == nil {
+		logger.Debug().Msg("ignoring publish state, no stateTopicTemplate configured")
+		return nil
+	}
+
+	mqttStateCounter().Inc()
+
+	topic, err := integ.stateTopic(bsEui)
+	if err != nil {
+		return err
+	}
+
+	bytes, err := integ.marshal(pb)
+	if err != nil {
+		return errors.Wrap(err, "marshal message error")
+	}
+	logger.Info().Str("topic", topic).Uint8("qos", integ.qos).Msg("publishing state")
+
+	if err := integ.publish(ctx, "", &paho.Publish{
+		QoS:        integ.qos,
+		Retain:     integ.stateRetained,
+		Topic:      topic,
+		Properties: integ.properties(bsEui, "", ""),
+		Payload:    bytes,
+	}); err != nil {
+		return errors.Wrap(err, "publish state error")
+	}
+	logger.Debug().Str("topic", topic).Uint8("qos", integ.qos).Any("data", pb).Msg("published state")
+
+	return nil
+}
+
+// Publish endnode messages.
+func (integ *Integration) PublishEndnodeEvent(bsEui common.EUI64, event string, pb *bs.EndnodeUplink) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceEndpoint).Logger()
+	ctx := context.Background()
+	ctx = logger.WithContext(ctx)
+
+	return integ.publishEvent(ctx, bsEui, eventSourceEndpoint, event, pb)
+}
+
+// Publish basestation messages.
+func (integ *Integration) PublishBasestationEvent(bsEui common.EUI64, event string, pb *bs.BasestationUplink) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceBasestation).Logger()
+	ctx := context.Background()
+	ctx = logger.WithContext(ctx)
+
+	err := integ.publishEvent(ctx, bsEui, eventSourceBasestation, event, pb)
+
+	// complete the commands waiting for this event
+	for _, req := range integ.requests.resolve(bsEui, event, pb) {
+		req.done(pb)
+	}
+	return err
+}
+
+// Publish events generated by the adapter.
+func (integ *Integration) PublishAdapterEvent(bsEui common.EUI64, event string, pb *structpb.Struct) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceBasestation).Logger()
+	ctx := context.Background()
+	ctx = logger.WithContext(ctx)
+
+	return integ.publishEvent(ctx, bsEui, eventSourceBasestation, event, pb)
+}
+
+func (integ *Integration) publishEvent(ctx context.Context, bsEui common.EUI64, source string, event string, pb proto.Message) error {
+	logger := zerolog.Ctx(ctx)
+
+	mqttEventCounter(bsEui.String(), source, event).Inc()
+
+	topic := bytes.NewBuffer(nil)
+	if err := integ.eventTopicTemplate.Execute(topic, struct {
+		BsEui       common.EUI64
+		EventSource string
+		EventType   string
+	}{bsEui, source, event}); err != nil {
+		return errors.Wrap(err, "execute event template error")
+	}
+	topicStr := topic.String()
+
+	bytes, err := integ.marshal(pb)
+	if err != nil {
+		return errors.Wrap(err, "marshal message error")
+	}
+
+	qos := integ.eventOptions.QOS(event)
+	retain := integ.eventOptions.Retain(event)
+	logger.Info().Str("topic", topicStr).Uint8("qos", qos).Bool("retain", retain).Msg("publishing event")
+
+	if err := integ.publish(ctx, event, &paho.Publish{
+		QoS:        qos,
+		Retain:     retain,
+		Topic:      topicStr,
+		Properties: integ.properties(bsEui, source, event),
+		Payload:    bytes,
+	}); err != nil {
+		return err
+	}
+	logger.Debug().Str("topic", topicStr).Uint8("qos", qos).Any("data", pb).Msg("published event")
+	return nil
+}
+
+// Publish the result of a command to the response topic requested by the command
+func (integ *Integration) publishCommandResult(bsEui common.EUI64, event string, responseTopic string, correlationData []byte, pb *bs.BasestationUplink) {
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("topic", responseTopic).Logger()
+	ctx := logger.WithContext(context.Background())
+
+	bytes, err := integ.marshal(pb)
+	if err != nil {
+		logger.Error().Err(err).Msg("marshal command result error")
+		return
+	}
+
+	props := integ.properties(bsEui, eventSourceBasestation, event)
+	props.CorrelationData = correlationData
+	if err := integ.publish(ctx, "", &paho.Publish{
+		QoS:        integ.qos,
+		Topic:      responseTopic,
+		Properties: props,
+		Payload:    bytes,
+	}); err != nil {
+		logger.Error().Err(err).Msg("publish command result error")
+		return
+	}
+	mqttCommandResultCounter("published").Inc()
+	logger.Info().Msg("published command result")
+}
+
+// Publish a message, waiting for the acknowledgement of the broker for qos > 0
+func (integ *Integration) publish(ctx context.Context, event string, p *paho.Publish) error {
+	logger := zerolog.Ctx(ctx)
+
+	publishCtx, cancel := context.WithTimeout(integ.ctx, integ.publishTimeout)
+	defer cancel()
+
+	return integ.aliases.publish(event, p, func(p *paho.Publish) error {
+		pr, err := integ.conn.Publish(publishCtx, p)
+		if pr != nil && p.QoS > 0 {
+			var reason string
+			if pr.Properties != nil {
+				reason = pr.Properties.ReasonString
+			}
+			logReasonCode(logger, packetPuback, pr.ReasonCode, reason)
+		}
+		return err
+	})
+}
+
+// Properties of a published message
+func (integ *Integration) properties(bsEui common.EUI64, source string, event string) *paho.PublishProperties {
+	props := paho.PublishProperties{ContentType: integ.contentType}
+	props.User.Add(userPropertyBsEui, bsEui.String())
+	if source != "" {
+		props.User.Add(userPropertyEventSource, source)
+	}
+	if event != "" {
+		props.User.Add(userPropertyEventType, event)
+	}
+	return &props
+}
+
+func (integ *Integration) stateTopic(bsEui common.EUI64) (string, error) {
+	topic := bytes.NewBuffer(nil)
+	if err := integ.stateTopicTemplate.Execute(topic, struct {
+		BsEui common.EUI64
+	}{bsEui}); err != nil {
+		return "", errors.Wrap(err, "execute state template error")
+	}
+	return topic.String(), nil
+}
+
+func (integ *Integration) onConnecting(connect *paho.Connect, u *url.URL) (*paho.Connect, error) {
+	// aliases of a previous connection are not valid anymore
+	integ.aliases.reset(0)
+	return connect, nil
+}
+
+func (integ *Integration) onConnected(cm *autopaho.ConnectionManager, connack *paho.Connack) {
+	mqttConnectCounter().Inc()
+	log.Info().Bool("session_present", connack.SessionPresent).Msg("connected to mqtt broker")
+
+	var reason string
+	var topicAliasMaximum uint16
+	if connack.Properties != nil {
+		reason = connack.Properties.ReasonString
+		if connack.Properties.TopicAliasMaximum != nil {
+			topicAliasMaximum = *connack.Properties.TopicAliasMaximum
+		}
+	}
+	logReasonCode(&log.Logger, packetConnack, connack.ReasonCode, reason)
+	integ.aliases.reset(topicAliasMaximum)
+
+	integ.connected.Store(true)
+	integ.subscriptions.Reset()
+}
+
+// IsConnected returns true when the client is connected to the broker.
+func (integ *Integration) IsConnected() bool {
+	return integ.connected.Load()
+}
+
+func (integ *Integration) onConnectionLost() bool {
+	integ.connected.Store(false)
+	if integ.terminateOnConnectError {
+		log.Fatal().Msg("mqtt connection lost")
+	}
+	mqttDisconnectCounter().Inc()
+	log.Error().Msg("mqtt connection lost")
+	return true
+}
+
+func (integ *Integration) onConnectError(err error) {
+	var connackErr *autopaho.ConnackError
+	if errors.As(err, &connackErr) {
+		logReasonCode(&log.Logger, packetConnack, connackErr.ReasonCode, connackErr.Reason)
+	}
+	if integ.terminateOnConnectError {
+		log.Fatal().Err(err).Msg("mqtt connection error")
+	}
+	log.Error().Err(err).Msg("mqtt connection error")
+}
+
+func (integ *Integration) onServerDisconnect(d *paho.Disconnect) {
+	var reason string
+	if d.Properties != nil {
+		reason = d.Properties.ReasonString
+	}
+	logReasonCode(&log.Logger, packetDisconnect, d.ReasonCode, reason)
+}
+
+// Publish the state of a basestation after its subscription changed
+func (integ *Integration) publishSubscriptionState(bsEui common.EUI64, subscribed bool) error {
+	logger := log.With().Str("bs_eui", bsEui.String()).Logger()
+	ctx := logger.WithContext(context.Background())
+
+	pl := bs.BasestationState{
+		BsEui: bsEui.String(),
+		State: bs.BasestationState_OFFLINE,
+	}
+	if subscribed {
+		pl.State = bs.BasestationState_ONLINE
+	}
+
+	if err := integ.PublishState(ctx, bsEui, &pl); err != nil {
+		logger.Error().Err(err).Msg("publish basestation error")
+		return err
+	}
+	return nil
+}
+
+// complete the commands whose result did not arrive in time
+func (integ *Integration) requestLoop() {
+	for {
+		select {
+		case <-integ.ctx.Done():
+			return
+		case <-time.After(time.Millisecond * 100):
+		}
+
+		for _, req := range integ.requests.expire(time.Now()) {
+			req.done(nil)
+		}
+	}
+}
+
+// Command and response topic of a basestation
+func (integ *Integration) basestationTopics(bsEui common.EUI64) (string, string, error) {
+	commandTopic, err := executeBasestationTemplate(integ.commandTopicTemplate, bsEui)
+	if err != nil {
+		return "", "", errors.Wrap(err, "execute command topic template error")
+	}
+	responseTopic, err := executeBasestationTemplate(integ.responseTopicTemplate, bsEui)
+	if err != nil {
+		return "", "", errors.Wrap(err, "execute response topic template error")
+	}
+	return commandTopic, responseTopic, nil
+}
+
+// Subscribe to the command and response topics of the basestations with one SUBSCRIBE packet
+func (integ *Integration) subscribeBasestations(bsEuis []common.EUI64) ([]common.EUI64, error) {
+	logger := log.With().Int("basestations", len(bsEuis)).Logger()
+
+	subscriptions := make([]paho.SubscribeOptions, 0, 2*len(bsEuis))
+	for _, bsEui := range bsEuis {
+		commandTopic, responseTopic, err := integ.basestationTopics(bsEui)
+		if err != nil {
+			return nil, err
+		}
+
+		// register the handlers first, messages may arrive before the suback
+		integ.router.UnregisterHandler(commandTopic)
+		integ.router.UnregisterHandler(responseTopic)
+		integ.router.RegisterHandler(commandTopic, integ.handleServerCommand)
+		integ.router.RegisterHandler(responseTopic, integ.handleServerResponse)
+
+		subscriptions = append(subscriptions,
+			paho.SubscribeOptions{Topic: commandTopic, QoS: integ.subscribeQOS},
+			paho.SubscribeOptions{Topic: responseTopic, QoS: integ.subscribeQOS},
+		)
+	}
+	logger.Info().Uint8("qos", integ.subscribeQOS).Msg("subscribing to topics")
+
+	subscribeCtx, cancel := context.WithTimeout(integ.ctx, integ.publishTimeout)
+	defer cancel()
+
+	// fails if one of the subscriptions is rejected, the suback holds the reason per topic
+	suback, err := integ.conn.Subscribe(subscribeCtx, &paho.Subscribe{Subscriptions: subscriptions})
+	if suback != nil {
+		var reason string
+		if suback.Properties != nil {
+			reason = suback.Properties.ReasonString
+		}
+		for _, code := range suback.Reasons {
+			logReasonCode(&logger, packetSuback, code, reason)
+		}
+		if rejected, ok := rejectedBasestations(bsEuis, suback.Reasons); ok {
+			logger.Debug().Int("rejected", len(rejected)).Uint8("qos", integ.subscribeQOS).Msg("subscribed to topics")
+			return rejected, nil
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "subscribe topics error")
+	}
+	logger.Debug().Uint8("qos", integ.subscribeQOS).Msg("subscribed to topics")
+
+	return nil, nil
+}
+
+func (integ *Integration) handleServerCommand(p *paho.Publish) {
+	logger := log.With().Str("topic", p.Topic).Logger()
+	logger.Debug().Msg("received message for command handler")
+
+	var pb bs.ServerCommand
+
+	if err := integ.unmarshal(p.Payload, &pb); err != nil {
+		logger.Error().Err(err).Msg("unmarshal server command error")
+		return
+	}
+
+	// track the command before it is handled to not miss its result
+	if p.Properties != nil {
+		integ.trackCommand(logger, &pb, p.Properties)
+	}
+
+	integ.serverCommandHandler(&pb)
+}
+
+// Wait for the result of a command requesting a response or carrying an expiring downlink
+func (integ *Integration) trackCommand(logger zerolog.Logger, pb *bs.ServerCommand, props *paho.PublishProperties) {
+	if props.ResponseTopic == "" && props.MessageExpiry == nil {
+		return
+	}
+	bsEui, err := common.Eui64FromHexString(pb.GetBsEui())
+	if err != nil {
+		logger.Warn().Err(err).Msg("invalid bs eui, not tracking command result")
+		return
+	}
+	result, ok := mqtt.CommandResultOf(pb)
+
+	if props.ResponseTopic != "" {
+		if !ok {
+			logger.Warn().Str("response_topic", props.ResponseTopic).Msg("no result is published for the command, ignoring response topic")
+		} else {
+			responseTopic := props.ResponseTopic
+			correlationData := props.CorrelationData
+			integ.requests.add(&pendingRequest{
+				bsEui:    bsEui,
+				result:   result,
+				deadline: time.Now().Add(integ.commandResultTimeout),
+				done: func(up *bs.BasestationUplink) {
+					if up == nil {
+						mqttCommandResultCounter("timeout").Inc()
+						logger.Warn().Str("response_topic", responseTopic).Msg("no command result within timeout")
+						return
+					}
+					integ.publishCommandResult(bsEui, string(result.EventType), responseTopic, correlationData, up)
+				},
+			})
+		}
+	}
+
+	// revoke the downlink if it was not sent before the message expired
+	if dl := pb.GetDlDataQue(); dl != nil && props.MessageExpiry != nil {
+		expiry := time.Duration(*props.MessageExpiry) * time.Second
+		integ.requests.add(&pendingRequest{
+			bsEui:    bsEui,
+			result:   result,
+			deadline: time.Now().Add(expiry),
+			done: func(up *bs.BasestationUplink) {
+				if up != nil {
+					return
+				}
+				mqttDownlinkExpiredCounter().Inc()
+				logger.Info().Str("endnode_eui", dl.GetEndnodeEui()).Uint64("dl_que_id", dl.GetDlQueId()).Msg("downlink expired, revoking")
+				integ.serverCommandHandler(&bs.ServerCommand{
+					BsEui: pb.GetBsEui(),
+					Command: &bs.ServerCommand_DlDataRev{DlDataRev: &bs.RevokeDownlink{
+						EndnodeEui: dl.GetEndnodeEui(),
+						DlQueId:    dl.GetDlQueId(),
+					}},
+				})
+			},
+		})
+	}
+}
+
+func (integ *Integration) handleServerResponse(p *paho.Publish) {
+	logger := log.With().Str("topic", p.Topic).Logger()
+	logger.Debug().Msg("received message for response handler")
+
+	var pb bs.ServerResponse
+
+	if err := integ.unmarshal(p.Payload, &pb); err != nil {
+		logger.Error().Err(err).Msg("unmarshal server response error")
+		return
+	}
+
+	integ.serverResponseHandler(&pb)
+}
+
+// Unsubscribe from the command and response topics of the basestations with one UNSUBSCRIBE packet
+func (integ *Integration) unsubscribeBasestations(bsEuis []common.EUI64) ([]common.EUI64, error) {
+	logger := log.With().Int("basestations", len(bsEuis)).Logger()
+
+	topics := make([]string, 0, 2*len(bsEuis))
+	for _, bsEui := range bsEuis {
+		commandTopic, responseTopic, err := integ.basestationTopics(bsEui)
+		if err != nil {
+			return nil, err
+		}
+		topics = append(topics, commandTopic, responseTopic)
+	}
+	logger.Info().Msg("unsubscribing from topics")
+
+	unsubscribeCtx, cancel := context.WithTimeout(integ.ctx, integ.publishTimeout)
+	defer cancel()
+
+	unsuback, err := integ.conn.Unsubscribe(unsubscribeCtx, &paho.Unsubscribe{Topics: topics})
+	var rejected []common.EUI64
+	if unsuback != nil {
+		var reason string
+		if unsuback.Properties != nil {
+			reason = unsuback.Properties.ReasonString
+		}
+		for _, code := range unsuback.Reasons {
+			logReasonCode(&logger, packetUnsuback, code, reason)
+		}
+		var ok bool
+		if rejected, ok = rejectedBasestations(bsEuis, unsuback.Reasons); ok {
+			err = nil
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "unsubscribe topics error")
+	}
+	for i, topic := range topics {
+		if !slices.Contains(rejected, bsEuis[i/2]) {
+			integ.router.UnregisterHandler(topic)
+		}
+	}
+
+	logger.Debug().Int("rejected", len(rejected)).Msg("unsubscribed from topics")
+
+	return rejected, nil
+}
+
+// Basestations with a rejected command or response topic, reasons holds the reason code
+// of each topic in the order of the basestation topics. False if the reasons do not match
+// the topics.
+func rejectedBasestations(bsEuis []common.EUI64, reasons []byte) ([]common.EUI64, bool) {
+	if len(reasons) != 2*len(bsEuis) {
+		return nil, false
+	}
+	var rejected []common.EUI64
+	for i, bsEui := range bsEuis {
+		if reasons[2*i] >= 0x80 || reasons[2*i+1] >= 0x80 {
+			rejected = append(rejected, bsEui)
+		}
+	}
+	return rejected, true
+}
+
+func executeBasestationTemplate(tmpl *template.Template, bsEui common.EUI64) (string, error) {
+	topic := bytes.NewBuffer(nil)
+	if err := tmpl.Execute(topic, struct{ BsEui common.EUI64 }{bsEui}); err != nil {
+		return "", err
+	}
+	return topic.String(), nil
+}
@@ -0,0 +1,128 @@
+package mqttv5
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestIntegration(t *testing.T) *Integration {
+	var conf config.Config
+	conf.Integration.Marshaler = "json"
+	conf.Integration.MQTTV5.EventTopicTemplate = "bssci/{{ .BsEui }}/event/{{ .EventSource }}/{{ .EventType }}"
+	conf.Integration.MQTTV5.StateTopicTemplate = "bssci/{{ .BsEui }}/state"
+	conf.Integration.MQTTV5.CommandTopicTemplate = "bssci/{{ .BsEui }}/command/#"
+	conf.Integration.MQTTV5.ResponseTopicTemplate = "bssci/{{ .BsEui }}/response/#"
+	conf.Integration.MQTTV5.CommandResultTimeout = time.Minute
+	conf.Integration.MQTTV5.Auth.Type = "generic"
+	conf.Integration.MQTTV5.Auth.Generic.Servers = []string{"tcp://127.0.0.1:1883"}
+
+	integ, err := NewIntegration(conf)
+	require.NoError(t, err)
+	return integ
+}
+
+func TestNewIntegration_invalidConfig(t *testing.T) {
+	var conf config.Config
+	conf.Integration.Marshaler = "json"
+	conf.Integration.MQTTV5.Auth.Type = "unknown"
+	_, err := NewIntegration(conf)
+	assert.Error(t, err)
+
+	conf.Integration.MQTTV5.Auth.Type = "generic"
+	conf.Integration.MQTTV5.Auth.Generic.Servers = []string{"://invalid"}
+	_, err = NewIntegration(conf)
+	assert.Error(t, err)
+
+	conf.Integration.MQTTV5.Auth.Generic.Servers = []string{"tcp://127.0.0.1:1883"}
+	conf.Integration.MQTTV5.EventQOS = map[string]uint8{"ul": 3}
+	_, err = NewIntegration(conf)
+	assert.Error(t, err)
+
+	conf.Integration.MQTTV5.EventQOS = nil
+	conf.Integration.MQTTV5.SubscribeQOS = 3
+	_, err = NewIntegration(conf)
+	assert.Error(t, err)
+}
+
+func TestIntegration_properties(t *testing.T) {
+	integ := newTestIntegration(t)
+
+	props := integ.properties(common.EUI64{1, 2, 3, 4, 5, 6, 7, 8}, eventSourceEndpoint, "ul")
+	assert.Equal(t, "application/json", props.ContentType)
+	assert.Equal(t, "0102030405060708", props.User.Get(userPropertyBsEui))
+	assert.Equal(t, eventSourceEndpoint, props.User.Get(userPropertyEventSource))
+	assert.Equal(t, "ul", props.User.Get(userPropertyEventType))
+}
+
+func TestIntegration_downlinkExpiry(t *testing.T) {
+	integ := newTestIntegration(t)
+	var commands []*bs.ServerCommand
+	integ.SetServerCommandHandler(func(pb *bs.ServerCommand) {
+		commands = append(commands, pb)
+	})
+
+	newCommand := func(dlQueId uint64) *bs.ServerCommand {
+		return &bs.ServerCommand{
+			BsEui:   "0102030405060708",
+			Command: &bs.ServerCommand_DlDataQue{DlDataQue: &bs.EnqueDownlink{EndnodeEui: "1112131415161718", DlQueId: dlQueId}},
+		}
+	}
+	expiry := uint32(1)
+	integ.trackCommand(zerolog.Nop(), newCommand(1), &paho.PublishProperties{MessageExpiry: &expiry})
+	integ.trackCommand(zerolog.Nop(), newCommand(2), &paho.PublishProperties{MessageExpiry: &expiry})
+
+	// the first downlink is sent in time
+	bsEui := common.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	dlRes := &bs.BasestationUplink{Message: &bs.BasestationUplink_DlRes{
+		DlRes: &bs.BasestationDownlinkResult{EpEui: "1112131415161718", DlQueId: 1},
+	}}
+	for _, req := range integ.requests.resolve(bsEui, "dl", dlRes) {
+		req.done(dlRes)
+	}
+	for _, req := range integ.requests.expire(time.Now().Add(2 * time.Second)) {
+		req.done(nil)
+	}
+
+	require.Len(t, commands, 1)
+	assert.Equal(t, "0102030405060708", commands[0].GetBsEui())
+	assert.Equal(t, "1112131415161718", commands[0].GetDlDataRev().GetEndnodeEui())
+	assert.Equal(t, uint64(2), commands[0].GetDlDataRev().GetDlQueId())
+}
+
+func TestIntegration_trackCommand_noResult(t *testing.T) {
+	integ := newTestIntegration(t)
+
+	// activating a variable MAC has no result event
+	integ.trackCommand(zerolog.Nop(), &bs.ServerCommand{
+		BsEui:   "0102030405060708",
+		Command: &bs.ServerCommand_VmActivate{VmActivate: &bs.EnableVariableMac{MacType: 1}},
+	}, &paho.PublishProperties{ResponseTopic: "reply"})
+	assert.Empty(t, integ.requests.pending)
+
+	integ.trackCommand(zerolog.Nop(), &bs.ServerCommand{
+		BsEui:   "0102030405060708",
+		Command: &bs.ServerCommand_ReqStatus{ReqStatus: &bs.RequestStatus{}},
+	}, &paho.PublishProperties{ResponseTopic: "reply", CorrelationData: []byte{1}})
+	assert.Len(t, integ.requests.pending, 1)
+}
+
+func TestRejectedBasestations(t *testing.T) {
+	bsEuis := []common.EUI64{{1}, {2}, {3}}
+
+	rejected, ok := rejectedBasestations(bsEuis, []byte{0x01, 0x01, 0x87, 0x01, 0x01, 0x80})
+	assert.True(t, ok)
+	assert.Equal(t, []common.EUI64{{2}, {3}}, rejected)
+
+	// the reason codes can not be matched to the basestations
+	_, ok = rejectedBasestations(bsEuis, []byte{0x87})
+	assert.False(t, ok)
+}
@@ -0,0 +1,82 @@
+package mqttv5
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	pc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_mqtt_v5_event_count",
+		Help: "The number of gateway events published by the MQTT v5 integration (per subscriber, source, event).",
+	}, []string{"basestation", "source", "event"})
+
+	sc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_mqtt_v5_state_count",
+		Help: "The number of gateway states published by the MQTT v5 integration",
+	})
+
+	mqttc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_mqtt_v5_connect_count",
+		Help: "The number of times the integration connected to the MQTT broker.",
+	})
+
+	mqttd = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_mqtt_v5_disconnect_count",
+		Help: "The number of times the integration disconnected from the MQTT broker.",
+	})
+
+	rc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_mqtt_v5_reason_code_count",
+		Help: "The number of reason codes received from the MQTT broker (per packet, reason code).",
+	}, []string{"packet", "reason_code"})
+
+	cr = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_mqtt_v5_command_result_count",
+		Help: "The number of command results published to a response topic or timed out (per result).",
+	}, []string{"result"})
+
+	de = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_mqtt_v5_downlink_expired_count",
+		Help: "The number of downlinks revoked because their message expiry passed.",
+	})
+
+	sp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "integration_mqtt_v5_subscription_pending_count",
+		Help: "The number of basestations with a pending subscribe or unsubscribe.",
+	})
+)
+
+func mqttEventCounter(c string, s string, e string) prometheus.Counter {
+	return pc.With(prometheus.Labels{"basestation": c, "source": s, "event": e})
+}
+
+func mqttStateCounter() prometheus.Counter {
+	return sc
+}
+
+func mqttConnectCounter() prometheus.Counter {
+	return mqttc
+}
+
+func mqttDisconnectCounter() prometheus.Counter {
+	return mqttd
+}
+
+func mqttReasonCodeCounter(packet string, code byte) prometheus.Counter {
+	return rc.With(prometheus.Labels{"packet": packet, "reason_code": fmt.Sprintf("0x%02x", code)})
+}
+
+func mqttCommandResultCounter(result string) prometheus.Counter {
+	return cr.With(prometheus.Labels{"result": result})
+}
+
+func mqttDownlinkExpiredCounter() prometheus.Counter {
+	return de
+}
+
+func mqttSubscriptionPendingGauge() prometheus.Gauge {
+	return sp
+}
@@ -0,0 +1,53 @@
+package mqttv5
+
+import (
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/rs/zerolog"
+)
+
+// Packets carrying reason codes
+const (
+	packetConnack    = "connack"
+	packetPuback     = "puback"
+	packetSuback     = "suback"
+	packetUnsuback   = "unsuback"
+	packetDisconnect = "disconnect"
+)
+
+// Reason codes from 0x80 on indicate a failure
+const reasonCodeFailure = 0x80
+
+// Human readable meaning of a reason code
+func reasonString(packet string, code byte) string {
+	switch packet {
+	case packetConnack:
+		return (&packets.Connack{ReasonCode: code}).Reason()
+	case packetPuback:
+		return (&packets.Puback{ReasonCode: code}).Reason()
+	case packetSuback:
+		return (&packets.Suback{Reasons: []byte{code}}).Reason(0)
+	case packetUnsuback:
+		return (&packets.Unsuback{Reasons: []byte{code}}).Reason(0)
+	case packetDisconnect:
+		return (&packets.Disconnect{ReasonCode: code}).Reason()
+	default:
+		return ""
+	}
+}
+
+// Count a received reason code and log it if it indicates a failure
+//
+// The reason string sent by the broker is logged if given.
+func logReasonCode(logger *zerolog.Logger, packet string, code byte, serverReason string) {
+	mqttReasonCodeCounter(packet, code).Inc()
+
+	event := logger.Debug()
+	if code >= reasonCodeFailure {
+		event = logger.Warn()
+	}
+	event = event.Str("packet", packet).Uint8("reason_code", code).Str("reason", reasonString(packet, code))
+	if serverReason != "" {
+		event = event.Str("server_reason", serverReason)
+	}
+	event.Msg("received reason code")
+}
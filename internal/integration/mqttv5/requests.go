@@ -0,0 +1,71 @@
+package mqttv5
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/mqtt"
+
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+)
+
+// A command waiting for its result event
+type pendingRequest struct {
+	bsEui    common.EUI64
+	result   mqtt.CommandResult
+	deadline time.Time
+	// called with the result event, or with nil once the deadline passed
+	done func(*bs.BasestationUplink)
+}
+
+// Commands waiting for their result events
+type requests struct {
+	mux     sync.Mutex
+	pending []*pendingRequest
+}
+
+func (r *requests) add(req *pendingRequest) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.pending = append(r.pending, req)
+}
+
+// Remove and return the requests the event is the result of
+func (r *requests) resolve(bsEui common.EUI64, event string, pb *bs.BasestationUplink) []*pendingRequest {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	var resolved []*pendingRequest
+	pending := r.pending[:0]
+	for _, req := range r.pending {
+		if req.bsEui == bsEui && string(req.result.EventType) == event && req.result.Match(pb) {
+			resolved = append(resolved, req)
+		} else {
+			pending = append(pending, req)
+		}
+	}
+	clear(r.pending[len(pending):])
+	r.pending = pending
+	return resolved
+}
+
+// Remove and return the requests with a deadline before now
+func (r *requests) expire(now time.Time) []*pendingRequest {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	var expired []*pendingRequest
+	pending := r.pending[:0]
+	for _, req := range r.pending {
+		if req.deadline.Before(now) {
+			expired = append(expired, req)
+		} else {
+			pending = append(pending, req)
+		}
+	}
+	clear(r.pending[len(pending):])
+	r.pending = pending
+	return expired
+}
@@ -0,0 +1,51 @@
+package mqttv5
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/mqtt"
+
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequests(t *testing.T) {
+	bsEui := common.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	otherEui := common.EUI64{8, 7, 6, 5, 4, 3, 2, 1}
+	now := time.Now()
+
+	newRequest := func(eui common.EUI64, dlQueId uint64, deadline time.Time) *pendingRequest {
+		result, ok := mqtt.CommandResultOf(&bs.ServerCommand{Command: &bs.ServerCommand_DlDataQue{
+			DlDataQue: &bs.EnqueDownlink{EndnodeEui: "0102030405060708", DlQueId: dlQueId},
+		}})
+		require.True(t, ok)
+		return &pendingRequest{bsEui: eui, result: result, deadline: deadline}
+	}
+	dlRes := func(dlQueId uint64) *bs.BasestationUplink {
+		return &bs.BasestationUplink{Message: &bs.BasestationUplink_DlRes{
+			DlRes: &bs.BasestationDownlinkResult{EpEui: "0102030405060708", DlQueId: dlQueId},
+		}}
+	}
+
+	var r requests
+	first := newRequest(bsEui, 1, now.Add(time.Minute))
+	second := newRequest(bsEui, 2, now.Add(time.Second))
+	third := newRequest(otherEui, 1, now.Add(time.Minute))
+	r.add(first)
+	r.add(second)
+	r.add(third)
+
+	// event type, basestation and result have to match
+	assert.Empty(t, r.resolve(bsEui, "status", dlRes(1)))
+	assert.Empty(t, r.resolve(bsEui, "dl", dlRes(3)))
+	assert.Equal(t, []*pendingRequest{first}, r.resolve(bsEui, "dl", dlRes(1)))
+	assert.Empty(t, r.resolve(bsEui, "dl", dlRes(1)))
+
+	assert.Empty(t, r.expire(now))
+	assert.Equal(t, []*pendingRequest{second}, r.expire(now.Add(2*time.Second)))
+	assert.Equal(t, []*pendingRequest{third}, r.resolve(otherEui, "dl", dlRes(1)))
+	assert.Empty(t, r.pending)
+}
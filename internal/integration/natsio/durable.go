@@ -0,0 +1,139 @@
+package natsio
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+)
+
+// Publishes events to a JetStream stream.
+//
+// A publish waits for the acknowledgement of the server. A message that was not
+// acknowledged is republished with the same message id, the server discards duplicates.
+type durable struct {
+	ctx context.Context
+	js  jetstream.JetStream
+
+	stream         string
+	createStream   bool
+	streamSubjects []string
+	events         []string
+	ackTimeout     time.Duration
+	maxPending     int
+	maxRetries     int
+	retryWait      time.Duration
+
+	// publishes waiting for an acknowledgement
+	pending sync.WaitGroup
+}
+
+// Setup JetStream on the connection, creates the stream if configured
+func (d *durable) start(conn *nats.Conn) error {
+	var err error
+	d.js, err = jetstream.New(conn,
+		jetstream.WithPublishAsyncMaxPending(d.maxPending),
+		jetstream.WithPublishAsyncTimeout(d.ackTimeout),
+	)
+	if err != nil {
+		return errors.Wrap(err, "new jetstream error")
+	}
+
+	if d.createStream {
+		ctx, cancel := context.WithTimeout(d.ctx, d.ackTimeout)
+		defer cancel()
+		if _, err := d.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+			Name:     d.stream,
+			Subjects: d.streamSubjects,
+		}); err != nil {
+			return errors.Wrapf(err, "create stream %s error", d.stream)
+		}
+		log.Info().Str("stream", d.stream).Strs("subjects", d.streamSubjects).Msg("jetstream stream created")
+	}
+	return nil
+}
+
+// Whether events of this type are published to JetStream
+func (d *durable) handles(event string) bool {
+	return slices.Contains(d.events, event)
+}
+
+// Publish a message and wait for the acknowledgement, republishes on error. Fails if the
+// message was not acknowledged after the last retry or the integration stopped.
+func (d *durable) publish(msg *nats.Msg) error {
+	d.pending.Add(1)
+	natsPendingGauge().Inc()
+	defer d.pending.Done()
+	defer natsPendingGauge().Dec()
+
+	id := uuid.NewString()
+	logger := log.With().Str("subject", msg.Subject).Str("msg_id", id).Logger()
+
+	for attempt := 0; ; attempt++ {
+		err := d.publishAttempt(id, msg, attempt)
+		if err == nil {
+			natsAckCounter("acked").Inc()
+			return nil
+		}
+		if attempt >= d.maxRetries {
+			natsAckCounter("failed").Inc()
+			return errors.Wrapf(err, "jetstream publish not acknowledged after %d attempts", attempt+1)
+		}
+		natsAckCounter("retried").Inc()
+		logger.Warn().Err(err).Int("attempt", attempt).Msg("jetstream publish not acknowledged, retrying")
+
+		select {
+		case <-d.ctx.Done():
+			natsAckCounter("failed").Inc()
+			return errors.Wrap(err, "integration stopped before jetstream publish was acknowledged")
+		case <-time.After(d.retryWait):
+		}
+	}
+}
+
+// Publish a message once and wait for the acknowledgement, at most for the ack timeout
+func (d *durable) publishAttempt(id string, msg *nats.Msg, attempt int) error {
+	// the client sets the reply subject, a retry needs a new message
+	m := nats.Msg{Subject: msg.Subject, Header: nats.Header{}, Data: msg.Data}
+	for k, v := range msg.Header {
+		m.Header[k] = slices.Clone(v)
+	}
+
+	future, err := d.js.PublishMsgAsync(&m, jetstream.WithMsgID(id), jetstream.WithExpectStream(d.stream))
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(d.ackTimeout)
+	defer timer.Stop()
+
+	select {
+	case ack := <-future.Ok():
+		log.Debug().Str("subject", msg.Subject).Str("msg_id", id).Int("attempt", attempt).Str("stream", ack.Stream).Uint64("sequence", ack.Sequence).Bool("duplicate", ack.Duplicate).Msg("jetstream publish acknowledged")
+		return nil
+	case err := <-future.Err():
+		return err
+	case <-timer.C:
+		return errors.New("jetstream acknowledgement timeout")
+	}
+}
+
+// Wait for the pending publishes, at most for the ack timeout
+func (d *durable) wait() {
+	done := make(chan struct{})
+	go func() {
+		d.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(d.ackTimeout):
+		log.Warn().Msg("timeout waiting for jetstream acknowledgements")
+	}
+}
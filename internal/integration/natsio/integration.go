@@ -0,0 +1,452 @@
+// Package natsio implements a NATS integration.
+//
+// Events and states are published to subjects derived from templates, commands and responses
+// are received on per basestation subjects. Optionally, selected events are published to a
+// JetStream stream and republished until the server acknowledged them.
+package natsio
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/nats-io/nats.go"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/auth"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/mqtt"
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+)
+
+const (
+	eventSourceEndpoint    = "ep"
+	eventSourceBasestation = "bs"
+)
+
+// Headers set on published messages
+const (
+	headerContentType = "Content-Type"
+	headerBsEui       = "Bssci-Bs-Eui"
+	headerEventSource = "Bssci-Event-Source"
+	headerEventType   = "Bssci-Event-Type"
+)
+
+// Integration implements a NATS integration.
+type Integration struct {
+	conn    *nats.Conn
+	url     string
+	options []nats.Option
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	serverCommandHandler  func(*bs.ServerCommand)
+	serverResponseHandler func(*bs.ServerResponse)
+
+	basestationsMux sync.Mutex
+	basestations    map[common.EUI64][]*nats.Subscription
+
+	reconnectWait time.Duration
+
+	eventSubjectTemplate    *template.Template
+	stateSubjectTemplate    *template.Template
+	commandSubjectTemplate  *template.Template
+	responseSubjectTemplate *template.Template
+
+	marshal     func(msg proto.Message) ([]byte, error)
+	unmarshal   func(b []byte, msg proto.Message) error
+	contentType string
+
+	// nil if JetStream is disabled
+	durable *durable
+}
+
+// NewIntegration creates a new Integration.
+func NewIntegration(conf config.Config) (*Integration, error) {
+	var err error
+	c := conf.Integration.NATS
+
+	integ := Integration{
+		url:           strings.Join(c.Servers, ","),
+		basestations:  make(map[common.EUI64][]*nats.Subscription),
+		reconnectWait: c.ReconnectWait,
+	}
+	integ.ctx, integ.cancel = context.WithCancel(context.Background())
+
+	// set marshaler
+	if integ.marshal, err = mqtt.Marshaler(conf.Integration.Marshaler); err != nil {
+		return nil, err
+	}
+	if integ.unmarshal, err = mqtt.Unmarshaler(conf.Integration.Marshaler); err != nil {
+		return nil, err
+	}
+	integ.contentType = mqtt.ContentType(conf.Integration.Marshaler)
+
+	// set subject templates
+	integ.eventSubjectTemplate, err = template.New("event").Parse(c.EventSubjectTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse event subject template error")
+	}
+	integ.stateSubjectTemplate, err = template.New("state").Parse(c.StateSubjectTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse state subject template error")
+	}
+	integ.commandSubjectTemplate, err = template.New("command").Parse(c.CommandSubjectTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse command subject template error")
+	}
+	integ.responseSubjectTemplate, err = template.New("response").Parse(c.ResponseSubjectTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse response subject template error")
+	}
+
+	// set connection options
+	integ.options = []nats.Option{
+		nats.Name(c.Name),
+		nats.Timeout(c.ConnectTimeout),
+		nats.ReconnectWait(c.ReconnectWait),
+		nats.MaxReconnects(-1),
+		nats.ReconnectHandler(integ.onConnected),
+		nats.DisconnectErrHandler(integ.onDisconnected),
+		nats.ErrorHandler(integ.onError),
+	}
+	if c.Username != "" {
+		integ.options = append(integ.options, nats.UserInfo(c.Username, c.Password))
+	}
+	if c.Token != "" {
+		integ.options = append(integ.options, nats.Token(c.Token))
+	}
+	if c.CredentialsFile != "" {
+		integ.options = append(integ.options, nats.UserCredentials(c.CredentialsFile))
+	}
+	tlsConfig, err := auth.NewTLSConfig(c.CACert, c.TLSCert, c.TLSKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "new tls config error")
+	}
+	if tlsConfig != nil {
+		integ.options = append(integ.options, nats.Secure(tlsConfig))
+	}
+
+	if c.JetStream.Enabled {
+		integ.durable = &durable{
+			ctx:            integ.ctx,
+			stream:         c.JetStream.Stream,
+			createStream:   c.JetStream.CreateStream,
+			streamSubjects: c.JetStream.StreamSubjects,
+			events:         c.JetStream.Events,
+			ackTimeout:     c.JetStream.AckTimeout,
+			maxPending:     c.JetStream.MaxPending,
+			maxRetries:     c.JetStream.MaxRetries,
+			retryWait:      c.JetStream.RetryWait,
+		}
+	}
+
+	return &integ, nil
+}
+
+// Start the integration.
+func (integ *Integration) Start() error {
+	// block until the client is connected
+	for {
+		var err error
+		integ.conn, err = nats.Connect(integ.url, integ.options...)
+		if err == nil {
+			break
+		}
+		log.Error().Err(err).Str("servers", integ.url).Msg("connect to nats server error, retrying")
+
+		select {
+		case <-integ.ctx.Done():
+			return errors.Wrap(err, "connect error")
+		case <-time.After(integ.reconnectWait):
+		}
+	}
+
+	integ.onConnected(integ.conn)
+
+	if integ.durable != nil {
+		if err := integ.durable.start(integ.conn); err != nil {
+			return errors.Wrap(err, "setup jetstream error")
+		}
+	}
+	return nil
+}
+
+// Stop the integration.
+func (integ *Integration) Stop() error {
+	integ.basestationsMux.Lock()
+	defer integ.basestationsMux.Unlock()
+
+	// setup ctx logger
+	logger := log.With().Logger()
+	ctx := context.Background()
+	ctx = logger.WithContext(ctx)
+
+	// Set gateway state to offline for all gateways.
+	for bsEui := range integ.basestations {
+		logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+			return c.Str("bs_eui", bsEui.String())
+		})
+
+		pl := bs.BasestationState{
+			BsEui: bsEui.String(),
+			State: bs.BasestationState_OFFLINE,
+		}
+		if err := integ.PublishState(ctx, bsEui, &pl); err != nil {
+			logger.Error().Err(err).Msg("publish state error")
+		}
+	}
+
+	if integ.durable != nil {
+		integ.durable.wait()
+	}
+	integ.cancel()
+
+	if integ.conn != nil {
+		if err := integ.conn.FlushTimeout(time.Second); err != nil {
+			log.Warn().Err(err).Msg("nats flush error")
+		}
+		integ.conn.Close()
+	}
+	return nil
+}
+
+// Updates the subscription for the given EUI.
+func (integ *Integration) SetBasestationSubscription(subscribe bool, bsEui common.EUI64) error {
+	logger := log.With().Str("bs_eui", bsEui.String()).Bool("subscribe", subscribe).Logger()
+	logger.Debug().Msg("updating basestation subscription")
+
+	integ.basestationsMux.Lock()
+	defer integ.basestationsMux.Unlock()
+
+	subs, subscribed := integ.basestations[bsEui]
+	if subscribe == subscribed {
+		return nil
+	}
+
+	if !subscribe {
+		for _, sub := range subs {
+			if err := sub.Unsubscribe(); err != nil {
+				logger.Warn().Err(err).Str("subject", sub.Subject).Msg("unsubscribe error")
+			}
+		}
+		delete(integ.basestations, bsEui)
+		logger.Info().Msg("basestation subscription updated")
+		return nil
+	}
+
+	command, err := integ.subject(integ.commandSubjectTemplate, bsEui)
+	if err != nil {
+		return err
+	}
+	commandSub, err := integ.conn.Subscribe(command, integ.handleServerCommand)
+	if err != nil {
+		return errors.Wrap(err, "subscribe command subject error")
+	}
+
+	response, err := integ.subject(integ.responseSubjectTemplate, bsEui)
+	if err != nil {
+		commandSub.Unsubscribe()
+		return err
+	}
+	responseSub, err := integ.conn.Subscribe(response, integ.handleServerResponse)
+	if err != nil {
+		commandSub.Unsubscribe()
+		return errors.Wrap(err, "subscribe response subject error")
+	}
+
+	integ.basestations[bsEui] = []*nats.Subscription{commandSub, responseSub}
+	logger.Info().Str("command_subject", command).Str("response_subject", response).Msg("basestation subscription updated")
+	return nil
+}
+
+// Set handler for server command messages
+func (integ *Integration) SetServerCommandHandler(f func(*bs.ServerCommand)) {
+	integ.serverCommandHandler = f
+}
+
+// Set handler for server command messages
+func (integ *Integration) SetServerResponseHandler(f func(*bs.ServerResponse)) {
+	integ.serverResponseHandler = f
+}
+
+// Publish basestation messages.
+func (integ *Integration) PublishState(ctx context.Context, bsEui common.EUI64, pb *bs.BasestationState) error {
+	logger := zerolog.Ctx(ctx)
+
+	natsStateCounter().Inc()
+
+	subject, err := integ.subject(integ.stateSubjectTemplate, bsEui)
+	if err != nil {
+		return err
+	}
+
+	bytes, err := integ.marshal(pb)
+	if err != nil {
+		return errors.Wrap(err, "marshal message error")
+	}
+	logger.Info().Str("subject", subject).Msg("publishing state")
+
+	if err := integ.conn.PublishMsg(&nats.Msg{
+		Subject: subject,
+		Header:  integ.header(bsEui, "", ""),
+		Data:    bytes,
+	}); err != nil {
+		return errors.Wrap(err, "publish state error")
+	}
+	logger.Debug().Str("subject", subject).Any("data", pb).Msg("published state")
+
+	return nil
+}
+
+// Publish endnode messages.
+func (integ *Integration) PublishEndnodeEvent(bsEui common.EUI64, event string, pb *bs.EndnodeUplink) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceEndpoint).Logger()
+	ctx := context.Background()
+	ctx = logger.WithContext(ctx)
+
+	return integ.publishEvent(ctx, bsEui, eventSourceEndpoint, event, pb)
+}
+
+// Publish basestation messages.
+func (integ *Integration) PublishBasestationEvent(bsEui common.EUI64, event string, pb *bs.BasestationUplink) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceBasestation).Logger()
+	ctx := context.Background()
+	ctx = logger.WithContext(ctx)
+
+	return integ.publishEvent(ctx, bsEui, eventSourceBasestation, event, pb)
+}
+
+// Publish events generated by the adapter.
+func (integ *Integration) PublishAdapterEvent(bsEui common.EUI64, event string, pb *structpb.Struct) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceBasestation).Logger()
+	ctx := context.Background()
+	ctx = logger.WithContext(ctx)
+
+	return integ.publishEvent(ctx, bsEui, eventSourceBasestation, event, pb)
+}
+
+func (integ *Integration) publishEvent(ctx context.Context, bsEui common.EUI64, source string, event string, pb proto.Message) error {
+	logger := zerolog.Ctx(ctx)
+
+	natsEventCounter(bsEui.String(), source, event).Inc()
+
+	subject := bytes.NewBuffer(nil)
+	if err := integ.eventSubjectTemplate.Execute(subject, struct {
+		BsEui       common.EUI64
+		EventSource string
+		EventType   string
+	}{bsEui, source, event}); err != nil {
+		return errors.Wrap(err, "execute event template error")
+	}
+	subjectStr := subject.String()
+
+	bytes, err := integ.marshal(pb)
+	if err != nil {
+		return errors.Wrap(err, "marshal message error")
+	}
+
+	msg := nats.Msg{
+		Subject: subjectStr,
+		Header:  integ.header(bsEui, source, event),
+		Data:    bytes,
+	}
+
+	if integ.durable != nil && integ.durable.handles(event) {
+		logger.Info().Str("subject", subjectStr).Msg("publishing event to jetstream")
+		if err := integ.durable.publish(&msg); err != nil {
+			return errors.Wrap(err, "publish event to jetstream error")
+		}
+	} else {
+		logger.Info().Str("subject", subjectStr).Msg("publishing event")
+		if err := integ.conn.PublishMsg(&msg); err != nil {
+			return errors.Wrap(err, "publish event error")
+		}
+	}
+	logger.Debug().Str("subject", subjectStr).Any("data", pb).Msg("published event")
+	return nil
+}
+
+// Headers of a published message
+func (integ *Integration) header(bsEui common.EUI64, source string, event string) nats.Header {
+	header := nats.Header{}
+	header.Set(headerContentType, integ.contentType)
+	header.Set(headerBsEui, bsEui.String())
+	if source != "" {
+		header.Set(headerEventSource, source)
+	}
+	if event != "" {
+		header.Set(headerEventType, event)
+	}
+	return header
+}
+
+func (integ *Integration) subject(t *template.Template, bsEui common.EUI64) (string, error) {
+	subject := bytes.NewBuffer(nil)
+	if err := t.Execute(subject, struct {
+		BsEui common.EUI64
+	}{bsEui}); err != nil {
+		return "", errors.Wrapf(err, "execute %s template error", t.Name())
+	}
+	return subject.String(), nil
+}
+
+func (integ *Integration) handleServerCommand(msg *nats.Msg) {
+	logger := log.With().Str("subject", msg.Subject).Logger()
+	logger.Debug().Msg("received message for command handler")
+
+	var pb bs.ServerCommand
+
+	if err := integ.unmarshal(msg.Data, &pb); err != nil {
+		logger.Error().Err(err).Msg("unmarshal server command error")
+		return
+	}
+
+	integ.serverCommandHandler(&pb)
+}
+
+func (integ *Integration) handleServerResponse(msg *nats.Msg) {
+	logger := log.With().Str("subject", msg.Subject).Logger()
+	logger.Debug().Msg("received message for response handler")
+
+	var pb bs.ServerResponse
+
+	if err := integ.unmarshal(msg.Data, &pb); err != nil {
+		logger.Error().Err(err).Msg("unmarshal server response error")
+		return
+	}
+
+	integ.serverResponseHandler(&pb)
+}
+
+func (integ *Integration) onConnected(conn *nats.Conn) {
+	natsConnectCounter().Inc()
+	log.Info().Str("server", conn.ConnectedUrlRedacted()).Msg("connected to nats server")
+}
+
+func (integ *Integration) onDisconnected(conn *nats.Conn, err error) {
+	natsDisconnectCounter().Inc()
+	log.Error().Err(err).Msg("nats connection lost")
+}
+
+func (integ *Integration) onError(conn *nats.Conn, sub *nats.Subscription, err error) {
+	logger := log.Error().Err(err)
+	if sub != nil {
+		logger = logger.Str("subject", sub.Subject)
+	}
+	logger.Msg("nats error")
+}
@@ -0,0 +1,261 @@
+package natsio
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+)
+
+type IntegrationTestSuite struct {
+	suite.Suite
+
+	server *server.Server
+	client *nats.Conn
+	js     jetstream.JetStream
+	conf   config.Config
+	integ  *Integration
+	bsEui  common.EUI64
+}
+
+func (ts *IntegrationTestSuite) SetupTest() {
+	var err error
+	ts.bsEui = common.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+
+	ts.server, err = server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  ts.T().TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	ts.Require().NoError(err)
+	go ts.server.Start()
+	ts.Require().True(ts.server.ReadyForConnections(5 * time.Second))
+
+	ts.client, err = nats.Connect(ts.server.ClientURL())
+	ts.Require().NoError(err)
+	ts.js, err = jetstream.New(ts.client)
+	ts.Require().NoError(err)
+
+	c := &ts.conf.Integration.NATS
+	ts.conf.Integration.Marshaler = "protobuf"
+	c.Servers = []string{ts.server.ClientURL()}
+	c.ConnectTimeout = time.Second
+	c.ReconnectWait = 10 * time.Millisecond
+	c.EventSubjectTemplate = "bssci.{{ .BsEui }}.event.{{ .EventSource }}.{{ .EventType }}"
+	c.StateSubjectTemplate = "bssci.{{ .BsEui }}.state"
+	c.CommandSubjectTemplate = "bssci.{{ .BsEui }}.command.>"
+	c.ResponseSubjectTemplate = "bssci.{{ .BsEui }}.response.>"
+	c.JetStream.Stream = "BSSCI"
+	c.JetStream.CreateStream = true
+	c.JetStream.StreamSubjects = []string{"bssci.*.event.>"}
+	c.JetStream.Events = []string{"ul"}
+	c.JetStream.AckTimeout = time.Second
+	c.JetStream.MaxPending = 100
+	c.JetStream.MaxRetries = 20
+	c.JetStream.RetryWait = 50 * time.Millisecond
+}
+
+func (ts *IntegrationTestSuite) TearDownTest() {
+	if ts.integ != nil {
+		ts.integ.Stop()
+		ts.integ = nil
+	}
+	ts.client.Close()
+	ts.server.Shutdown()
+	ts.server.WaitForShutdown()
+}
+
+func (ts *IntegrationTestSuite) start() {
+	var err error
+	ts.integ, err = NewIntegration(ts.conf)
+	ts.Require().NoError(err)
+	ts.Require().NoError(ts.integ.Start())
+}
+
+// Number of messages in the stream
+func (ts *IntegrationTestSuite) streamMsgs() uint64 {
+	stream, err := ts.js.Stream(context.Background(), "BSSCI")
+	if err != nil {
+		return 0
+	}
+	info, err := stream.Info(context.Background())
+	ts.Require().NoError(err)
+	return info.State.Msgs
+}
+
+func (ts *IntegrationTestSuite) TestPublishEvent() {
+	assert := ts.Assert()
+	ts.start()
+
+	sub, err := ts.client.SubscribeSync("bssci.>")
+	ts.Require().NoError(err)
+	ts.Require().NoError(ts.client.Flush())
+
+	pb := bs.BasestationUplink{BsEui: ts.bsEui.String()}
+	assert.NoError(ts.integ.PublishBasestationEvent(ts.bsEui, "status", &pb))
+
+	msg, err := sub.NextMsg(time.Second)
+	ts.Require().NoError(err)
+	assert.Equal("bssci."+ts.bsEui.String()+".event.bs.status", msg.Subject)
+	assert.Equal("application/x-protobuf", msg.Header.Get(headerContentType))
+	assert.Equal(ts.bsEui.String(), msg.Header.Get(headerBsEui))
+	assert.Equal("bs", msg.Header.Get(headerEventSource))
+	assert.Equal("status", msg.Header.Get(headerEventType))
+
+	var got bs.BasestationUplink
+	ts.Require().NoError(proto.Unmarshal(msg.Data, &got))
+	assert.True(proto.Equal(&pb, &got))
+}
+
+func (ts *IntegrationTestSuite) TestJetStream() {
+	ts.conf.Integration.NATS.JetStream.Enabled = true
+	ts.start()
+
+	ts.Assert().NoError(ts.integ.PublishEndnodeEvent(ts.bsEui, "ul", &bs.EndnodeUplink{}))
+	ts.Assert().NoError(ts.integ.PublishEndnodeEvent(ts.bsEui, "ul", &bs.EndnodeUplink{}))
+	ts.integ.durable.wait()
+	ts.Assert().Equal(uint64(2), ts.streamMsgs())
+}
+
+func (ts *IntegrationTestSuite) TestJetStreamDuplicate() {
+	ts.conf.Integration.NATS.JetStream.Enabled = true
+	ts.start()
+
+	msg := nats.Msg{Subject: "bssci." + ts.bsEui.String() + ".event.ep.ul", Header: nats.Header{}}
+	ts.Require().NoError(ts.integ.durable.publishAttempt("id", &msg, 0))
+	ts.Require().NoError(ts.integ.durable.publishAttempt("id", &msg, 1))
+	ts.integ.durable.wait()
+	ts.Assert().Equal(uint64(1), ts.streamMsgs())
+}
+
+func (ts *IntegrationTestSuite) TestJetStreamRetry() {
+	ts.conf.Integration.NATS.JetStream.Enabled = true
+	ts.conf.Integration.NATS.JetStream.CreateStream = false
+	ts.start()
+
+	// the stream does not exist yet, the publish is retried until it is created
+	published := make(chan error, 1)
+	go func() {
+		published <- ts.integ.PublishEndnodeEvent(ts.bsEui, "ul", &bs.EndnodeUplink{})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	_, err := ts.js.CreateStream(context.Background(), jetstream.StreamConfig{
+		Name:     "BSSCI",
+		Subjects: []string{"bssci.*.event.>"},
+	})
+	ts.Require().NoError(err)
+
+	select {
+	case err := <-published:
+		ts.Assert().NoError(err)
+	case <-time.After(5 * time.Second):
+		ts.Fail("publish not completed")
+	}
+	ts.Assert().Equal(uint64(1), ts.streamMsgs())
+}
+
+func (ts *IntegrationTestSuite) TestJetStreamFailed() {
+	ts.conf.Integration.NATS.JetStream.Enabled = true
+	ts.conf.Integration.NATS.JetStream.CreateStream = false
+	ts.conf.Integration.NATS.JetStream.MaxRetries = 1
+	ts.start()
+
+	// the stream does not exist, the publish fails after the last retry
+	ts.Assert().Error(ts.integ.PublishEndnodeEvent(ts.bsEui, "ul", &bs.EndnodeUplink{}))
+}
+
+func (ts *IntegrationTestSuite) TestCoreEventsWithJetStream() {
+	ts.conf.Integration.NATS.JetStream.Enabled = true
+	ts.start()
+
+	sub, err := ts.client.SubscribeSync("bssci.*.event.bs.>")
+	ts.Require().NoError(err)
+	ts.Require().NoError(ts.client.Flush())
+
+	// events not selected for JetStream are published using core NATS
+	ts.Assert().NoError(ts.integ.PublishBasestationEvent(ts.bsEui, "status", &bs.BasestationUplink{}))
+	_, err = sub.NextMsg(time.Second)
+	ts.Assert().NoError(err)
+	ts.Assert().Equal(0, ts.integ.durable.js.PublishAsyncPending())
+}
+
+func (ts *IntegrationTestSuite) TestCommand() {
+	ts.start()
+
+	commands := make(chan *bs.ServerCommand, 1)
+	ts.integ.SetServerCommandHandler(func(pb *bs.ServerCommand) { commands <- pb })
+
+	publish := func() {
+		b, err := proto.Marshal(&bs.ServerCommand{BsEui: ts.bsEui.String()})
+		ts.Require().NoError(err)
+		ts.Require().NoError(ts.client.Publish("bssci."+ts.bsEui.String()+".command.dl_data_que", b))
+		ts.Require().NoError(ts.client.Flush())
+	}
+
+	ts.Require().NoError(ts.integ.SetBasestationSubscription(true, ts.bsEui))
+	ts.Require().NoError(ts.integ.conn.Flush())
+	publish()
+	select {
+	case pb := <-commands:
+		ts.Assert().Equal(ts.bsEui.String(), pb.BsEui)
+	case <-time.After(time.Second):
+		ts.Fail("command not received")
+	}
+
+	ts.Require().NoError(ts.integ.SetBasestationSubscription(false, ts.bsEui))
+	ts.Require().NoError(ts.integ.conn.Flush())
+	publish()
+	select {
+	case <-commands:
+		ts.Fail("command received after unsubscribe")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func (ts *IntegrationTestSuite) TestStop() {
+	ts.start()
+
+	sub, err := ts.client.SubscribeSync("bssci.*.state")
+	ts.Require().NoError(err)
+	ts.Require().NoError(ts.client.Flush())
+
+	ts.Require().NoError(ts.integ.SetBasestationSubscription(true, ts.bsEui))
+	ts.Require().NoError(ts.integ.Stop())
+	ts.integ = nil
+
+	msg, err := sub.NextMsg(time.Second)
+	ts.Require().NoError(err)
+	var state bs.BasestationState
+	ts.Require().NoError(proto.Unmarshal(msg.Data, &state))
+	ts.Assert().Equal(bs.BasestationState_OFFLINE, state.State)
+}
+
+func TestIntegration(t *testing.T) {
+	suite.Run(t, new(IntegrationTestSuite))
+}
+
+func TestNewIntegration_invalidConfig(t *testing.T) {
+	var conf config.Config
+	conf.Integration.Marshaler = "xml"
+	_, err := NewIntegration(conf)
+	assert.Error(t, err)
+
+	conf.Integration.Marshaler = "json"
+	conf.Integration.NATS.EventSubjectTemplate = "bssci.{{ .BsEui"
+	_, err = NewIntegration(conf)
+	assert.Error(t, err)
+}
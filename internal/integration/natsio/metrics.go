@@ -0,0 +1,62 @@
+package natsio
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	ec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_nats_event_count",
+		Help: "The number of events published by the NATS integration (per basestation, source, event).",
+	}, []string{"basestation", "source", "event"})
+
+	sc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_nats_state_count",
+		Help: "The number of states published by the NATS integration.",
+	})
+
+	cc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_nats_connect_count",
+		Help: "The number of times the integration connected to the NATS server.",
+	})
+
+	dc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_nats_disconnect_count",
+		Help: "The number of times the integration disconnected from the NATS server.",
+	})
+
+	ac = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_nats_jetstream_ack_count",
+		Help: "The number of JetStream publish acknowledgements (per result).",
+	}, []string{"result"})
+
+	pg = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "integration_nats_jetstream_pending",
+		Help: "The number of JetStream publishes waiting for an acknowledgement.",
+	})
+)
+
+func natsEventCounter(c string, s string, e string) prometheus.Counter {
+	return ec.With(prometheus.Labels{"basestation": c, "source": s, "event": e})
+}
+
+func natsStateCounter() prometheus.Counter {
+	return sc
+}
+
+func natsConnectCounter() prometheus.Counter {
+	return cc
+}
+
+func natsDisconnectCounter() prometheus.Counter {
+	return dc
+}
+
+func natsAckCounter(result string) prometheus.Counter {
+	return ac.With(prometheus.Labels{"result": result})
+}
+
+func natsPendingGauge() prometheus.Gauge {
+	return pg
+}
@@ -0,0 +1,273 @@
+package integration
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/api/go/bssci"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/journal"
+)
+
+const (
+	eventSourceEndpoint    = "ep"
+	eventSourceBasestation = "bs"
+)
+
+// Implemented by integrations that know whether their broker is reachable
+type connectionChecker interface {
+	IsConnected() bool
+}
+
+// Journals the events of an integration to disk before publishing them.
+//
+// Events are published in order by a single goroutine, a failed publish is retried
+// until it succeeds or the event expires. Queued events survive a restart. States and
+// subscriptions are passed to the integration directly.
+type storeForward struct {
+	Integration
+
+	name          string
+	journal       *journal.Journal
+	maxAge        time.Duration
+	retryInterval time.Duration
+	now           func() time.Time
+
+	// signals an appended event
+	notify chan struct{}
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+// Wrap an integration, the journal is stored in a sub-directory named after it
+func newStoreForward(name string, i Integration, conf config.Config) (*storeForward, error) {
+	c := conf.Integration.StoreForward
+
+	j, err := journal.Open(filepath.Join(c.Dir, name), journal.Options{
+		SegmentSize: int64(c.SegmentSizeMB) << 20,
+		MaxSize:     int64(c.MaxSizeMB) << 20,
+		SyncWrites:  c.SyncWrites,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "open journal error")
+	}
+	if n := j.Len(); n != 0 {
+		log.Info().Str("integration", name).Int("events", n).Msg("replaying journaled events")
+	}
+
+	sf := storeForward{
+		Integration:   i,
+		name:          name,
+		journal:       j,
+		maxAge:        c.MaxAge,
+		retryInterval: c.RetryInterval,
+		now:           time.Now,
+		notify:        make(chan struct{}, 1),
+	}
+	sf.ctx, sf.cancel = context.WithCancel(context.Background())
+	storeForwardDepthGauge(name).Set(float64(j.Len()))
+	return &sf, nil
+}
+
+func (sf *storeForward) Start() error {
+	if err := sf.Integration.Start(); err != nil {
+		return err
+	}
+	sf.running.Add(1)
+	go func() {
+		defer sf.running.Done()
+		sf.drain()
+	}()
+	return nil
+}
+
+// Stop publishing, queued events remain in the journal
+func (sf *storeForward) Stop() error {
+	sf.cancel()
+	sf.running.Wait()
+	if err := sf.journal.Close(); err != nil {
+		log.Error().Err(err).Str("integration", sf.name).Msg("close journal error")
+	}
+	return sf.Integration.Stop()
+}
+
+func (sf *storeForward) PublishEndnodeEvent(bsEui common.EUI64, event string, pb *bs.EndnodeUplink) error {
+	return sf.enqueue(&bssci.AdapterMessage{
+		BsEui:       bsEui.String(),
+		EventSource: eventSourceEndpoint,
+		EventType:   event,
+		Message:     &bssci.AdapterMessage_EndnodeUplink{EndnodeUplink: pb},
+	})
+}
+
+func (sf *storeForward) PublishBasestationEvent(bsEui common.EUI64, event string, pb *bs.BasestationUplink) error {
+	return sf.enqueue(&bssci.AdapterMessage{
+		BsEui:       bsEui.String(),
+		EventSource: eventSourceBasestation,
+		EventType:   event,
+		Message:     &bssci.AdapterMessage_BasestationUplink{BasestationUplink: pb},
+	})
+}
+
+func (sf *storeForward) PublishAdapterEvent(bsEui common.EUI64, event string, pb *structpb.Struct) error {
+	return sf.enqueue(&bssci.AdapterMessage{
+		BsEui:       bsEui.String(),
+		EventSource: eventSourceBasestation,
+		EventType:   event,
+		Message:     &bssci.AdapterMessage_AdapterEvent{AdapterEvent: pb},
+	})
+}
+
+// Append an event to the journal
+func (sf *storeForward) enqueue(msg *bssci.AdapterMessage) error {
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "marshal event error")
+	}
+
+	dropped, err := sf.journal.Append(sf.now(), b)
+	if dropped != 0 {
+		log.Warn().Str("integration", sf.name).Int("events", dropped).Msg("journal full, dropped oldest events")
+		storeForwardDroppedCounter(sf.name, "size").Add(float64(dropped))
+	}
+	if err != nil {
+		return errors.Wrap(err, "journal event error")
+	}
+	storeForwardDepthGauge(sf.name).Set(float64(sf.journal.Len()))
+
+	select {
+	case sf.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Publish the journaled events in order until stopped
+func (sf *storeForward) drain() {
+	logger := log.With().Str("integration", sf.name).Logger()
+
+	for {
+		rec, ok, err := sf.journal.Peek()
+		if err != nil {
+			logger.Error().Err(err).Msg("read journal error")
+			if !sf.wait(sf.retryInterval) {
+				return
+			}
+			continue
+		}
+
+		storeForwardDepthGauge(sf.name).Set(float64(sf.journal.Len()))
+		if !ok {
+			storeForwardAgeGauge(sf.name).Set(0)
+			select {
+			case <-sf.notify:
+			case <-sf.ctx.Done():
+				return
+			}
+			continue
+		}
+
+		age := sf.now().Sub(rec.Time)
+		storeForwardAgeGauge(sf.name).Set(age.Seconds())
+		if sf.maxAge > 0 && age > sf.maxAge {
+			logger.Warn().Dur("age", age).Msg("dropping expired event")
+			storeForwardDroppedCounter(sf.name, "age").Inc()
+			if !sf.pop(rec) {
+				return
+			}
+			continue
+		}
+
+		// the event is replayed once the integration reconnected
+		if c, ok := sf.Integration.(connectionChecker); ok && !c.IsConnected() {
+			if !sf.wait(sf.retryInterval) {
+				return
+			}
+			continue
+		}
+
+		var msg bssci.AdapterMessage
+		bsEui, err := unmarshalJournaled(rec.Data, &msg)
+		if err != nil {
+			logger.Error().Err(err).Msg("invalid journaled event, dropping event")
+			storeForwardDroppedCounter(sf.name, "invalid").Inc()
+			if !sf.pop(rec) {
+				return
+			}
+			continue
+		}
+
+		if err := sf.publish(bsEui, &msg); err != nil {
+			logger.Warn().Err(err).Str("bs_eui", msg.BsEui).Str("event", msg.EventType).Msg("publish journaled event error, retrying")
+			storeForwardRetryCounter(sf.name).Inc()
+			if !sf.wait(sf.retryInterval) {
+				return
+			}
+			continue
+		}
+		storeForwardForwardedCounter(sf.name).Inc()
+		if !sf.pop(rec) {
+			return
+		}
+	}
+}
+
+// Decode a journaled event, returns the basestation EUI
+func unmarshalJournaled(b []byte, msg *bssci.AdapterMessage) (common.EUI64, error) {
+	if err := proto.Unmarshal(b, msg); err != nil {
+		return common.EUI64{}, errors.Wrap(err, "unmarshal error")
+	}
+	if msg.Message == nil {
+		return common.EUI64{}, errors.New("empty message")
+	}
+	bsEui, err := common.Eui64FromHexString(msg.BsEui)
+	if err != nil {
+		return common.EUI64{}, errors.Wrap(err, "invalid bs eui")
+	}
+	return bsEui, nil
+}
+
+// Publish a journaled event to the integration
+func (sf *storeForward) publish(bsEui common.EUI64, msg *bssci.AdapterMessage) error {
+	switch m := msg.Message.(type) {
+	case *bssci.AdapterMessage_EndnodeUplink:
+		return sf.Integration.PublishEndnodeEvent(bsEui, msg.EventType, m.EndnodeUplink)
+	case *bssci.AdapterMessage_BasestationUplink:
+		return sf.Integration.PublishBasestationEvent(bsEui, msg.EventType, m.BasestationUplink)
+	case *bssci.AdapterMessage_AdapterEvent:
+		return sf.Integration.PublishAdapterEvent(bsEui, msg.EventType, m.AdapterEvent)
+	default:
+		return errors.Errorf("unexpected journaled message: %T", m)
+	}
+}
+
+// Remove the oldest event, waits before the next attempt on error. False if stopped.
+func (sf *storeForward) pop(rec journal.Record) bool {
+	if err := sf.journal.Pop(rec); err != nil {
+		log.Error().Err(err).Str("integration", sf.name).Msg("remove journaled event error")
+		return sf.wait(sf.retryInterval)
+	}
+	return true
+}
+
+// Wait for the duration, false if stopped
+func (sf *storeForward) wait(d time.Duration) bool {
+	select {
+	case <-sf.ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
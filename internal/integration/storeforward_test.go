@@ -0,0 +1,167 @@
+package integration
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+)
+
+// a test integration reporting its connection state
+type connTestIntegration struct {
+	testIntegration
+	connected atomic.Bool
+}
+
+func (i *connTestIntegration) IsConnected() bool {
+	return i.connected.Load()
+}
+
+type StoreForwardTestSuite struct {
+	suite.Suite
+
+	conf  config.Config
+	inner *connTestIntegration
+	sf    *storeForward
+	bsEui common.EUI64
+}
+
+func (ts *StoreForwardTestSuite) SetupTest() {
+	ts.bsEui = common.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	ts.conf = config.Config{}
+	ts.conf.Integration.StoreForward.Dir = ts.T().TempDir()
+	ts.conf.Integration.StoreForward.SegmentSizeMB = 1
+	ts.conf.Integration.StoreForward.RetryInterval = 10 * time.Millisecond
+
+	ts.inner = &connTestIntegration{}
+	ts.inner.connected.Store(true)
+	ts.start()
+}
+
+func (ts *StoreForwardTestSuite) TearDownTest() {
+	ts.sf.Stop()
+}
+
+func (ts *StoreForwardTestSuite) start() {
+	var err error
+	ts.sf, err = newStoreForward("test", ts.inner, ts.conf)
+	ts.Require().NoError(err)
+	ts.Require().NoError(ts.sf.Start())
+}
+
+func (ts *StoreForwardTestSuite) setErr(err error) {
+	ts.inner.mux.Lock()
+	defer ts.inner.mux.Unlock()
+	ts.inner.err = err
+}
+
+func (ts *StoreForwardTestSuite) events() []string {
+	ts.inner.mux.Lock()
+	defer ts.inner.mux.Unlock()
+	return append([]string(nil), ts.inner.events...)
+}
+
+func (ts *StoreForwardTestSuite) publish() {
+	ts.Require().NoError(ts.sf.PublishEndnodeEvent(ts.bsEui, "ul", &bs.EndnodeUplink{}))
+	ts.Require().NoError(ts.sf.PublishBasestationEvent(ts.bsEui, "status", &bs.BasestationUplink{}))
+	ts.Require().NoError(ts.sf.PublishAdapterEvent(ts.bsEui, "bs_connected", &structpb.Struct{}))
+}
+
+// Wait until the journal is empty
+func (ts *StoreForwardTestSuite) waitDrained() {
+	ts.Require().Eventually(func() bool { return ts.sf.journal.Len() == 0 }, time.Second, time.Millisecond)
+}
+
+func (ts *StoreForwardTestSuite) TestPublish() {
+	ts.publish()
+	ts.waitDrained()
+	ts.Assert().Equal([]string{"ul", "status", "bs_connected"}, ts.events())
+}
+
+func (ts *StoreForwardTestSuite) TestRetryInOrder() {
+	ts.setErr(errors.New("publish error"))
+	ts.publish()
+
+	// the oldest event is retried, later events wait
+	ts.Require().Eventually(func() bool { return len(ts.events()) >= 3 }, time.Second, time.Millisecond)
+	for _, event := range ts.events() {
+		ts.Assert().Equal("ul", event)
+	}
+
+	ts.setErr(nil)
+	ts.waitDrained()
+	events := ts.events()
+	ts.Assert().Equal([]string{"ul", "status", "bs_connected"}, events[len(events)-3:])
+}
+
+func (ts *StoreForwardTestSuite) TestDisconnected() {
+	ts.inner.connected.Store(false)
+	ts.publish()
+	time.Sleep(50 * time.Millisecond)
+	ts.Assert().Empty(ts.events())
+	ts.Assert().Equal(3, ts.sf.journal.Len())
+
+	ts.inner.connected.Store(true)
+	ts.waitDrained()
+	ts.Assert().Equal([]string{"ul", "status", "bs_connected"}, ts.events())
+}
+
+func (ts *StoreForwardTestSuite) TestRestart() {
+	ts.inner.connected.Store(false)
+	ts.publish()
+	ts.Require().NoError(ts.sf.Stop())
+
+	// the journaled events are replayed after a restart
+	ts.inner = &connTestIntegration{}
+	ts.inner.connected.Store(true)
+	ts.start()
+	ts.waitDrained()
+	ts.Assert().Equal([]string{"ul", "status", "bs_connected"}, ts.events())
+}
+
+func (ts *StoreForwardTestSuite) TestMaxAge() {
+	ts.Require().NoError(ts.sf.Stop())
+	ts.conf.Integration.StoreForward.MaxAge = time.Minute
+	ts.inner.connected.Store(false)
+
+	var err error
+	ts.sf, err = newStoreForward("test", ts.inner, ts.conf)
+	ts.Require().NoError(err)
+	ts.sf.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	ts.Require().NoError(ts.sf.PublishEndnodeEvent(ts.bsEui, "ul", &bs.EndnodeUplink{}))
+
+	// the expired event is dropped although the integration is not connected
+	ts.sf.now = time.Now
+	ts.Require().NoError(ts.sf.Start())
+	ts.waitDrained()
+
+	ts.Assert().Empty(ts.events())
+}
+
+func TestStoreForward(t *testing.T) {
+	suite.Run(t, new(StoreForwardTestSuite))
+}
+
+func TestSetup_storeForward(t *testing.T) {
+	var conf config.Config
+	conf.Integration.Marshaler = "json"
+	conf.Integration.MQTTV5.Auth.Type = "generic"
+	conf.Integration.Types = []string{"mqtt_v5"}
+	conf.Integration.StoreForward.Dir = t.TempDir()
+	conf.Integration.StoreForward.Integrations = []string{"mqtt_v3"}
+	assert.ErrorContains(t, Setup(conf), "unconfigured")
+
+	conf.Integration.StoreForward.Integrations = []string{"mqtt_v5"}
+	require.NoError(t, Setup(conf))
+	assert.IsType(t, &storeForward{}, GetIntegration())
+}
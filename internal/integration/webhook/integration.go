@@ -0,0 +1,463 @@
+// Package webhook implements an HTTP webhook integration.
+//
+// Events and states are POSTed to templated URLs, failed requests are retried with an
+// exponential backoff. Server commands and responses are accepted on an inbound endpoint.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/auth"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/mqtt"
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+)
+
+const (
+	eventSourceEndpoint    = "ep"
+	eventSourceBasestation = "bs"
+)
+
+// Headers set on published requests
+const (
+	headerBsEui       = "X-Bssci-Bs-Eui"
+	headerEventSource = "X-Bssci-Event-Source"
+	headerEventType   = "X-Bssci-Event-Type"
+)
+
+// Request kinds used in metrics
+const (
+	kindEvent = "event"
+	kindState = "state"
+)
+
+// Maximum size of an inbound request body
+const maxInboundBodySize = 1 << 20
+
+// Time to publish the offline states on stop, each with a single attempt
+const stopTimeout = 5 * time.Second
+
+// Integration implements an HTTP webhook integration.
+type Integration struct {
+	client *http.Client
+	server *http.Server
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	serverCommandHandler  func(*bs.ServerCommand)
+	serverResponseHandler func(*bs.ServerResponse)
+
+	basestationsMux sync.Mutex
+	basestations    map[common.EUI64]struct{}
+
+	maxRetries      int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	signingSecret   []byte
+
+	inboundBind    string
+	inboundTLSCert string
+	inboundTLSKey  string
+
+	eventURLTemplate *template.Template
+	stateURLTemplate *template.Template
+
+	marshaler   string
+	marshal     func(msg proto.Message) ([]byte, error)
+	contentType string
+
+	// time of signatures, replaced in tests
+	now func() time.Time
+}
+
+// NewIntegration creates a new Integration.
+func NewIntegration(conf config.Config) (*Integration, error) {
+	var err error
+	c := conf.Integration.Webhook
+
+	if c.RetryBackoff <= 0 {
+		return nil, errors.New("retry_backoff must be positive")
+	}
+	if c.MaxRetryBackoff <= 0 {
+		return nil, errors.New("max_retry_backoff must be positive")
+	}
+
+	integ := Integration{
+		basestations:    make(map[common.EUI64]struct{}),
+		maxRetries:      c.MaxRetries,
+		retryBackoff:    c.RetryBackoff,
+		maxRetryBackoff: c.MaxRetryBackoff,
+		signingSecret:   []byte(c.SigningSecret),
+		inboundBind:     c.Inbound.Bind,
+		inboundTLSCert:  c.Inbound.TLSCert,
+		inboundTLSKey:   c.Inbound.TLSKey,
+		marshaler:       conf.Integration.Marshaler,
+		now:             time.Now,
+	}
+	integ.ctx, integ.cancel = context.WithCancel(context.Background())
+
+	// set marshaler
+	if integ.marshal, err = mqtt.Marshaler(conf.Integration.Marshaler); err != nil {
+		return nil, err
+	}
+	integ.contentType = mqtt.ContentType(conf.Integration.Marshaler)
+
+	// set url templates
+	integ.eventURLTemplate, err = template.New("event").Parse(c.EventURLTemplate)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse event url template error")
+	}
+	if c.StateURLTemplate != "" {
+		integ.stateURLTemplate, err = template.New("state").Parse(c.StateURLTemplate)
+		if err != nil {
+			return nil, errors.Wrap(err, "parse state url template error")
+		}
+	}
+
+	tlsConfig, err := auth.NewTLSConfig(c.CACert, c.TLSCert, c.TLSKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "new tls config error")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	integ.client = &http.Client{Transport: transport, Timeout: c.Timeout}
+
+	return &integ, nil
+}
+
+// Start the integration.
+func (integ *Integration) Start() error {
+	if integ.inboundBind == "" {
+		log.Info().Msg("webhook inbound endpoint disabled")
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /command", integ.handleServerCommand)
+	mux.HandleFunc("POST /response", integ.handleServerResponse)
+	integ.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ln, err := net.Listen("tcp", integ.inboundBind)
+	if err != nil {
+		return errors.Wrap(err, "listen error")
+	}
+	if integ.inboundTLSCert != "" || integ.inboundTLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(integ.inboundTLSCert, integ.inboundTLSKey)
+		if err != nil {
+			ln.Close()
+			return errors.Wrap(err, "load key-pair error")
+		}
+		ln = tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}})
+	}
+
+	log.Info().Str("bind", ln.Addr().String()).Msg("starting webhook inbound endpoint")
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok && !addr.IP.IsLoopback() && len(integ.signingSecret) == 0 {
+		log.Warn().Str("bind", ln.Addr().String()).Msg("webhook inbound endpoint accepts unsigned commands, configure signing_secret to verify requests")
+	}
+	go func() {
+		if err := integ.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("webhook inbound endpoint error")
+		}
+	}()
+	return nil
+}
+
+// Stop the integration.
+//
+// The offline states are published without retries, the remaining ones are skipped
+// once the stop timeout passed.
+func (integ *Integration) Stop() error {
+	integ.basestationsMux.Lock()
+	basestations := make([]common.EUI64, 0, len(integ.basestations))
+	for bsEui := range integ.basestations {
+		basestations = append(basestations, bsEui)
+	}
+	integ.basestationsMux.Unlock()
+
+	// Set gateway state to offline for all gateways.
+	deadline := time.Now().Add(stopTimeout)
+	for i, bsEui := range basestations {
+		logger := log.With().Str("bs_eui", bsEui.String()).Logger()
+		if time.Now().After(deadline) {
+			logger.Warn().Int("skipped", len(basestations)-i).Msg("timeout publishing offline states")
+			break
+		}
+
+		pl := bs.BasestationState{
+			BsEui: bsEui.String(),
+			State: bs.BasestationState_OFFLINE,
+		}
+		if err := integ.publishState(logger.WithContext(context.Background()), bsEui, &pl, 0); err != nil {
+			logger.Error().Err(err).Msg("publish state error")
+		}
+	}
+
+	// abort pending retries
+	integ.cancel()
+
+	if integ.server != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := integ.server.Shutdown(shutdownCtx); err != nil {
+			log.Warn().Err(err).Msg("webhook inbound endpoint shutdown error")
+		}
+	}
+	return nil
+}
+
+// Updates the subscription for the given EUI.
+//
+// Webhooks have no subscriptions, the basestation is only tracked to publish
+// its state on stop.
+func (integ *Integration) SetBasestationSubscription(subscribe bool, bsEui common.EUI64) error {
+	logger := log.With().Str("bs_eui", bsEui.String()).Bool("subscribe", subscribe).Logger()
+	logger.Debug().Msg("updating basestation subscription")
+
+	integ.basestationsMux.Lock()
+	defer integ.basestationsMux.Unlock()
+
+	if subscribe {
+		integ.basestations[bsEui] = struct{}{}
+	} else {
+		delete(integ.basestations, bsEui)
+	}
+	return nil
+}
+
+// Set handler for server command messages
+func (integ *Integration) SetServerCommandHandler(f func(*bs.ServerCommand)) {
+	integ.serverCommandHandler = f
+}
+
+// Set handler for server command messages
+func (integ *Integration) SetServerResponseHandler(f func(*bs.ServerResponse)) {
+	integ.serverResponseHandler = f
+}
+
+// Publish basestation messages.
+func (integ *Integration) PublishState(ctx context.Context, bsEui common.EUI64, pb *bs.BasestationState) error {
+	return integ.publishState(ctx, bsEui, pb, integ.maxRetries)
+}
+
+func (integ *Integration) publishState(ctx context.Context, bsEui common.EUI64, pb *bs.BasestationState, maxRetries int) error {
+	logger := zerolog.Ctx(ctx)
+
+	if integ.stateURLTemplate == nil {
+		logger.Debug().Msg("ignoring publish state, no stateURLTemplate configured")
+		return nil
+	}
+
+	url := bytes.NewBuffer(nil)
+	if err := integ.stateURLTemplate.Execute(url, struct {
+		BsEui common.EUI64
+	}{bsEui}); err != nil {
+		return errors.Wrap(err, "execute state template error")
+	}
+
+	header := make(http.Header)
+	header.Set(headerBsEui, bsEui.String())
+	if err := integ.post(ctx, kindState, url.String(), header, pb, maxRetries); err != nil {
+		return errors.Wrap(err, "publish state error")
+	}
+	return nil
+}
+
+// Publish endnode messages.
+func (integ *Integration) PublishEndnodeEvent(bsEui common.EUI64, event string, pb *bs.EndnodeUplink) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceEndpoint).Logger()
+	ctx := context.Background()
+	ctx = logger.WithContext(ctx)
+
+	return integ.publishEvent(ctx, bsEui, eventSourceEndpoint, event, pb)
+}
+
+// Publish basestation messages.
+func (integ *Integration) PublishBasestationEvent(bsEui common.EUI64, event string, pb *bs.BasestationUplink) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceBasestation).Logger()
+	ctx := context.Background()
+	ctx = logger.WithContext(ctx)
+
+	return integ.publishEvent(ctx, bsEui, eventSourceBasestation, event, pb)
+}
+
+// Publish events generated by the adapter.
+func (integ *Integration) PublishAdapterEvent(bsEui common.EUI64, event string, pb *structpb.Struct) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceBasestation).Logger()
+	ctx := context.Background()
+	ctx = logger.WithContext(ctx)
+
+	return integ.publishEvent(ctx, bsEui, eventSourceBasestation, event, pb)
+}
+
+func (integ *Integration) publishEvent(ctx context.Context, bsEui common.EUI64, source string, event string, pb proto.Message) error {
+	url := bytes.NewBuffer(nil)
+	if err := integ.eventURLTemplate.Execute(url, struct {
+		BsEui       common.EUI64
+		EventSource string
+		EventType   string
+	}{bsEui, source, event}); err != nil {
+		return errors.Wrap(err, "execute event template error")
+	}
+
+	header := make(http.Header)
+	header.Set(headerBsEui, bsEui.String())
+	header.Set(headerEventSource, source)
+	header.Set(headerEventType, event)
+	if err := integ.post(ctx, kindEvent, url.String(), header, pb, integ.maxRetries); err != nil {
+		return errors.Wrap(err, "publish event error")
+	}
+	return nil
+}
+
+// POST a message, retrying on network errors, 429 and 5xx responses up to maxRetries times
+func (integ *Integration) post(ctx context.Context, kind string, url string, header http.Header, pb proto.Message, maxRetries int) error {
+	logger := zerolog.Ctx(ctx).With().Str("url", url).Logger()
+
+	body, err := integ.marshal(pb)
+	if err != nil {
+		return errors.Wrap(err, "marshal message error")
+	}
+	header.Set("Content-Type", integ.contentType)
+
+	logger.Info().Msg("posting webhook")
+
+	backoff := integ.retryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := integ.do(url, header, body)
+		if err == nil {
+			webhookRequestCounter(kind, "success").Inc()
+			logger.Debug().Any("data", pb).Msg("posted webhook")
+			return nil
+		}
+		if !retry || attempt >= maxRetries {
+			webhookRequestCounter(kind, "error").Inc()
+			return err
+		}
+
+		logger.Warn().Err(err).Int("attempt", attempt+1).Dur("backoff", backoff).Msg("webhook request failed, retrying")
+		webhookRetryCounter(kind).Inc()
+
+		select {
+		case <-integ.ctx.Done():
+			webhookRequestCounter(kind, "error").Inc()
+			return errors.Wrap(err, "integration stopped")
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, integ.maxRetryBackoff)
+	}
+}
+
+// Send a single request, returns whether a failed request should be retried
+func (integ *Integration) do(url string, header http.Header, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(integ.ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.Wrap(err, "new request error")
+	}
+	req.Header = header.Clone()
+	if len(integ.signingSecret) != 0 {
+		signRequest(req.Header, integ.signingSecret, body, integ.now())
+	}
+
+	resp, err := integ.client.Do(req)
+	if err != nil {
+		return true, errors.Wrap(err, "request error")
+	}
+	defer resp.Body.Close()
+	// drain the body to reuse the connection
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxInboundBodySize))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, errors.Errorf("unexpected status: %s", resp.Status)
+	default:
+		return false, errors.Errorf("unexpected status: %s", resp.Status)
+	}
+}
+
+func (integ *Integration) handleServerCommand(w http.ResponseWriter, r *http.Request) {
+	var pb bs.ServerCommand
+	status := integ.handleInbound(w, r, &pb, integ.serverCommandHandler != nil)
+	if status == http.StatusAccepted {
+		integ.serverCommandHandler(&pb)
+	}
+	webhookInboundCounter("command", status).Inc()
+	w.WriteHeader(status)
+}
+
+func (integ *Integration) handleServerResponse(w http.ResponseWriter, r *http.Request) {
+	var pb bs.ServerResponse
+	status := integ.handleInbound(w, r, &pb, integ.serverResponseHandler != nil)
+	if status == http.StatusAccepted {
+		integ.serverResponseHandler(&pb)
+	}
+	webhookInboundCounter("response", status).Inc()
+	w.WriteHeader(status)
+}
+
+// Read, verify and unmarshal an inbound request, returns the response status
+func (integ *Integration) handleInbound(w http.ResponseWriter, r *http.Request, pb proto.Message, handled bool) int {
+	logger := log.With().Str("path", r.URL.Path).Str("remote", r.RemoteAddr).Logger()
+	logger.Debug().Msg("received inbound webhook request")
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxInboundBodySize))
+	if err != nil {
+		logger.Error().Err(err).Msg("read body error")
+		return http.StatusBadRequest
+	}
+
+	if len(integ.signingSecret) != 0 {
+		if err := verifyRequest(r.Header, integ.signingSecret, body, integ.now()); err != nil {
+			logger.Warn().Err(err).Msg("verify signature error")
+			return http.StatusUnauthorized
+		}
+	}
+
+	if !handled {
+		logger.Warn().Msg("no handler set")
+		return http.StatusServiceUnavailable
+	}
+
+	// the content type takes precedence over the configured marshaler
+	marshaler := integ.marshaler
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil {
+		if m := mqtt.MarshalerOfContentType(mediaType); m != "" {
+			marshaler = m
+		}
+	}
+	unmarshal, err := mqtt.Unmarshaler(marshaler)
+	if err != nil {
+		logger.Error().Err(err).Msg("unmarshaler error")
+		return http.StatusInternalServerError
+	}
+	if err := unmarshal(body, pb); err != nil {
+		logger.Error().Err(err).Msg("unmarshal error")
+		return http.StatusBadRequest
+	}
+	return http.StatusAccepted
+}
@@ -0,0 +1,280 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+)
+
+// a received webhook request
+type request struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+type IntegrationTestSuite struct {
+	suite.Suite
+
+	server *httptest.Server
+	integ  *Integration
+	bsEui  common.EUI64
+
+	mux      sync.Mutex
+	requests []request
+	statuses []int
+}
+
+func (ts *IntegrationTestSuite) SetupTest() {
+	ts.requests = nil
+	ts.statuses = nil
+	ts.bsEui = common.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+
+	ts.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		ts.mux.Lock()
+		defer ts.mux.Unlock()
+		ts.requests = append(ts.requests, request{r.URL.Path, r.Header, body})
+
+		// respond with the queued statuses, then with 200
+		status := http.StatusOK
+		if len(ts.statuses) != 0 {
+			status, ts.statuses = ts.statuses[0], ts.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+
+	var conf config.Config
+	conf.Integration.Marshaler = "protobuf"
+	conf.Integration.Webhook.EventURLTemplate = ts.server.URL + "/bssci/{{ .BsEui }}/event/{{ .EventSource }}/{{ .EventType }}"
+	conf.Integration.Webhook.StateURLTemplate = ts.server.URL + "/bssci/{{ .BsEui }}/state"
+	conf.Integration.Webhook.Timeout = time.Second
+	conf.Integration.Webhook.MaxRetries = 2
+	conf.Integration.Webhook.RetryBackoff = time.Millisecond
+	conf.Integration.Webhook.MaxRetryBackoff = 2 * time.Millisecond
+	conf.Integration.Webhook.SigningSecret = "secret"
+
+	var err error
+	ts.integ, err = NewIntegration(conf)
+	ts.Require().NoError(err)
+}
+
+func (ts *IntegrationTestSuite) TearDownTest() {
+	ts.integ.cancel()
+	ts.server.Close()
+}
+
+func (ts *IntegrationTestSuite) TestPublishEndnodeEvent() {
+	assert := ts.Assert()
+
+	pb := bs.EndnodeUplink{BsEui: ts.bsEui.String()}
+	assert.NoError(ts.integ.PublishEndnodeEvent(ts.bsEui, "ul", &pb))
+
+	ts.Require().Len(ts.requests, 1)
+	req := ts.requests[0]
+	assert.Equal("/bssci/"+ts.bsEui.String()+"/event/ep/ul", req.path)
+	assert.Equal("application/x-protobuf", req.header.Get("Content-Type"))
+	assert.Equal(ts.bsEui.String(), req.header.Get(headerBsEui))
+	assert.Equal("ep", req.header.Get(headerEventSource))
+	assert.Equal("ul", req.header.Get(headerEventType))
+	assert.NoError(verifyRequest(req.header, []byte("secret"), req.body, time.Now()))
+
+	var got bs.EndnodeUplink
+	ts.Require().NoError(proto.Unmarshal(req.body, &got))
+	assert.True(proto.Equal(&pb, &got))
+}
+
+func (ts *IntegrationTestSuite) TestPublishState() {
+	pb := bs.BasestationState{BsEui: ts.bsEui.String(), State: bs.BasestationState_ONLINE}
+	ts.Assert().NoError(ts.integ.PublishState(context.Background(), ts.bsEui, &pb))
+
+	ts.Require().Len(ts.requests, 1)
+	ts.Assert().Equal("/bssci/"+ts.bsEui.String()+"/state", ts.requests[0].path)
+}
+
+func (ts *IntegrationTestSuite) TestStop() {
+	ts.Require().NoError(ts.integ.SetBasestationSubscription(true, ts.bsEui))
+	ts.Require().NoError(ts.integ.Stop())
+
+	ts.Require().Len(ts.requests, 1)
+	var got bs.BasestationState
+	ts.Require().NoError(proto.Unmarshal(ts.requests[0].body, &got))
+	ts.Assert().Equal(bs.BasestationState_OFFLINE, got.State)
+}
+
+func (ts *IntegrationTestSuite) TestStopWithoutRetries() {
+	ts.integ.retryBackoff = time.Minute
+	ts.integ.maxRetryBackoff = time.Minute
+	ts.statuses = []int{500}
+
+	ts.Require().NoError(ts.integ.SetBasestationSubscription(true, ts.bsEui))
+	start := time.Now()
+	ts.Require().NoError(ts.integ.Stop())
+	ts.Assert().Less(time.Since(start), 10*time.Second)
+	ts.Assert().Len(ts.requests, 1)
+}
+
+func (ts *IntegrationTestSuite) TestRetry() {
+	tests := []struct {
+		name     string
+		statuses []int
+		requests int
+		wantErr  bool
+	}{
+		{"server error recovers", []int{http.StatusBadGateway}, 2, false},
+		{"too many requests recovers", []int{http.StatusTooManyRequests, http.StatusServiceUnavailable}, 3, false},
+		{"retries exhausted", []int{500, 500, 500}, 3, true},
+		{"client error is permanent", []int{http.StatusBadRequest}, 1, true},
+	}
+	for _, tt := range tests {
+		ts.Run(tt.name, func() {
+			ts.requests = nil
+			ts.statuses = tt.statuses
+
+			err := ts.integ.PublishBasestationEvent(ts.bsEui, "status", &bs.BasestationUplink{})
+			if tt.wantErr {
+				ts.Assert().Error(err)
+			} else {
+				ts.Assert().NoError(err)
+			}
+			ts.Assert().Len(ts.requests, tt.requests)
+		})
+	}
+}
+
+func (ts *IntegrationTestSuite) TestRetryAbortedOnStop() {
+	ts.integ.retryBackoff = time.Minute
+	ts.integ.maxRetryBackoff = time.Minute
+	ts.statuses = []int{500}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		ts.integ.cancel()
+	}()
+	start := time.Now()
+	ts.Assert().Error(ts.integ.PublishEndnodeEvent(ts.bsEui, "ul", &bs.EndnodeUplink{}))
+	ts.Assert().Less(time.Since(start), 10*time.Second)
+}
+
+func TestIntegration(t *testing.T) {
+	suite.Run(t, new(IntegrationTestSuite))
+}
+
+func TestInbound(t *testing.T) {
+	var conf config.Config
+	conf.Integration.Marshaler = "protobuf"
+	conf.Integration.Webhook.RetryBackoff = time.Second
+	conf.Integration.Webhook.MaxRetryBackoff = time.Second
+	conf.Integration.Webhook.SigningSecret = "secret"
+	integ, err := NewIntegration(conf)
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+	integ.now = func() time.Time { return now }
+
+	var commands []*bs.ServerCommand
+	var responses []*bs.ServerResponse
+
+	command := bs.ServerCommand{BsEui: "0102030405060708"}
+	commandPb, err := proto.Marshal(&command)
+	require.NoError(t, err)
+	commandJson, err := protojson.Marshal(&command)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        []byte
+		sign        bool
+		handlers    bool
+		want        int
+	}{
+		{"protobuf command", "/command", "application/x-protobuf", commandPb, true, true, http.StatusAccepted},
+		{"json command", "/command", "application/json; charset=utf-8", commandJson, true, true, http.StatusAccepted},
+		{"configured marshaler", "/command", "", commandPb, true, true, http.StatusAccepted},
+		{"response", "/response", "application/json", []byte(`{}`), true, true, http.StatusAccepted},
+		{"unsigned", "/command", "application/x-protobuf", commandPb, false, true, http.StatusUnauthorized},
+		{"invalid payload", "/command", "application/json", []byte(`{`), true, true, http.StatusBadRequest},
+		{"no handler", "/command", "application/x-protobuf", commandPb, true, false, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commands = nil
+			responses = nil
+			integ.serverCommandHandler = nil
+			integ.serverResponseHandler = nil
+			if tt.handlers {
+				integ.SetServerCommandHandler(func(pb *bs.ServerCommand) { commands = append(commands, pb) })
+				integ.SetServerResponseHandler(func(pb *bs.ServerResponse) { responses = append(responses, pb) })
+			}
+
+			r := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.sign {
+				signRequest(r.Header, []byte("secret"), tt.body, now)
+			}
+			w := httptest.NewRecorder()
+			if tt.path == "/command" {
+				integ.handleServerCommand(w, r)
+			} else {
+				integ.handleServerResponse(w, r)
+			}
+
+			assert.Equal(t, tt.want, w.Code)
+			if tt.want != http.StatusAccepted {
+				assert.Empty(t, commands)
+				assert.Empty(t, responses)
+			} else if tt.path == "/command" {
+				require.Len(t, commands, 1)
+				assert.Equal(t, command.BsEui, commands[0].BsEui)
+			} else {
+				assert.Len(t, responses, 1)
+			}
+		})
+	}
+}
+
+func TestNewIntegration_invalidConfig(t *testing.T) {
+	var conf config.Config
+	conf.Integration.Marshaler = "xml"
+	_, err := NewIntegration(conf)
+	assert.Error(t, err)
+
+	conf.Integration.Marshaler = "json"
+	conf.Integration.Webhook.RetryBackoff = time.Second
+	conf.Integration.Webhook.MaxRetryBackoff = time.Second
+	conf.Integration.Webhook.EventURLTemplate = "{{ .BsEui"
+	_, err = NewIntegration(conf)
+	assert.Error(t, err)
+
+	// a backoff of zero retries without delay
+	conf.Integration.Webhook.EventURLTemplate = ""
+	_, err = NewIntegration(conf)
+	assert.NoError(t, err)
+	conf.Integration.Webhook.RetryBackoff = 0
+	_, err = NewIntegration(conf)
+	assert.Error(t, err)
+	conf.Integration.Webhook.RetryBackoff = time.Second
+	conf.Integration.Webhook.MaxRetryBackoff = 0
+	_, err = NewIntegration(conf)
+	assert.Error(t, err)
+}
@@ -0,0 +1,37 @@
+package webhook
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	rc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_webhook_request_count",
+		Help: "The number of webhook requests (per kind, result).",
+	}, []string{"kind", "result"})
+
+	rr = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_webhook_retry_count",
+		Help: "The number of retried webhook requests (per kind).",
+	}, []string{"kind"})
+
+	ic = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_webhook_inbound_count",
+		Help: "The number of requests received by the inbound endpoint (per message, status).",
+	}, []string{"message", "status"})
+)
+
+func webhookRequestCounter(kind string, result string) prometheus.Counter {
+	return rc.With(prometheus.Labels{"kind": kind, "result": result})
+}
+
+func webhookRetryCounter(kind string) prometheus.Counter {
+	return rr.With(prometheus.Labels{"kind": kind})
+}
+
+func webhookInboundCounter(message string, status int) prometheus.Counter {
+	return ic.With(prometheus.Labels{"message": message, "status": http.StatusText(status)})
+}
@@ -0,0 +1,61 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Headers of signed requests
+const (
+	headerTimestamp = "X-Bssci-Timestamp"
+	headerSignature = "X-Bssci-Signature"
+)
+
+// Signed requests older than this are rejected
+const signatureMaxAge = 5 * time.Minute
+
+const signaturePrefix = "sha256="
+
+// HMAC-SHA256 of the timestamp and the body
+func signature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Set the timestamp and signature headers of a request
+func signRequest(header http.Header, secret []byte, body []byte, now time.Time) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	header.Set(headerTimestamp, timestamp)
+	header.Set(headerSignature, signature(secret, timestamp, body))
+}
+
+// Check the signature and age of a request
+func verifyRequest(header http.Header, secret []byte, body []byte, now time.Time) error {
+	timestamp := header.Get(headerTimestamp)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid timestamp")
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > signatureMaxAge || age < -signatureMaxAge {
+		return errors.Errorf("timestamp outside of the accepted window of %s", signatureMaxAge)
+	}
+
+	got := header.Get(headerSignature)
+	if !strings.HasPrefix(got, signaturePrefix) {
+		return errors.New("missing or invalid signature")
+	}
+	if !hmac.Equal([]byte(got), []byte(signature(secret, timestamp, body))) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
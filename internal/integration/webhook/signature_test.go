@@ -0,0 +1,53 @@
+package webhook
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyRequest(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"bsEui":"0102030405060708"}`)
+	now := time.Unix(1700000000, 0)
+
+	signed := func() http.Header {
+		header := make(http.Header)
+		signRequest(header, secret, body, now)
+		return header
+	}
+
+	tests := []struct {
+		name    string
+		header  func() http.Header
+		body    []byte
+		secret  []byte
+		now     time.Time
+		wantErr bool
+	}{
+		{"valid", signed, body, secret, now, false},
+		{"clock skew", signed, body, secret, now.Add(-time.Minute), false},
+		{"modified body", signed, []byte(`{}`), secret, now, true},
+		{"other secret", signed, body, []byte("other"), now, true},
+		{"expired", signed, body, secret, now.Add(signatureMaxAge + time.Second), true},
+		{"unsigned", func() http.Header { return make(http.Header) }, body, secret, now, true},
+		{"missing signature", func() http.Header {
+			header := make(http.Header)
+			header.Set(headerTimestamp, strconv.FormatInt(now.Unix(), 10))
+			return header
+		}, body, secret, now, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyRequest(tt.header(), tt.secret, tt.body, tt.now)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
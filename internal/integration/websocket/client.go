@@ -0,0 +1,150 @@
+package websocket
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+)
+
+// Server-side filter of a connection, an empty set matches everything
+type filter struct {
+	bsEuis map[common.EUI64]struct{}
+	epEuis map[common.EUI64]struct{}
+	events map[string]struct{}
+}
+
+// Parse the bs_eui, ep_eui and event query parameters
+func parseFilter(query url.Values) (filter, error) {
+	var f filter
+	var err error
+	if f.bsEuis, err = parseEuis(query["bs_eui"]); err != nil {
+		return f, errors.Wrap(err, "invalid bs_eui")
+	}
+	if f.epEuis, err = parseEuis(query["ep_eui"]); err != nil {
+		return f, errors.Wrap(err, "invalid ep_eui")
+	}
+	for _, event := range splitValues(query["event"]) {
+		if f.events == nil {
+			f.events = make(map[string]struct{})
+		}
+		f.events[event] = struct{}{}
+	}
+	return f, nil
+}
+
+func parseEuis(values []string) (map[common.EUI64]struct{}, error) {
+	var euis map[common.EUI64]struct{}
+	for _, s := range splitValues(values) {
+		eui, err := common.Eui64FromHexString(s)
+		if err != nil {
+			return nil, err
+		}
+		if euis == nil {
+			euis = make(map[common.EUI64]struct{})
+		}
+		euis[eui] = struct{}{}
+	}
+	return euis, nil
+}
+
+// Values of repeated and comma separated parameters
+func splitValues(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// Whether a message passes the filter.
+//
+// The endnode filter only applies to endnode events, events without endnode EUI do
+// not match it.
+func (f filter) matches(bsEui common.EUI64, source string, epEui *common.EUI64, event string) bool {
+	if len(f.bsEuis) != 0 {
+		if _, ok := f.bsEuis[bsEui]; !ok {
+			return false
+		}
+	}
+	if len(f.events) != 0 {
+		if _, ok := f.events[event]; !ok {
+			return false
+		}
+	}
+	if len(f.epEuis) != 0 && source == eventSourceEndpoint {
+		if epEui == nil {
+			return false
+		}
+		if _, ok := f.epEuis[*epEui]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Endnode EUI of an uplink, nil if unset or invalid
+//
+// Variable MAC uplinks carry no endnode EUI.
+func endnodeEui(pb *bs.EndnodeUplink) *common.EUI64 {
+	var s string
+	switch m := pb.GetMessage().(type) {
+	case *bs.EndnodeUplink_UlData:
+		s = m.UlData.GetEpEui()
+	case *bs.EndnodeUplink_Att:
+		s = m.Att.GetEpEui()
+	case *bs.EndnodeUplink_Det:
+		s = m.Det.GetEpEui()
+	}
+	if s == "" {
+		return nil
+	}
+	eui, err := common.Eui64FromHexString(s)
+	if err != nil {
+		return nil
+	}
+	return &eui
+}
+
+// A connected client
+type client struct {
+	peer   string
+	filter filter
+	send   chan []byte
+
+	// closed when the client is dropped
+	dropped  chan struct{}
+	dropOnce sync.Once
+}
+
+func newClient(peer string, f filter, bufferSize int) *client {
+	return &client{
+		peer:    peer,
+		filter:  f,
+		send:    make(chan []byte, bufferSize),
+		dropped: make(chan struct{}),
+	}
+}
+
+// Queue a message without blocking, false if the buffer is full
+func (c *client) queue(b []byte) bool {
+	select {
+	case c.send <- b:
+		return true
+	default:
+		return false
+	}
+}
+
+// Mark the client for disconnect
+func (c *client) drop() {
+	c.dropOnce.Do(func() { close(c.dropped) })
+}
@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+)
+
+func TestFilter(t *testing.T) {
+	bsEuiA := common.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	bsEuiB := common.EUI64{8, 7, 6, 5, 4, 3, 2, 1}
+	epEui := common.EUI64{1, 1, 1, 1, 1, 1, 1, 1}
+	otherEpEui := common.EUI64{2, 2, 2, 2, 2, 2, 2, 2}
+
+	tests := []struct {
+		name    string
+		query   string
+		bsEui   common.EUI64
+		source  string
+		epEui   *common.EUI64
+		event   string
+		matches bool
+	}{
+		{name: "empty", query: "", bsEui: bsEuiA, event: "ul", matches: true},
+		{name: "bs eui", query: "bs_eui=" + bsEuiA.String(), bsEui: bsEuiA, event: "ul", matches: true},
+		{name: "other bs eui", query: "bs_eui=" + bsEuiA.String(), bsEui: bsEuiB, event: "ul", matches: false},
+		{name: "comma separated", query: "bs_eui=" + bsEuiA.String() + "," + bsEuiB.String(), bsEui: bsEuiB, event: "ul", matches: true},
+		{name: "repeated", query: "event=ul&event=status", bsEui: bsEuiA, event: "status", matches: true},
+		{name: "other event", query: "event=ul", bsEui: bsEuiA, event: "status", matches: false},
+		{name: "ep eui", query: "ep_eui=" + epEui.String(), bsEui: bsEuiA, source: "ep", epEui: &epEui, event: "ul", matches: true},
+		{name: "other ep eui", query: "ep_eui=" + epEui.String(), bsEui: bsEuiA, source: "ep", epEui: &otherEpEui, event: "ul", matches: false},
+		{name: "ep eui without eui", query: "ep_eui=" + epEui.String(), bsEui: bsEuiA, source: "ep", event: "ul", matches: false},
+		{name: "ep eui basestation event", query: "ep_eui=" + epEui.String(), bsEui: bsEuiA, source: "bs", event: "status", matches: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+			f, err := parseFilter(query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.matches, f.matches(tt.bsEui, tt.source, tt.epEui, tt.event))
+		})
+	}
+}
+
+func TestParseFilter_invalid(t *testing.T) {
+	_, err := parseFilter(url.Values{"bs_eui": {"010203040506070g"}})
+	assert.Error(t, err)
+	_, err = parseFilter(url.Values{"ep_eui": {"xyz"}})
+	assert.Error(t, err)
+}
+
+func TestEndnodeEui(t *testing.T) {
+	epEui := common.EUI64{1, 1, 1, 1, 1, 1, 1, 1}
+
+	pb := bs.EndnodeUplink{Message: &bs.EndnodeUplink_Att{Att: &bs.EndnodeAttMessage{EpEui: epEui.String()}}}
+	if assert.NotNil(t, endnodeEui(&pb)) {
+		assert.Equal(t, epEui, *endnodeEui(&pb))
+	}
+	assert.Nil(t, endnodeEui(&bs.EndnodeUplink{}))
+}
+
+func TestClientQueue(t *testing.T) {
+	c := newClient("peer", filter{}, 1)
+	assert.True(t, c.queue([]byte("a")))
+	assert.False(t, c.queue([]byte("b")))
+
+	c.drop()
+	c.drop()
+	select {
+	case <-c.dropped:
+	default:
+		t.Fatal("client not dropped")
+	}
+}
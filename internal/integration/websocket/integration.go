@@ -0,0 +1,420 @@
+// Package websocket implements a WebSocket integration.
+//
+// Clients connect to the endpoint and receive events and states as JSON encoded
+// bssci.AdapterMessage frames, using the same encoding as the json marshaler. Each
+// connection filters events by the bs_eui, ep_eui and event query parameters. Like
+// the retained states of the MQTT integrations, the last state of each basestation
+// is sent on connect. Clients that do not keep up are disconnected.
+package websocket
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/api/go/bssci"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/integration/mqtt"
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+)
+
+const (
+	eventSourceEndpoint    = "ep"
+	eventSourceBasestation = "bs"
+
+	// event type of states, used by the event filter
+	eventState = "state"
+)
+
+// Integration implements a WebSocket integration.
+type Integration struct {
+	server   *http.Server
+	upgrader websocket.Upgrader
+	marshal  func(msg proto.Message) ([]byte, error)
+
+	bind    string
+	path    string
+	tlsCert string
+	tlsKey  string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	sendBufferSize int
+	writeTimeout   time.Duration
+
+	// running connection handlers
+	handlers sync.WaitGroup
+
+	mux          sync.RWMutex
+	clients      map[*client]struct{}
+	basestations map[common.EUI64]struct{}
+	states       map[common.EUI64]*bs.BasestationState
+}
+
+// NewIntegration creates a new Integration.
+func NewIntegration(conf config.Config) (*Integration, error) {
+	c := conf.Integration.WebSocket
+
+	marshal, err := mqtt.Marshaler("json")
+	if err != nil {
+		return nil, err
+	}
+
+	integ := Integration{
+		marshal:        marshal,
+		bind:           c.Bind,
+		path:           c.Path,
+		tlsCert:        c.TLSCert,
+		tlsKey:         c.TLSKey,
+		sendBufferSize: c.SendBufferSize,
+		writeTimeout:   c.WriteTimeout,
+		clients:        make(map[*client]struct{}),
+		basestations:   make(map[common.EUI64]struct{}),
+		states:         make(map[common.EUI64]*bs.BasestationState),
+	}
+	integ.ctx, integ.cancel = context.WithCancel(context.Background())
+
+	if integ.path == "" {
+		integ.path = "/"
+	}
+
+	// the upgrader checks for the same origin by default
+	if len(c.AllowedOrigins) != 0 {
+		origins := c.AllowedOrigins
+		integ.upgrader.CheckOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || slices.Contains(origins, "*") || slices.Contains(origins, origin)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+integ.path, integ.handle)
+	integ.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return &integ, nil
+}
+
+// Start the integration.
+func (integ *Integration) Start() error {
+	ln, err := net.Listen("tcp", integ.bind)
+	if err != nil {
+		return errors.Wrap(err, "listen error")
+	}
+	if integ.tlsCert != "" || integ.tlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(integ.tlsCert, integ.tlsKey)
+		if err != nil {
+			ln.Close()
+			return errors.Wrap(err, "load key-pair error")
+		}
+		ln = tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{cert}})
+	}
+
+	log.Info().Str("bind", ln.Addr().String()).Str("path", integ.path).Msg("starting websocket server")
+	if addr, ok := ln.Addr().(*net.TCPAddr); ok && !addr.IP.IsLoopback() {
+		log.Warn().Str("bind", ln.Addr().String()).Msg("websocket server streams events to unauthenticated clients, bind to a loopback address behind an authenticating proxy")
+	}
+	integ.serve(ln)
+	return nil
+}
+
+func (integ *Integration) serve(ln net.Listener) {
+	go func() {
+		if err := integ.server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("websocket server error")
+		}
+	}()
+}
+
+// Stop the integration.
+func (integ *Integration) Stop() error {
+	integ.mux.RLock()
+	basestations := make([]common.EUI64, 0, len(integ.basestations))
+	for bsEui := range integ.basestations {
+		basestations = append(basestations, bsEui)
+	}
+	integ.mux.RUnlock()
+
+	// setup ctx logger
+	logger := log.With().Logger()
+	ctx := context.Background()
+	ctx = logger.WithContext(ctx)
+
+	// Set gateway state to offline for all gateways.
+	for _, bsEui := range basestations {
+		pl := bs.BasestationState{
+			BsEui: bsEui.String(),
+			State: bs.BasestationState_OFFLINE,
+		}
+		if err := integ.PublishState(ctx, bsEui, &pl); err != nil {
+			logger.Error().Err(err).Str("bs_eui", bsEui.String()).Msg("publish state error")
+		}
+	}
+
+	// connections send their buffered messages and close
+	integ.cancel()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := integ.server.Shutdown(shutdownCtx); err != nil {
+		log.Warn().Err(err).Msg("websocket server shutdown error")
+	}
+
+	// hijacked connections are not tracked by the server
+	done := make(chan struct{})
+	go func() {
+		integ.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-shutdownCtx.Done():
+		log.Warn().Msg("timeout closing websocket connections")
+	}
+	return nil
+}
+
+// Updates the subscription for the given EUI.
+//
+// The basestation is only tracked to publish its state on stop.
+func (integ *Integration) SetBasestationSubscription(subscribe bool, bsEui common.EUI64) error {
+	logger := log.With().Str("bs_eui", bsEui.String()).Bool("subscribe", subscribe).Logger()
+	logger.Debug().Msg("updating basestation subscription")
+
+	integ.mux.Lock()
+	defer integ.mux.Unlock()
+
+	if subscribe {
+		integ.basestations[bsEui] = struct{}{}
+	} else {
+		delete(integ.basestations, bsEui)
+	}
+	return nil
+}
+
+// Set handler for server command messages
+//
+// The WebSocket integration does not accept commands.
+func (integ *Integration) SetServerCommandHandler(f func(*bs.ServerCommand)) {}
+
+// Set handler for server command messages
+//
+// The WebSocket integration does not accept responses.
+func (integ *Integration) SetServerResponseHandler(f func(*bs.ServerResponse)) {}
+
+// Publish basestation messages.
+func (integ *Integration) PublishState(ctx context.Context, bsEui common.EUI64, pb *bs.BasestationState) error {
+	integ.mux.Lock()
+	integ.states[bsEui] = pb
+	integ.mux.Unlock()
+
+	return integ.publish(ctx, bsEui, nil, eventState, &bssci.AdapterMessage{
+		BsEui:   bsEui.String(),
+		Message: &bssci.AdapterMessage_State{State: pb},
+	})
+}
+
+// Publish endnode messages.
+func (integ *Integration) PublishEndnodeEvent(bsEui common.EUI64, event string, pb *bs.EndnodeUplink) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceEndpoint).Logger()
+	ctx := logger.WithContext(context.Background())
+
+	return integ.publish(ctx, bsEui, endnodeEui(pb), event, &bssci.AdapterMessage{
+		BsEui:       bsEui.String(),
+		EventSource: eventSourceEndpoint,
+		EventType:   event,
+		Message:     &bssci.AdapterMessage_EndnodeUplink{EndnodeUplink: pb},
+	})
+}
+
+// Publish basestation messages.
+func (integ *Integration) PublishBasestationEvent(bsEui common.EUI64, event string, pb *bs.BasestationUplink) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceBasestation).Logger()
+	ctx := logger.WithContext(context.Background())
+
+	return integ.publish(ctx, bsEui, nil, event, &bssci.AdapterMessage{
+		BsEui:       bsEui.String(),
+		EventSource: eventSourceBasestation,
+		EventType:   event,
+		Message:     &bssci.AdapterMessage_BasestationUplink{BasestationUplink: pb},
+	})
+}
+
+// Publish events generated by the adapter.
+func (integ *Integration) PublishAdapterEvent(bsEui common.EUI64, event string, pb *structpb.Struct) error {
+	// setup ctx logger
+	logger := log.With().Str("bs_eui", bsEui.String()).Str("event", event).Str("source", eventSourceBasestation).Logger()
+	ctx := logger.WithContext(context.Background())
+
+	return integ.publish(ctx, bsEui, nil, event, &bssci.AdapterMessage{
+		BsEui:       bsEui.String(),
+		EventSource: eventSourceBasestation,
+		EventType:   event,
+		Message:     &bssci.AdapterMessage_AdapterEvent{AdapterEvent: pb},
+	})
+}
+
+// Queue a message for all clients whose filter matches, drops clients with a full buffer
+func (integ *Integration) publish(ctx context.Context, bsEui common.EUI64, epEui *common.EUI64, event string, msg *bssci.AdapterMessage) error {
+	logger := zerolog.Ctx(ctx)
+
+	b, err := integ.marshal(msg)
+	if err != nil {
+		return errors.Wrap(err, "marshal message error")
+	}
+
+	integ.mux.RLock()
+	defer integ.mux.RUnlock()
+
+	var queued int
+	for c := range integ.clients {
+		if !c.filter.matches(bsEui, msg.EventSource, epEui, event) {
+			continue
+		}
+		if !c.queue(b) {
+			logger.Warn().Str("peer", c.peer).Msg("send buffer full, dropping client")
+			wsDroppedCounter().Inc()
+			c.drop()
+			continue
+		}
+		wsMessageCounter(event).Inc()
+		queued++
+	}
+	logger.Debug().Int("clients", queued).Msg("published message")
+	return nil
+}
+
+// Upgrade a request and stream messages until the connection closes
+func (integ *Integration) handle(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	integ.handlers.Add(1)
+	defer integ.handlers.Done()
+
+	// the upgrader replies with an error on failure
+	conn, err := integ.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Warn().Err(err).Str("peer", r.RemoteAddr).Msg("websocket upgrade error")
+		return
+	}
+	defer conn.Close()
+
+	c := newClient(r.RemoteAddr, f, integ.sendBufferSize)
+	logger := log.With().Str("peer", c.peer).Logger()
+	logger.Info().Msg("websocket client connected")
+
+	if err := integ.register(c); err != nil {
+		logger.Error().Err(err).Msg("register client error")
+		return
+	}
+	wsClientGauge().Inc()
+
+	defer func() {
+		integ.mux.Lock()
+		delete(integ.clients, c)
+		integ.mux.Unlock()
+		wsClientGauge().Dec()
+		logger.Info().Msg("websocket client disconnected")
+	}()
+
+	// clients do not send messages, reading handles control frames and detects the close
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case b := <-c.send:
+			if err := integ.write(conn, b); err != nil {
+				logger.Warn().Err(err).Msg("websocket write error")
+				return
+			}
+		case <-c.dropped:
+			integ.close(conn, websocket.CloseTryAgainLater, "send buffer full")
+			return
+		case <-closed:
+			return
+		case <-integ.ctx.Done():
+			// send the buffered messages before closing
+			for {
+				select {
+				case b := <-c.send:
+					if err := integ.write(conn, b); err != nil {
+						return
+					}
+				default:
+					integ.close(conn, websocket.CloseGoingAway, "adapter stopped")
+					return
+				}
+			}
+		}
+	}
+}
+
+// Add a client and queue the last states matching its filter
+func (integ *Integration) register(c *client) error {
+	integ.mux.Lock()
+	defer integ.mux.Unlock()
+
+	for bsEui, state := range integ.states {
+		if !c.filter.matches(bsEui, "", nil, eventState) {
+			continue
+		}
+		b, err := integ.marshal(&bssci.AdapterMessage{
+			BsEui:   bsEui.String(),
+			Message: &bssci.AdapterMessage_State{State: state},
+		})
+		if err != nil {
+			return errors.Wrap(err, "marshal state error")
+		}
+		if !c.queue(b) {
+			wsDroppedCounter().Inc()
+			return errors.New("send buffer full")
+		}
+	}
+	integ.clients[c] = struct{}{}
+	return nil
+}
+
+func (integ *Integration) write(conn *websocket.Conn, b []byte) error {
+	if integ.writeTimeout > 0 {
+		conn.SetWriteDeadline(time.Now().Add(integ.writeTimeout))
+	}
+	return conn.WriteMessage(websocket.TextMessage, b)
+}
+
+// Send a close frame, the connection is closed by the caller
+func (integ *Integration) close(conn *websocket.Conn, code int, text string) {
+	deadline := time.Now().Add(time.Second)
+	if err := conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), deadline); err != nil {
+		log.Debug().Err(err).Msg("websocket close error")
+	}
+}
@@ -0,0 +1,208 @@
+package websocket
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/suite"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/api/go/bssci"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/config"
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+)
+
+type IntegrationTestSuite struct {
+	suite.Suite
+
+	conf   config.Config
+	integ  *Integration
+	addr   string
+	bsEuiA common.EUI64
+	bsEuiB common.EUI64
+	epEui  common.EUI64
+}
+
+func (ts *IntegrationTestSuite) SetupTest() {
+	ts.bsEuiA = common.EUI64{1, 2, 3, 4, 5, 6, 7, 8}
+	ts.bsEuiB = common.EUI64{8, 7, 6, 5, 4, 3, 2, 1}
+	ts.epEui = common.EUI64{1, 1, 1, 1, 1, 1, 1, 1}
+
+	ts.conf = config.Config{}
+	ts.conf.Integration.WebSocket.Path = "/events"
+	ts.conf.Integration.WebSocket.SendBufferSize = 10
+	ts.conf.Integration.WebSocket.WriteTimeout = time.Second
+}
+
+func (ts *IntegrationTestSuite) TearDownTest() {
+	if ts.integ != nil {
+		ts.integ.Stop()
+		ts.integ = nil
+	}
+}
+
+func (ts *IntegrationTestSuite) start() {
+	var err error
+	ts.integ, err = NewIntegration(ts.conf)
+	ts.Require().NoError(err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	ts.Require().NoError(err)
+	ts.addr = ln.Addr().String()
+	ts.integ.serve(ln)
+}
+
+// Connect a client with the given query and wait until it is registered
+func (ts *IntegrationTestSuite) connect(query string) *websocket.Conn {
+	ts.integ.mux.RLock()
+	n := len(ts.integ.clients)
+	ts.integ.mux.RUnlock()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+ts.addr+"/events?"+query, nil)
+	ts.Require().NoError(err)
+	ts.T().Cleanup(func() { conn.Close() })
+
+	ts.Require().Eventually(func() bool {
+		ts.integ.mux.RLock()
+		defer ts.integ.mux.RUnlock()
+		return len(ts.integ.clients) == n+1
+	}, time.Second, time.Millisecond)
+	return conn
+}
+
+func (ts *IntegrationTestSuite) recv(conn *websocket.Conn) *bssci.AdapterMessage {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	mt, b, err := conn.ReadMessage()
+	ts.Require().NoError(err)
+	ts.Require().Equal(websocket.TextMessage, mt)
+
+	var msg bssci.AdapterMessage
+	ts.Require().NoError(protojson.Unmarshal(b, &msg))
+	return &msg
+}
+
+func (ts *IntegrationTestSuite) TestFilter() {
+	assert := ts.Assert()
+	ts.start()
+
+	connA := ts.connect("bs_eui=" + ts.bsEuiA.String() + "&event=status")
+	connEp := ts.connect("ep_eui=" + ts.epEui.String() + "&event=ul")
+	connAll := ts.connect("")
+
+	uplink := func(epEui common.EUI64) *bs.EndnodeUplink {
+		return &bs.EndnodeUplink{
+			BsEui:   ts.bsEuiB.String(),
+			Message: &bs.EndnodeUplink_UlData{UlData: &bs.EndnodeUlDataMessage{EpEui: epEui.String()}},
+		}
+	}
+	assert.NoError(ts.integ.PublishEndnodeEvent(ts.bsEuiB, "ul", uplink(common.EUI64{2, 2, 2, 2, 2, 2, 2, 2})))
+	assert.NoError(ts.integ.PublishEndnodeEvent(ts.bsEuiB, "ul", uplink(ts.epEui)))
+	assert.NoError(ts.integ.PublishBasestationEvent(ts.bsEuiA, "status", &bs.BasestationUplink{BsEui: ts.bsEuiA.String()}))
+
+	// the first client only receives status events of basestation A
+	msg := ts.recv(connA)
+	assert.Equal(ts.bsEuiA.String(), msg.BsEui)
+	assert.Equal("bs", msg.EventSource)
+	assert.Equal("status", msg.EventType)
+	assert.NotNil(msg.GetBasestationUplink())
+
+	msg = ts.recv(connEp)
+	assert.Equal("ul", msg.EventType)
+	assert.Equal(ts.epEui.String(), msg.GetEndnodeUplink().GetUlData().GetEpEui())
+
+	assert.Equal("ul", ts.recv(connAll).EventType)
+	assert.Equal("ul", ts.recv(connAll).EventType)
+	assert.Equal("status", ts.recv(connAll).EventType)
+}
+
+func (ts *IntegrationTestSuite) TestStateOnConnect() {
+	ts.start()
+	ts.Require().NoError(ts.integ.PublishState(context.Background(), ts.bsEuiA, &bs.BasestationState{BsEui: ts.bsEuiA.String(), State: bs.BasestationState_ONLINE}))
+	ts.Require().NoError(ts.integ.PublishState(context.Background(), ts.bsEuiB, &bs.BasestationState{BsEui: ts.bsEuiB.String(), State: bs.BasestationState_ONLINE}))
+
+	conn := ts.connect("bs_eui=" + ts.bsEuiB.String())
+	msg := ts.recv(conn)
+	ts.Assert().Equal(ts.bsEuiB.String(), msg.BsEui)
+	ts.Assert().Equal(bs.BasestationState_ONLINE, msg.GetState().GetState())
+}
+
+func (ts *IntegrationTestSuite) TestInvalidFilter() {
+	ts.start()
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws://"+ts.addr+"/events?bs_eui=xyz", nil)
+	ts.Require().Error(err)
+	ts.Assert().Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func (ts *IntegrationTestSuite) TestOrigin() {
+	ts.conf.Integration.WebSocket.AllowedOrigins = []string{"https://noc.example.com"}
+	ts.start()
+
+	header := http.Header{"Origin": {"https://other.example.com"}}
+	_, resp, err := websocket.DefaultDialer.Dial("ws://"+ts.addr+"/events", header)
+	ts.Require().Error(err)
+	ts.Assert().Equal(http.StatusForbidden, resp.StatusCode)
+
+	header.Set("Origin", "https://noc.example.com")
+	conn, _, err := websocket.DefaultDialer.Dial("ws://"+ts.addr+"/events", header)
+	ts.Require().NoError(err)
+	conn.Close()
+}
+
+func (ts *IntegrationTestSuite) TestDropSlowClient() {
+	ts.conf.Integration.WebSocket.SendBufferSize = 1
+	ts.start()
+
+	// a client that is not served keeps its buffer full
+	c := newClient("slow", filter{}, 1)
+	ts.integ.mux.Lock()
+	ts.integ.clients[c] = struct{}{}
+	ts.integ.mux.Unlock()
+
+	ts.Assert().NoError(ts.integ.PublishEndnodeEvent(ts.bsEuiA, "ul", &bs.EndnodeUplink{}))
+	ts.Assert().NoError(ts.integ.PublishEndnodeEvent(ts.bsEuiA, "ul", &bs.EndnodeUplink{}))
+	select {
+	case <-c.dropped:
+	default:
+		ts.Fail("client not dropped")
+	}
+}
+
+func (ts *IntegrationTestSuite) TestDropClose() {
+	ts.start()
+	conn := ts.connect("")
+
+	ts.integ.mux.RLock()
+	for c := range ts.integ.clients {
+		c.drop()
+	}
+	ts.integ.mux.RUnlock()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := conn.ReadMessage()
+	ts.Assert().True(websocket.IsCloseError(err, websocket.CloseTryAgainLater))
+}
+
+func (ts *IntegrationTestSuite) TestStop() {
+	ts.start()
+	conn := ts.connect("")
+	ts.Require().NoError(ts.integ.SetBasestationSubscription(true, ts.bsEuiA))
+	ts.Require().NoError(ts.integ.Stop())
+	ts.integ = nil
+
+	// the offline state is sent before the connection closes
+	msg := ts.recv(conn)
+	ts.Assert().Equal(bs.BasestationState_OFFLINE, msg.GetState().GetState())
+	_, _, err := conn.ReadMessage()
+	ts.Assert().True(websocket.IsCloseError(err, websocket.CloseGoingAway))
+}
+
+func TestIntegration(t *testing.T) {
+	suite.Run(t, new(IntegrationTestSuite))
+}
@@ -0,0 +1,35 @@
+package websocket
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	cg = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "integration_websocket_client_count",
+		Help: "The number of connected WebSocket clients.",
+	})
+
+	mc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "integration_websocket_message_count",
+		Help: "The number of messages queued for WebSocket clients (per message).",
+	}, []string{"message"})
+
+	dc = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "integration_websocket_dropped_count",
+		Help: "The number of clients disconnected because their send buffer was full.",
+	})
+)
+
+func wsClientGauge() prometheus.Gauge {
+	return cg
+}
+
+func wsMessageCounter(message string) prometheus.Counter {
+	return mc.With(prometheus.Labels{"message": message})
+}
+
+func wsDroppedCounter() prometheus.Counter {
+	return dc
+}
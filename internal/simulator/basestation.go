@@ -0,0 +1,371 @@
+// Package simulator implements BSSCI basestations for testing the adapter without mioty hardware.
+package simulator
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs/messages"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/tinylib/msgp/msgp"
+)
+
+// A simulated basestation
+type Basestation struct {
+	sync.Mutex
+
+	config BasestationConfig
+	logger zerolog.Logger
+
+	conn net.Conn
+	// next opId of an operation initiated by the basestation, 0 is used by con
+	opId int64
+	// session UUID, kept across reconnects
+	snBsUuid uuid.UUID
+	started  time.Time
+	// active variable MAC types
+	vmMacTypes map[uint32]struct{}
+	// packet counter per endnode
+	packetCnt map[common.EUI64]uint32
+
+	// counters across all sessions
+	sentCnt  atomic.Int64
+	errorCnt atomic.Int64
+}
+
+// Counters of a simulated basestation
+type Stats struct {
+	// Messages sent by the traffic generators
+	Sent int64
+	// Error messages received from the adapter, including rejected connections
+	Errors int64
+}
+
+func NewBasestation(config BasestationConfig, logger zerolog.Logger) *Basestation {
+	return &Basestation{
+		config:     config,
+		logger:     logger.With().Str("bs_eui", config.eui.String()).Logger(),
+		snBsUuid:   uuid.New(),
+		started:    time.Now(),
+		vmMacTypes: make(map[uint32]struct{}),
+		packetCnt:  make(map[common.EUI64]uint32),
+	}
+}
+
+// Eui of the basestation
+func (b *Basestation) Eui() common.EUI64 {
+	return b.config.eui
+}
+
+// Counters across all sessions of the basestation
+func (b *Basestation) Stats() Stats {
+	return Stats{
+		Sent:   b.sentCnt.Load(),
+		Errors: b.errorCnt.Load(),
+	}
+}
+
+// Run a session over the connection until the context is done or the connection fails.
+//
+// The connection is closed on return.
+func (b *Basestation) Run(ctx context.Context, conn net.Conn) error {
+	b.Lock()
+	b.conn = conn
+	b.opId = 1
+	b.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	if err := b.connect(); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, traffic := range b.config.Traffic {
+		wg.Add(1)
+		go func(traffic TrafficConfig) {
+			defer wg.Done()
+			b.generate(ctx, traffic)
+		}(traffic)
+	}
+
+	err := b.handleMessages()
+	stopped := ctx.Err() != nil
+
+	// stop the traffic generators
+	cancel()
+	wg.Wait()
+
+	if stopped {
+		return nil
+	}
+	return err
+}
+
+// Send the con message and wait for the conRsp
+func (b *Basestation) connect() error {
+	vendor, model, name := b.config.Vendor, b.config.Model, b.config.Name
+	con := messages.Con{
+		Command:  structs.MsgCon,
+		OpId:     0,
+		Version:  b.config.Version,
+		BsEui:    b.config.eui,
+		Vendor:   &vendor,
+		Model:    &model,
+		Name:     &name,
+		Bidi:     b.config.Bidi,
+		SnBsUuid: structs.NewSessionUuid(b.snBsUuid),
+	}
+	if err := b.write(&con); err != nil {
+		return err
+	}
+
+	cmd, raw, err := bssci_v1.ReadBssciMessage(b.conn)
+	if err != nil {
+		return errors.Wrap(err, "read conRsp error")
+	}
+	switch cmd.GetCommand() {
+	case structs.MsgConRsp:
+		var rsp messages.ConRsp
+		if _, err := rsp.UnmarshalMsg(raw); err != nil {
+			return errors.Wrap(err, "unmarshal conRsp error")
+		}
+		b.logger.Info().Str("version", rsp.Version).Msg("connected")
+	case structs.MsgError:
+		var rsp messages.BssciError
+		rsp.UnmarshalMsg(raw)
+		b.errorCnt.Add(1)
+		return errors.Errorf("connection rejected: %s (code %d)", rsp.Message, rsp.Code)
+	default:
+		return errors.Errorf("expected conRsp, got %s", cmd.GetCommand())
+	}
+
+	conCmp := messages.NewConCmp(cmd.GetOpId())
+	return b.write(&conCmp)
+}
+
+// Answer the messages of the adapter
+func (b *Basestation) handleMessages() error {
+	for {
+		cmd, raw, err := bssci_v1.ReadBssciMessage(b.conn)
+		if err != nil {
+			return err
+		}
+
+		response, err := b.handleMessage(cmd, raw)
+		if err != nil {
+			b.logger.Error().Err(err).Str("command", string(cmd.GetCommand())).Msg("failed to handle message")
+			bssciError := messages.NewBssciError(cmd.GetOpId(), messages.ErrorCodeEBADMSG, err.Error())
+			response = &bssciError
+		}
+		if response == nil {
+			continue
+		}
+		if err := b.write(response); err != nil {
+			return err
+		}
+	}
+}
+
+// returns the response to a message of the adapter, nil if the operation is complete
+func (b *Basestation) handleMessage(cmd structs.CommandHeader, raw msgp.Raw) (messages.MessageMsgp, error) {
+	opId := cmd.GetOpId()
+	logger := b.logger.With().Str("command", string(cmd.GetCommand())).Int64("op_id", opId).Logger()
+	logger.Debug().Msg("received message")
+
+	switch cmd.GetCommand() {
+	// operations initiated by the adapter
+	case structs.ServerMsgPing:
+		rsp := messages.NewPingRsp(opId)
+		return &rsp, nil
+	case structs.ServerMsgStatus:
+		now := uint64(time.Now().UnixNano())
+		uptime := uint64(time.Since(b.started).Seconds())
+		rsp := messages.NewStatusRsp(opId, 0, "ok", now, 0, nil, &uptime, nil, nil, nil)
+		return &rsp, nil
+	case structs.ServerMsgDlDataQue:
+		var msg messages.DlDataQue
+		if _, err := msg.UnmarshalMsg(raw); err != nil {
+			return nil, err
+		}
+		logger.Info().Str("ep_eui", msg.EpEui.String()).Uint64("que_id", msg.QueId).Msg("downlink queued")
+		rsp := messages.NewDlDataQueRsp(opId)
+		return &rsp, nil
+	case structs.ServerMsgDlDataRev:
+		rsp := messages.NewDlDataRevRsp(opId)
+		return &rsp, nil
+	case structs.ServerMsgDlRxStatQry:
+		rsp := messages.NewDlRxStatQryRsp(opId)
+		return &rsp, nil
+	case structs.ServerMsgAttPrp:
+		var msg messages.AttPrp
+		if _, err := msg.UnmarshalMsg(raw); err != nil {
+			return nil, err
+		}
+		logger.Info().Str("ep_eui", msg.EpEui.String()).Msg("endnode attach propagated")
+		rsp := messages.NewAttPrpRsp(opId)
+		return &rsp, nil
+	case structs.ServerMsgDetPrp:
+		rsp := messages.NewDetPrpRsp(opId)
+		return &rsp, nil
+	case structs.ServerMsgVmActivate:
+		var msg messages.VmActivate
+		if _, err := msg.UnmarshalMsg(raw); err != nil {
+			return nil, err
+		}
+		b.Lock()
+		b.vmMacTypes[msg.MacType] = struct{}{}
+		b.Unlock()
+		rsp := messages.NewVmActivateRsp(opId)
+		return &rsp, nil
+	case structs.ServerMsgVmDeactivate:
+		var msg messages.VmDeactivate
+		if _, err := msg.UnmarshalMsg(raw); err != nil {
+			return nil, err
+		}
+		b.Lock()
+		delete(b.vmMacTypes, msg.MacType)
+		b.Unlock()
+		rsp := messages.NewVmDeactivateRsp(opId)
+		return &rsp, nil
+	case structs.ServerMsgVmStatus:
+		rsp := messages.NewVmStatusRsp(opId, b.activeMacTypes())
+		return &rsp, nil
+
+	// responses to operations initiated by the basestation
+	case structs.ServerMsgAttRsp:
+		rsp := messages.NewAttCmp(opId)
+		return &rsp, nil
+	case structs.ServerMsgDetRsp:
+		rsp := messages.NewDetCmp(opId)
+		return &rsp, nil
+	case structs.ServerMsgUlDataRsp:
+		rsp := messages.NewUlDataCmp(opId)
+		return &rsp, nil
+	case structs.ServerMsgVmUlDataRsp:
+		rsp := messages.NewVmUlDataCmp(opId)
+		return &rsp, nil
+	case structs.ServerMsgDlRxStatRsp:
+		rsp := messages.NewDlRxStatCmp(opId)
+		return &rsp, nil
+	case structs.ServerMsgDlDataResRsp:
+		rsp := messages.NewDlDataResCmp(opId)
+		return &rsp, nil
+	case structs.ServerMsgPingRsp:
+		rsp := messages.NewPingCmp(opId)
+		return &rsp, nil
+
+	case structs.ServerMsgError:
+		var msg messages.BssciError
+		if _, err := msg.UnmarshalMsg(raw); err != nil {
+			return nil, err
+		}
+		b.errorCnt.Add(1)
+		logger.Warn().Uint32("err_code", msg.Code).Str("err_msg", msg.Message).Msg("received bssci error message")
+		rsp := messages.NewBssciErrorAck(opId)
+		return &rsp, nil
+
+	// completions of operations initiated by the adapter
+	case structs.ServerMsgPingCmp, structs.ServerMsgStatusCmp, structs.ServerMsgDlDataQueCmp,
+		structs.ServerMsgDlDataRevCmp, structs.ServerMsgDlRxStatQryCmp, structs.ServerMsgAttPrpCmp,
+		structs.ServerMsgDetPrpCmp, structs.ServerMsgVmActivateCmp, structs.ServerMsgVmDeactivateCmp,
+		structs.ServerMsgVmStatusCmp, structs.ServerMsgErrorAck:
+		return nil, nil
+
+	default:
+		logger.Warn().Msg("unsupported message type")
+		rsp := messages.NewBssciError(opId, messages.ErrorCodeENOTSUP, "unsupported message type")
+		return &rsp, nil
+	}
+}
+
+func (b *Basestation) activeMacTypes() []int64 {
+	b.Lock()
+	defer b.Unlock()
+
+	macTypes := make([]int64, 0, len(b.vmMacTypes))
+	for macType := range b.vmMacTypes {
+		macTypes = append(macTypes, int64(macType))
+	}
+	sort.Slice(macTypes, func(i, j int) bool { return macTypes[i] < macTypes[j] })
+	return macTypes
+}
+
+// Send messages of the traffic config until the count is reached or the context is done
+func (b *Basestation) generate(ctx context.Context, traffic TrafficConfig) {
+	select {
+	case <-time.After(traffic.Delay):
+	case <-ctx.Done():
+		return
+	}
+
+	ticker := time.NewTicker(traffic.Interval)
+	defer ticker.Stop()
+
+	for sent := 0; traffic.Count == 0 || sent < traffic.Count; sent++ {
+		msg := b.newMessage(traffic, time.Now())
+		if err := b.write(msg); err != nil {
+			b.logger.Error().Err(err).Str("command", string(msg.GetCommand())).Msg("failed to send message")
+			return
+		}
+		b.sentCnt.Add(1)
+		b.logger.Debug().Str("command", string(msg.GetCommand())).Int64("op_id", msg.GetOpId()).Msg("sent message")
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Create the next message of the traffic config
+func (b *Basestation) newMessage(traffic TrafficConfig, now time.Time) messages.MessageMsgp {
+	b.Lock()
+	opId := b.opId
+	b.opId++
+	packetCnt := b.packetCnt[traffic.endnode]
+	b.packetCnt[traffic.endnode]++
+	b.Unlock()
+
+	rxTime := uint64(now.UnixNano())
+
+	switch traffic.Type {
+	case TrafficAtt:
+		msg := messages.NewAtt(opId, traffic.endnode, rxTime, nil, packetCnt, traffic.Snr, traffic.Rssi, nil, nil, nil, [4]byte{}, [4]byte{}, nil, false, false, false, false)
+		return &msg
+	case TrafficDlRxStat:
+		msg := messages.NewDlRxStat(opId, traffic.endnode, "", rxTime, packetCnt, traffic.Snr, traffic.Rssi)
+		return &msg
+	case TrafficVmUlData:
+		msg := messages.NewVmUlData(opId, traffic.MacType, traffic.payload, rxTime, 0, traffic.Snr, traffic.Rssi, nil, nil, 0, 0, 0, [2]byte{})
+		return &msg
+	default:
+		msg := messages.NewUlData(opId, traffic.endnode, rxTime, nil, packetCnt, traffic.Snr, traffic.Rssi, nil, nil, nil, nil, traffic.payload, nil, false, false, false)
+		return &msg
+	}
+}
+
+// Write a message, safe for concurrent use
+func (b *Basestation) write(msg messages.MessageMsgp) error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return bssci_v1.WriteBssciMessage(b.conn, msg)
+}
@@ -0,0 +1,168 @@
+package simulator
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs/messages"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// plays the adapter side of a simulated basestation session
+type adapter struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func (a *adapter) write(msg messages.MessageMsgp) {
+	require.NoError(a.t, bssci_v1.WriteBssciMessage(a.conn, msg))
+}
+
+func (a *adapter) expect(cmd structs.Command, opId int64) []byte {
+	header, raw, err := bssci_v1.ReadBssciMessage(a.conn)
+	require.NoError(a.t, err)
+	require.Equal(a.t, cmd, header.GetCommand())
+	require.Equal(a.t, opId, header.GetOpId())
+	return raw
+}
+
+func newTestBasestation(t *testing.T, traffic ...TrafficConfig) (*Basestation, *adapter, chan error) {
+	s := Scenario{Basestations: []BasestationConfig{{Eui: "0102030405060708", Traffic: traffic}}}
+	require.NoError(t, s.init())
+
+	bs := NewBasestation(s.Basestations[0], zerolog.Nop())
+	server, client := net.Pipe()
+	server.SetDeadline(time.Now().Add(5 * time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- bs.Run(ctx, client)
+	}()
+
+	a := &adapter{t: t, conn: server}
+
+	// connect
+	raw := a.expect(structs.MsgCon, 0)
+	var con messages.Con
+	_, err := con.UnmarshalMsg(raw)
+	require.NoError(t, err)
+	assert.Equal(t, bs.Eui(), con.BsEui)
+	assert.NoError(t, con.Validate())
+
+	conRsp := messages.NewConRsp(0, con.Version, uuid.New())
+	a.write(&conRsp)
+	a.expect(structs.MsgConCmp, 0)
+
+	return bs, a, done
+}
+
+func TestBasestation_serverOperations(t *testing.T) {
+	bs, a, done := newTestBasestation(t)
+
+	ping := messages.NewPing(-1)
+	a.write(&ping)
+	a.expect(structs.MsgPingRsp, -1)
+	pingCmp := messages.NewPingCmp(-1)
+	a.write(&pingCmp)
+
+	status := messages.NewStatus(-2)
+	a.write(&status)
+	var statusRsp messages.StatusRsp
+	_, err := statusRsp.UnmarshalMsg(a.expect(structs.MsgStatusRsp, -2))
+	require.NoError(t, err)
+	assert.NoError(t, statusRsp.Validate())
+
+	que := messages.DlDataQue{Command: structs.MsgDlDataQue, OpId: -3, QueId: 7}
+	a.write(&que)
+	a.expect(structs.MsgDlDataQueRsp, -3)
+
+	attPrp := messages.AttPrp{Command: structs.MsgAttPrp, OpId: -4}
+	a.write(&attPrp)
+	a.expect(structs.MsgAttPrpRsp, -4)
+
+	activate := messages.NewVmActivate(-5, 3)
+	a.write(&activate)
+	a.expect(structs.MsgVmActivateRsp, -5)
+
+	vmStatus := messages.NewVmStatus(-6)
+	a.write(&vmStatus)
+	var vmStatusRsp messages.VmStatusRsp
+	_, err = vmStatusRsp.UnmarshalMsg(a.expect(structs.MsgVmStatusRsp, -6))
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3}, vmStatusRsp.MacTypes)
+
+	deactivate := messages.NewVmDeactivate(-7, 3)
+	a.write(&deactivate)
+	a.expect(structs.MsgVmDeactivateRsp, -7)
+
+	bssciError := messages.NewBssciError(-8, messages.ErrorCodeEIO, "test")
+	a.write(&bssciError)
+	a.expect(structs.MsgErrorAck, -8)
+
+	require.NoError(t, bssci_v1.WriteBssciMessage(a.conn, &messages.BssciErrorAck{Command: "unsupported", OpId: -9}))
+	a.expect(structs.MsgError, -9)
+
+	// the adapter closes the connection
+	a.conn.Close()
+	assert.Error(t, <-done)
+	assert.Equal(t, Stats{Errors: 1}, bs.Stats())
+}
+
+func TestBasestation_traffic(t *testing.T) {
+	bs, a, done := newTestBasestation(t,
+		TrafficConfig{Type: TrafficUlData, Endnode: "1112131415161718", Interval: time.Millisecond, Count: 2, Payload: "cafe"},
+	)
+
+	for opId := int64(1); opId <= 2; opId++ {
+		var ulData messages.UlData
+		_, err := ulData.UnmarshalMsg(a.expect(structs.MsgUlData, opId))
+		require.NoError(t, err)
+		assert.NoError(t, ulData.Validate())
+		assert.Equal(t, []byte{0xca, 0xfe}, ulData.UserData)
+		assert.Equal(t, uint32(opId-1), ulData.PacketCnt)
+
+		rsp := messages.NewUlDataRsp(opId)
+		a.write(&rsp)
+		a.expect(structs.MsgUlDataCmp, opId)
+	}
+
+	a.conn.Close()
+	assert.Error(t, <-done)
+	assert.Equal(t, Stats{Sent: 2}, bs.Stats())
+}
+
+func TestBasestation_newMessage(t *testing.T) {
+	s := Scenario{Basestations: []BasestationConfig{{
+		Eui: "0102030405060708",
+		Traffic: []TrafficConfig{
+			{Type: TrafficAtt, Endnode: "1112131415161718", Interval: time.Second},
+			{Type: TrafficUlData, Endnode: "1112131415161718", Interval: time.Second},
+			{Type: TrafficDlRxStat, Endnode: "1112131415161718", Interval: time.Second},
+			{Type: TrafficVmUlData, Interval: time.Second, MacType: 2},
+		},
+	}}}
+	require.NoError(t, s.init())
+	bs := NewBasestation(s.Basestations[0], zerolog.Nop())
+
+	want := []structs.Command{structs.MsgAtt, structs.MsgUlData, structs.MsgDlRxStat, structs.MsgVmUlData}
+	for i, traffic := range s.Basestations[0].Traffic {
+		msg := bs.newMessage(traffic, time.Now())
+		assert.Equal(t, want[i], msg.GetCommand())
+		assert.Equal(t, int64(i), msg.GetOpId())
+
+		if v, ok := msg.(messages.ValidatableMessage); assert.True(t, ok) {
+			assert.NoError(t, v.Validate())
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package simulator
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/SplitStackServer/splitstack/api/go/v5/bs"
+	"github.com/pkg/errors"
+)
+
+// Parameters of a load test
+type BenchConfig struct {
+	// Number of simulated basestations
+	Basestations int
+	// Number of endnodes per basestation
+	Endnodes int
+	// Total uplink rate of all basestations per second
+	Rate float64
+	// Size of the user data of an uplink
+	PayloadSize int
+	// Requested protocol version, the latest if empty
+	Version string
+}
+
+// Create the scenario of a load test.
+//
+// Every endnode sends ulData at the same interval, the first uplinks are spread across one
+// interval. The EUIs are random to separate the events of different runs on a shared broker.
+func NewBenchScenario(config BenchConfig) (Scenario, error) {
+	var s Scenario
+
+	if config.Basestations <= 0 || config.Basestations > math.MaxUint16 {
+		return s, errors.Errorf("number of basestations must be between 1 and %d", math.MaxUint16)
+	}
+	if config.Endnodes <= 0 || config.Endnodes > math.MaxUint16 {
+		return s, errors.Errorf("number of endnodes must be between 1 and %d", math.MaxUint16)
+	}
+	if config.Rate <= 0 {
+		return s, errors.New("rate must be positive")
+	}
+
+	var runId [4]byte
+	if _, err := rand.Read(runId[:]); err != nil {
+		return s, errors.Wrap(err, "generate run id error")
+	}
+
+	total := config.Basestations * config.Endnodes
+	interval := time.Duration(float64(total) / config.Rate * float64(time.Second))
+	payload := hex.EncodeToString(make([]byte, config.PayloadSize))
+
+	for i := 0; i < config.Basestations; i++ {
+		var eui common.EUI64
+		copy(eui[:], runId[:])
+		binary.BigEndian.PutUint32(eui[4:], uint32(i))
+
+		basestation := BasestationConfig{
+			Eui:     eui.String(),
+			Version: config.Version,
+			Vendor:  "mioty-bssci-adapter",
+			Model:   "bench",
+			Bidi:    true,
+		}
+		for j := 0; j < config.Endnodes; j++ {
+			var endnode common.EUI64
+			copy(endnode[:], runId[:])
+			binary.BigEndian.PutUint16(endnode[4:], uint16(i))
+			binary.BigEndian.PutUint16(endnode[6:], uint16(j))
+
+			basestation.Traffic = append(basestation.Traffic, TrafficConfig{
+				Type:     TrafficUlData,
+				Endnode:  endnode.String(),
+				Interval: interval,
+				Delay:    time.Duration(float64(interval) * float64(j*config.Basestations+i) / float64(total)),
+				Payload:  payload,
+			})
+		}
+		s.Basestations = append(s.Basestations, basestation)
+	}
+	return s, s.init()
+}
+
+// identifies an uplink of a load test
+type benchUplink struct {
+	bsEui     string
+	epEui     string
+	packetCnt uint32
+}
+
+// Records the uplink events published by the adapter during a load test
+type BenchRecorder struct {
+	sync.Mutex
+
+	start        time.Time
+	basestations map[string]struct{}
+	received     map[benchUplink]struct{}
+	latencies    []time.Duration
+	duplicates   int
+	last         time.Time
+}
+
+func NewBenchRecorder(scenario Scenario, start time.Time) *BenchRecorder {
+	r := BenchRecorder{
+		start:        start,
+		basestations: make(map[string]struct{}),
+		received:     make(map[benchUplink]struct{}),
+	}
+	for _, basestation := range scenario.Basestations {
+		r.basestations[basestation.eui.String()] = struct{}{}
+	}
+	return &r
+}
+
+// Record an uplink event, events of other basestations are ignored.
+//
+// The latency is measured from the rxTime set by the simulated basestation.
+func (r *BenchRecorder) Record(uplink *bs.EndnodeUplink, ts time.Time) {
+	ulData := uplink.GetUlData()
+	rxTime := uplink.GetMeta().GetRxTime()
+	if ulData == nil || rxTime == nil {
+		return
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.basestations[uplink.GetBsEui()]; !ok {
+		return
+	}
+
+	key := benchUplink{
+		bsEui:     uplink.GetBsEui(),
+		epEui:     ulData.GetEpEui(),
+		packetCnt: uplink.GetMeta().GetPacketCnt(),
+	}
+	if _, ok := r.received[key]; ok {
+		r.duplicates++
+		return
+	}
+	r.received[key] = struct{}{}
+	r.latencies = append(r.latencies, ts.Sub(rxTime.AsTime()))
+	if ts.After(r.last) {
+		r.last = ts
+	}
+}
+
+// Number of unique uplinks received
+func (r *BenchRecorder) Received() int {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.received)
+}
+
+// Result of a load test
+type BenchReport struct {
+	// Time from the start of the test to the last received uplink
+	Duration time.Duration `json:"duration"`
+	// Uplinks sent by the simulated basestations
+	Sent int64 `json:"sent"`
+	// Unique uplinks published by the adapter
+	Received int `json:"received"`
+	// Uplinks sent but not published
+	Dropped int64 `json:"dropped"`
+	// Uplinks published more than once
+	Duplicates int `json:"duplicates"`
+	// Error messages and failed connections reported by the adapter
+	Errors int64 `json:"errors"`
+	// Received uplinks per second
+	Throughput float64 `json:"throughput"`
+
+	Latency BenchLatency `json:"latency"`
+}
+
+// End-to-end latency from the basestation to the published event
+type BenchLatency struct {
+	Min  time.Duration `json:"min"`
+	Mean time.Duration `json:"mean"`
+	P50  time.Duration `json:"p50"`
+	P90  time.Duration `json:"p90"`
+	P95  time.Duration `json:"p95"`
+	P99  time.Duration `json:"p99"`
+	Max  time.Duration `json:"max"`
+}
+
+// Create the report of the recorded uplinks
+func (r *BenchRecorder) Report(sent int64, adapterErrors int64) BenchReport {
+	r.Lock()
+	defer r.Unlock()
+
+	report := BenchReport{
+		Sent:       sent,
+		Received:   len(r.received),
+		Dropped:    max(sent-int64(len(r.received)), 0),
+		Duplicates: r.duplicates,
+		Errors:     adapterErrors,
+	}
+	if !r.last.IsZero() {
+		report.Duration = r.last.Sub(r.start)
+	}
+	if report.Duration > 0 {
+		report.Throughput = float64(report.Received) / report.Duration.Seconds()
+	}
+
+	if len(r.latencies) == 0 {
+		return report
+	}
+
+	latencies := append([]time.Duration(nil), r.latencies...)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	var sum time.Duration
+	for _, l := range latencies {
+		sum += l
+	}
+	report.Latency = BenchLatency{
+		Min:  latencies[0],
+		Mean: sum / time.Duration(len(latencies)),
+		P50:  percentile(latencies, 50),
+		P90:  percentile(latencies, 90),
+		P95:  percentile(latencies, 95),
+		P99:  percentile(latencies, 99),
+		Max:  latencies[len(latencies)-1],
+	}
+	return report
+}
+
+// nearest-rank percentile of sorted values
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,109 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs/messages"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBenchScenario(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewBenchScenario(BenchConfig{Basestations: 2, Endnodes: 3, Rate: 12, PayloadSize: 4})
+	require.NoError(t, err)
+
+	endnodes := make(map[common.EUI64]struct{})
+	if assert.Len(s.Basestations, 2) {
+		assert.NotEqual(s.Basestations[0].eui, s.Basestations[1].eui)
+
+		for _, bs := range s.Basestations {
+			if assert.Len(bs.Traffic, 3) {
+				for _, traffic := range bs.Traffic {
+					assert.Equal(TrafficUlData, traffic.Type)
+					// 6 endnodes at 12 uplinks per second
+					assert.Equal(500*time.Millisecond, traffic.Interval)
+					assert.Less(traffic.Delay, traffic.Interval)
+					assert.Len(traffic.payload, 4)
+					endnodes[traffic.endnode] = struct{}{}
+				}
+			}
+		}
+	}
+	assert.Len(endnodes, 6)
+
+	// every run uses different EUIs
+	other, err := NewBenchScenario(BenchConfig{Basestations: 1, Endnodes: 1, Rate: 1})
+	require.NoError(t, err)
+	assert.NotEqual(s.Basestations[0].eui, other.Basestations[0].eui)
+
+	for _, config := range []BenchConfig{
+		{Basestations: 0, Endnodes: 1, Rate: 1},
+		{Basestations: 1, Endnodes: 0, Rate: 1},
+		{Basestations: 1, Endnodes: 1, Rate: 0},
+		{Basestations: 1 << 16, Endnodes: 1, Rate: 1},
+	} {
+		_, err := NewBenchScenario(config)
+		assert.Error(err, "%+v", config)
+	}
+}
+
+func TestBenchRecorder(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewBenchScenario(BenchConfig{Basestations: 1, Endnodes: 1, Rate: 1})
+	require.NoError(t, err)
+	bsEui := s.Basestations[0].eui
+	epEui := s.Basestations[0].Traffic[0].endnode
+
+	start := time.Now()
+	r := NewBenchRecorder(s, start)
+
+	uplink := func(bsEui common.EUI64, packetCnt uint32, rxTime time.Time) {
+		msg := messages.NewUlData(int64(packetCnt), epEui, uint64(rxTime.UnixNano()), nil, packetCnt, 0, 0, nil, nil, nil, nil, nil, nil, false, false, false)
+		r.Record(msg.IntoProto(&bsEui), rxTime.Add(time.Duration(packetCnt+1)*time.Millisecond))
+	}
+
+	for i := uint32(0); i < 100; i++ {
+		uplink(bsEui, i, start.Add(time.Duration(i)*10*time.Millisecond))
+	}
+	// duplicate
+	uplink(bsEui, 0, start)
+	// other basestation
+	uplink(common.EUI64{1}, 0, start)
+
+	assert.Equal(100, r.Received())
+
+	report := r.Report(102, 3)
+	assert.Equal(int64(102), report.Sent)
+	assert.Equal(100, report.Received)
+	assert.Equal(int64(2), report.Dropped)
+	assert.Equal(1, report.Duplicates)
+	assert.Equal(int64(3), report.Errors)
+	assert.Equal(1090*time.Millisecond, report.Duration)
+	assert.InDelta(100/1.09, report.Throughput, 0.01)
+	assert.Equal(BenchLatency{
+		Min:  1 * time.Millisecond,
+		Mean: 50500 * time.Microsecond,
+		P50:  50 * time.Millisecond,
+		P90:  90 * time.Millisecond,
+		P95:  95 * time.Millisecond,
+		P99:  99 * time.Millisecond,
+		Max:  100 * time.Millisecond,
+	}, report.Latency)
+
+	// more received than sent is not reported as negative drops
+	assert.Equal(int64(0), r.Report(50, 0).Dropped)
+}
+
+func TestBenchRecorder_empty(t *testing.T) {
+	s, err := NewBenchScenario(BenchConfig{Basestations: 1, Endnodes: 1, Rate: 1})
+	require.NoError(t, err)
+
+	report := NewBenchRecorder(s, time.Now()).Report(5, 0)
+	assert.Equal(t, BenchReport{Sent: 5, Dropped: 5}, report)
+}
@@ -0,0 +1,133 @@
+package simulator
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/viper"
+)
+
+// Types of generated traffic
+const (
+	TrafficAtt      = string(structs.MsgAtt)
+	TrafficUlData   = string(structs.MsgUlData)
+	TrafficDlRxStat = string(structs.MsgDlRxStat)
+	TrafficVmUlData = string(structs.MsgVmUlData)
+)
+
+// Scenario describes the simulated basestations
+type Scenario struct {
+	Basestations []BasestationConfig `mapstructure:"basestations"`
+}
+
+// A simulated basestation
+type BasestationConfig struct {
+	// Basestation EUI64
+	Eui string `mapstructure:"eui"`
+	// Requested protocol version
+	Version string `mapstructure:"version"`
+	Vendor  string `mapstructure:"vendor"`
+	Model   string `mapstructure:"model"`
+	Name    string `mapstructure:"name"`
+	Bidi    bool   `mapstructure:"bidi"`
+
+	Traffic []TrafficConfig `mapstructure:"traffic"`
+
+	eui common.EUI64
+}
+
+// Traffic generated by a simulated basestation
+type TrafficConfig struct {
+	// One of att, ulData, dlRxStat, vm.ulData
+	Type string `mapstructure:"type"`
+	// Endnode EUI64, not used for vm.ulData
+	Endnode string `mapstructure:"endnode"`
+	// Interval between two messages
+	Interval time.Duration `mapstructure:"interval"`
+	// Delay before the first message
+	Delay time.Duration `mapstructure:"delay"`
+	// Number of messages, 0 for unlimited
+	Count int `mapstructure:"count"`
+	// Hex encoded user data of ulData and vm.ulData
+	Payload string `mapstructure:"payload"`
+	// Reception quality
+	Snr  float64 `mapstructure:"snr"`
+	Rssi float64 `mapstructure:"rssi"`
+	// Variable MAC type of vm.ulData
+	MacType uint8 `mapstructure:"mac_type"`
+
+	endnode common.EUI64
+	payload []byte
+}
+
+// Load a scenario file, the format is derived from the file extension (toml, yaml or json)
+func LoadScenario(path string) (Scenario, error) {
+	var s Scenario
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return s, errors.Wrap(err, "read scenario error")
+	}
+	if err := v.Unmarshal(&s); err != nil {
+		return s, errors.Wrap(err, "unmarshal scenario error")
+	}
+	return s, s.init()
+}
+
+// Validate the scenario and apply defaults
+func (s *Scenario) init() error {
+	if len(s.Basestations) == 0 {
+		return errors.New("scenario contains no basestations")
+	}
+
+	for i := range s.Basestations {
+		bs := &s.Basestations[i]
+
+		eui, err := parseEui(bs.Eui)
+		if err != nil {
+			return fmt.Errorf("basestation %d: invalid eui %q", i, bs.Eui)
+		}
+		bs.eui = eui
+		if bs.Version == "" {
+			bs.Version = structs.MaxVersion.String()
+		}
+
+		for j := range bs.Traffic {
+			t := &bs.Traffic[j]
+
+			switch t.Type {
+			case TrafficAtt, TrafficUlData, TrafficDlRxStat:
+				if t.endnode, err = parseEui(t.Endnode); err != nil {
+					return fmt.Errorf("basestation %s traffic %d: invalid endnode eui %q", bs.Eui, j, t.Endnode)
+				}
+			case TrafficVmUlData:
+			default:
+				return fmt.Errorf("basestation %s traffic %d: unknown type %q", bs.Eui, j, t.Type)
+			}
+
+			if t.Interval <= 0 {
+				return fmt.Errorf("basestation %s traffic %d: interval must be positive", bs.Eui, j)
+			}
+			if t.payload, err = hex.DecodeString(t.Payload); err != nil {
+				return fmt.Errorf("basestation %s traffic %d: invalid payload", bs.Eui, j)
+			}
+		}
+	}
+	return nil
+}
+
+// Eui64FromHexString accepts short input, a scenario must contain complete EUIs
+func parseEui(in string) (common.EUI64, error) {
+	eui, err := common.Eui64FromHexString(in)
+	if err == nil && len(strings.TrimPrefix(in, "0x")) != 2*len(eui) {
+		err = errors.New("eui must be 8 bytes")
+	}
+	return eui, err
+}
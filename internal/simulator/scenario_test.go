@@ -0,0 +1,124 @@
+package simulator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/backend/bssci_v1/structs"
+	"github.com/SplitStackServer/mioty-bssci-adapter/internal/common"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadScenario(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "scenario.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+[[basestations]]
+eui="0102030405060708"
+vendor="simulator"
+bidi=true
+
+  [[basestations.traffic]]
+  type="ulData"
+  endnode="1112131415161718"
+  interval="10s"
+  count=3
+  payload="cafe"
+  rssi=-90
+
+  [[basestations.traffic]]
+  type="vm.ulData"
+  interval="1m"
+  mac_type=2
+`), 0o600))
+
+	s, err := LoadScenario(path)
+	require.NoError(t, err)
+
+	if assert.Len(s.Basestations, 1) {
+		bs := s.Basestations[0]
+		assert.Equal(common.EUI64{1, 2, 3, 4, 5, 6, 7, 8}, bs.eui)
+		assert.Equal(structs.MaxVersion.String(), bs.Version)
+		assert.True(bs.Bidi)
+
+		if assert.Len(bs.Traffic, 2) {
+			assert.Equal(TrafficUlData, bs.Traffic[0].Type)
+			assert.Equal(common.EUI64{0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18}, bs.Traffic[0].endnode)
+			assert.Equal(10*time.Second, bs.Traffic[0].Interval)
+			assert.Equal(3, bs.Traffic[0].Count)
+			assert.Equal([]byte{0xca, 0xfe}, bs.Traffic[0].payload)
+			assert.Equal(float64(-90), bs.Traffic[0].Rssi)
+			assert.Equal(uint8(2), bs.Traffic[1].MacType)
+		}
+	}
+
+	_, err = LoadScenario(filepath.Join(t.TempDir(), "missing.toml"))
+	assert.Error(err)
+}
+
+func TestScenario_init(t *testing.T) {
+	valid := func() Scenario {
+		return Scenario{Basestations: []BasestationConfig{{
+			Eui:     "0102030405060708",
+			Traffic: []TrafficConfig{{Type: TrafficAtt, Endnode: "1112131415161718", Interval: time.Second}},
+		}}}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(s *Scenario)
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			modify: func(s *Scenario) {},
+		},
+		{
+			name:    "no basestations",
+			modify:  func(s *Scenario) { s.Basestations = nil },
+			wantErr: true,
+		},
+		{
+			name:    "invalid eui",
+			modify:  func(s *Scenario) { s.Basestations[0].Eui = "01" },
+			wantErr: true,
+		},
+		{
+			name:    "invalid endnode",
+			modify:  func(s *Scenario) { s.Basestations[0].Traffic[0].Endnode = "" },
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			modify:  func(s *Scenario) { s.Basestations[0].Traffic[0].Type = "det" },
+			wantErr: true,
+		},
+		{
+			name:    "missing interval",
+			modify:  func(s *Scenario) { s.Basestations[0].Traffic[0].Interval = 0 },
+			wantErr: true,
+		},
+		{
+			name:    "invalid payload",
+			modify:  func(s *Scenario) { s.Basestations[0].Traffic[0].Payload = "xyz" },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid()
+			tt.modify(&s)
+			err := s.init()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}